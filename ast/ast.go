@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"unicode"
 )
 
 // Pos represents a position in a source file.
@@ -74,13 +75,19 @@ func (g *Grammar) InitialNames() map[string]struct{} {
 }
 
 // Rule represents a rule in the PEG grammar. It has a name, an optional
-// display name to be used in error messages, and an expression.
+// display name to be used in error messages, an optional Go type of its
+// value, and an expression.
 type Rule struct {
 	p           Pos
 	Name        *Identifier
 	DisplayName *StringLit
+	Type        *GoType
 	Expr        Expression
 
+	// Annotations are the annotations written before the rule, in
+	// order, e.g. `@inline` or `@doc("...")`.
+	Annotations []*Annotation
+
 	IsLabelExists bool
 
 	// Fields below to work with left recursion.
@@ -107,6 +114,23 @@ func (r *Rule) String() string {
 		r.p, r, r.Name, r.DisplayName, r.Expr)
 }
 
+// Annotation returns the first annotation of the rule with the specified
+// name, or nil if the rule has no such annotation.
+func (r *Rule) Annotation(name string) *Annotation {
+	for _, a := range r.Annotations {
+		if a.Name.Val == name {
+			return a
+		}
+	}
+	return nil
+}
+
+// HasAnnotation returns true if the rule has an annotation with the
+// specified name.
+func (r *Rule) HasAnnotation(name string) bool {
+	return r.Annotation(name) != nil
+}
+
 // NullableVisit recursively determines whether an object is nullable.
 func (r *Rule) NullableVisit(rules map[string]*Rule) bool {
 	if r.Visited {
@@ -328,6 +352,17 @@ func (s *SeqExpr) String() string {
 	return buf.String()
 }
 
+// Plucked returns the indices of the plucked expressions of the sequence.
+func (s *SeqExpr) Plucked() []int {
+	var ixs []int
+	for i, e := range s.Exprs {
+		if lab, ok := e.(*LabeledExpr); ok && lab.Pluck {
+			ixs = append(ixs, i)
+		}
+	}
+	return ixs
+}
+
 // NullableVisit recursively determines whether an object is nullable.
 func (s *SeqExpr) NullableVisit(rules map[string]*Rule) bool {
 	for _, item := range s.Exprs {
@@ -362,11 +397,16 @@ func (s *SeqExpr) InitialNames() map[string]struct{} {
 // LabeledExpr is an expression that has an associated label. Code blocks
 // can access the value of the expression using that label, that becomes
 // a local variable in the code.
+//
+// If Pluck is true, the value of the expression is plucked as the value of
+// the sequence it belongs to ("@" operator). A plucked expression may have
+// no label, in which case Label is nil.
 type LabeledExpr struct {
 	p           Pos
 	Label       *Identifier
 	Expr        Expression
 	TextCapture bool
+	Pluck       bool
 }
 
 var _ Expression = (*LabeledExpr)(nil)
@@ -384,6 +424,18 @@ func (l *LabeledExpr) String() string {
 	return fmt.Sprintf("%s: %T{Label: %v, Expr: %v}", l.p, l, l.Label, l.Expr)
 }
 
+// IsPlucked returns true if expr is a plucked expression or a sequence
+// containing plucked expressions.
+func IsPlucked(expr Expression) bool {
+	switch expr := expr.(type) {
+	case *LabeledExpr:
+		return expr.Pluck
+	case *SeqExpr:
+		return len(expr.Plucked()) > 0
+	}
+	return false
+}
+
 // NullableVisit recursively determines whether an object is nullable.
 func (l *LabeledExpr) NullableVisit(rules map[string]*Rule) bool {
 	return l.Expr.NullableVisit(rules)
@@ -575,12 +627,12 @@ func (o *OneOrMoreExpr) String() string {
 
 // NullableVisit recursively determines whether an object is nullable.
 func (o *OneOrMoreExpr) NullableVisit(rules map[string]*Rule) bool {
-	return false
+	return o.Expr.NullableVisit(rules)
 }
 
 // IsNullable returns the nullable attribute of the node.
 func (o *OneOrMoreExpr) IsNullable() bool {
-	return false
+	return o.Expr.IsNullable()
 }
 
 // InitialNames returns names of nodes with which an expression can begin.
@@ -684,13 +736,20 @@ func (l *LitMatcher) InitialNames() map[string]struct{} {
 // CharClassMatcher is a character class matcher. The value to match must
 // be one of the specified characters, in a range of characters, or in the
 // Unicode classes of characters.
+//
+// NotUnicodeClasses are the negated Unicode classes (\P{..}). The set
+// operations "--" and "&&" restrict the characters of the class to those
+// not in Subtract and in all of Intersect.
 type CharClassMatcher struct {
 	posValue
-	IgnoreCase     bool
-	Inverted       bool
-	Chars          []rune
-	Ranges         []rune // pairs of low/high range
-	UnicodeClasses []string
+	IgnoreCase        bool
+	Inverted          bool
+	Chars             []rune
+	Ranges            []rune // pairs of low/high range
+	UnicodeClasses    []string
+	NotUnicodeClasses []string
+	Subtract          []*CharClassMatcher
+	Intersect         []*CharClassMatcher
 }
 
 var _ Expression = (*CharClassMatcher)(nil)
@@ -704,6 +763,12 @@ func NewCharClassMatcher(p Pos, raw string) *CharClassMatcher {
 	return c
 }
 
+// HasSetOperations returns true if the character class uses negated Unicode
+// classes or set operations.
+func (c *CharClassMatcher) HasSetOperations() bool {
+	return len(c.NotUnicodeClasses) > 0 || len(c.Subtract) > 0 || len(c.Intersect) > 0
+}
+
 func (c *CharClassMatcher) parse() {
 	raw := c.Val
 	c.IgnoreCase = strings.HasSuffix(raw, "i")
@@ -711,79 +776,77 @@ func (c *CharClassMatcher) parse() {
 		raw = raw[:len(raw)-1]
 	}
 
-	// "unquote" the character classes
-	raw = raw[1 : len(raw)-1]
-	if len(raw) == 0 {
-		return
-	}
+	// content of char class is necessarily valid, so escapes and set
+	// operations are correct
+	c.parseClass([]rune(raw), 1)
+}
 
-	c.Inverted = raw[0] == '^'
-	if c.Inverted {
-		raw = raw[1:]
-		if len(raw) == 0 {
-			return
-		}
+// parseClass parses the content of the character class starting at rs[i],
+// after its opening bracket. It returns the index following the closing
+// bracket.
+func (c *CharClassMatcher) parseClass(rs []rune, i int) int {
+	if i < len(rs) && rs[i] == '^' {
+		c.Inverted = true
+		i++
 	}
 
-	// content of char class is necessarily valid, so escapes are correct
-	r := strings.NewReader(raw)
 	var chars []rune
 	var buf bytes.Buffer
-outer:
-	for {
-		rn, _, err := r.ReadRune()
-		if err != nil {
-			break outer
+	for i < len(rs) && rs[i] != ']' {
+		if op := setOperation(rs, i); op != "" {
+			i += len(op)
+			operand := &CharClassMatcher{posValue: posValue{p: c.p}, IgnoreCase: c.IgnoreCase}
+			start := i
+			if rs[i] == '[' {
+				i = operand.parseClass(rs, i+1)
+				operand.Val = string(rs[start:i])
+			} else {
+				// a single Unicode class escape
+				i = operand.parseUnicodeClass(rs, i+1)
+				operand.Val = "[" + string(rs[start:i]) + "]"
+			}
+			if op == "--" {
+				c.Subtract = append(c.Subtract, operand)
+			} else {
+				c.Intersect = append(c.Intersect, operand)
+			}
+			continue
+		}
+
+		rn := rs[i]
+		i++
+		if rn != '\\' {
+			chars = append(chars, rn)
+			continue
 		}
 
+		rn = rs[i]
 		consumeN := 0
 		switch rn {
-		case '\\':
-			rn, _, _ := r.ReadRune()
-			switch rn {
-			case ']':
-				chars = append(chars, rn)
-				continue
-
-			case 'p':
-				rn, _, _ := r.ReadRune()
-				if rn == '{' {
-					buf.Reset()
-					for {
-						rn, _, _ := r.ReadRune()
-						if rn == '}' {
-							break
-						}
-						buf.WriteRune(rn)
-					}
-					c.UnicodeClasses = append(c.UnicodeClasses, buf.String())
-				} else {
-					c.UnicodeClasses = append(c.UnicodeClasses, string(rn))
-				}
-				continue
-
-			case 'x':
-				consumeN = 2
-			case 'u':
-				consumeN = 4
-			case 'U':
-				consumeN = 8
-			case '0', '1', '2', '3', '4', '5', '6', '7':
-				consumeN = 2
-			}
-
-			buf.Reset()
-			buf.WriteRune(rn)
-			for i := 0; i < consumeN; i++ {
-				rn, _, _ := r.ReadRune()
-				buf.WriteRune(rn)
-			}
-			rn, _, _, _ = strconv.UnquoteChar("\\"+buf.String(), 0)
+		case ']':
 			chars = append(chars, rn)
+			i++
+			continue
 
-		default:
-			chars = append(chars, rn)
+		case 'p', 'P':
+			i = c.parseUnicodeClass(rs, i)
+			continue
+
+		case 'x':
+			consumeN = 2
+		case 'u':
+			consumeN = 4
+		case 'U':
+			consumeN = 8
+		case '0', '1', '2', '3', '4', '5', '6', '7':
+			consumeN = 2
 		}
+
+		buf.Reset()
+		buf.WriteString(string(rs[i : i+1+consumeN]))
+		i += 1 + consumeN
+		rn, _, _, _ = strconv.UnquoteChar("\\"+buf.String(), 0)
+		chars = append(chars, rn)
 	}
 
 	// extract ranges and chars
@@ -807,6 +870,74 @@ outer:
 		wasRange = false
 		c.Chars = append(c.Chars, r)
 	}
+	return i + 1
+}
+
+// parseUnicodeClass parses the Unicode class escape starting at rs[i], on
+// the "p" or "P" following the backslash. It returns the index following
+// the escape.
+func (c *CharClassMatcher) parseUnicodeClass(rs []rune, i int) int {
+	negated := rs[i] == 'P'
+	i++
+
+	name := string(rs[i])
+	i++
+	if name == "{" {
+		end := i
+		for rs[end] != '}' {
+			end++
+		}
+		name = string(rs[i:end])
+		i = end + 1
+		if prop, value, ok := strings.Cut(name, "="); ok {
+			name, _ = UnicodePropertyValue(prop, value)
+		}
+	}
+
+	if negated {
+		c.NotUnicodeClasses = append(c.NotUnicodeClasses, name)
+	} else {
+		c.UnicodeClasses = append(c.UnicodeClasses, name)
+	}
+	return i
+}
+
+// setOperation returns the set operation ("--" or "&&") starting at rs[i],
+// or an empty string. An operation must be followed by a character class or
+// a Unicode class escape, so that e.g. [+--] is still the range from "+" to
+// "-".
+func setOperation(rs []rune, i int) string {
+	if i+2 >= len(rs) || rs[i] != rs[i+1] || (rs[i] != '-' && rs[i] != '&') {
+		return ""
+	}
+	next := rs[i+2]
+	if next == '[' || (next == '\\' && i+3 < len(rs) && (rs[i+3] == 'p' || rs[i+3] == 'P')) {
+		return string(rs[i : i+2])
+	}
+	return ""
+}
+
+// unicodeProperties maps the property names accepted in the \p{Name=Value}
+// escapes to the tables of their values.
+var unicodeProperties = map[string]map[string]*unicode.RangeTable{
+	"Script":           unicode.Scripts,
+	"sc":               unicode.Scripts,
+	"General_Category": unicode.Categories,
+	"gc":               unicode.Categories,
+}
+
+// UnicodePropertyValue validates the value of the Unicode property escape
+// \p{prop=value} and returns the name of the Unicode class it designates,
+// e.g. "Greek" for \p{Script=Greek}.
+func UnicodePropertyValue(prop, value string) (string, error) {
+	tables, ok := unicodeProperties[prop]
+	if !ok {
+		return "", fmt.Errorf("unknown Unicode property %q", prop)
+	}
+	if _, ok := tables[value]; !ok {
+		return "", fmt.Errorf("unknown Unicode %s value %q", prop, value)
+	}
+	return value, nil
 }
 
 // Pos returns the starting position of the node.
@@ -825,7 +956,8 @@ func (c *CharClassMatcher) NullableVisit(rules map[string]*Rule) bool {
 
 // IsNullable returns the nullable attribute of the node.
 func (c *CharClassMatcher) IsNullable() bool {
-	return len(c.Chars) == 0 && len(c.Ranges) == 0 && len(c.UnicodeClasses) == 0
+	return len(c.Chars) == 0 && len(c.Ranges) == 0 && len(c.UnicodeClasses) == 0 &&
+		len(c.NotUnicodeClasses) == 0
 }
 
 // InitialNames returns names of nodes with which an expression can begin.
@@ -977,6 +1109,99 @@ func (s *StringLit) InitialNames() map[string]struct{} {
 	panic("InitialNames should not be called on the StringLit")
 }
 
+// GoType represents the Go type of the value of a rule, e.g. "float64"
+// in `Number <float64> = ...`.
+type GoType struct {
+	posValue
+}
+
+var _ Expression = (*GoType)(nil)
+
+// NewGoType creates a new Go type at the specified position and
+// with the specified type expression.
+func NewGoType(p Pos, typ string) *GoType {
+	return &GoType{posValue{p: p, Val: typ}}
+}
+
+// Pos returns the starting position of the node.
+func (g *GoType) Pos() Pos { return g.p }
+
+// String returns the textual representation of a node.
+func (g *GoType) String() string {
+	return fmt.Sprintf("%s: %T{Val: %q}", g.p, g, g.Val)
+}
+
+// NullableVisit recursively determines whether an object is nullable.
+func (g *GoType) NullableVisit(rules map[string]*Rule) bool {
+	panic("NullableVisit should not be called on the GoType")
+}
+
+// IsNullable returns the nullable attribute of the node.
+func (g *GoType) IsNullable() bool {
+	panic("IsNullable should not be called on the GoType")
+}
+
+// InitialNames returns names of nodes with which an expression can begin.
+func (g *GoType) InitialNames() map[string]struct{} {
+	panic("InitialNames should not be called on the GoType")
+}
+
+// Annotation represents an annotation of a rule, e.g. `@inline` or
+// `@doc("text")`. Args holds the unquoted values of the arguments.
+type Annotation struct {
+	p    Pos
+	Name *Identifier
+	Args []string
+}
+
+// NewAnnotation creates a new annotation at the specified position and
+// with the specified name.
+func NewAnnotation(p Pos, name *Identifier) *Annotation {
+	return &Annotation{p: p, Name: name}
+}
+
+// Pos returns the starting position of the node.
+func (a *Annotation) Pos() Pos { return a.p }
+
+// String returns the textual representation of a node.
+func (a *Annotation) String() string {
+	return fmt.Sprintf("%s: %T{Name: %v, Args: %q}", a.p, a, a.Name, a.Args)
+}
+
+// KnownAnnotations is the set of rule annotations understood by pigeon:
+//   - inline: the rule may be inlined by Optimize even if it references
+//     other rules, as long as it is not recursive.
+//   - memo: the results are memoized while parsing the rule, as if the
+//     Memoize option was set.
+//   - export: the rule is never removed by Optimize.
+//   - token: the rule is lexical, the skip rule is never applied in it.
+//   - doc: the argument is written as a comment in the generated parser.
+var KnownAnnotations = map[string]int{
+	"inline": 0,
+	"memo":   0,
+	"export": 0,
+	"token":  0,
+	"doc":    1,
+}
+
+// AnnotationWarnings returns a warning for each unknown annotation of g and
+// for each known annotation used with the wrong number of arguments.
+func AnnotationWarnings(g *Grammar) []error {
+	var warnings []error
+	for _, r := range g.Rules {
+		for _, a := range r.Annotations {
+			n, ok := KnownAnnotations[a.Name.Val]
+			switch {
+			case !ok:
+				warnings = append(warnings, fmt.Errorf("%s: rule %s: unknown annotation @%s", a.p, r.Name.Val, a.Name.Val))
+			case len(a.Args) != n:
+				warnings = append(warnings, fmt.Errorf("%s: rule %s: annotation @%s expects %d argument(s), got %d", a.p, r.Name.Val, a.Name.Val, n, len(a.Args)))
+			}
+		}
+	}
+	return warnings
+}
+
 type posValue struct {
 	p   Pos
 	Val string
@@ -0,0 +1,315 @@
+package ast
+
+import "fmt"
+
+// An ApplyFunc is invoked by Apply for each Expression, with the Cursor
+// positioned on it. Its result controls the traversal, see Apply.
+type ApplyFunc func(*Cursor) bool
+
+// Apply traverses an AST recursively, starting with root, and calls pre and
+// post for each Expression: pre is called before its children are traversed
+// (pre-order), post after (post-order). If pre returns false, the children
+// and post are skipped. If post returns false, the traversal is terminated
+// and Apply returns immediately. pre and post may be nil.
+//
+// The Cursor passed to pre and post may be used to modify the AST: the
+// current Expression can be replaced, deleted, or other expressions can be
+// inserted before or after it. If pre replaces the current Expression, the
+// children of the new one are traversed. If pre deletes it, its children
+// and post are skipped. The inserted expressions are not traversed.
+//
+// Apply visits the same expressions as Walk, in the same order, and returns
+// the possibly replaced root.
+func Apply(root Expression, pre, post ApplyFunc) (result Expression) {
+	parent := &applyRoot{root}
+	defer func() {
+		if r := recover(); r != nil && r != abortApply {
+			panic(r)
+		}
+		result = parent.Expression
+	}()
+
+	a := &application{pre: pre, post: post}
+	a.apply(parent, "", nil, root)
+	return
+}
+
+// abortApply is the panic value used to terminate Apply when post returns
+// false.
+var abortApply = new(int)
+
+// applyRoot is the parent of the root expression passed to Apply, so that
+// the root can be replaced like any other expression.
+type applyRoot struct {
+	Expression
+}
+
+// A Cursor describes an Expression encountered during Apply, along with its
+// parent and the field of the parent holding it.
+type Cursor struct {
+	parent Expression
+	name   string
+	iter   *iterator // nil if the field is not a list
+	node   Expression
+}
+
+// iterator holds the position of the current Expression in a list. step is
+// adjusted by the modifications of the list, so that the next element is
+// the right one.
+type iterator struct {
+	index, step int
+}
+
+// Node returns the current Expression. It is nil once deleted.
+func (c *Cursor) Node() Expression { return c.node }
+
+// Parent returns the parent of the current Expression, or nil for the root
+// expression passed to Apply.
+func (c *Cursor) Parent() Expression {
+	if _, ok := c.parent.(*applyRoot); ok {
+		return nil
+	}
+	return c.parent
+}
+
+// Name returns the name of the field of the parent holding the current
+// Expression, e.g. "Expr", "RecoverExpr", "Alternatives", "Exprs" or "Rules".
+// It is empty for the root expression.
+func (c *Cursor) Name() string { return c.name }
+
+// Index returns the index of the current Expression in the list field of its
+// parent, or a value < 0 if the field is not a list.
+func (c *Cursor) Index() int {
+	if c.iter != nil {
+		return c.iter.index
+	}
+	return -1
+}
+
+// Replace replaces the current Expression with expr. The rules of a Grammar
+// can only be replaced with a *Rule.
+func (c *Cursor) Replace(expr Expression) {
+	if c.iter != nil {
+		i := c.iter.index
+		switch p := c.parent.(type) {
+		case *ChoiceExpr:
+			p.Alternatives[i] = expr
+		case *Grammar:
+			p.Rules[i] = asRule(expr)
+		case *SeqExpr:
+			p.Exprs[i] = expr
+		}
+		c.node = expr
+		return
+	}
+
+	switch p := c.parent.(type) {
+	case *applyRoot:
+		p.Expression = expr
+	case *ActionExpr:
+		p.Expr = expr
+	case *AndExpr:
+		p.Expr = expr
+	case *LabeledExpr:
+		p.Expr = expr
+	case *NotExpr:
+		p.Expr = expr
+	case *OneOrMoreExpr:
+		p.Expr = expr
+	case *RecoveryExpr:
+		if c.name == "RecoverExpr" {
+			p.RecoverExpr = expr
+		} else {
+			p.Expr = expr
+		}
+	case *Rule:
+		p.Expr = expr
+	case *ZeroOrMoreExpr:
+		p.Expr = expr
+	case *ZeroOrOneExpr:
+		p.Expr = expr
+	default:
+		panic(fmt.Sprintf("unknown parent type %T", p))
+	}
+	c.node = expr
+}
+
+// Delete deletes the current Expression from the list field of its parent.
+// It panics if the field is not a list. Deleting all the alternatives of a
+// choice or all the expressions of a sequence leaves an invalid AST.
+func (c *Cursor) Delete() {
+	if c.iter == nil {
+		panic("Delete expression not contained in a list")
+	}
+
+	i := c.iter.index
+	switch p := c.parent.(type) {
+	case *ChoiceExpr:
+		p.Alternatives = deleteAt(p.Alternatives, i)
+	case *Grammar:
+		p.Rules = deleteAt(p.Rules, i)
+	case *SeqExpr:
+		p.Exprs = deleteAt(p.Exprs, i)
+	}
+	c.iter.step--
+	c.node = nil
+}
+
+// InsertAfter inserts expr after the current Expression in the list field of
+// its parent. It panics if the field is not a list. expr is not traversed by
+// Apply.
+func (c *Cursor) InsertAfter(expr Expression) {
+	if c.iter == nil {
+		panic("InsertAfter expression not contained in a list")
+	}
+	c.insert(c.iter.index+1, expr)
+	c.iter.step++
+}
+
+// InsertBefore inserts expr before the current Expression in the list field
+// of its parent. It panics if the field is not a list. expr is not traversed
+// by Apply.
+func (c *Cursor) InsertBefore(expr Expression) {
+	if c.iter == nil {
+		panic("InsertBefore expression not contained in a list")
+	}
+	c.insert(c.iter.index, expr)
+	c.iter.index++
+}
+
+func (c *Cursor) insert(i int, expr Expression) {
+	switch p := c.parent.(type) {
+	case *ChoiceExpr:
+		p.Alternatives = insertAt(p.Alternatives, i, expr)
+	case *Grammar:
+		p.Rules = insertAt(p.Rules, i, asRule(expr))
+	case *SeqExpr:
+		p.Exprs = insertAt(p.Exprs, i, expr)
+	}
+}
+
+func asRule(expr Expression) *Rule {
+	rule, ok := expr.(*Rule)
+	if !ok {
+		panic(fmt.Sprintf("%T is not a rule of the grammar", expr))
+	}
+	return rule
+}
+
+func deleteAt[T any](s []T, i int) []T {
+	copy(s[i:], s[i+1:])
+	var zero T
+	s[len(s)-1] = zero
+	return s[:len(s)-1]
+}
+
+func insertAt[T any](s []T, i int, v T) []T {
+	var zero T
+	s = append(s, zero)
+	copy(s[i+1:], s[i:])
+	s[i] = v
+	return s
+}
+
+type application struct {
+	pre, post ApplyFunc
+	cursor    Cursor
+	iter      iterator
+}
+
+func (a *application) apply(parent Expression, name string, iter *iterator, expr Expression) {
+	if expr == nil {
+		return
+	}
+
+	saved := a.cursor
+	defer func() { a.cursor = saved }()
+	a.cursor = Cursor{parent: parent, name: name, iter: iter, node: expr}
+	if a.pre != nil && !a.pre(&a.cursor) {
+		return
+	}
+
+	switch expr := a.cursor.node.(type) {
+	case nil:
+		// Deleted by pre
+		return
+	case *ActionExpr:
+		a.apply(expr, "Expr", nil, expr.Expr)
+	case *AndCodeExpr:
+		// Nothing to do
+	case *AndExpr:
+		a.apply(expr, "Expr", nil, expr.Expr)
+	case *AnyMatcher:
+		// Nothing to do
+	case *CharClassMatcher:
+		// Nothing to do
+	case *ChoiceExpr:
+		a.applyList(expr, "Alternatives")
+	case *CodeExpr:
+		// Nothing to do
+	case *Grammar:
+		a.applyList(expr, "Rules")
+	case *LabeledExpr:
+		a.apply(expr, "Expr", nil, expr.Expr)
+	case *LitMatcher:
+		// Nothing to do
+	case *NotCodeExpr:
+		// Nothing to do
+	case *NotExpr:
+		a.apply(expr, "Expr", nil, expr.Expr)
+	case *OneOrMoreExpr:
+		a.apply(expr, "Expr", nil, expr.Expr)
+	case *RecoveryExpr:
+		a.apply(expr, "Expr", nil, expr.Expr)
+		a.apply(expr, "RecoverExpr", nil, expr.RecoverExpr)
+	case *Rule:
+		a.apply(expr, "Expr", nil, expr.Expr)
+	case *RuleRefExpr:
+		// Nothing to do
+	case *SeqExpr:
+		a.applyList(expr, "Exprs")
+	case *ThrowExpr:
+		// Nothing to do
+	case *ZeroOrMoreExpr:
+		a.apply(expr, "Expr", nil, expr.Expr)
+	case *ZeroOrOneExpr:
+		a.apply(expr, "Expr", nil, expr.Expr)
+	default:
+		panic(fmt.Sprintf("unknown expression type %T", expr))
+	}
+
+	if a.post != nil && !a.post(&a.cursor) {
+		panic(abortApply)
+	}
+}
+
+func (a *application) applyList(parent Expression, name string) {
+	saved := a.iter
+	defer func() { a.iter = saved }()
+
+	a.iter.index = 0
+	for {
+		var expr Expression
+		switch p := parent.(type) {
+		case *ChoiceExpr:
+			if a.iter.index >= len(p.Alternatives) {
+				return
+			}
+			expr = p.Alternatives[a.iter.index]
+		case *Grammar:
+			if a.iter.index >= len(p.Rules) {
+				return
+			}
+			expr = p.Rules[a.iter.index]
+		case *SeqExpr:
+			if a.iter.index >= len(p.Exprs) {
+				return
+			}
+			expr = p.Exprs[a.iter.index]
+		}
+
+		a.iter.step = 1
+		a.apply(parent, name, &a.iter, expr)
+		a.iter.index += a.iter.step
+	}
+}
@@ -0,0 +1,153 @@
+package ast
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestApplyOrder(t *testing.T) {
+	var walked []Expression
+	Inspect(cases[0].in, func(expr Expression) bool {
+		if expr != nil {
+			walked = append(walked, expr)
+		}
+		return true
+	})
+
+	var pre, post []Expression
+	Apply(cases[0].in, func(c *Cursor) bool {
+		pre = append(pre, c.Node())
+		return true
+	}, func(c *Cursor) bool {
+		post = append(post, c.Node())
+		return true
+	})
+
+	if !reflect.DeepEqual(pre, walked) {
+		t.Errorf("want the expressions of Walk in pre-order, got %v", pre)
+	}
+	if len(post) != len(pre) || post[len(post)-1] != cases[0].in {
+		t.Errorf("want the root last in post-order, got %v", post)
+	}
+}
+
+func TestApplyCursor(t *testing.T) {
+	throw := &ThrowExpr{Label: "err"}
+	// A ← ( 'a' B C 'c' //{err} ( %{err} D ) ) / B
+	g := &Grammar{Rules: []*Rule{
+		{Name: &Identifier{posValue: posValue{Val: "A"}}, Expr: &ChoiceExpr{Alternatives: []Expression{
+			&RecoveryExpr{
+				Expr:        &SeqExpr{Exprs: []Expression{lit("a"), ref("B"), ref("C"), lit("c")}},
+				RecoverExpr: &SeqExpr{Exprs: []Expression{throw, ref("D")}},
+				Labels:      []FailureLabel{"err"},
+			},
+			ref("B"),
+		}}},
+	}}
+
+	var names []string
+	got := Apply(g, func(c *Cursor) bool {
+		switch expr := c.Node().(type) {
+		case *RuleRefExpr:
+			switch expr.Name.Val {
+			case "B":
+				// Expands B into 'b' 'b' in sequences and 'b' elsewhere.
+				if _, ok := c.Parent().(*SeqExpr); ok {
+					c.InsertBefore(lit("b"))
+					c.Replace(lit("b"))
+				} else {
+					c.Replace(lit("b"))
+				}
+			case "C":
+				c.Delete()
+			}
+		case *ThrowExpr:
+			names = append(names, c.Name())
+			c.InsertAfter(lit("inserted"))
+		case *LitMatcher:
+			names = append(names, expr.Val)
+		}
+		return true
+	}, nil)
+
+	if got != g {
+		t.Fatalf("want the grammar back, got %v", got)
+	}
+	want := &Grammar{Rules: []*Rule{
+		{Name: &Identifier{posValue: posValue{Val: "A"}}, Expr: &ChoiceExpr{Alternatives: []Expression{
+			&RecoveryExpr{
+				Expr:        &SeqExpr{Exprs: []Expression{lit("a"), lit("b"), lit("b"), lit("c")}},
+				RecoverExpr: &SeqExpr{Exprs: []Expression{throw, lit("inserted"), ref("D")}},
+				Labels:      []FailureLabel{"err"},
+			},
+			lit("b"),
+		}}},
+	}}
+	if !reflect.DeepEqual(g, want) {
+		t.Errorf("want %v, got %v", want, g)
+	}
+	// pre is not called again for the replacements and inserted expressions.
+	wantNames := []string{"a", "c", "Exprs"}
+	if !reflect.DeepEqual(names, wantNames) {
+		t.Errorf("want visited %q, got %q", wantNames, names)
+	}
+}
+
+func TestApplyRoot(t *testing.T) {
+	root := &ZeroOrOneExpr{Expr: &AnyMatcher{}}
+	var parents []Expression
+	var indexes []int
+	got := Apply(root, func(c *Cursor) bool {
+		parents = append(parents, c.Parent())
+		indexes = append(indexes, c.Index())
+		if _, ok := c.Node().(*ZeroOrOneExpr); ok {
+			c.Replace(&ZeroOrMoreExpr{Expr: root.Expr})
+		}
+		return true
+	}, nil)
+
+	want := &ZeroOrMoreExpr{Expr: &AnyMatcher{}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+	// The children of the replacement are traversed.
+	if len(parents) != 2 || parents[0] != nil || parents[1] != got {
+		t.Errorf("want parents [nil, %p], got %v", got, parents)
+	}
+	if !reflect.DeepEqual(indexes, []int{-1, -1}) {
+		t.Errorf("want indexes [-1, -1], got %v", indexes)
+	}
+}
+
+func TestApplyAbort(t *testing.T) {
+	seq := &SeqExpr{Exprs: []Expression{&AnyMatcher{}, &AnyMatcher{}, &AnyMatcher{}}}
+	var pre, post int
+	got := Apply(seq, func(c *Cursor) bool {
+		pre++
+		return true
+	}, func(c *Cursor) bool {
+		post++
+		return c.Index() != 1
+	})
+
+	if got != seq {
+		t.Errorf("want the root back, got %v", got)
+	}
+	if pre != 3 || post != 2 {
+		t.Errorf("want 3 pre and 2 post calls, got %d and %d", pre, post)
+	}
+}
+
+func TestApplyDeletePanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("want a panic when deleting an expression out of a list")
+		}
+	}()
+	Apply(&ActionExpr{Expr: &AnyMatcher{}}, func(c *Cursor) bool {
+		if _, ok := c.Node().(*AnyMatcher); ok {
+			c.Delete()
+		}
+		return true
+	}, nil)
+}
@@ -0,0 +1,240 @@
+package ast
+
+import (
+	"fmt"
+	"strings"
+)
+
+// UndefinedRuleError reports a reference to a rule that is not defined in
+// the grammar.
+type UndefinedRuleError struct {
+	// Pos is the position of the reference, it is the zero value for an
+	// alternate entrypoint.
+	Pos Pos
+	// Rule is the name of the rule containing the reference, it is empty
+	// for an alternate entrypoint.
+	Rule string
+	// Name is the name of the undefined rule.
+	Name string
+	// Suggestion is the name of the defined rule closest to Name, if any.
+	Suggestion string
+}
+
+// Error returns the error message.
+func (e *UndefinedRuleError) Error() string {
+	var buf strings.Builder
+	if e.Rule != "" {
+		fmt.Fprintf(&buf, "%s: rule %s: undefined rule %s", e.Pos, e.Rule, e.Name)
+	} else {
+		fmt.Fprintf(&buf, "undefined rule %s used as alternate entrypoint", e.Name)
+	}
+	if e.Suggestion != "" {
+		fmt.Fprintf(&buf, ", did you mean %s?", e.Suggestion)
+	}
+	return buf.String()
+}
+
+// RepetitionError reports an expression repeated with the "*" or "+"
+// operators that matches the empty input.
+type RepetitionError struct {
+	// Pos is the position of the repetition.
+	Pos Pos
+	// Rule is the name of the rule containing the repetition.
+	Rule string
+}
+
+// Error returns the error message.
+func (e *RepetitionError) Error() string {
+	return fmt.Sprintf("%s: rule %s: repeated expression matches the empty input", e.Pos, e.Rule)
+}
+
+// ErrorList is a list of errors reported at once.
+type ErrorList []error
+
+// Error returns the error messages, one per line.
+func (e ErrorList) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// CheckRuleRefs checks that all the rule references of g and the alternate
+// entrypoints are defined rules. All the undefined rules are reported at
+// once, as an ErrorList of *UndefinedRuleError in the order of the grammar.
+func CheckRuleRefs(g *Grammar, alternateEntrypoints ...string) error {
+	rules := make(map[string]struct{}, len(g.Rules))
+	for _, rule := range g.Rules {
+		rules[rule.Name.Val] = struct{}{}
+	}
+
+	var errs ErrorList
+	for _, rule := range g.Rules {
+		Inspect(rule.Expr, func(expr Expression) bool {
+			if ref, ok := expr.(*RuleRefExpr); ok {
+				if _, ok := rules[ref.Name.Val]; !ok {
+					errs = append(errs, &UndefinedRuleError{
+						Pos:        ref.Pos(),
+						Rule:       rule.Name.Val,
+						Name:       ref.Name.Val,
+						Suggestion: closestRule(g, ref.Name.Val),
+					})
+				}
+			}
+			return true
+		})
+	}
+	for _, name := range alternateEntrypoints {
+		if name == "" {
+			continue
+		}
+		if _, ok := rules[name]; !ok {
+			errs = append(errs, &UndefinedRuleError{
+				Name:       name,
+				Suggestion: closestRule(g, name),
+			})
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// CheckRepetitions checks that no expression repeated with the "*" or "+"
+// operators matches the empty input: the repetition would match it forever.
+// All such repetitions are reported at once, as an ErrorList of
+// *RepetitionError in the order of the grammar.
+func CheckRepetitions(g *Grammar) error {
+	nullables := nullableRules(g)
+
+	var errs ErrorList
+	for _, rule := range g.Rules {
+		Inspect(rule.Expr, func(expr Expression) bool {
+			var inner Expression
+			switch expr := expr.(type) {
+			case *ZeroOrMoreExpr:
+				inner = expr.Expr
+			case *OneOrMoreExpr:
+				inner = expr.Expr
+			default:
+				return true
+			}
+			if isNullable(inner, nullables) {
+				errs = append(errs, &RepetitionError{Pos: expr.Pos(), Rule: rule.Name.Val})
+			}
+			return true
+		})
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// nullableRules returns the names of the rules of g that match the empty
+// input. The nullability of each rule is computed once, as a fixed point
+// over the rules, instead of visiting the referenced rules again for each
+// expression.
+func nullableRules(g *Grammar) map[string]bool {
+	nullables := make(map[string]bool, len(g.Rules))
+	for changed := true; changed; {
+		changed = false
+		for _, rule := range g.Rules {
+			if !nullables[rule.Name.Val] && isNullable(rule.Expr, nullables) {
+				nullables[rule.Name.Val] = true
+				changed = true
+			}
+		}
+	}
+	return nullables
+}
+
+// isNullable returns true if expr matches the empty input, given the
+// nullable rules.
+func isNullable(expr Expression, nullables map[string]bool) bool {
+	switch expr := expr.(type) {
+	case *ChoiceExpr:
+		for _, alt := range expr.Alternatives {
+			if isNullable(alt, nullables) {
+				return true
+			}
+		}
+		return false
+	case *SeqExpr:
+		for _, item := range expr.Exprs {
+			if !isNullable(item, nullables) {
+				return false
+			}
+		}
+		return true
+	case *RecoveryExpr:
+		return isNullable(expr.Expr, nullables) || isNullable(expr.RecoverExpr, nullables)
+	case *ActionExpr:
+		return isNullable(expr.Expr, nullables)
+	case *LabeledExpr:
+		return isNullable(expr.Expr, nullables)
+	case *OneOrMoreExpr:
+		return isNullable(expr.Expr, nullables)
+	case *RuleRefExpr:
+		return nullables[expr.Name.Val]
+	default:
+		// the other expressions do not depend on the rules
+		return expr.NullableVisit(nil)
+	}
+}
+
+// closestRule returns the name of the rule of g closest to name, or an
+// empty string if no rule is close enough to be a likely typo.
+func closestRule(g *Grammar, name string) string {
+	best, bestDist := "", len([]rune(name))/3
+	for _, rule := range g.Rules {
+		// names that differ only by case are at distance 0
+		nm := rule.Name.Val
+		d := editDistance(strings.ToLower(name), strings.ToLower(nm))
+		if d < bestDist || (best == "" && d == bestDist) {
+			best, bestDist = nm, d
+		}
+	}
+	return best
+}
+
+// editDistance returns the edit distance between a and b, counting the
+// insertion, deletion or substitution of a rune and the transposition of
+// two adjacent runes as one edit.
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	rows := make([][]int, len(ra)+1)
+	for i := range rows {
+		rows[i] = make([]int, len(rb)+1)
+		rows[i][0] = i
+	}
+	for j := range rows[0] {
+		rows[0][j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			d := rows[i-1][j-1] + cost
+			if v := rows[i-1][j] + 1; v < d {
+				d = v
+			}
+			if v := rows[i][j-1] + 1; v < d {
+				d = v
+			}
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				if v := rows[i-2][j-2] + 1; v < d {
+					d = v
+				}
+			}
+			rows[i][j] = d
+		}
+	}
+	return rows[len(ra)][len(rb)]
+}
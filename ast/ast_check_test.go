@@ -0,0 +1,82 @@
+package ast
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheckRuleRefs(t *testing.T) {
+	refAt := func(line int, name string) *RuleRefExpr {
+		r := ref(name)
+		r.p = Pos{Line: line, Col: 5}
+		return r
+	}
+
+	g := grammar(
+		rule("Expression", seq(refAt(1, "Term"), refAt(1, "Expression"))),
+		rule("Term", seq(refAt(2, "Term"))),
+	)
+	if err := CheckRuleRefs(g, "Term", ""); err != nil {
+		t.Fatalf("want no error for defined rules, got %v", err)
+	}
+
+	g.Rules = []*Rule{
+		rule("Expression", seq(refAt(1, "Term"), refAt(1, "Expresion"))),
+		rule("Term", seq(refAt(2, "term"), refAt(2, "Factor"), refAt(2, "x"))),
+	}
+	err := CheckRuleRefs(g, "Expr", "Trem", "Zzz")
+	want := `1:5 (0): rule Expression: undefined rule Expresion, did you mean Expression?
+2:5 (0): rule Term: undefined rule term, did you mean Term?
+2:5 (0): rule Term: undefined rule Factor
+2:5 (0): rule Term: undefined rule x
+undefined rule Expr used as alternate entrypoint
+undefined rule Trem used as alternate entrypoint, did you mean Term?
+undefined rule Zzz used as alternate entrypoint`
+	if err == nil || err.Error() != want {
+		t.Fatalf("want error:\n%s\ngot:\n%v", want, err)
+	}
+
+	var list ErrorList
+	if !errors.As(err, &list) || len(list) != 7 {
+		t.Fatalf("want an ErrorList of 7 errors, got %#v", err)
+	}
+	var undef *UndefinedRuleError
+	if !errors.As(list[0], &undef) || undef.Rule != "Expression" || undef.Suggestion != "Expression" {
+		t.Errorf("want an UndefinedRuleError in Expression, got %#v", list[0])
+	}
+}
+
+func TestCheckRepetitions(t *testing.T) {
+	zeroOrOne := func(e Expression) *ZeroOrOneExpr {
+		z := NewZeroOrOneExpr(Pos{})
+		z.Expr = e
+		return z
+	}
+	zeroOrMore := func(line int, e Expression) *ZeroOrMoreExpr {
+		z := NewZeroOrMoreExpr(Pos{Line: line, Col: 1})
+		z.Expr = e
+		return z
+	}
+	oneOrMore := func(line int, e Expression) *OneOrMoreExpr {
+		o := NewOneOrMoreExpr(Pos{Line: line, Col: 1})
+		o.Expr = e
+		return o
+	}
+
+	g := grammar(
+		rule("A", zeroOrMore(1, lit("a"))),
+		rule("B", oneOrMore(2, ref("A"))),
+		rule("C", zeroOrMore(3, zeroOrOne(lit("c")))),
+		rule("D", zeroOrMore(4, oneOrMore(5, zeroOrOne(ref("B"))))),
+		rule("E", oneOrMore(6, ref("F"))),
+		rule("F", oneOrMore(7, lit("f"))),
+	)
+	err := CheckRepetitions(g)
+	want := `2:1 (0): rule B: repeated expression matches the empty input
+3:1 (0): rule C: repeated expression matches the empty input
+4:1 (0): rule D: repeated expression matches the empty input
+5:1 (0): rule D: repeated expression matches the empty input`
+	if err == nil || err.Error() != want {
+		t.Fatalf("want error:\n%s\ngot:\n%v", want, err)
+	}
+}
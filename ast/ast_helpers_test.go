@@ -0,0 +1,49 @@
+package ast
+
+// The helpers below build the nodes of the grammars of the tests, at the
+// zero position.
+
+func ref(name string) *RuleRefExpr {
+	r := NewRuleRefExpr(Pos{})
+	r.Name = NewIdentifier(Pos{}, name)
+	return r
+}
+
+func lit(val string) *LitMatcher {
+	return NewLitMatcher(Pos{}, val)
+}
+
+func seq(exprs ...Expression) *SeqExpr {
+	s := NewSeqExpr(Pos{})
+	s.Exprs = exprs
+	return s
+}
+
+func action(expr Expression) *ActionExpr {
+	a := NewActionExpr(Pos{})
+	a.Expr = expr
+	a.Code = NewCodeBlock(Pos{}, "{ return nil, nil }")
+	return a
+}
+
+func label(name string, expr Expression) *LabeledExpr {
+	l := NewLabeledExpr(Pos{})
+	l.Label = NewIdentifier(Pos{}, name)
+	l.Expr = expr
+	return l
+}
+
+func rule(name string, expr Expression, annotations ...string) *Rule {
+	r := NewRule(Pos{}, NewIdentifier(Pos{}, name))
+	r.Expr = expr
+	for _, a := range annotations {
+		r.Annotations = append(r.Annotations, NewAnnotation(Pos{}, NewIdentifier(Pos{}, a)))
+	}
+	return r
+}
+
+func grammar(rules ...*Rule) *Grammar {
+	g := NewGrammar(Pos{})
+	g.Rules = rules
+	return g
+}
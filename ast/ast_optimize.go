@@ -14,6 +14,17 @@ type grammarOptimizer struct {
 	ruleUsedByRules map[string]map[string]struct{}
 	visitor         func(expr Expression) Visitor
 	optimized       bool
+
+	// syntactic reports the rules applying the skip rule implicitly, nil
+	// if the grammar has no skip rule.
+	syntactic func(rule *Rule) bool
+	// discarded holds the expressions whose value is never used, i.e. the
+	// expressions of an action, of a predicate or of a text capture, and
+	// their children. Only their value may be changed by an optimization.
+	discarded map[Expression]bool
+	// classes holds the character classes combined with other matchers,
+	// whose Val is regenerated by cleanupCharClassMatcher.
+	classes map[*CharClassMatcher]struct{}
 }
 
 func newGrammarOptimizer(protectedRules []string) *grammarOptimizer {
@@ -27,6 +38,7 @@ func newGrammarOptimizer(protectedRules []string) *grammarOptimizer {
 		rules:           make(map[string]*Rule),
 		ruleUsesRules:   make(map[string]map[string]struct{}),
 		ruleUsedByRules: make(map[string]map[string]struct{}),
+		classes:         make(map[*CharClassMatcher]struct{}),
 	}
 	r.visitor = r.init
 	return &r
@@ -68,14 +80,22 @@ func set(m map[string]map[string]struct{}, src, dst string) {
 // optimize is a Visitor, which is used with the Walk function
 // The purpose of this function is to perform the actual optimizations.
 // See Optimize for a detailed list of the performed optimizations.
+//
+// The children of an expression are optimized when the expression is
+// visited, before they are walked, and marked as discarded if the value of
+// the expression does not depend on theirs.
 func (r *grammarOptimizer) optimize(expr0 Expression) Visitor {
+	discarded := r.discarded[expr0]
+
 	switch expr := expr0.(type) {
 	case *ActionExpr:
-		expr.Expr = r.optimizeRule(expr.Expr)
+		expr.Expr = r.optimizeRule(expr.Expr, true)
+		r.discard(true, expr.Expr)
 	case *AndExpr:
-		expr.Expr = r.optimizeRule(expr.Expr)
+		expr.Expr = r.optimizeRule(expr.Expr, true)
+		r.discard(true, expr.Expr)
 	case *ChoiceExpr:
-		expr.Alternatives = r.optimizeRules(expr.Alternatives)
+		expr.Alternatives = r.optimizeRules(expr.Alternatives, discarded)
 
 		// Optimize choice nested in choice
 		for i := 0; i < len(expr.Alternatives); i++ {
@@ -94,6 +114,9 @@ func (r *grammarOptimizer) optimize(expr0 Expression) Visitor {
 				l1, lok1 := expr.Alternatives[i].(*LitMatcher)
 				c0, cok0 := expr.Alternatives[i-1].(*CharClassMatcher)
 				c1, cok1 := expr.Alternatives[i].(*CharClassMatcher)
+				// set operations only apply to their own class
+				cok0 = cok0 && len(c0.Subtract) == 0 && len(c0.Intersect) == 0
+				cok1 = cok1 && len(c1.Subtract) == 0 && len(c1.Intersect) == 0
 
 				combined := false
 
@@ -108,6 +131,7 @@ func (r *grammarOptimizer) optimize(expr0 Expression) Visitor {
 						posValue:   l0.posValue,
 					}
 					expr.Alternatives[i-1] = &cm
+					r.classes[&cm] = struct{}{}
 
 				// Combine LitMatcher with CharClassMatcher
 				// "a" / [bc] => [abc]
@@ -115,12 +139,14 @@ func (r *grammarOptimizer) optimize(expr0 Expression) Visitor {
 					combined = true
 					c1.Chars = append(c1.Chars, []rune(l0.Val)...)
 					expr.Alternatives[i-1] = c1
+					r.classes[c1] = struct{}{}
 
 				// Combine CharClassMatcher with LitMatcher
 				// [ab] / "c" => [abc]
 				case cok0 && lok1 && len([]rune(l1.Val)) == 1 && c0.IgnoreCase == l1.IgnoreCase && !c0.Inverted:
 					combined = true
 					c0.Chars = append(c0.Chars, []rune(l1.Val)...)
+					r.classes[c0] = struct{}{}
 
 				// Combine CharClassMatcher with CharClassMatcher
 				// [ab] / [cd] => [abcd]
@@ -129,6 +155,8 @@ func (r *grammarOptimizer) optimize(expr0 Expression) Visitor {
 					c0.Chars = append(c0.Chars, c1.Chars...)
 					c0.Ranges = append(c0.Ranges, c1.Ranges...)
 					c0.UnicodeClasses = append(c0.UnicodeClasses, c1.UnicodeClasses...)
+					c0.NotUnicodeClasses = append(c0.NotUnicodeClasses, c1.NotUnicodeClasses...)
+					r.classes[c0] = struct{}{}
 				}
 
 				// If one of the optimizations was applied, remove the second element from Alternatives
@@ -142,10 +170,12 @@ func (r *grammarOptimizer) optimize(expr0 Expression) Visitor {
 				}
 			}
 		}
+		r.discard(discarded, expr.Alternatives...)
 
 	case *Grammar:
 		// Reset optimized at the start of each Walk.
 		r.optimized = false
+		r.discarded = make(map[Expression]bool)
 		for i := 0; i < len(expr.Rules); i++ {
 			rule := expr.Rules[i]
 			// Remove Rule, if it is no longer used by any other Rule and it is not the first Rule.
@@ -172,17 +202,35 @@ func (r *grammarOptimizer) optimize(expr0 Expression) Visitor {
 			}
 		}
 	case *LabeledExpr:
-		expr.Expr = r.optimizeRule(expr.Expr)
+		// The label holds the value of the expression, unless it captures
+		// the text. A plucked text capture returns the text.
+		discarded = discarded && (expr.TextCapture || expr.Label == nil) || expr.TextCapture && expr.Pluck
+		expr.Expr = r.optimizeRule(expr.Expr, discarded)
+		r.discard(discarded, expr.Expr)
 	case *NotExpr:
-		expr.Expr = r.optimizeRule(expr.Expr)
+		expr.Expr = r.optimizeRule(expr.Expr, true)
+		r.discard(true, expr.Expr)
 	case *OneOrMoreExpr:
-		expr.Expr = r.optimizeRule(expr.Expr)
+		expr.Expr = r.optimizeRule(expr.Expr, discarded)
+		r.discard(discarded, expr.Expr)
+	case *RecoveryExpr:
+		expr.Expr = r.optimizeRule(expr.Expr, discarded)
+		expr.RecoverExpr = r.optimizeRule(expr.RecoverExpr, discarded)
+		r.discard(discarded, expr.Expr, expr.RecoverExpr)
 	case *Rule:
 		r.rule = expr.Name.Val
-		expr.Expr = r.optimizeRule(expr.Expr)
+		expr.Expr = r.optimizeRule(expr.Expr, false)
 	case *SeqExpr:
-		expr.Exprs = r.optimizeRules(expr.Exprs)
+		expr.Exprs = r.optimizeRules(expr.Exprs, discarded)
 
+		// The value of a sequence is the list of the values of its
+		// expressions, which is changed by the optimizations below.
+		if !discarded {
+			break
+		}
+		// Combining the literals would not apply the skip rule between
+		// them.
+		combine := r.syntactic == nil || !r.syntactic(r.rules[r.rule])
 		for i := 0; i < len(expr.Exprs); i++ {
 			// Optimize nested sequences
 			if seq, ok := expr.Exprs[i].(*SeqExpr); ok {
@@ -195,7 +243,7 @@ func (r *grammarOptimizer) optimize(expr0 Expression) Visitor {
 			}
 
 			// Combine sequence of LitMatcher
-			if i > 0 {
+			if i > 0 && combine {
 				l0, ok0 := expr.Exprs[i-1].(*LitMatcher)
 				l1, ok1 := expr.Exprs[i].(*LitMatcher)
 				if ok0 && ok1 && l0.IgnoreCase == l1.IgnoreCase {
@@ -210,37 +258,50 @@ func (r *grammarOptimizer) optimize(expr0 Expression) Visitor {
 				}
 			}
 		}
+		r.discard(true, expr.Exprs...)
 
 	case *ZeroOrMoreExpr:
-		expr.Expr = r.optimizeRule(expr.Expr)
+		expr.Expr = r.optimizeRule(expr.Expr, discarded)
+		r.discard(discarded, expr.Expr)
 	case *ZeroOrOneExpr:
-		expr.Expr = r.optimizeRule(expr.Expr)
+		expr.Expr = r.optimizeRule(expr.Expr, discarded)
+		r.discard(discarded, expr.Expr)
 	}
 	return r
 }
 
-func (r *grammarOptimizer) optimizeRules(exprs []Expression) []Expression {
+// discard marks the value of exprs as discarded if discarded is set.
+func (r *grammarOptimizer) discard(discarded bool, exprs ...Expression) {
+	if !discarded {
+		return
+	}
+	for _, expr := range exprs {
+		r.discarded[expr] = true
+	}
+}
+
+func (r *grammarOptimizer) optimizeRules(exprs []Expression, discarded bool) []Expression {
 	for i := 0; i < len(exprs); i++ {
-		exprs[i] = r.optimizeRule(exprs[i])
+		exprs[i] = r.optimizeRule(exprs[i], discarded)
 	}
 	return exprs
 }
 
-func (r *grammarOptimizer) optimizeRule(expr Expression) Expression {
+// optimizeRule returns the optimized expr. The value of a sequence is only
+// changed if discarded is set.
+func (r *grammarOptimizer) optimizeRule(expr Expression, discarded bool) Expression {
 	// Optimize RuleRefExpr
 	if ruleRef, ok := expr.(*RuleRefExpr); ok {
-		if _, ok := r.ruleUsesRules[ruleRef.Name.Val]; !ok {
+		if r.inlinable(ruleRef.Name.Val) {
 			r.optimized = true
-			delete(r.ruleUsedByRules[ruleRef.Name.Val], r.rule)
-			if len(r.ruleUsedByRules[ruleRef.Name.Val]) == 0 {
-				delete(r.ruleUsedByRules, ruleRef.Name.Val)
-			}
-			delete(r.ruleUsesRules[r.rule], ruleRef.Name.Val)
-			if len(r.ruleUsesRules[r.rule]) == 0 {
-				delete(r.ruleUsesRules, r.rule)
+			// the rules used by an inlined @inline rule are now used by
+			// the current rule. The references are collected again before
+			// the next pass, when the inlined rule may no longer be used.
+			for used := range r.ruleUsesRules[ruleRef.Name.Val] {
+				set(r.ruleUsesRules, r.rule, used)
+				set(r.ruleUsedByRules, used, r.rule)
 			}
-			// TODO: Check if reference exists, otherwise raise an error, which reference is missing!
-			return cloneExpr(r.rules[ruleRef.Name.Val].Expr)
+			return r.cloneRule(ruleRef.Name.Val)
 		}
 	}
 
@@ -253,7 +314,7 @@ func (r *grammarOptimizer) optimizeRule(expr Expression) Expression {
 	}
 
 	// Remove Sequence with only one Expression
-	if seq, ok := expr.(*SeqExpr); ok {
+	if seq, ok := expr.(*SeqExpr); ok && discarded {
 		if len(seq.Exprs) == 1 {
 			r.optimized = true
 			return seq.Exprs[0]
@@ -263,6 +324,110 @@ func (r *grammarOptimizer) optimizeRule(expr Expression) Expression {
 	return expr
 }
 
+// inlinable returns true if the references to the rule name may be replaced
+// by a copy of its expression in the current rule: the rule references no
+// other rule, or it is annotated with @inline and does not reference itself,
+// directly or indirectly. The rules whose inlining would change the result
+// of the parser are never inlined: the rules with a display name, a type or
+// the @memo annotation, and the rules that do not apply the skip rule or do
+// not share their labels the same way once inlined.
+func (r *grammarOptimizer) inlinable(name string) bool {
+	rule, ok := r.rules[name]
+	if !ok || rule.DisplayName != nil || rule.Type != nil || rule.HasAnnotation("memo") {
+		return false
+	}
+	cur := r.rules[r.rule]
+	if r.syntactic != nil && (r.syntactic(rule) || r.syntactic(cur)) {
+		return false
+	}
+
+	// The labels of the rules are all set in the variables of the current
+	// rule once inlined, and passed to the code blocks in their scope.
+	labels, code := ruleLabels(rule)
+	curLabels, curCode := ruleLabels(cur)
+	if len(labels) > 0 && curCode || len(curLabels) > 0 && code {
+		return false
+	}
+	for label := range labels {
+		if _, ok := curLabels[label]; ok {
+			return false
+		}
+	}
+
+	if _, ok := r.ruleUsesRules[name]; !ok {
+		return true
+	}
+	if !rule.HasAnnotation("inline") {
+		return false
+	}
+
+	seen := map[string]struct{}{}
+	var recursive func(nm string) bool
+	recursive = func(nm string) bool {
+		for used := range r.ruleUsesRules[nm] {
+			if used == name {
+				return true
+			}
+			if _, ok := seen[used]; ok {
+				continue
+			}
+			seen[used] = struct{}{}
+			if recursive(used) {
+				return true
+			}
+		}
+		return false
+	}
+	return !recursive(name)
+}
+
+// cloneRule returns a copy of the expression of the rule name. The copies
+// of the combined character classes are marked as combined too.
+func (r *grammarOptimizer) cloneRule(name string) Expression {
+	expr := r.rules[name].Expr
+	clone := cloneExpr(expr)
+
+	var combined []bool
+	Inspect(expr, func(expr Expression) bool {
+		chr, ok := expr.(*CharClassMatcher)
+		if ok {
+			_, ok = r.classes[chr]
+		}
+		combined = append(combined, ok)
+		return true
+	})
+	i := 0
+	Inspect(clone, func(expr Expression) bool {
+		if combined[i] {
+			r.classes[expr.(*CharClassMatcher)] = struct{}{}
+		}
+		i++
+		return true
+	})
+	return clone
+}
+
+// ruleLabels returns the labels of rule, and whether it has code blocks.
+func ruleLabels(rule *Rule) (map[string]struct{}, bool) {
+	labels := make(map[string]struct{})
+	code := false
+	if rule == nil {
+		return labels, code
+	}
+	Inspect(rule.Expr, func(expr Expression) bool {
+		switch expr := expr.(type) {
+		case *LabeledExpr:
+			if expr.Label != nil {
+				labels[expr.Label.Val] = struct{}{}
+			}
+		case *ActionExpr, *AndCodeExpr, *NotCodeExpr, *CodeExpr:
+			code = true
+		}
+		return true
+	})
+	return labels, code
+}
+
 // cloneExpr takes an Expression and deep clones it (including all children)
 // This is necessary because referenced Rules are denormalized and therefore
 // have to become independent from their original Expression.
@@ -277,8 +442,9 @@ func cloneExpr(expr Expression) Expression {
 		}
 	case *AndExpr:
 		return &AndExpr{
-			Expr: cloneExpr(expr.Expr),
-			p:    expr.p,
+			Expr:    cloneExpr(expr.Expr),
+			Logical: expr.Logical,
+			p:       expr.p,
 		}
 	case *AndCodeExpr:
 		return &AndCodeExpr{
@@ -286,15 +452,27 @@ func cloneExpr(expr Expression) Expression {
 			FuncIx: expr.FuncIx,
 			p:      expr.p,
 		}
+	case *AnyMatcher:
+		return &AnyMatcher{
+			posValue: expr.posValue,
+		}
 	case *CharClassMatcher:
-		return &CharClassMatcher{
-			Chars:          append([]rune{}, expr.Chars...),
-			IgnoreCase:     expr.IgnoreCase,
-			Inverted:       expr.Inverted,
-			posValue:       expr.posValue,
-			Ranges:         append([]rune{}, expr.Ranges...),
-			UnicodeClasses: append([]string{}, expr.UnicodeClasses...),
+		chr := &CharClassMatcher{
+			Chars:             append([]rune{}, expr.Chars...),
+			IgnoreCase:        expr.IgnoreCase,
+			Inverted:          expr.Inverted,
+			posValue:          expr.posValue,
+			Ranges:            append([]rune{}, expr.Ranges...),
+			UnicodeClasses:    append([]string{}, expr.UnicodeClasses...),
+			NotUnicodeClasses: append([]string{}, expr.NotUnicodeClasses...),
+		}
+		for _, op := range expr.Subtract {
+			chr.Subtract = append(chr.Subtract, cloneExpr(op).(*CharClassMatcher))
 		}
+		for _, op := range expr.Intersect {
+			chr.Intersect = append(chr.Intersect, cloneExpr(op).(*CharClassMatcher))
+		}
+		return chr
 	case *ChoiceExpr:
 		alts := make([]Expression, 0, len(expr.Alternatives))
 		for i := 0; i < len(expr.Alternatives); i++ {
@@ -304,16 +482,31 @@ func cloneExpr(expr Expression) Expression {
 			Alternatives: alts,
 			p:            expr.p,
 		}
+	case *CodeExpr:
+		return &CodeExpr{
+			Code:    expr.Code,
+			FuncIx:  expr.FuncIx,
+			NotSkip: expr.NotSkip,
+			p:       expr.p,
+		}
 	case *LabeledExpr:
 		return &LabeledExpr{
-			Expr:  cloneExpr(expr.Expr),
-			Label: expr.Label,
-			p:     expr.p,
+			Expr:        cloneExpr(expr.Expr),
+			Label:       expr.Label,
+			TextCapture: expr.TextCapture,
+			Pluck:       expr.Pluck,
+			p:           expr.p,
+		}
+	case *LitMatcher:
+		return &LitMatcher{
+			IgnoreCase: expr.IgnoreCase,
+			posValue:   expr.posValue,
 		}
 	case *NotExpr:
 		return &NotExpr{
-			Expr: cloneExpr(expr.Expr),
-			p:    expr.p,
+			Expr:    cloneExpr(expr.Expr),
+			Logical: expr.Logical,
+			p:       expr.p,
 		}
 	case *NotCodeExpr:
 		return &NotCodeExpr{
@@ -326,6 +519,18 @@ func cloneExpr(expr Expression) Expression {
 			Expr: cloneExpr(expr.Expr),
 			p:    expr.p,
 		}
+	case *RecoveryExpr:
+		return &RecoveryExpr{
+			Expr:        cloneExpr(expr.Expr),
+			RecoverExpr: cloneExpr(expr.RecoverExpr),
+			Labels:      append([]FailureLabel{}, expr.Labels...),
+			p:           expr.p,
+		}
+	case *RuleRefExpr:
+		return &RuleRefExpr{
+			Name: expr.Name,
+			p:    expr.p,
+		}
 	case *SeqExpr:
 		exprs := make([]Expression, 0, len(expr.Exprs))
 		for i := 0; i < len(expr.Exprs); i++ {
@@ -335,6 +540,11 @@ func cloneExpr(expr Expression) Expression {
 			Exprs: exprs,
 			p:     expr.p,
 		}
+	case *ThrowExpr:
+		return &ThrowExpr{
+			Label: expr.Label,
+			p:     expr.p,
+		}
 	case *ZeroOrMoreExpr:
 		return &ZeroOrMoreExpr{
 			Expr: cloneExpr(expr.Expr),
@@ -355,8 +565,9 @@ func cloneExpr(expr Expression) Expression {
 // and UnicodeClasses of the given CharClassMatcher as well as regenerating the
 // correct content for the Val field (string representation of the CharClassMatcher).
 func (r *grammarOptimizer) cleanupCharClassMatcher(expr0 Expression) Visitor {
-	// We are only interested in nodes of type *CharClassMatcher
-	if chr, ok := expr0.(*CharClassMatcher); ok {
+	// We are only interested in the combined nodes of type *CharClassMatcher
+	chr, ok := expr0.(*CharClassMatcher)
+	if _, combined := r.classes[chr]; ok && combined {
 		// Remove redundancies in Chars
 		chars := make([]rune, 0, len(chr.Chars))
 		charsMap := make(map[rune]struct{})
@@ -403,6 +614,15 @@ func (r *grammarOptimizer) cleanupCharClassMatcher(expr0 Expression) Visitor {
 			chr.UnicodeClasses = nil
 		}
 
+		if len(chr.NotUnicodeClasses) == 0 {
+			chr.NotUnicodeClasses = nil
+		}
+
+		// The set operations are kept as written in Val
+		if len(chr.Subtract) > 0 || len(chr.Intersect) > 0 {
+			return r
+		}
+
 		// Regenerate the content for Val
 		var val bytes.Buffer
 		val.WriteString("[")
@@ -418,7 +638,10 @@ func (r *grammarOptimizer) cleanupCharClassMatcher(expr0 Expression) Visitor {
 			val.WriteString(escapeRune(chr.Ranges[i+1]))
 		}
 		for _, u := range chr.UnicodeClasses {
-			val.WriteString("\\p" + u)
+			val.WriteString("\\p" + unicodeClassName(u))
+		}
+		for _, u := range chr.NotUnicodeClasses {
+			val.WriteString("\\P" + unicodeClassName(u))
 		}
 		val.WriteString("]")
 		if chr.IgnoreCase {
@@ -429,6 +652,13 @@ func (r *grammarOptimizer) cleanupCharClassMatcher(expr0 Expression) Visitor {
 	return r
 }
 
+func unicodeClassName(u string) string {
+	if len(u) == 1 {
+		return u
+	}
+	return "{" + u + "}"
+}
+
 func escapeRune(r rune) string {
 	return strings.Trim(strconv.QuoteRune(r), `'`)
 }
@@ -437,24 +667,52 @@ func escapeRune(r rune) string {
 // of parsing performance. This is done with several optimizations:
 //   - removal of unreferenced rules
 //   - replace rule references with a copy of the referenced Rule, if the
-//     referenced rule it self has no references.
+//     referenced rule it self has no references or is annotated with
+//     @inline and is not recursive.
+//   - keep the rules annotated with @export, even if they are unused.
 //   - resolve nested choice expressions
 //   - resolve choice expressions with only one alternative
 //   - resolve nested sequences expression
 //   - resolve sequence expressions with only one element
 //   - combine character class matcher and literal matcher, where possible
+//
+// The optimized grammar gives the same results as the original one, only
+// the error messages may differ. The sequences are only changed where their
+// value is not used, and the rules are only inlined where it does not change
+// their value or the values of the labels.
 func Optimize(g *Grammar, alternateEntrypoints ...string) {
-	entrypoints := alternateEntrypoints
+	OptimizeSkip(g, nil, alternateEntrypoints...)
+}
+
+// OptimizeSkip is like Optimize, for a grammar whose syntactic rules apply a
+// skip rule implicitly before each token. syntactic reports whether a rule is
+// syntactic. The syntactic rules are never inlined, do not inline other
+// rules and do not combine the literals of their sequences, which would
+// change where the skip rule is applied. The skip rule is only kept if it is
+// one of the alternate entrypoints.
+func OptimizeSkip(g *Grammar, syntactic func(rule *Rule) bool, alternateEntrypoints ...string) {
+	entrypoints := append([]string{}, alternateEntrypoints...)
 	if len(g.Rules) > 0 {
 		entrypoints = append(entrypoints, g.Rules[0].Name.Val)
 	}
+	for _, rule := range g.Rules {
+		if rule.HasAnnotation("export") {
+			entrypoints = append(entrypoints, rule.Name.Val)
+		}
+	}
 
 	r := newGrammarOptimizer(entrypoints)
-	Walk(r, g)
-
-	r.visitor = r.optimize
+	r.syntactic = syntactic
 	r.optimized = true
 	for r.optimized {
+		// collect the references before each pass, the references to
+		// the inlined rules are only removed by the previous pass.
+		r.ruleUsesRules = make(map[string]map[string]struct{})
+		r.ruleUsedByRules = make(map[string]map[string]struct{})
+		r.visitor = r.init
+		Walk(r, g)
+
+		r.visitor = r.optimize
 		Walk(r, g)
 	}
 
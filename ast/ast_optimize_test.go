@@ -21,99 +21,101 @@ var cases = []struct {
 							Val: "Input",
 						},
 					},
-					Expr: &SeqExpr{
-						Exprs: []Expression{
-							&LitMatcher{
-								posValue: posValue{
-									Val: "a",
-								},
-							},
-							&RuleRefExpr{
-								Name: &Identifier{
+					Expr: &ActionExpr{
+						Expr: &SeqExpr{
+							Exprs: []Expression{
+								&LitMatcher{
 									posValue: posValue{
-										Val: "innerseq",
+										Val: "a",
 									},
 								},
-							},
-							&AndExpr{
-								Expr: &RuleRefExpr{
+								&RuleRefExpr{
 									Name: &Identifier{
 										posValue: posValue{
 											Val: "innerseq",
 										},
 									},
 								},
-							},
-							&ChoiceExpr{
-								Alternatives: []Expression{
-									&LitMatcher{
-										posValue: posValue{
-											Val: "c1",
+								&AndExpr{
+									Expr: &RuleRefExpr{
+										Name: &Identifier{
+											posValue: posValue{
+												Val: "innerseq",
+											},
 										},
 									},
-									&ChoiceExpr{
-										Alternatives: []Expression{
-											&LitMatcher{
-												posValue: posValue{
-													Val: "c2",
-												},
+								},
+								&ChoiceExpr{
+									Alternatives: []Expression{
+										&LitMatcher{
+											posValue: posValue{
+												Val: "c1",
 											},
-											&LitMatcher{
-												posValue: posValue{
-													Val: "c3",
+										},
+										&ChoiceExpr{
+											Alternatives: []Expression{
+												&LitMatcher{
+													posValue: posValue{
+														Val: "c2",
+													},
+												},
+												&LitMatcher{
+													posValue: posValue{
+														Val: "c3",
+													},
 												},
 											},
 										},
-									},
-									&LitMatcher{
-										posValue: posValue{
-											Val: "c4",
+										&LitMatcher{
+											posValue: posValue{
+												Val: "c4",
+											},
 										},
 									},
 								},
-							},
-							&SeqExpr{
-								Exprs: []Expression{
-									&LitMatcher{
-										posValue: posValue{
-											Val: "s1",
+								&SeqExpr{
+									Exprs: []Expression{
+										&LitMatcher{
+											posValue: posValue{
+												Val: "s1",
+											},
 										},
-									},
-									&LitMatcher{
-										posValue: posValue{
-											Val: "s2",
+										&LitMatcher{
+											posValue: posValue{
+												Val: "s2",
+											},
 										},
 									},
 								},
-							},
-							&LitMatcher{
-								posValue: posValue{
-									Val: "c",
-								},
-							},
-							&ChoiceExpr{
-								Alternatives: []Expression{
-									&LitMatcher{
-										posValue: posValue{
-											Val: "\n",
-										},
+								&LitMatcher{
+									posValue: posValue{
+										Val: "c",
 									},
-									&LitMatcher{
-										posValue: posValue{
-											Val: "\r",
+								},
+								&ChoiceExpr{
+									Alternatives: []Expression{
+										&LitMatcher{
+											posValue: posValue{
+												Val: "\n",
+											},
 										},
-									},
-									&CharClassMatcher{
-										posValue: posValue{
-											Val: "[\t]",
+										&LitMatcher{
+											posValue: posValue{
+												Val: "\r",
+											},
 										},
-										Chars: []rune{
-											'\t',
+										&CharClassMatcher{
+											posValue: posValue{
+												Val: "[\t]",
+											},
+											Chars: []rune{
+												'\t',
+											},
 										},
-									},
-									&LitMatcher{
-										posValue: posValue{
-											Val: "a",
+										&LitMatcher{
+											posValue: posValue{
+												Val: "a",
+											},
 										},
 									},
 								},
@@ -155,55 +157,57 @@ var cases = []struct {
 							Val: "Input",
 						},
 					},
-					Expr: &SeqExpr{
-						Exprs: []Expression{
-							&LitMatcher{
-								posValue: posValue{
-									Val: "ab",
-								},
-							},
-							&AndExpr{
-								Expr: &LitMatcher{
+					Expr: &ActionExpr{
+						Expr: &SeqExpr{
+							Exprs: []Expression{
+								&LitMatcher{
 									posValue: posValue{
-										Val: "b",
+										Val: "ab",
 									},
 								},
-							},
-							&ChoiceExpr{
-								Alternatives: []Expression{
-									&LitMatcher{
+								&AndExpr{
+									Expr: &LitMatcher{
 										posValue: posValue{
-											Val: "c1",
+											Val: "b",
 										},
 									},
-									&LitMatcher{
-										posValue: posValue{
-											Val: "c2",
+								},
+								&ChoiceExpr{
+									Alternatives: []Expression{
+										&LitMatcher{
+											posValue: posValue{
+												Val: "c1",
+											},
 										},
-									},
-									&LitMatcher{
-										posValue: posValue{
-											Val: "c3",
+										&LitMatcher{
+											posValue: posValue{
+												Val: "c2",
+											},
 										},
-									},
-									&LitMatcher{
-										posValue: posValue{
-											Val: "c4",
+										&LitMatcher{
+											posValue: posValue{
+												Val: "c3",
+											},
+										},
+										&LitMatcher{
+											posValue: posValue{
+												Val: "c4",
+											},
 										},
 									},
 								},
-							},
-							&LitMatcher{
-								posValue: posValue{
-									Val: "s1s2c",
-								},
-							},
-							&CharClassMatcher{
-								posValue: posValue{
-									Val: "[\\n\\r\\ta]",
+								&LitMatcher{
+									posValue: posValue{
+										Val: "s1s2c",
+									},
 								},
-								Chars: []rune{
-									'\n', '\r', '\t', 'a',
+								&CharClassMatcher{
+									posValue: posValue{
+										Val: "[\\n\\r\\ta]",
+									},
+									Chars: []rune{
+										'\n', '\r', '\t', 'a',
+									},
 								},
 							},
 						},
@@ -222,35 +226,37 @@ var cases = []struct {
 							Val: "x",
 						},
 					},
-					Expr: &ChoiceExpr{
-						Alternatives: []Expression{
-							&SeqExpr{
-								Exprs: []Expression{
-									&RuleRefExpr{
-										Name: &Identifier{
-											posValue: posValue{
-												Val: "y",
+					Expr: &ActionExpr{
+						Expr: &ChoiceExpr{
+							Alternatives: []Expression{
+								&SeqExpr{
+									Exprs: []Expression{
+										&RuleRefExpr{
+											Name: &Identifier{
+												posValue: posValue{
+													Val: "y",
+												},
 											},
 										},
-									},
-									&LitMatcher{
-										posValue: posValue{
-											Val: ";",
+										&LitMatcher{
+											posValue: posValue{
+												Val: ";",
+											},
 										},
 									},
 								},
-							},
-							&SeqExpr{
-								Exprs: []Expression{
-									&LitMatcher{
-										posValue: posValue{
-											Val: "z",
-										},
-									},
-									&RuleRefExpr{
-										Name: &Identifier{
+								&SeqExpr{
+									Exprs: []Expression{
+										&LitMatcher{
 											posValue: posValue{
-												Val: "b",
+												Val: "z",
+											},
+										},
+										&RuleRefExpr{
+											Name: &Identifier{
+												posValue: posValue{
+													Val: "b",
+												},
 											},
 										},
 									},
@@ -304,28 +310,30 @@ var cases = []struct {
 							Val: "x",
 						},
 					},
-					Expr: &ChoiceExpr{
-						Alternatives: []Expression{
-							&SeqExpr{
-								Exprs: []Expression{
-									&CharClassMatcher{
-										posValue: posValue{
-											Val: "[ab]",
-										},
-										Chars: []rune{
-											'a', 'b',
+					Expr: &ActionExpr{
+						Expr: &ChoiceExpr{
+							Alternatives: []Expression{
+								&SeqExpr{
+									Exprs: []Expression{
+										&CharClassMatcher{
+											posValue: posValue{
+												Val: "[ab]",
+											},
+											Chars: []rune{
+												'a', 'b',
+											},
 										},
-									},
-									&LitMatcher{
-										posValue: posValue{
-											Val: ";",
+										&LitMatcher{
+											posValue: posValue{
+												Val: ";",
+											},
 										},
 									},
 								},
-							},
-							&LitMatcher{
-								posValue: posValue{
-									Val: "zb",
+								&LitMatcher{
+									posValue: posValue{
+										Val: "zb",
+									},
 								},
 							},
 						},
@@ -360,3 +368,112 @@ func TestOptimize(t *testing.T) {
 		}
 	}
 }
+
+func TestOptimizeAnnotations(t *testing.T) {
+	// A uses the @inline rule B, which is not recursive and is inlined,
+	// and the @inline rule C, which is recursive and is kept. D is unused
+	// but exported. The value of the sequence of A is discarded by its
+	// action, so B is flattened in it.
+	g := grammar(
+		rule("A", action(seq(ref("B"), ref("C")))),
+		rule("B", seq(lit("b"), ref("E")), "inline"),
+		rule("C", seq(lit("c"), ref("C")), "inline"),
+		rule("D", lit("d"), "export"),
+		rule("E", seq(lit("e"), ref("E"))),
+	)
+	Optimize(g)
+
+	var names []string
+	for _, r := range g.Rules {
+		names = append(names, r.Name.Val)
+	}
+	if want := []string{"A", "C", "D", "E"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("want rules %v, got %v", want, names)
+	}
+	a := g.Rules[0].Expr.(*ActionExpr).Expr.(*SeqExpr)
+	if len(a.Exprs) != 3 {
+		t.Fatalf("want 3 expressions in A, got %d", len(a.Exprs))
+	}
+	if lit, ok := a.Exprs[0].(*LitMatcher); !ok || lit.Val != "b" {
+		t.Errorf("want B inlined in A, got %v", a.Exprs[0])
+	}
+	if r, ok := a.Exprs[2].(*RuleRefExpr); !ok || r.Name.Val != "C" {
+		t.Errorf("want recursive rule C kept in A, got %v", a.Exprs[2])
+	}
+}
+
+func TestOptimizeValues(t *testing.T) {
+	// the value of the sequence is used, the inlined literal is not
+	// combined
+	g := grammar(rule("A", seq(lit("a"), ref("B"))), rule("B", lit("b")))
+	Optimize(g)
+	if s, ok := g.Rules[0].Expr.(*SeqExpr); !ok || len(s.Exprs) != 2 || len(g.Rules) != 1 {
+		t.Errorf("want B inlined in the sequence of A, got %v", g.Rules[0].Expr)
+	}
+
+	// the text capture discards the value of the sequence
+	capture := label("t", seq(lit("a"), lit("b")))
+	capture.TextCapture = true
+	g = grammar(rule("A", action(capture)))
+	Optimize(g)
+	if l, ok := capture.Expr.(*LitMatcher); !ok || l.Val != "ab" {
+		t.Errorf("want combined literal in the text capture, got %v", capture.Expr)
+	}
+
+	// the labels of B would be passed to the action of A
+	g = grammar(rule("A", action(seq(ref("B")))), rule("B", label("x", lit("b"))))
+	Optimize(g)
+	if len(g.Rules) != 2 {
+		t.Errorf("want B with labels kept, got %d rules", len(g.Rules))
+	}
+
+	// the skip rule is applied between the literals of the syntactic
+	// rules and before the references
+	g = grammar(rule("A", action(seq(lit("a"), lit("b"), ref("b")))), rule("b", lit("b")))
+	OptimizeSkip(g, func(r *Rule) bool { return r.Name.Val == "A" })
+	if s, ok := g.Rules[0].Expr.(*ActionExpr).Expr.(*SeqExpr); !ok || len(s.Exprs) != 3 || len(g.Rules) != 2 {
+		t.Errorf("want syntactic rule A unchanged, got %v", g.Rules[0].Expr)
+	}
+}
+
+func TestCloneExpr(t *testing.T) {
+	code := NewCodeBlock(Pos{}, "{ return nil }")
+	rec := NewRecoveryExpr(Pos{})
+	rec.Labels = []FailureLabel{"err"}
+	rec.Expr = NewThrowExpr(Pos{})
+	rec.Expr.(*ThrowExpr).Label = "err"
+	rec.RecoverExpr = NewAnyMatcher(Pos{}, ".")
+	state := NewCodeExpr(Pos{})
+	state.Code = code
+	state.NotSkip = true
+	capture := NewLabeledExpr(Pos{})
+	capture.Label = NewIdentifier(Pos{}, "t")
+	capture.Expr = NewLitMatcher(Pos{}, "a")
+	capture.TextCapture = true
+	capture.Pluck = true
+	and := NewAndExpr(Pos{})
+	and.Expr = NewLitMatcher(Pos{}, "b")
+	and.Logical = true
+	not := NewNotExpr(Pos{})
+	not.Expr = NewRuleRefExpr(Pos{})
+	not.Expr.(*RuleRefExpr).Name = NewIdentifier(Pos{}, "B")
+	not.Logical = true
+	seq := NewSeqExpr(Pos{})
+	seq.Exprs = []Expression{rec, state, capture, and, not}
+
+	clone := cloneExpr(seq)
+	if !reflect.DeepEqual(seq, clone) {
+		t.Fatalf("want clone equal to %v, got %v", seq, clone)
+	}
+	nodes := make(map[Expression]bool)
+	Inspect(seq, func(expr Expression) bool {
+		nodes[expr] = true
+		return true
+	})
+	Inspect(clone, func(expr Expression) bool {
+		if expr != nil && nodes[expr] {
+			t.Errorf("want %v cloned, got the same node", expr)
+		}
+		return true
+	})
+}
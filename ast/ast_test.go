@@ -1,6 +1,7 @@
 package ast
 
 import (
+	"reflect"
 	"strings"
 	"testing"
 	"unicode/utf8"
@@ -105,3 +106,67 @@ func TestCharClassParse(t *testing.T) {
 		}
 	}
 }
+
+func TestCharClassSetOperations(t *testing.T) {
+	cases := []struct {
+		in        string
+		classes   []string
+		notClass  []string
+		subtract  []string
+		intersect []string
+	}{
+		{in: `[+--]`},
+		{in: `[\p{Script=Greek}\p{Han}]`, classes: []string{"Greek", "Han"}},
+		{in: `[\P{sc=Latin}\PL]`, notClass: []string{"Latin", "L"}},
+		{in: `[\p{L}--[a-z]]`, classes: []string{"L"}, subtract: []string{"[a-z]"}},
+		{in: `[\p{L}&&\p{Lu}]`, classes: []string{"L"}, intersect: []string{`[\p{Lu}]`}},
+		{in: `[a-z--[aeiou]&&[^x]]i`, subtract: []string{"[aeiou]"}, intersect: []string{"[^x]"}},
+	}
+
+	for _, tc := range cases {
+		m := NewCharClassMatcher(Pos{}, tc.in)
+		if !reflect.DeepEqual(m.UnicodeClasses, tc.classes) {
+			t.Errorf("%q: want classes %v, got %v", tc.in, tc.classes, m.UnicodeClasses)
+		}
+		if !reflect.DeepEqual(m.NotUnicodeClasses, tc.notClass) {
+			t.Errorf("%q: want negated classes %v, got %v", tc.in, tc.notClass, m.NotUnicodeClasses)
+		}
+		var subtract, intersect []string
+		for _, op := range m.Subtract {
+			subtract = append(subtract, op.Val)
+		}
+		for _, op := range m.Intersect {
+			intersect = append(intersect, op.Val)
+			if op.IgnoreCase != m.IgnoreCase {
+				t.Errorf("%q: want operand ignore case %t, got %t", tc.in, m.IgnoreCase, op.IgnoreCase)
+			}
+		}
+		if !reflect.DeepEqual(subtract, tc.subtract) {
+			t.Errorf("%q: want subtract %v, got %v", tc.in, tc.subtract, subtract)
+		}
+		if !reflect.DeepEqual(intersect, tc.intersect) {
+			t.Errorf("%q: want intersect %v, got %v", tc.in, tc.intersect, intersect)
+		}
+	}
+}
+
+func TestAnnotationWarnings(t *testing.T) {
+	g := NewGrammar(Pos{})
+	r := NewRule(Pos{Line: 1, Col: 1}, NewIdentifier(Pos{}, "A"))
+	for _, name := range []string{"inline", "bogus", "doc"} {
+		r.Annotations = append(r.Annotations, NewAnnotation(Pos{Line: 1, Col: 1}, NewIdentifier(Pos{}, name)))
+	}
+	g.Rules = []*Rule{r}
+
+	var got []string
+	for _, w := range AnnotationWarnings(g) {
+		got = append(got, w.Error())
+	}
+	want := []string{
+		"1:1 (0): rule A: unknown annotation @bogus",
+		"1:1 (0): rule A: annotation @doc expects 1 argument(s), got 0",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want warnings %q, got %q", want, got)
+	}
+}
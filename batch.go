@@ -0,0 +1,279 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	rtdebug "runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/fy0/pigeon/staleparser"
+)
+
+// batchConfig is the configuration of the batch mode.
+type batchConfig struct {
+	// outdir is the directory of the parsers, next to their grammar if it
+	// is empty.
+	outdir string
+	// jobs is the number of grammars generated in parallel.
+	jobs int
+	// force generates the parsers even if they are up to date.
+	force bool
+	// check compares the parsers with the existing files instead of
+	// writing them, as the -check flag.
+	check bool
+}
+
+// isBatch returns true if the arguments of the generation are several
+// grammars or a directory, or if an output directory is set.
+func isBatch(args []string, outdir string) bool {
+	if len(args) > 1 || outdir != "" {
+		return true
+	}
+	if len(args) == 1 {
+		fi, err := os.Stat(args[0])
+		return err == nil && fi.IsDir()
+	}
+	return false
+}
+
+// batch generates the parsers of the grammar files of args, replacing the
+// directories by their .peg files, with up to bc.jobs grammars in
+// parallel. Each parser is written next to its grammar, with the .go
+// extension, or in bc.outdir if it is set. The parsers whose source header
+// matches the one of the existing file are not generated again, unless
+// bc.force is set. It returns the exit code of the first grammar that
+// failed, in the order of args, or 0.
+func batch(args []string, bc batchConfig, cfg *genConfig) int {
+	files := grammarFiles(args)
+	outfiles := make([]string, len(files))
+	seen := make(map[string]string, len(files))
+	for i, file := range files {
+		outfiles[i] = strings.TrimSuffix(file, filepath.Ext(file)) + ".go"
+		if bc.outdir != "" {
+			outfiles[i] = filepath.Join(bc.outdir, filepath.Base(outfiles[i]))
+		}
+		if prev, ok := seen[outfiles[i]]; ok {
+			argError(1, "%s and %s are both generated to %s", prev, file, outfiles[i])
+		}
+		seen[outfiles[i]] = file
+	}
+
+	codes := make([]int, len(files))
+	sem := make(chan struct{}, bc.jobs)
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex // serializes the diffs of the check
+	)
+	for i := range files {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			d, err := generateFile(files[i], outfiles[i], bc, cfg)
+			if d != nil {
+				mu.Lock()
+				os.Stdout.Write(d)
+				mu.Unlock()
+			}
+			if err != nil {
+				var gerr *genError
+				if !errors.As(err, &gerr) {
+					gerr = &genError{1, "error: ", err}
+				}
+				fmt.Fprintf(os.Stderr, "%s: %s\n", files[i], gerr)
+				codes[i] = gerr.code
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for _, code := range codes {
+		if code != 0 {
+			return code
+		}
+	}
+	return 0
+}
+
+// generateFile generates the parser of the grammar file to outfile, if it
+// is not up to date or if bc.force is set. If bc.check is set, it returns
+// the diffs of the files that are not up to date instead of writing them.
+func generateFile(file, outfile string, bc batchConfig, cfg *genConfig) (diffs []byte, err error) {
+	src, err := os.ReadFile(file)
+	if err != nil {
+		return nil, &genError{2, "open error: ", err}
+	}
+	if !bc.force && !bc.check && upToDate(file, src, outfile, cfg) {
+		return nil, nil
+	}
+
+	parser, fuzz, err := generate(file, src, outfile, cfg)
+	if parser == nil || err != nil && bc.check {
+		return nil, err
+	}
+	if bc.check {
+		diffs, err := checkOutput(outfile, parser, fuzz)
+		if err != nil {
+			return nil, &genError{2, "open error: ", err}
+		}
+		if diffs != nil {
+			return diffs, &genError{10, "check: ", fmt.Errorf("%s is not up to date", outfile)}
+		}
+		return nil, nil
+	}
+	if err := os.WriteFile(outfile, parser, 0644); err != nil {
+		return nil, &genError{7, "write error: ", err}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if fuzz != nil {
+		if err := os.WriteFile(fuzzTestName(outfile), fuzz, 0644); err != nil {
+			return nil, &genError{7, "write error: ", err}
+		}
+	}
+	return nil, nil
+}
+
+// upToDate returns true if outfile exists and has the source header of
+// the grammar src read from nm generated with cfg, and so does not need to
+// be generated again. The fuzz harness must exist too if it is requested.
+func upToDate(nm string, src []byte, outfile string, cfg *genConfig) bool {
+	if cfg.noBuild {
+		return false
+	}
+	eff, err := cfg.withGrammarOptions(src)
+	if err != nil {
+		return false
+	}
+	b, err := os.ReadFile(outfile)
+	if err != nil || readSourceHeader(b) != sourceHeader(nm, src, outfile, eff) {
+		return false
+	}
+	if cfg.fuzzTest {
+		if _, err := os.Stat(fuzzTestName(outfile)); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// grammarFiles returns the grammar files of args, replacing the
+// directories by their .peg files.
+func grammarFiles(args []string) []string {
+	var files []string
+	for _, arg := range args {
+		fi, err := os.Stat(arg)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			exit(2)
+		}
+		if !fi.IsDir() {
+			files = append(files, arg)
+			continue
+		}
+		matches, err := filepath.Glob(filepath.Join(arg, "*.peg"))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			exit(2)
+		}
+		sort.Strings(matches)
+		files = append(files, matches...)
+	}
+	return files
+}
+
+// sourceHeader returns the source header of the parser of the grammar src
+// read from nm, generated with the effective configuration cfg to outfile:
+// the staleparser header, recording the path and the hash of the grammar
+// and the version of pigeon, followed by the options line of cfg, if any.
+// The parsers are generated again in batch mode only if it changes.
+func sourceHeader(nm string, src []byte, outfile string, cfg *genConfig) string {
+	header := staleparser.Header(grammarPath(outfile, nm), src, version())
+	if line := optionsLine(cfg); line != "" {
+		header += "\n" + line
+	}
+	return header
+}
+
+// optionsLine returns the line recording the effective options of cfg in
+// the header of the parsers, or an empty string if they are the default
+// ones.
+func optionsLine(cfg *genConfig) string {
+	args := cfg.grammarArgs()
+	if len(args) == 0 {
+		return ""
+	}
+	return optionsPragma + " " + strings.Join(args, " ")
+}
+
+// addSourceHeader returns the generated parser src with the source header
+// after the line of the code generated comment, or before the code if
+// there is none.
+func addSourceHeader(src []byte, header string) []byte {
+	var buf bytes.Buffer
+	if rest, ok := bytes.CutPrefix(src, []byte("// Code generated")); ok {
+		i := bytes.IndexByte(rest, '\n')
+		if i < 0 {
+			i = len(rest)
+		}
+		buf.Write(src[:len(src)-len(rest)+i])
+		buf.WriteString("\n" + header)
+		buf.Write(rest[i:])
+		return buf.Bytes()
+	}
+	buf.WriteString(header + "\n\n")
+	buf.Write(src)
+	return buf.Bytes()
+}
+
+// readSourceHeader returns the source header of the generated parser b,
+// the source and options lines before the package clause.
+func readSourceHeader(b []byte) string {
+	var lines []string
+	for _, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, staleparser.HeaderPrefix) || strings.HasPrefix(line, optionsPragma+" ") {
+			lines = append(lines, line)
+		}
+		if strings.HasPrefix(line, "package ") {
+			break
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// version returns the version of pigeon: the version of its module, or
+// the VCS revision it is built from if it is a development build.
+func version() string {
+	info, ok := rtdebug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	if v := info.Main.Version; v != "" && v != "(devel)" {
+		return v
+	}
+	var rev, modified string
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			rev = s.Value
+		case "vcs.modified":
+			if s.Value == "true" {
+				modified = "-dirty"
+			}
+		}
+	}
+	if rev == "" {
+		return "devel"
+	}
+	return "devel-" + rev + modified
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fy0/pigeon/staleparser"
+)
+
+func TestBatch(t *testing.T) {
+	dir := t.TempDir()
+	for _, file := range []string{"test/pluck/pluck.peg", "examples/calculator/calculator.peg"} {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, filepath.Base(file)), b, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	outdir := filepath.Join(dir, "out")
+	if err := os.Mkdir(outdir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &genConfig{receiverName: "c", grammarName: "g", target: "go", nolint: true}
+	if code := batch([]string{dir}, batchConfig{outdir: outdir, jobs: 2}, cfg); code != 0 {
+		t.Fatalf("want code 0, got %d", code)
+	}
+	src, err := os.ReadFile(filepath.Join(dir, "pluck.peg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	outfile := filepath.Join(outdir, "pluck.go")
+	b, err := os.ReadFile(outfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := readSourceHeader(b), sourceHeader(filepath.Join(dir, "pluck.peg"), src, outfile, cfg); got != want {
+		t.Fatalf("want source header %q, got %q", want, got)
+	}
+	if _, err := os.Stat(filepath.Join(outdir, "calculator.go")); err != nil {
+		t.Fatal(err)
+	}
+
+	// the up to date parsers are not generated again, unless forced or
+	// generated with another configuration
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(outfile, old, old); err != nil {
+		t.Fatal(err)
+	}
+	modified := func() bool {
+		fi, err := os.Stat(outfile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fi.ModTime().After(old)
+	}
+	batch([]string{dir}, batchConfig{outdir: outdir, jobs: 2}, cfg)
+	if modified() {
+		t.Fatal("up to date parser generated again")
+	}
+	batch([]string{dir}, batchConfig{outdir: outdir, jobs: 2, force: true}, cfg)
+	if !modified() {
+		t.Fatal("want parser generated again with force")
+	}
+	if err := os.Chtimes(outfile, old, old); err != nil {
+		t.Fatal(err)
+	}
+	cfg.optimizeParser = true
+	batch([]string{dir}, batchConfig{outdir: outdir, jobs: 2}, cfg)
+	if !modified() {
+		t.Fatal("want parser generated again with another configuration")
+	}
+
+	stdout, stderr := os.Stdout, os.Stderr
+	os.Stdout, _ = os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	os.Stderr, _ = os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	defer func() { os.Stdout, os.Stderr = stdout, stderr }()
+
+	// the check compares the parsers without writing them
+	if code := batch([]string{dir}, batchConfig{outdir: outdir, jobs: 2, check: true}, cfg); code != 0 {
+		t.Fatalf("check: want code 0, got %d", code)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "pluck.peg"), append(src, "\nUnused = 'x'\n"...), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(outfile, old, old); err != nil {
+		t.Fatal(err)
+	}
+	if code := batch([]string{dir}, batchConfig{outdir: outdir, jobs: 2, check: true}, cfg); code != 10 {
+		t.Fatalf("check: want code 10, got %d", code)
+	}
+	if modified() {
+		t.Fatal("check: want parser not written")
+	}
+
+	// the grammar errors are reported after the other grammars are
+	// generated
+	if err := os.WriteFile(filepath.Join(dir, "bad.peg"), []byte("A = B\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if code := batch([]string{dir}, batchConfig{jobs: 1}, cfg); code != 9 {
+		t.Fatalf("want code 9, got %d", code)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "pluck.go")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAddSourceHeader(t *testing.T) {
+	const header = staleparser.HeaderPrefix + "grammar.peg sha256:00 v1.0.0\n" + optionsPragma + " -nolint"
+	cases := []struct {
+		src, want string
+	}{
+		{
+			src:  "// Code generated by pigeon; DO NOT EDIT.\n\npackage main\n",
+			want: "// Code generated by pigeon; DO NOT EDIT.\n" + header + "\n\npackage main\n",
+		},
+		{
+			src:  "package main\n",
+			want: header + "\n\npackage main\n",
+		},
+	}
+	for _, tc := range cases {
+		got := string(addSourceHeader([]byte(tc.src), header))
+		if got != tc.want {
+			t.Errorf("%q: want %q, got %q", tc.src, tc.want, got)
+		}
+		if h := readSourceHeader([]byte(got)); h != header {
+			t.Errorf("%q: want source header %q, got %q", tc.src, header, h)
+		}
+	}
+	if h := readSourceHeader([]byte("package main\n" + header + "\n")); h != "" {
+		t.Errorf("want no source header after the package clause, got %q", h)
+	}
+}
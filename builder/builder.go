@@ -5,12 +5,16 @@ package builder
 import (
 	"bytes"
 	"fmt"
+	goast "go/ast"
+	"go/parser"
+	"go/token"
 	"io"
 	"regexp"
 	"strconv"
 	"strings"
 	"text/template"
 	"unicode"
+	"unicode/utf8"
 
 	"github.com/fy0/pigeon/ast"
 )
@@ -23,6 +27,11 @@ type ExprInfo struct {
 
 const codeGeneratedComment = "// Code generated by pigeon; DO NOT EDIT.\n\n"
 
+// CodeEndMarker is the line that follows the code blocks when the
+// CodePositions or LineDirectives option is set. It can be replaced by a //line directive to
+// restore the position of the generated code.
+const CodeEndMarker = "//pigeon:codeend"
+
 func (b *Builder) TemplateRenderBase(text string, trim bool, m map[string]any) string {
 	t, err := template.New("").Parse(text)
 	if err != nil {
@@ -53,9 +62,11 @@ func (b *Builder) TemplateRender(text string, trim bool) string {
 // generated function templates
 var (
 	callCodeFuncTemplate = `func (p *parser) call{{.FuncName}}() any {
-{{ if .useStack }} stack := p.vstack[len(p.vstack)-1]; {{ end }} return (func (c *current, {{.paramsDef}}) any {
+{{ if .useStack }} stack := p.vstack[len(p.vstack)-1]; {{ end }} return (func (c *current, {{.paramsDef}}) {{ or .resultType "any" }} {
 		{{.code}}
+{{- if not .resultType }}
 		return nil
+{{- end }}
 	})(&p.cur, {{.paramsCall}})
 }
 `
@@ -136,6 +147,59 @@ func Nolint(nolint bool) Option {
 	}
 }
 
+// SkipRule returns an option that specifies the rule that is implicitly
+// applied before each token of the syntactic rules. Syntactic rules are
+// the rules whose name starts with an uppercase letter, except for the skip
+// rule itself and the rules it references, which are always lexical.
+func SkipRule(name string) Option {
+	return func(b *Builder) Option {
+		prev := b.SkipRule
+		b.SkipRule = name
+		return SkipRule(prev)
+	}
+}
+
+// AlternateEntrypoints returns an option that specifies the rules, in
+// addition to the first one, that may be used as entrypoints. They must be
+// defined in the grammar.
+func AlternateEntrypoints(names ...string) Option {
+	return func(b *Builder) Option {
+		prev := b.AlternateEntrypoints
+		b.AlternateEntrypoints = names
+		return AlternateEntrypoints(prev...)
+	}
+}
+
+// CodePositions returns an option that specifies the name of the grammar
+// file used to set the position of the code blocks in the generated code.
+// If it is not empty, each code block is preceded by a /*line*/ directive
+// with its position in the grammar and followed by a line containing
+// CodeEndMarker, so that errors reported by go/types in code blocks point
+// to the grammar. The generated code must not be formatted, which would
+// indent the lines of the code blocks.
+func CodePositions(filename string) Option {
+	return func(b *Builder) Option {
+		prev := b.CodePositions
+		b.CodePositions = filename
+		return CodePositions(prev)
+	}
+}
+
+// LineDirectives returns an option that specifies the name of the grammar
+// file used in //line directives of the code blocks. If it is not empty,
+// each code block is preceded by a //line directive with its line in the
+// grammar, so that panics, stack traces and compile errors in code blocks
+// point to the grammar, and followed by a line containing CodeEndMarker,
+// which must be replaced by a //line directive restoring the position in
+// the generated file once it is formatted.
+func LineDirectives(filename string) Option {
+	return func(b *Builder) Option {
+		prev := b.LineDirectives
+		b.LineDirectives = filename
+		return LineDirectives(prev)
+	}
+}
+
 // BuildParser builds the PEG parser using the provider grammar. The code is
 // written to the specified W.
 func BuildParser(w io.Writer, g *ast.Grammar, opts ...Option) error {
@@ -160,11 +224,31 @@ type Builder struct {
 	ExprIndex int
 	ArgsStack [][]string
 
+	// RuleTypes maps the names of the typed rules to their Go type. The
+	// labels of typed rule references are typed in the code blocks, with
+	// ArgTypesStack following ArgsStack, and ResultActions are the actions
+	// of the current rule that return the typed value of the rule.
+	RuleTypes       map[string]string
+	ArgTypesStack   []map[string]string
+	ResultActions   map[*ast.ActionExpr]bool
+	HaveTypedLabels bool
+
 	Target     string
 	RangeTable bool
 	GrammarMap bool
 	Entrypoint string
 
+	AlternateEntrypoints []string
+
+	// CodePositions is the name of the grammar file used in the position
+	// directives of the code blocks, if any.
+	CodePositions string
+	// LineDirectives is the name of the grammar file used in the //line
+	// directives of the code blocks, if any.
+	LineDirectives string
+	// FuzzW is the writer of the fuzz harness of the parser, if any.
+	FuzzW io.Writer
+
 	IRefEnable     bool
 	IRefCodeEnable bool
 
@@ -172,6 +256,20 @@ type Builder struct {
 	GrammarName string
 	GrammarOnly bool
 
+	// SkipRule is the name of the rule applied before each token of the
+	// syntactic rules, SkipActive is set while such a rule is written.
+	SkipRule     string
+	SkipActive   bool
+	LexicalRules map[string]struct{}
+
+	// HavePluck is set if a sequence with plucked expressions is written.
+	HavePluck bool
+	// HaveCharClassSet is set if a character class with negated Unicode
+	// classes or set operations is written.
+	HaveCharClassSet bool
+	// HaveMemoRules is set if a rule annotated with @memo is written.
+	HaveMemoRules bool
+
 	RuleName2Index map[string]*ExprInfo
 
 	Shims       OverrideShims
@@ -182,7 +280,7 @@ type Builder struct {
 }
 
 func GetExprInfo(expr ast.Expression) *ExprInfo {
-	switch expr.(type) {
+	switch expr := expr.(type) {
 	case *ast.ActionExpr:
 		return &ExprInfo{ExprType: "actionExpr"}
 	case *ast.AndCodeExpr:
@@ -192,6 +290,9 @@ func GetExprInfo(expr ast.Expression) *ExprInfo {
 	case *ast.AnyMatcher:
 		return &ExprInfo{ExprType: "anyMatcher"}
 	case *ast.CharClassMatcher:
+		if expr.HasSetOperations() {
+			return &ExprInfo{ExprType: "charClassSetMatcher"}
+		}
 		return &ExprInfo{ExprType: "charClassMatcher"}
 	case *ast.ChoiceExpr:
 		return &ExprInfo{ExprType: "choiceExpr"}
@@ -210,6 +311,9 @@ func GetExprInfo(expr ast.Expression) *ExprInfo {
 	case *ast.RuleRefExpr:
 		return &ExprInfo{ExprType: "ruleRefExpr"}
 	case *ast.SeqExpr:
+		if ast.IsPlucked(expr) {
+			return &ExprInfo{ExprType: "pluckExpr"}
+		}
 		return &ExprInfo{ExprType: "seqExpr"}
 	case *ast.CodeExpr:
 		return &ExprInfo{ExprType: "codeExpr"}
@@ -239,7 +343,7 @@ func (r *RuleLabelCheck) Visit(expr ast.Expression) ast.Visitor {
 		return nil
 	}
 
-	if _, ok := expr.(*ast.LabeledExpr); ok {
+	if lab, ok := expr.(*ast.LabeledExpr); ok && lab.Label != nil {
 		r.IsLabelExists = true
 		return nil
 	}
@@ -248,6 +352,13 @@ func (r *RuleLabelCheck) Visit(expr ast.Expression) ast.Visitor {
 }
 
 func (b *Builder) BuildParser(grammar *ast.Grammar) error {
+	if err := ast.CheckRuleRefs(grammar, b.AlternateEntrypoints...); err != nil {
+		return fmt.Errorf("incorrect grammar:\n%w", err)
+	}
+	if err := ast.CheckRepetitions(grammar); err != nil {
+		return fmt.Errorf("incorrect grammar:\n%w", err)
+	}
+
 	for index, rule := range grammar.Rules {
 		r := &RuleLabelCheck{}
 		ast.Walk(r, rule.Expr)
@@ -263,6 +374,21 @@ func (b *Builder) BuildParser(grammar *ast.Grammar) error {
 	}
 	b.HaveLeftRecursion = haveLeftRecursion
 
+	b.RuleTypes = make(map[string]string)
+	for _, rule := range grammar.Rules {
+		if rule.Type != nil {
+			b.RuleTypes[rule.Name.Val] = rule.Type.Val
+		}
+	}
+
+	if b.SkipRule != "" {
+		lexical, err := LexicalRules(grammar, b.SkipRule)
+		if err != nil {
+			return fmt.Errorf("incorrect grammar: %w", err)
+		}
+		b.LexicalRules = lexical
+	}
+
 	b.writeInit(grammar.Init)
 	if !b.GrammarMap {
 		b.writeGrammar(grammar)
@@ -277,6 +403,9 @@ func (b *Builder) BuildParser(grammar *ast.Grammar) error {
 		b.writeStaticCodeWrap()
 	}
 
+	if b.FuzzW != nil && b.Err == nil {
+		b.Err = b.writeFuzzHarness(grammar)
+	}
 	return b.Err
 }
 
@@ -297,10 +426,49 @@ func (b *Builder) WriteRulePos(pos ast.Pos) {
 }
 
 func (b *Builder) WriteRule(r *ast.Rule) {
+	b.SkipActive = b.IsSyntactic(r)
 	b.Shims.WriteRule(b, r)
+	b.SkipActive = false
+}
+
+// IsSyntactic returns true if the skip rule must be applied implicitly
+// before the tokens of rule r.
+func (b *Builder) IsSyntactic(r *ast.Rule) bool {
+	if b.SkipRule == "" || r == nil || r.Name == nil {
+		return false
+	}
+	if _, ok := b.LexicalRules[r.Name.Val]; ok {
+		return false
+	}
+	rn, _ := utf8.DecodeRuneInString(r.Name.Val)
+	return unicode.IsUpper(rn)
+}
+
+// NeedSkip returns true if the skip rule must be applied before expr in a
+// syntactic rule. This is the case for the tokens (matchers and rule
+// references), and for the expressions capturing text, so that the skipped
+// input is not part of the captured text.
+func NeedSkip(expr ast.Expression) bool {
+	switch expr := expr.(type) {
+	case *ast.ActionExpr, *ast.AnyMatcher, *ast.CharClassMatcher,
+		*ast.LitMatcher, *ast.RuleRefExpr:
+		return true
+	case *ast.LabeledExpr:
+		return expr.TextCapture
+	}
+	return false
 }
 
 func (b *Builder) WriteExpr(expr ast.Expression) {
+	if b.SkipActive && NeedSkip(expr) {
+		b.writeSkipExpr(expr)
+		return
+	}
+	b.WriteExprNoSkip(expr)
+}
+
+// WriteExprNoSkip writes expr without applying the skip rule before it.
+func (b *Builder) WriteExprNoSkip(expr ast.Expression) {
 	b.ExprIndex++
 	switch expr := expr.(type) {
 	case *ast.ActionExpr:
@@ -364,6 +532,77 @@ func (b *Builder) writeCharClassMatcher(ch *ast.CharClassMatcher) {
 	b.Shims.WriteCharClassMatcher(b, ch)
 }
 
+// writeCharClassFields writes the fields of the character class ch. The
+// operands of the set operations are written recursively, and use the
+// ignoreCase flag of the outermost class.
+func (b *Builder) writeCharClassFields(ch *ast.CharClassMatcher, ignoreCase bool) {
+	b.Writelnf("\tval: %q,", ch.Val)
+	if len(ch.Chars) > 0 {
+		b.Writef("\tchars:")
+		b.WriteArray("rune", false, func() {
+			for _, rn := range ch.Chars {
+				if ignoreCase {
+					b.Writef("%q,", unicode.ToLower(rn))
+				} else {
+					b.Writef("%q,", rn)
+				}
+			}
+		})
+	}
+	if len(ch.Ranges) > 0 {
+		b.Writef("\tranges:")
+		b.WriteArray("rune", false, func() {
+			for _, rn := range ch.Ranges {
+				if ignoreCase {
+					b.Writef("%q,", unicode.ToLower(rn))
+				} else {
+					b.Writef("%q,", rn)
+				}
+			}
+		})
+	}
+	if len(ch.UnicodeClasses) > 0 {
+		b.RangeTable = true
+		b.Writef("\tclasses: ")
+		b.WriteArray("*unicode.RangeTable", false, func() {
+			for _, cl := range ch.UnicodeClasses {
+				b.Writef("unicode.%s,", cl)
+			}
+		})
+	}
+	if len(ch.NotUnicodeClasses) > 0 {
+		b.RangeTable = true
+		b.Writef("\tnotClasses: ")
+		b.WriteArray("*unicode.RangeTable", false, func() {
+			for _, cl := range ch.NotUnicodeClasses {
+				b.Writef("unicode.%s,", cl)
+			}
+		})
+	}
+	for _, set := range []struct {
+		name     string
+		operands []*ast.CharClassMatcher
+	}{{"intersect", ch.Intersect}, {"subtract", ch.Subtract}} {
+		if len(set.operands) == 0 {
+			continue
+		}
+		b.Writef("\t%s: ", set.name)
+		b.WriteArray("*charClassSetMatcher", true, func() {
+			for _, op := range set.operands {
+				b.Writelnf("{")
+				b.writeCharClassFields(op, ignoreCase)
+				b.Writelnf("},")
+			}
+		})
+	}
+	if ignoreCase {
+		b.Writelnf("\tignoreCase: %t,", ignoreCase)
+	}
+	if ch.Inverted {
+		b.Writelnf("\tinverted: %t,", ch.Inverted)
+	}
+}
+
 func (b *Builder) writeCodeExpr(state *ast.CodeExpr) {
 	b.Shims.WriteCodeExpr(b, state)
 }
@@ -400,6 +639,10 @@ func (b *Builder) writeRuleRefExpr(ref *ast.RuleRefExpr) {
 	b.Shims.WriteRuleRefExpr(b, ref)
 }
 
+func (b *Builder) writeSkipExpr(expr ast.Expression) {
+	b.Shims.WriteSkipExpr(b, expr)
+}
+
 func (b *Builder) writeSeqExpr(seq *ast.SeqExpr) {
 	b.Shims.WriteSeqExpr(b, seq)
 }
@@ -424,25 +667,59 @@ func (b *Builder) writeRuleCode(rule *ast.Rule) {
 	// keep trace of the current rule, as the code blocks are created
 	// in functions named "on<RuleName><#ExprIndex>".
 	b.RuleName = rule.Name.Val
+	b.ResultActions = nil
+	if rule.Type != nil {
+		b.ResultActions = make(map[*ast.ActionExpr]bool)
+		resultActions(rule.Expr, b.ResultActions)
+	}
 	b.pushArgsSet()
 	b.writeExprCode(rule.Expr)
 	b.popArgsSet()
 }
 
+// resultActions adds to set the actions whose value is the value of expr.
+func resultActions(expr ast.Expression, set map[*ast.ActionExpr]bool) {
+	switch expr := expr.(type) {
+	case *ast.ActionExpr:
+		set[expr] = true
+	case *ast.ChoiceExpr:
+		for _, alt := range expr.Alternatives {
+			resultActions(alt, set)
+		}
+	case *ast.RecoveryExpr:
+		resultActions(expr.Expr, set)
+		resultActions(expr.RecoverExpr, set)
+	}
+}
+
 func (b *Builder) pushArgsSet() {
 	b.ArgsStack = append(b.ArgsStack, nil)
+	b.ArgTypesStack = append(b.ArgTypesStack, nil)
 }
 
 func (b *Builder) popArgsSet() {
 	b.ArgsStack = b.ArgsStack[:len(b.ArgsStack)-1]
+	b.ArgTypesStack = b.ArgTypesStack[:len(b.ArgTypesStack)-1]
 }
 
-func (b *Builder) addArg(arg *ast.Identifier) {
-	if arg == nil {
+func (b *Builder) addArg(lab *ast.LabeledExpr) {
+	if lab.Label == nil {
 		return
 	}
 	ix := len(b.ArgsStack) - 1
-	b.ArgsStack[ix] = append(b.ArgsStack[ix], arg.Val)
+	b.ArgsStack[ix] = append(b.ArgsStack[ix], lab.Label.Val)
+
+	// the label of a reference to a typed rule has the type of the rule
+	ref, ok := lab.Expr.(*ast.RuleRefExpr)
+	if !ok || lab.TextCapture || ref.Name == nil {
+		return
+	}
+	if typ, ok := b.RuleTypes[ref.Name.Val]; ok {
+		if b.ArgTypesStack[ix] == nil {
+			b.ArgTypesStack[ix] = make(map[string]string)
+		}
+		b.ArgTypesStack[ix][lab.Label.Val] = typ
+	}
 }
 
 func (b *Builder) writeExprCode(expr ast.Expression) {
@@ -455,7 +732,7 @@ func (b *Builder) writeExprCode(expr ast.Expression) {
 		b.writeAndCodeExprCode(expr)
 
 	case *ast.LabeledExpr:
-		b.addArg(expr.Label)
+		b.addArg(expr)
 		b.pushArgsSet()
 		b.writeExprCode(expr.Expr)
 		b.popArgsSet()
@@ -521,6 +798,17 @@ func (b *Builder) writeActionExprCode(act *ast.ActionExpr) {
 	}
 }
 
+// resultType returns the Go type returned by the code block of an action
+// whose value is the value of a typed rule, or an empty string.
+func (b *Builder) resultType(code *ast.CodeBlock) string {
+	for act := range b.ResultActions {
+		if act.Code == code {
+			return b.RuleTypes[b.RuleName]
+		}
+	}
+	return ""
+}
+
 func (b *Builder) writeAndCodeExprCode(and *ast.AndCodeExpr) {
 	if and == nil {
 		return
@@ -567,6 +855,56 @@ func (b *Builder) writeFunc(funcIx int, code *ast.CodeBlock, funcTpl string) {
 	b.Shims.WriteFunc(b, funcIx, code, funcTpl)
 }
 
+// withCodePosition returns val, the text of code written to the generated
+// code, preceded by the directive setting its position in the grammar and
+// followed by CodeEndMarker if the CodePositions or LineDirectives option
+// is set. The text starts at the first character of code after the opening
+// brace, skipping the leading white space if trim is set.
+func (b *Builder) withCodePosition(code *ast.CodeBlock, val string, trim bool) string {
+	if b.CodePositions == "" && b.LineDirectives == "" {
+		return val
+	}
+
+	pos := code.Pos()
+	line, col := pos.Line, pos.Col+1
+	for _, r := range code.Val[1:] {
+		if !trim || !unicode.IsSpace(r) {
+			break
+		}
+		if r == '\n' {
+			line, col = line+1, 1
+		} else {
+			col++
+		}
+	}
+	if b.CodePositions != "" {
+		return fmt.Sprintf("/*line %s:%d:%d*/%s\n%s", b.CodePositions, line, col, val, CodeEndMarker)
+	}
+	// the code is indented once formatted, the column is left unknown
+	return fmt.Sprintf("\n//line %s:%d\n%s\n%s", b.LineDirectives, line, val, CodeEndMarker)
+}
+
+// initWithLineDirective returns val, the text of the initializer init
+// written to the generated code, with a //line directive following its
+// import declarations, which are modified by goimports, and followed by
+// CodeEndMarker. The directive is omitted if val is not valid Go.
+func (b *Builder) initWithLineDirective(init *ast.CodeBlock, val string) string {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", val, parser.ImportsOnly)
+	if err != nil {
+		return val
+	}
+	end := f.Name.End()
+	for _, decl := range f.Decls {
+		if gen, ok := decl.(*goast.GenDecl); ok && gen.Tok == token.IMPORT {
+			end = gen.End()
+		}
+	}
+	off := fset.Position(end).Offset
+	line := init.Pos().Line + strings.Count(val[:off], "\n")
+	return fmt.Sprintf("%s\n//line %s:%d\n%s\n%s", val[:off], b.LineDirectives, line, val[off:], CodeEndMarker)
+}
+
 func (b *Builder) writeStaticCodeWrap() {
 	b.Shims.WriteStaticCodeWrap(b)
 }
@@ -584,6 +922,11 @@ func (b *Builder) WriteStaticCode(code string) {
 		NeedExprWrap   bool
 		ParseExprName  string
 		GrammarVarName string
+		SkipRule       string
+		Pluck          bool
+		CharClassSet   bool
+		TypedLabels    bool
+		MemoRules      bool
 	}{
 		Optimize:       b.Optimize,
 		Nolint:         b.Nolint,
@@ -595,6 +938,11 @@ func (b *Builder) WriteStaticCode(code string) {
 		NeedExprWrap:   !b.Optimize || b.HaveLeftRecursion,
 		ParseExprName:  "parseExpr",
 		GrammarVarName: b.GrammarName,
+		SkipRule:       b.SkipRule,
+		Pluck:          b.HavePluck,
+		CharClassSet:   b.HaveCharClassSet,
+		TypedLabels:    b.HaveTypedLabels,
+		MemoRules:      b.HaveMemoRules,
 	}
 	if !params.NeedExprWrap {
 		params.ParseExprName = "parseExprWrap"
@@ -681,6 +1029,7 @@ type OverrideShims struct {
 	WriteRecoveryExpr     func(b *Builder, recover *ast.RecoveryExpr)
 	WriteRuleRefExpr      func(b *Builder, ref *ast.RuleRefExpr)
 	WriteSeqExpr          func(b *Builder, seq *ast.SeqExpr)
+	WriteSkipExpr         func(b *Builder, expr ast.Expression)
 	WriteThrowExpr        func(b *Builder, throw *ast.ThrowExpr)
 	WriteZeroOrMoreExpr   func(b *Builder, zero *ast.ZeroOrMoreExpr)
 	WriteZeroOrOneExpr    func(b *Builder, zero *ast.ZeroOrOneExpr)
@@ -707,8 +1056,13 @@ func (b *Builder) Init() {
 		}
 
 		// remove opening and closing braces
-		val := codeGeneratedComment + b.TemplateRender(init.Val[1:len(init.Val)-1], false)
-		b.Writelnf("%s", val)
+		val := b.TemplateRender(init.Val[1:len(init.Val)-1], false)
+		if b.LineDirectives != "" {
+			val = b.initWithLineDirective(init, val)
+		} else {
+			val = b.withCodePosition(init, val, false)
+		}
+		b.Writelnf("%s", codeGeneratedComment+val)
 	}
 
 	b.Shims.WriteGrammar = func(b *Builder, g *ast.Grammar) {
@@ -720,6 +1074,9 @@ func (b *Builder) Init() {
 		for index, r := range g.Rules {
 			info := b.GetExprInfo(r.Expr)
 			info.Index = index
+			if b.IsSyntactic(r) && NeedSkip(r.Expr) {
+				info.ExprType = "skipExpr"
+			}
 			m[r.Name.Val] = info
 		}
 		b.RuleName2Index = m
@@ -755,6 +1112,11 @@ func (b *Builder) Init() {
 			b.Entrypoint = r.Name.Val
 		}
 
+		if doc := r.Annotation("doc"); doc != nil && len(doc.Args) > 0 {
+			for _, line := range strings.Split(doc.Args[0], "\n") {
+				b.Writelnf("// %s", line)
+			}
+		}
 		if b.GrammarMap {
 			b.Writelnf("%q: {", r.Name.Val)
 		} else {
@@ -767,6 +1129,10 @@ func (b *Builder) Init() {
 		if r.IsLabelExists {
 			b.Writelnf("\tvarExists: %t,", r.IsLabelExists)
 		}
+		if r.HasAnnotation("memo") {
+			b.Writelnf("\tmemoize: true,")
+			b.HaveMemoRules = true
+		}
 		b.WriteRulePos(r.Pos())
 		b.Writef("\texpr: ")
 		b.WriteExpr(r.Expr)
@@ -847,50 +1213,15 @@ func (b *Builder) Init() {
 			b.WriteNilLine()
 			return
 		}
-		b.WriteExprBlock("charClassMatcher", true, func() {
+		name := "charClassMatcher"
+		if ch.HasSetOperations() {
+			b.HaveCharClassSet = true
+			name = "charClassSetMatcher"
+		}
+		b.WriteExprBlock(name, true, func() {
 			pos := ch.Pos()
 			b.WriteRulePos(pos)
-			b.Writelnf("\tval: %q,", ch.Val)
-			if len(ch.Chars) > 0 {
-				b.Writef("\tchars:")
-				b.WriteArray("rune", false, func() {
-					for _, rn := range ch.Chars {
-						if ch.IgnoreCase {
-							b.Writef("%q,", unicode.ToLower(rn))
-						} else {
-							b.Writef("%q,", rn)
-						}
-					}
-				})
-			}
-			if len(ch.Ranges) > 0 {
-				b.Writef("\tranges:")
-				b.WriteArray("rune", false, func() {
-					for _, rn := range ch.Ranges {
-						if ch.IgnoreCase {
-							b.Writef("%q,", unicode.ToLower(rn))
-						} else {
-							b.Writef("%q,", rn)
-						}
-					}
-				})
-			}
-			if len(ch.UnicodeClasses) > 0 {
-				b.RangeTable = true
-				b.Writef("\tclasses: ")
-				b.WriteArray("*unicode.RangeTable", false, func() {
-					for _, cl := range ch.UnicodeClasses {
-						// b.Writef("RangeTable(%q),", cl)
-						b.Writef("unicode.%s,", cl)
-					}
-				})
-			}
-			if ch.IgnoreCase {
-				b.Writelnf("\tignoreCase: %t,", ch.IgnoreCase)
-			}
-			if ch.Inverted {
-				b.Writelnf("\tinverted: %t,", ch.Inverted)
-			}
+			b.writeCharClassFields(ch, ch.IgnoreCase)
 		})
 	}
 
@@ -946,6 +1277,9 @@ func (b *Builder) Init() {
 			b.WriteExpr(lab.Expr)
 			if lab.TextCapture {
 				b.Writelnf("\ttextCapture: %v,", lab.TextCapture)
+				if lab.Pluck {
+					b.Writelnf("\tpluck: true,")
+				}
 			}
 		})
 	}
@@ -1095,6 +1429,27 @@ func (b *Builder) Init() {
 			b.WriteNilLine()
 			return
 		}
+		if plucked := seq.Plucked(); len(plucked) > 0 {
+			b.HavePluck = true
+			b.WriteExprBlock("pluckExpr", true, func() {
+				b.WriteRulePos(seq.Pos())
+				b.Writef("\texprs: ")
+				b.WriteArray("any", true, func() {
+					for _, e := range seq.Exprs {
+						b.WriteExpr(e)
+					}
+				})
+				b.Writef("\tpluck: []int{")
+				for i, ix := range plucked {
+					if i > 0 {
+						b.Writef(", ")
+					}
+					b.Writef("%d", ix)
+				}
+				b.Writelnf("},")
+			})
+			return
+		}
 		b.WriteExprBlock("seqExpr", true, func() {
 			b.WriteRulePos(seq.Pos())
 			if len(seq.Exprs) > 0 {
@@ -1108,6 +1463,14 @@ func (b *Builder) Init() {
 		})
 	}
 
+	b.Shims.WriteSkipExpr = func(b *Builder, expr ast.Expression) {
+		b.WriteExprBlock("skipExpr", true, func() {
+			b.WriteRulePos(expr.Pos())
+			b.Writef("\texpr: ")
+			b.WriteExprNoSkip(expr)
+		})
+	}
+
 	b.Shims.WriteThrowExpr = func(b *Builder, throw *ast.ThrowExpr) {
 		if throw == nil {
 			b.WriteNilLine()
@@ -1158,18 +1521,30 @@ func (b *Builder) Init() {
 		if len(val) > 0 && val[len(val)-1] == '\n' {
 			val = val[:len(val)-1]
 		}
+		val = b.withCodePosition(code, val, true)
 		var args bytes.Buffer
 		ix := len(b.ArgsStack) - 1
 		argsInfo := StringArrayUniq(b.ArgsStack[ix])
+		var argTypes map[string]string
+		if ix >= 0 {
+			argTypes = b.ArgTypesStack[ix]
+		}
 		if ix >= 0 {
 			for i, arg := range argsInfo {
 				if i > 0 {
 					args.WriteString(", ")
 				}
 				args.WriteString(arg)
+				if len(argTypes) > 0 {
+					if typ, ok := argTypes[arg]; ok {
+						args.WriteString(" " + typ)
+					} else {
+						args.WriteString(" any")
+					}
+				}
 			}
 		}
-		if args.Len() > 0 {
+		if args.Len() > 0 && len(argTypes) == 0 {
 			args.WriteString(" any")
 		}
 
@@ -1180,7 +1555,12 @@ func (b *Builder) Init() {
 				if i > 0 {
 					args.WriteString(", ")
 				}
-				args.WriteString(fmt.Sprintf(`stack[%q]`, arg))
+				if typ, ok := argTypes[arg]; ok {
+					b.HaveTypedLabels = true
+					args.WriteString(fmt.Sprintf(`typedLabel[%s](p, %q, stack[%[2]q])`, typ, arg))
+				} else {
+					args.WriteString(fmt.Sprintf(`stack[%q]`, arg))
+				}
 			}
 		}
 
@@ -1190,6 +1570,7 @@ func (b *Builder) Init() {
 			"code":       val,
 			"paramsCall": args.String(),
 			"useStack":   len(argsInfo) > 0,
+			"resultType": b.resultType(code),
 		}))
 	}
 
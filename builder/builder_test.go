@@ -74,3 +74,98 @@ func TestBuildParserIncludesNoMatchFormatterHook(t *testing.T) {
 		})
 	}
 }
+
+func TestBuildParserUndefinedRules(t *testing.T) {
+	p := bootstrap.NewParser()
+	g, err := p.Parse("", strings.NewReader("a = b c\nc = 'c' / d\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "incorrect grammar:\n" +
+		"1:5 (4): rule a: undefined rule b\n" +
+		"2:11 (18): rule c: undefined rule d\n" +
+		"undefined rule C used as alternate entrypoint, did you mean c?"
+	for _, opts := range [][]Option{
+		{AlternateEntrypoints("C")},
+		{AlternateEntrypoints("C"), OptimizeRefExprByIndex(true)},
+	} {
+		err := BuildParser(io.Discard, g, opts...)
+		if err == nil || err.Error() != want {
+			t.Errorf("want error %q, got %v", want, err)
+		}
+	}
+}
+
+func TestBuildParserCodePositions(t *testing.T) {
+	p := bootstrap.NewParser()
+	g, err := p.Parse("", strings.NewReader("{\npackage p\n}\na = 'a' {\n\n\t\treturn 1\n}\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := BuildParser(&buf, g, CodePositions("g.peg")); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"/*line g.peg:1:2*/\npackage p\n",
+		"/*line g.peg:6:3*/return 1\n" + CodeEndMarker + "\n",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("want %q in the generated code", want)
+		}
+	}
+}
+
+func TestBuildParserLineDirectives(t *testing.T) {
+	p := bootstrap.NewParser()
+	g, err := p.Parse("", strings.NewReader("{\npackage p\n\nimport \"fmt\"\n\nvar x = fmt.Sprint()\n}\na = 'a' {\n\n\t\treturn 1\n}\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := BuildParser(&buf, g, LineDirectives("g.peg")); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"import \"fmt\"\n//line g.peg:4\n\n\nvar x",
+		"\n//line g.peg:10\nreturn 1\n" + CodeEndMarker + "\n",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("want %q in the generated code", want)
+		}
+	}
+}
+
+func TestBuildParserFuzzHarness(t *testing.T) {
+	p := bootstrap.NewParser()
+	g, err := p.Parse("", strings.NewReader("{\n// Package p.\npackage p\n}\na = b\nb = 'b'\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := BuildParser(io.Discard, g, FuzzHarness(&buf), AlternateEntrypoints("b", "a"), GrammarName("list")); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"package p\n",
+		"var fuzzEntrypointsList = []string{\"a\", \"b\"}\n",
+		"func FuzzParseList(f *testing.F) {\n",
+		"v, err := p.parse(list)\n",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("want %q in the fuzz harness", want)
+		}
+	}
+
+	g, err = p.Parse("", strings.NewReader("a = 'a'\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := BuildParser(io.Discard, g, FuzzHarness(&buf)); err != errNoPackage {
+		t.Errorf("want errNoPackage, got %v", err)
+	}
+}
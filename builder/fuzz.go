@@ -0,0 +1,138 @@
+package builder
+
+import (
+	"errors"
+	"go/parser"
+	"go/token"
+	"io"
+	"strings"
+	"text/template"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/fy0/pigeon/ast"
+)
+
+// errNoPackage is returned when the fuzz harness is requested for a grammar
+// without a package clause in its init code block.
+var errNoPackage = errors.New("fuzz harness: no package clause in the init code block")
+
+// FuzzHarness returns an option that specifies the writer of the fuzz
+// harness of the generated parser, a _test.go file of the same package. If
+// it is not nil, the harness is written to w once the parser is built.
+func FuzzHarness(w io.Writer) Option {
+	return func(b *Builder) Option {
+		prev := b.FuzzW
+		b.FuzzW = w
+		return FuzzHarness(prev)
+	}
+}
+
+var fuzzHarnessTemplate = template.Must(template.New("fuzz").Parse(codeGeneratedComment + `package {{ .Package }}
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// fuzzEntrypoints{{ .Suffix }} are the rules used as entrypoints by Fuzz{{ .Name }}.
+var fuzzEntrypoints{{ .Suffix }} = []string{
+{{- range $i, $e := .Entrypoints }}{{ if $i }}, {{ end }}{{ printf "%q" $e }}{{ end -}}
+}
+
+// Fuzz{{ .Name }} checks that the parser does not panic, that the positions of
+// its errors are within the input and that the memoized and non-memoized
+// parses agree on the success and the value, for each entrypoint. It is
+// seeded with the files of the testdata directory, in addition to the
+// corpus of testdata/fuzz/Fuzz{{ .Name }}.
+func Fuzz{{ .Name }}(f *testing.F) {
+	files, _ := filepath.Glob(filepath.Join("testdata", "*"))
+	for _, file := range files {
+		if b, err := os.ReadFile(file); err == nil {
+			f.Add(b)
+		}
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		for _, entrypoint := range fuzzEntrypoints{{ .Suffix }} {
+			want, wantErr := fuzzParse{{ .Suffix }}(t, entrypoint, data, false)
+			got, gotErr := fuzzParse{{ .Suffix }}(t, entrypoint, data, true)
+			if (gotErr == nil) != (wantErr == nil) {
+				t.Fatalf("%s: memoized parse error %v, want %v", entrypoint, gotErr, wantErr)
+			}
+			if gotErr == nil && !reflect.DeepEqual(got, want) {
+				t.Fatalf("%s: memoized parse value %#v, want %#v", entrypoint, got, want)
+			}
+		}
+	})
+}
+
+// fuzzParse{{ .Suffix }} parses data from entrypoint and checks the positions of
+// the errors.
+func fuzzParse{{ .Suffix }}(t *testing.T, entrypoint string, data []byte, memoize bool) (any, error) {
+	p := newParser("", data)
+	p.entrypoint = entrypoint
+	p.memoized = memoize
+	v, err := p.parse({{ .GrammarVarName }})
+	if err == nil {
+		return v, nil
+	}
+	el, ok := err.(errList)
+	if !ok {
+		t.Fatalf("%s: want an error list, got %T: %v", entrypoint, err, err)
+	}
+	for _, e := range el {
+		pe, ok := e.(*parserError)
+		if !ok {
+			t.Fatalf("%s: want a parser error, got %T: %v", entrypoint, e, e)
+		}
+		if pos := pe.pos; pos.line < 1 || pos.col < 0 || pos.offset < 0 || pos.offset > len(data) {
+			t.Fatalf("%s: error position %s out of the input of %d bytes: %v", entrypoint, pos, len(data), e)
+		}
+	}
+	return v, err
+}
+`))
+
+// writeFuzzHarness writes the fuzz harness of the parser of g to b.FuzzW.
+// The names of the harness are suffixed with the grammar name if it is not
+// the default one, so that several harnesses can live in a package.
+func (b *Builder) writeFuzzHarness(g *ast.Grammar) error {
+	pkg := packageName(g.Init)
+	if pkg == "" {
+		return errNoPackage
+	}
+	params := struct {
+		Package        string
+		Name           string
+		Suffix         string
+		GrammarVarName string
+		Entrypoints    []string
+	}{
+		Package:        pkg,
+		Name:           "Parse",
+		GrammarVarName: b.GrammarName,
+		Entrypoints:    StringArrayUniq(append([]string{g.Rules[0].Name.Val}, b.AlternateEntrypoints...)),
+	}
+	if b.GrammarName != "" && b.GrammarName != "g" {
+		r, n := utf8.DecodeRuneInString(b.GrammarName)
+		params.Suffix = string(unicode.ToUpper(r)) + b.GrammarName[n:]
+		params.Name += params.Suffix
+	}
+	return fuzzHarnessTemplate.Execute(b.FuzzW, params)
+}
+
+// packageName returns the name of the package declared in the init code
+// block, or "" if there is none.
+func packageName(init *ast.CodeBlock) string {
+	if init == nil {
+		return ""
+	}
+	src := strings.TrimSuffix(strings.TrimPrefix(init.Val, "{"), "}")
+	f, err := parser.ParseFile(token.NewFileSet(), "", src, parser.PackageClauseOnly)
+	if err != nil {
+		return ""
+	}
+	return f.Name.Name
+}
@@ -0,0 +1,48 @@
+package builder
+
+import (
+	"fmt"
+
+	"github.com/fy0/pigeon/ast"
+)
+
+// LexicalRules returns the set of rules that must never apply the skip rule
+// implicitly: the skip rule itself and all the rules it references, directly
+// or indirectly. Applying the skip rule inside those rules would recurse
+// forever. The rules annotated with @token, and the rules they reference, are
+// lexical too.
+func LexicalRules(grammar *ast.Grammar, skipRule string) (map[string]struct{}, error) {
+	rules := make(map[string]*ast.Rule, len(grammar.Rules))
+	for _, rule := range grammar.Rules {
+		rules[rule.Name.Val] = rule
+	}
+	if _, ok := rules[skipRule]; !ok {
+		return nil, fmt.Errorf("skip rule %q is not defined", skipRule)
+	}
+
+	lexical := make(map[string]struct{})
+	var visit func(name string)
+	visit = func(name string) {
+		rule, ok := rules[name]
+		if !ok {
+			return
+		}
+		if _, ok := lexical[name]; ok {
+			return
+		}
+		lexical[name] = struct{}{}
+		ast.Inspect(rule.Expr, func(expr ast.Expression) bool {
+			if ref, ok := expr.(*ast.RuleRefExpr); ok {
+				visit(ref.Name.Val)
+			}
+			return true
+		})
+	}
+	visit(skipRule)
+	for _, rule := range grammar.Rules {
+		if rule.HasAnnotation("token") {
+			visit(rule.Name.Val)
+		}
+	}
+	return lexical, nil
+}
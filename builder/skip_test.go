@@ -0,0 +1,89 @@
+package builder
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/fy0/pigeon/ast"
+	"github.com/fy0/pigeon/bootstrap"
+)
+
+var skipGrammar = `
+Program = Stmt* EOF
+Stmt = ident "=" ident ";"
+ident = [a-z]+
+Spacing = ( Whitespace / Comment )*
+Whitespace = [ \t\r\n]
+Comment = "#" ( !EOL . )* EOL?
+EOL = "\n"
+EOF = !.
+`
+
+func TestLexicalRules(t *testing.T) {
+	p := bootstrap.NewParser()
+	g, err := p.Parse("", strings.NewReader(skipGrammar))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := LexicalRules(g, "Spacing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]struct{}{
+		"Spacing":    {},
+		"Whitespace": {},
+		"Comment":    {},
+		"EOL":        {},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+
+	b := &Builder{SkipRule: "Spacing", LexicalRules: got}
+	for _, r := range g.Rules {
+		_, lexical := want[r.Name.Val]
+		syntactic := !lexical && r.Name.Val != "ident"
+		if b.IsSyntactic(r) != syntactic {
+			t.Errorf("%s: want syntactic %t, got %t", r.Name.Val, syntactic, !syntactic)
+		}
+	}
+}
+
+func TestBuildParserUndefinedSkipRule(t *testing.T) {
+	p := bootstrap.NewParser()
+	g, err := p.Parse("", strings.NewReader(skipGrammar))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = BuildParser(io.Discard, g, SkipRule("Blank"))
+	if err == nil || !strings.Contains(err.Error(), `skip rule "Blank" is not defined`) {
+		t.Fatalf("want undefined skip rule error, got %v", err)
+	}
+}
+
+func TestLexicalRulesToken(t *testing.T) {
+	p := bootstrap.NewParser()
+	g, err := p.Parse("", strings.NewReader(skipGrammar))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Stmt is annotated with @token
+	stmt := g.Rules[1]
+	stmt.Annotations = []*ast.Annotation{ast.NewAnnotation(stmt.Pos(), ast.NewIdentifier(stmt.Pos(), "token"))}
+
+	got, err := LexicalRules(g, "Spacing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, nm := range []string{"Stmt", "ident", "Spacing"} {
+		if _, ok := got[nm]; !ok {
+			t.Errorf("want %s lexical", nm)
+		}
+	}
+	if _, ok := got["Program"]; ok {
+		t.Error("want Program syntactic")
+	}
+}
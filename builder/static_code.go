@@ -183,6 +183,9 @@ type rule struct {
 	displayName string
 	expr        any
 	varExists   bool
+	// ==template== {{ if .MemoRules }}
+	memoize     bool
+	// {{ end }} ==template==
 }
 
 // {{ if .Nolint }} nolint: structcheck {{else}} ==template== {{ end }}
@@ -236,6 +239,9 @@ type labeledExpr struct {
 	label string
 	expr  any
 	textCapture bool
+	// ==template== {{ if .Pluck }}
+	pluck bool
+	// {{ end }} ==template==
 }
 
 // {{ if .Nolint }} nolint: structcheck {{else}} ==template== {{ end }}
@@ -256,6 +262,27 @@ type (
 	oneOrMoreExpr  expr //{{ if .Nolint }} nolint: structcheck {{else}} ==template== {{ end }}
 )
 
+// ==template== {{ if .Pluck }}
+// {{ if .Nolint }} nolint: structcheck {{else}} ==template== {{ end }}
+type pluckExpr struct {
+	// ==template== {{ if .SetRulePos }}
+	pos position
+	// {{ end }} ==template==
+	exprs []any
+	pluck []int
+}
+
+// {{ end }} ==template==
+// ==template== {{ if .SkipRule }}
+// {{ if .Nolint }} nolint: structcheck {{else}} ==template== {{ end }}
+type skipExpr struct {
+	// ==template== {{ if .SetRulePos }}
+	pos position
+	// {{ end }} ==template==
+	expr any
+}
+
+// {{ end }} ==template==
 // {{ if .Nolint }} nolint: structcheck {{else}} ==template== {{ end }}
 type ruleRefExpr struct {
 	// ==template== {{ if .SetRulePos }}
@@ -333,6 +360,24 @@ type charClassMatcher struct {
 	inverted        bool
 }
 
+// ==template== {{ if .CharClassSet }}
+// {{ if .Nolint }} nolint: structcheck {{else}} ==template== {{ end }}
+type charClassSetMatcher struct {
+	// ==template== {{ if .SetRulePos }}
+	pos position
+	// {{ end }} ==template==
+	val        string
+	chars      []rune
+	ranges     []rune
+	classes    []*unicode.RangeTable
+	notClasses []*unicode.RangeTable
+	intersect  []*charClassSetMatcher
+	subtract   []*charClassSetMatcher
+	ignoreCase bool
+	inverted   bool
+}
+
+// {{ end }} ==template==
 // ==template== {{ if .SetRulePos }}
 type anyMatcher position //{{ if .Nolint }} nolint: structcheck {{else}} ==template== {{ end }}
 // {{ else }} ==template==
@@ -484,6 +529,11 @@ type parser struct {
 	scStack []bool
 	// save point stack
 	spStack parserStack
+	// ==template== {{ if .SkipRule }}
+
+	// rule applied implicitly before the tokens of syntactic rules
+	skipRule *rule
+	// {{ end }} ==template==
 }
 
 // newParser creates a parser with the specified input source and options.
@@ -630,6 +680,19 @@ func (p *parser) addErr(err error) {
 	}
 }
 
+// ==template== {{ if .TypedLabels }}
+// typedLabel converts the value of the label of a typed rule reference. A nil
+// value, e.g. of an action that returned nothing, is the zero value of T.
+func typedLabel[T any](p *parser, label string, v any) T {
+	t, ok := v.(T)
+	if !ok && v != nil {
+		want := strings.TrimPrefix(fmt.Sprintf("%T", (*T)(nil)), "*")
+		p.addErr(fmt.Errorf("label %s: want type %s, got %T", label, want, v))
+	}
+	return t
+}
+
+// {{ end }} ==template==
 func (p *parser) addErrAt(err error, pos position, expected []string) {
 	var buf bytes.Buffer
 	if p.filename != "" {
@@ -760,6 +823,9 @@ func (p *parser) parse(grammar map[string]*rule) (val any, err error) {
 		p.addErr(errInvalidEntrypoint)
 		return nil, p.errs.err()
 	}
+	// ==template== {{ if .SkipRule }}
+	p.skipRule = p.rules[{{ printf "%q" .SkipRule }}]
+	// {{ end }} ==template==
 
 	p.read() // advance to first rune
 	val, ok = p.parseRuleWrap(startRule)
@@ -841,6 +907,9 @@ func (p *parser) parse(grammar *grammar) (val any, err error) {
 		p.addErr(errInvalidEntrypoint)
 		return nil, p.errs.err()
 	}
+	// ==template== {{ if .SkipRule }}
+	p.skipRule = p.rules[{{ printf "%q" .SkipRule }}]
+	// {{ end }} ==template==
 
 	p.read() // advance to first rune
 	val, ok = p.parseRuleWrap(startRule)
@@ -901,6 +970,12 @@ func (p *parser) parseRuleWrap(rule *rule) (any, bool) {
 		// {{ end }} ==template==
 	)
 
+	// ==template== {{ if .MemoRules }}
+	if rule.memoize && !p.memoized {
+		p.memoized = true
+		defer func() { p.memoized = false }()
+	}
+	// {{ end }} ==template==
 	val, ok = p.parseRule(rule)
 
 	// ==template== {{ if not .Optimize }}
@@ -921,6 +996,12 @@ func (p *parser) parseRule(rule *rule) (any, bool) {
 }
 // {{ else }}
 func (p *parser) parseRuleWrap(rule *rule) (any, bool) {
+	// ==template== {{ if .MemoRules }}
+	if rule.memoize && !p.memoized {
+		p.memoized = true
+		defer func() { p.memoized = false }()
+	}
+	// {{ end }} ==template==
 	p.rstack = append(p.rstack, rule)
 	var val any
 	var ok bool
@@ -998,6 +1079,10 @@ func (p *parser) {{ .ParseExprName }}(expr any) (any, bool) {
 		val, ok = p.parseAnyMatcher(expr)
 	case *charClassMatcher:
 		val, ok = p.parseCharClassMatcher(expr)
+	// ==template== {{ if .CharClassSet }}
+	case *charClassSetMatcher:
+		val, ok = p.parseCharClassSetMatcher(expr)
+	// {{ end }} ==template==
 	case *choiceExpr:
 		val, ok = p.parseChoiceExpr(expr)
 	case *codeExpr:
@@ -1028,6 +1113,14 @@ func (p *parser) {{ .ParseExprName }}(expr any) (any, bool) {
 	// {{ end }} ==template==
 	case *seqExpr:
 		val, ok = p.parseSeqExpr(expr)
+	// ==template== {{ if .Pluck }}
+	case *pluckExpr:
+		val, ok = p.parsePluckExpr(expr)
+	// {{ end }} ==template==
+	// ==template== {{ if .SkipRule }}
+	case *skipExpr:
+		val, ok = p.parseSkipExpr(expr)
+	// {{ end }} ==template==
 	case *throwExpr:
 		val, ok = p.parseThrowExpr(expr)
 	case *zeroOrMoreExpr:
@@ -1200,6 +1293,84 @@ func (p *parser) parseCharClassMatcher(chr *charClassMatcher) (any, bool) {
 	return nil, false
 }
 
+// ==template== {{ if .CharClassSet }}
+func (p *parser) parseCharClassSetMatcher(chr *charClassSetMatcher) (any, bool) {
+	// ==template== {{ if not .Optimize }}
+	if p.debug {
+		defer p.out(p.in("parseCharClassSetMatcher"))
+	}
+
+	// {{ end }} ==template==
+	cur := p.pt.rn
+
+	// can't match EOF
+	if cur == utf8.RuneError && p.pt.w == 0 { // see utf8.DecodeRune
+		p.failAt(false, &p.pt.position, chr.val)
+		return nil, false
+	}
+
+	if chr.match(cur) {
+		p.failAt(true, &p.pt.position, chr.val)
+		p.read()
+		return nil, true
+	}
+	p.failAt(false, &p.pt.position, chr.val)
+	return nil, false
+}
+
+// match returns true if rn is in the set of characters of the class.
+func (chr *charClassSetMatcher) match(rn rune) bool {
+	if chr.ignoreCase {
+		rn = unicode.ToLower(rn)
+	}
+	in := chr.contains(rn)
+	if in {
+		for _, set := range chr.intersect {
+			if !set.match(rn) {
+				in = false
+				break
+			}
+		}
+	}
+	if in {
+		for _, set := range chr.subtract {
+			if set.match(rn) {
+				in = false
+				break
+			}
+		}
+	}
+	return in != chr.inverted
+}
+
+// contains returns true if rn is in the chars, ranges or Unicode classes of
+// the class, before the set operations are applied.
+func (chr *charClassSetMatcher) contains(rn rune) bool {
+	for _, c := range chr.chars {
+		if c == rn {
+			return true
+		}
+	}
+	for i := 0; i < len(chr.ranges); i += 2 {
+		if rn >= chr.ranges[i] && rn <= chr.ranges[i+1] {
+			return true
+		}
+	}
+	for _, cl := range chr.classes {
+		if unicode.Is(cl, rn) {
+			return true
+		}
+	}
+	for _, cl := range chr.notClasses {
+		if !unicode.Is(cl, rn) {
+			return true
+		}
+	}
+	return false
+}
+
+// {{ end }} ==template==
+
 // ==template== {{ if not .Optimize }}
 
 func (p *parser) incChoiceAltCnt(ch *choiceExpr, altI int) {
@@ -1258,6 +1429,12 @@ func (p *parser) parseLabeledExpr(lab *labeledExpr) (any, bool) {
 			m[lab.label] = val
 		}
 	}
+	// ==template== {{ if .Pluck }}
+	if ok && lab.pluck && !p.checkSkipCode() {
+		// a plucked text capture returns the captured text
+		val = string(p.sliceFromOffset(startOffset))
+	}
+	// {{ end }} ==template==
 	return val, ok
 }
 
@@ -1351,18 +1528,25 @@ func (p *parser) parseOneOrMoreExpr(expr *oneOrMoreExpr) (any, bool) {
 	var vals []any
 	var matched bool
 	for {
+		pos := p.pt.offset
 		val, ok := p.parseExprWrap(expr.expr)
 		if !ok {
-			if len(vals) > 0 {
-				return vals, matched
-			}
-			return nil, matched
+			break
 		}
 		matched = true
 		if val != nil {
 			vals = append(vals, val)
 		}
+		if p.pt.offset == pos {
+			// the expression matched without consuming input, it would
+			// match forever
+			break
+		}
+	}
+	if len(vals) > 0 {
+		return vals, matched
 	}
+	return nil, matched
 }
 
 func (p *parser) parseRecoveryExpr(recover *recoveryExpr) (any, bool) {
@@ -1433,6 +1617,70 @@ func (p *parser) parseSeqExpr(seq *seqExpr) (any, bool) {
 	return nil, true
 }
 
+// ==template== {{ if .Pluck }}
+// parsePluckExpr parses a sequence and returns the value of its plucked
+// expression, or a slice of the values if more than one is plucked.
+func (p *parser) parsePluckExpr(pluck *pluckExpr) (any, bool) {
+	// ==template== {{ if not .Optimize }}
+	if p.debug {
+		defer p.out(p.in("parsePluckExpr"))
+	}
+
+	// {{ end }} ==template==
+	skipCode := p.checkSkipCode()
+	vals := make([]any, 0, len(pluck.pluck))
+
+	pt := p.pt
+	for i, expr := range pluck.exprs {
+		val, ok := p.parseExprWrap(expr)
+		if !ok {
+			p.restore(&pt)
+			return nil, false
+		}
+		if len(vals) < len(pluck.pluck) && pluck.pluck[len(vals)] == i {
+			vals = append(vals, val)
+		}
+	}
+	if skipCode {
+		return nil, true
+	}
+	if len(vals) == 1 {
+		return vals[0], true
+	}
+	return vals, true
+}
+
+// {{ end }} ==template==
+// ==template== {{ if .SkipRule }}
+func (p *parser) parseSkipExpr(skip *skipExpr) (any, bool) {
+	// ==template== {{ if not .Optimize }}
+	if p.debug {
+		defer p.out(p.in("parseSkipExpr"))
+	}
+
+	// {{ end }} ==template==
+	pt := p.pt
+	p.parseSkipRule()
+	val, ok := p.parseExprWrap(skip.expr)
+	if !ok {
+		p.restore(&pt)
+	}
+	return val, ok
+}
+
+// parseSkipRule consumes the input matched by the skip rule. The code
+// blocks of the skip rule are not run and its value is discarded.
+func (p *parser) parseSkipRule() {
+	pt := p.pt
+	p.scStack = append(p.scStack, true)
+	_, ok := p.parseRuleWrap(p.skipRule)
+	p.scStack = p.scStack[:len(p.scStack)-1]
+	if !ok {
+		p.restore(&pt)
+	}
+}
+
+// {{ end }} ==template==
 func (p *parser) parseThrowExpr(expr *throwExpr) (any, bool) {
 	// ==template== {{ if not .Optimize }}
 	if p.debug {
@@ -1459,17 +1707,24 @@ func (p *parser) parseZeroOrMoreExpr(expr *zeroOrMoreExpr) (any, bool) {
 	// {{ end }} ==template==
 	var vals []any
 	for {
+		pos := p.pt.offset
 		val, ok := p.parseExprWrap(expr.expr)
 		if !ok {
-			if len(vals) > 0 {
-				return vals, true
-			}
-			return nil, true
+			break
 		}
 		if val != nil {
 			vals = append(vals, val)
 		}
+		if p.pt.offset == pos {
+			// the expression matched without consuming input, it would
+			// match forever
+			break
+		}
 	}
+	if len(vals) > 0 {
+		return vals, true
+	}
+	return nil, true
 }
 
 func (p *parser) parseZeroOrOneExpr(expr *zeroOrOneExpr) (any, bool) {
@@ -0,0 +1,44 @@
+package builder
+
+import (
+	"bytes"
+	"go/format"
+	"strings"
+	"testing"
+
+	"github.com/fy0/pigeon/ast"
+	"github.com/fy0/pigeon/bootstrap"
+)
+
+func TestBuildParserTypedRules(t *testing.T) {
+	grammar := `
+Sum = l:Num "+" r:Num { return l + r } / n:Num { return n }
+Num = [0-9]+ { return len(c.text) }
+`
+	p := bootstrap.NewParser()
+	g, err := p.Parse("", strings.NewReader(grammar))
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.Rules[1].Type = ast.NewGoType(ast.Pos{}, "int")
+
+	var buf bytes.Buffer
+	if err := BuildParser(&buf, g); err != nil {
+		t.Fatal(err)
+	}
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(src)
+	for _, want := range []string{
+		`func(c *current, l int, r int) any {`,
+		`typedLabel[int](p, "l", stack["l"]), typedLabel[int](p, "r", stack["r"])`,
+		"func(c *current) int {\n\t\treturn len(c.text)\n\t})",
+		`func typedLabel[T any](`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("want generated code to contain %q", want)
+		}
+	}
+}
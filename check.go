@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"strings"
+
+	"github.com/fy0/pigeon/diff"
+	"github.com/fy0/pigeon/staleparser"
+)
+
+// checkOutput compares the generated parser and its fuzz harness, if not
+// nil, with the files outfile and its fuzz test file. It returns the
+// unified diffs of the files that are not up to date, or nil.
+func checkOutput(outfile string, parser, fuzz []byte) ([]byte, error) {
+	diffs, err := checkFile(outfile, parser)
+	if err != nil || fuzz == nil {
+		return diffs, err
+	}
+	d, err := checkFile(fuzzTestName(outfile), fuzz)
+	return append(diffs, d...), err
+}
+
+// checkFile returns the unified diff from the file filename to the
+// generated content b, or nil if they are the same. A missing file is
+// compared as an empty one. The version of pigeon in the source header is
+// ignored, so that a parser does not need to be generated again for each
+// version.
+func checkFile(filename string, b []byte) ([]byte, error) {
+	old, err := os.ReadFile(filename)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if bytes.Equal(withoutVersion(old), withoutVersion(b)) {
+		return nil, nil
+	}
+	return diff.Unified(filename, filename+".new", old, b), nil
+}
+
+// withoutVersion returns the generated code b without the version of pigeon
+// in its source header.
+func withoutVersion(b []byte) []byte {
+	lines := bytes.Split(b, []byte("\n"))
+	for i, line := range lines {
+		if grammar, hash, _, ok := staleparser.ParseHeader(string(line)); ok {
+			lines[i] = []byte(staleparser.HeaderPrefix + grammar + " " + hash)
+			break
+		}
+		if strings.HasPrefix(string(line), "package ") {
+			break
+		}
+	}
+	return bytes.Join(lines, []byte("\n"))
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"reflect"
 	"strconv"
 	"testing"
 
@@ -49,6 +50,31 @@ func compareRule(t *testing.T, prefix string, exp, got *ast.Rule) bool {
 			return false
 		}
 	}
+	if (exp.Type != nil) != (got.Type != nil) {
+		t.Errorf("%q: want Type? %t, got %t", prefix, exp.Type != nil, got.Type != nil)
+		return false
+	}
+	if exp.Type != nil {
+		if exp.Type.Val != got.Type.Val {
+			t.Errorf("%q: want Type %q, got %q", prefix, exp.Type.Val, got.Type.Val)
+			return false
+		}
+	}
+	if len(exp.Annotations) != len(got.Annotations) {
+		t.Errorf("%q: want %d annotations, got %d", prefix, len(exp.Annotations), len(got.Annotations))
+		return false
+	}
+	for i, ea := range exp.Annotations {
+		ga := got.Annotations[i]
+		if ea.Name.Val != ga.Name.Val {
+			t.Errorf("%q: want annotation %d name %q, got %q", prefix, i, ea.Name.Val, ga.Name.Val)
+			return false
+		}
+		if !reflect.DeepEqual(ea.Args, ga.Args) {
+			t.Errorf("%q: want annotation %d args %q, got %q", prefix, i, ea.Args, ga.Args)
+			return false
+		}
+	}
 	return compareExpr(t, prefix, 0, exp.Expr, got.Expr)
 }
 
@@ -161,6 +187,55 @@ func compareExpr(t *testing.T, prefix string, ix int, exp, got ast.Expression) b
 			}
 		}
 
+		ne, ng = len(exp.NotUnicodeClasses), len(got.NotUnicodeClasses)
+		if ne != ng {
+			t.Errorf("%q: want %d NotUnicodeClasses, got %d", ixPrefix, ne, ng)
+			return false
+		}
+		for i, s := range exp.NotUnicodeClasses {
+			if s != got.NotUnicodeClasses[i] {
+				t.Errorf("%q: want NotUnicodeClasses[%d] %q, got %q", ixPrefix, i, s, got.NotUnicodeClasses[i])
+				return false
+			}
+		}
+
+		ne, ng = len(exp.Subtract), len(got.Subtract)
+		if ne != ng {
+			t.Errorf("%q: want %d Subtract, got %d", ixPrefix, ne, ng)
+			return false
+		}
+		for i, op := range exp.Subtract {
+			if !compareExpr(t, prefix, ix+1, op, got.Subtract[i]) {
+				return false
+			}
+		}
+
+		ne, ng = len(exp.Intersect), len(got.Intersect)
+		if ne != ng {
+			t.Errorf("%q: want %d Intersect, got %d", ixPrefix, ne, ng)
+			return false
+		}
+		for i, op := range exp.Intersect {
+			if !compareExpr(t, prefix, ix+1, op, got.Intersect[i]) {
+				return false
+			}
+		}
+
+	case *ast.CodeExpr:
+		got, ok := got.(*ast.CodeExpr)
+		if !ok {
+			t.Errorf("%q: want expression type %T, got %T", ixPrefix, exp, got)
+			return false
+		}
+		if exp.NotSkip != got.NotSkip {
+			t.Errorf("%q: want NotSkip %t, got %t", ixPrefix, exp.NotSkip, got.NotSkip)
+			return false
+		}
+		if exp.Code.Val != got.Code.Val {
+			t.Errorf("%q: want code %q, got %q", ixPrefix, exp.Code.Val, got.Code.Val)
+			return false
+		}
+
 	case *ast.ChoiceExpr:
 		got, ok := got.(*ast.ChoiceExpr)
 		if !ok {
@@ -195,6 +270,14 @@ func compareExpr(t *testing.T, prefix string, ix int, exp, got ast.Expression) b
 				return false
 			}
 		}
+		if exp.Pluck != got.Pluck {
+			t.Errorf("%q: want Pluck %t, got %t", ixPrefix, exp.Pluck, got.Pluck)
+			return false
+		}
+		if exp.TextCapture != got.TextCapture {
+			t.Errorf("%q: want TextCapture %t, got %t", ixPrefix, exp.TextCapture, got.TextCapture)
+			return false
+		}
 
 		return compareExpr(t, prefix, ix+1, exp.Expr, got.Expr)
 
@@ -246,6 +329,21 @@ func compareExpr(t *testing.T, prefix string, ix int, exp, got ast.Expression) b
 		}
 		return compareExpr(t, prefix, ix+1, exp.Expr, got.Expr)
 
+	case *ast.RecoveryExpr:
+		got, ok := got.(*ast.RecoveryExpr)
+		if !ok {
+			t.Errorf("%q: want expression type %T, got %T", ixPrefix, exp, got)
+			return false
+		}
+		if !reflect.DeepEqual(exp.Labels, got.Labels) {
+			t.Errorf("%q: want labels %v, got %v", ixPrefix, exp.Labels, got.Labels)
+			return false
+		}
+		if !compareExpr(t, prefix, ix+1, exp.Expr, got.Expr) {
+			return false
+		}
+		return compareExpr(t, prefix, ix+1, exp.RecoverExpr, got.RecoverExpr)
+
 	case *ast.RuleRefExpr:
 		got, ok := got.(*ast.RuleRefExpr)
 		if !ok {
@@ -281,6 +379,17 @@ func compareExpr(t *testing.T, prefix string, ix int, exp, got ast.Expression) b
 			}
 		}
 
+	case *ast.ThrowExpr:
+		got, ok := got.(*ast.ThrowExpr)
+		if !ok {
+			t.Errorf("%q: want expression type %T, got %T", ixPrefix, exp, got)
+			return false
+		}
+		if exp.Label != got.Label {
+			t.Errorf("%q: want label %q, got %q", ixPrefix, exp.Label, got.Label)
+			return false
+		}
+
 	case *ast.ZeroOrMoreExpr:
 		got, ok := got.(*ast.ZeroOrMoreExpr)
 		if !ok {
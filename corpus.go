@@ -0,0 +1,193 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+
+	"github.com/fy0/pigeon/ast"
+	"github.com/fy0/pigeon/corpus"
+	"github.com/fy0/pigeon/diff"
+	"github.com/fy0/pigeon/interp"
+)
+
+var testUsagePage = `usage: %[1]s test [options] GRAMMAR_FILE CORPUS...
+
+Test runs the cases of the corpus files against the PEG grammar of
+GRAMMAR_FILE, parsing their input as the run command does, and prints the
+diff between the expected and the actual result of the failing cases.
+CORPUS is a corpus file or a directory, whose .txt files are corpus files.
+
+A corpus file is a list of cases in the format of the tree-sitter corpus
+files:
+
+	==================
+	Name of the case
+	:rule NAME
+	==================
+	input
+	---
+	expected result
+
+The header lines are made of 3 or more '=', the separator line of 3 or more
+'-'. The optional attribute lines after the name set the rule used to
+parse the input (":rule NAME") or skip the case (":skip"). The input ends
+with the newline before the separator. The expected result is either "ok",
+for an input that must match without error, or the tree of the matched
+rules, as printed by the run command, or "no match", followed by the
+errors, one per line and without filename.
+
+The exit code is 0 if all the cases pass, 10 if a case fails, 9 if the
+grammar has errors, 3 if the grammar or a corpus file cannot be parsed, 2 if
+a file cannot be opened, 1 if the arguments are invalid and 7 if a corpus
+file cannot be updated.
+
+The following options can be specified:
+
+	-h -help
+		display this help message.
+	-memoize
+		memoize the results of the expressions, as the Memoize option of
+		the generated parser.
+	-run REGEXP
+		run only the cases whose name matches REGEXP.
+	-skip-rule NAME
+		name of the rule applied implicitly before each token, as for
+		the generation of the parser.
+	-update
+		write the actual results of the failing cases in the corpus
+		files instead of reporting them.
+	-v
+		print the name of the passing and skipped cases too.
+`
+
+// testMain implements the test command.
+func testMain(args []string) {
+	fs := flag.NewFlagSet(os.Args[0]+" test", flag.ExitOnError)
+	var (
+		shortHelpFlag = fs.Bool("h", false, "show help page")
+		longHelpFlag  = fs.Bool("help", false, "show help page")
+		memoizeFlag   = fs.Bool("memoize", false, "memoize the results of the expressions")
+		runFlag       = fs.String("run", "", "run only the cases whose name matches `REGEXP`")
+		skipRuleFlag  = fs.String("skip-rule", "", "rule applied implicitly before each token")
+		updateFlag    = fs.Bool("update", false, "write the actual results of the failing cases")
+		verboseFlag   = fs.Bool("v", false, "print the passing and skipped cases")
+	)
+	fs.Usage = func() {
+		fmt.Printf(testUsagePage, os.Args[0])
+	}
+	if err := fs.Parse(args); err != nil {
+		fmt.Fprintf(os.Stderr, "args parse error:\n%v\n", err)
+		exit(6)
+	}
+
+	if *shortHelpFlag || *longHelpFlag {
+		fs.Usage()
+		exit(0)
+	}
+	if fs.NArg() < 2 {
+		fmt.Fprintf(os.Stderr, "expected a grammar and corpus files, got %q\n", fs.Args())
+		fs.Usage()
+		exit(1)
+	}
+	filter, err := regexp.Compile(*runFlag)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "invalid -run regexp:", err)
+		exit(1)
+	}
+
+	nm, rc := input(fs.Arg(0))
+	g, err := ParseReader(nm, rc)
+	rc.Close()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "parse error(s):\n%v\n", err)
+		exit(3)
+	}
+	in, err := interp.New(g.(*ast.Grammar), interp.Options{SkipRule: *skipRuleFlag})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "grammar error(s):\n%v\n", err)
+		exit(9)
+	}
+
+	var total, failed, skipped int
+	for _, file := range corpusFiles(fs.Args()[1:]) {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			exit(2)
+		}
+		cases, err := corpus.Parse(file, b)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "parse error(s):\n%v\n", err)
+			exit(3)
+		}
+
+		updated := 0
+		for _, c := range cases {
+			if c.Skip || !filter.MatchString(c.Name) {
+				skipped++
+				if *verboseFlag {
+					fmt.Printf("--- SKIP: %s:%d: %s\n", file, c.Line, c.Name)
+				}
+				continue
+			}
+			total++
+			got, pass := corpus.Run(in, c, interp.Memoize(*memoizeFlag))
+			switch {
+			case pass:
+				if *verboseFlag {
+					fmt.Printf("--- PASS: %s:%d: %s\n", file, c.Line, c.Name)
+				}
+			case *updateFlag:
+				c.Want = got
+				updated++
+			default:
+				failed++
+				fmt.Printf("--- FAIL: %s:%d: %s\n", file, c.Line, c.Name)
+				os.Stdout.Write(diff.Unified("want", "got", []byte(c.Want+"\n"), []byte(got+"\n")))
+			}
+		}
+
+		if updated > 0 {
+			if err := os.WriteFile(file, corpus.Update(b, cases), 0644); err != nil {
+				fmt.Fprintf(os.Stderr, "write error: %v\n", err)
+				exit(7)
+			}
+			fmt.Printf("updated %s: %d case(s)\n", file, updated)
+		}
+	}
+
+	if failed > 0 {
+		fmt.Printf("FAIL: %d of %d case(s) failed, %d skipped\n", failed, total, skipped)
+		exit(10)
+	}
+	fmt.Printf("ok: %d case(s) passed, %d skipped\n", total, skipped)
+}
+
+// corpusFiles returns the corpus files of args, replacing the directories
+// by their .txt files.
+func corpusFiles(args []string) []string {
+	var files []string
+	for _, arg := range args {
+		fi, err := os.Stat(arg)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			exit(2)
+		}
+		if !fi.IsDir() {
+			files = append(files, arg)
+			continue
+		}
+		matches, err := filepath.Glob(filepath.Join(arg, "*.txt"))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			exit(2)
+		}
+		sort.Strings(matches)
+		files = append(files, matches...)
+	}
+	return files
+}
@@ -0,0 +1,190 @@
+// Package corpus reads and runs corpus files: test cases of a grammar with
+// a name, an input and the expected result of its parsing, in the format of
+// the tree-sitter corpus files:
+//
+//	==================
+//	Name of the case
+//	==================
+//	input
+//	---
+//	expected result
+//
+// The header lines are made of 3 or more '=', the separator line of 3 or
+// more '-'. The input is the text between the header and the first
+// separator line, without the newline that ends it. The expected result is
+// the text up to the next header, without the trailing blank lines. It is
+// either "ok", for an input that must match without error, or the result
+// of the parsing, as returned by Run: the tree of the matched rules, or
+// "no match", followed by the errors.
+//
+// Lines starting with a colon after the name are attributes of the case:
+// ":rule NAME" parses the input with the rule NAME instead of the first
+// rule of the grammar, and ":skip" skips the case.
+package corpus
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/fy0/pigeon/interp"
+)
+
+// OK is the expected result of the inputs that must match without error.
+const OK = "ok"
+
+// Case is a test case of a corpus file.
+type Case struct {
+	Name string
+	// Line is the line of the first header line of the case.
+	Line int
+	// Rule is the rule used to parse the input, the first rule of the
+	// grammar if it is empty.
+	Rule  string
+	Skip  bool
+	Input string
+	Want  string
+
+	// start and end are the offsets of the expected result in the file.
+	start, end int
+}
+
+// Parse returns the cases of the corpus file b.
+func Parse(filename string, b []byte) ([]*Case, error) {
+	var (
+		cases []*Case
+		cur   *Case
+		state int // 0: before a header, 1: name, 2: input, 3: expected
+		input int // offset of the input
+		last  int // end offset of the last non-blank line of the expected result
+	)
+	end := func() {
+		if cur != nil && state == 3 {
+			cur.end = last
+			if cur.end < cur.start {
+				cur.end = cur.start
+			}
+			cur.Want = string(b[cur.start:cur.end])
+		}
+	}
+	errorf := func(line int, format string, args ...any) error {
+		return fmt.Errorf("%s:%d: %s", filename, line, fmt.Sprintf(format, args...))
+	}
+
+	off := 0
+	for ln := 1; off < len(b); ln++ {
+		next := bytes.IndexByte(b[off:], '\n')
+		if next < 0 {
+			next = len(b)
+		} else {
+			next += off + 1
+		}
+		line := strings.TrimRight(string(b[off:next]), "\r\n")
+
+		switch {
+		case state == 1:
+			if isBar(line, '=') {
+				if cur.Name == "" {
+					return nil, errorf(ln, "missing name of the case")
+				}
+				state, input = 2, next
+				break
+			}
+			if attr, ok := strings.CutPrefix(line, ":"); ok && cur.Name != "" {
+				name, arg, _ := strings.Cut(strings.TrimSpace(attr), " ")
+				switch name {
+				case "rule":
+					cur.Rule = strings.TrimSpace(arg)
+				case "skip":
+					cur.Skip = true
+				default:
+					return nil, errorf(ln, "unknown attribute :%s", name)
+				}
+				break
+			}
+			if cur.Name != "" {
+				return nil, errorf(ln, "want a header line after the name of the case")
+			}
+			cur.Name = strings.TrimSpace(line)
+		case state == 2:
+			if isBar(line, '-') {
+				cur.Input = strings.TrimSuffix(strings.TrimSuffix(string(b[input:off]), "\n"), "\r")
+				cur.start, last, state = next, next, 3
+			}
+		case isBar(line, '=') && (state == 0 || state == 3):
+			end()
+			cur = &Case{Line: ln}
+			cases = append(cases, cur)
+			state = 1
+		case state == 3:
+			if strings.TrimSpace(line) != "" {
+				last = off + len(line)
+			}
+		default:
+			if strings.TrimSpace(line) != "" {
+				return nil, errorf(ln, "want a header line")
+			}
+		}
+		off = next
+	}
+
+	switch state {
+	case 1:
+		return nil, errorf(cur.Line, "missing header line after the name of the case")
+	case 2:
+		return nil, errorf(cur.Line, "missing separator line after the input of %q", cur.Name)
+	}
+	end()
+	return cases, nil
+}
+
+// isBar returns true if line is made of 3 or more c.
+func isBar(line string, c byte) bool {
+	return len(line) >= 3 && strings.Trim(line, string(c)) == ""
+}
+
+// Run parses the input of c with in and returns the result, as written in
+// the corpus files: the tree of the matched rules, or "no match", then the
+// errors, one per line, without a trailing newline. The errors have no
+// filename. It also returns true if the result is the expected one.
+func Run(in *interp.Interpreter, c *Case, opts ...interp.ParseOption) (got string, pass bool) {
+	if c.Rule != "" {
+		opts = append(opts, interp.Entrypoint(c.Rule))
+	}
+	node, err := in.Parse("", []byte(c.Input), opts...)
+
+	var buf strings.Builder
+	if node != nil {
+		buf.WriteString(node.String())
+	} else {
+		buf.WriteString("no match\n")
+	}
+	if err != nil {
+		buf.WriteString(err.Error())
+	}
+	got = strings.TrimRight(buf.String(), "\n")
+	if c.Want == OK {
+		return got, node != nil && err == nil
+	}
+	return got, got == c.Want
+}
+
+// Update returns the corpus file b with the expected results of the cases
+// replaced by their Want field. The cases must be the ones returned by
+// Parse for b, in the same order.
+func Update(b []byte, cases []*Case) []byte {
+	var buf bytes.Buffer
+	off := 0
+	for _, c := range cases {
+		buf.Write(b[off:c.start])
+		buf.WriteString(c.Want)
+		// An empty expected result or one at the end of the file has no
+		// newline to end the new one.
+		if c.Want != "" && (c.end == c.start || c.end == len(b)) {
+			buf.WriteByte('\n')
+		}
+		off = c.end
+	}
+	buf.Write(b[off:])
+	return buf.Bytes()
+}
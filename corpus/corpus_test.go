@@ -0,0 +1,134 @@
+package corpus
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/fy0/pigeon/bootstrap"
+	"github.com/fy0/pigeon/interp"
+)
+
+const file = `
+=====
+One
+=====
+a
+---
+ok
+
+=====
+Two lines
+:rule List
+:skip
+=====
+a
+b
+
+-----
+List 1:1-3:0 "a\nb\n"
+
+=====
+Empty
+=====
+---
+====
+Last
+====
+b
+---
+no match`
+
+func TestParse(t *testing.T) {
+	cases, err := Parse("file", []byte(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Case{
+		{Name: "One", Line: 2, Input: "a", Want: "ok"},
+		{Name: "Two lines", Line: 9, Rule: "List", Skip: true, Input: "a\nb\n", Want: `List 1:1-3:0 "a\nb\n"`},
+		{Name: "Empty", Line: 20, Input: "", Want: ""},
+		{Name: "Last", Line: 24, Input: "b", Want: "no match"},
+	}
+	if len(cases) != len(want) {
+		t.Fatalf("want %d cases, got %d", len(want), len(cases))
+	}
+	for i, c := range cases {
+		w := want[i]
+		if c.Name != w.Name || c.Line != w.Line || c.Rule != w.Rule || c.Skip != w.Skip ||
+			c.Input != w.Input || c.Want != w.Want {
+			t.Errorf("%d: want %+v, got %+v", i, w, *c)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	cases := []struct {
+		in, err string
+	}{
+		{in: "a\n===\n", err: "file:1: want a header line"},
+		{in: "===\n===\n", err: "file:2: missing name of the case"},
+		{in: "===\nA\nB\n", err: "file:3: want a header line after the name of the case"},
+		{in: "===\nA\n:nope\n===\n", err: "file:3: unknown attribute :nope"},
+		{in: "===\nA\n", err: "file:1: missing header line after the name of the case"},
+		{in: "===\nA\n===\na\n", err: `file:1: missing separator line after the input of "A"`},
+	}
+	for _, tc := range cases {
+		_, err := Parse("file", []byte(tc.in))
+		if err == nil || err.Error() != tc.err {
+			t.Errorf("%q: want error %q, got %v", tc.in, tc.err, err)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	g, err := bootstrap.NewParser().Parse("", strings.NewReader(`
+List = Item ( ',' Item )* !.
+Item = [a-z]+
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	in, err := interp.New(g, interp.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		c    Case
+		got  string
+		pass bool
+	}{
+		{c: Case{Input: "a", Want: OK}, got: "List 1:1-1:2 \"a\"\n  Item 1:1-1:2 \"a\"", pass: true},
+		{c: Case{Input: "a,", Want: OK}, got: "no match\n1:3 (2): no match found, expected: [a-z]"},
+		{c: Case{Input: "ab", Rule: "Item", Want: `Item 1:1-1:3 "ab"`}, got: `Item 1:1-1:3 "ab"`, pass: true},
+		{c: Case{Input: "ab", Rule: "Item", Want: "no match"}, got: `Item 1:1-1:3 "ab"`},
+	}
+	for _, tc := range cases {
+		got, pass := Run(in, &tc.c)
+		if got != tc.got || pass != tc.pass {
+			t.Errorf("%q: want %q %t, got %q %t", tc.c.Input, tc.got, tc.pass, got, pass)
+		}
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	cases, err := Parse("file", []byte(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases[0].Want = "A 1:1-1:2 \"a\"\n  B 1:1-1:2 \"a\""
+	cases[2].Want = "no match"
+	cases[3].Want = "ok"
+	want := strings.Replace(file, "---\nok\n", "---\nA 1:1-1:2 \"a\"\n  B 1:1-1:2 \"a\"\n", 1)
+	want = strings.Replace(want, "---\n====\n", "---\nno match\n====\n", 1)
+	want = strings.TrimSuffix(want, "no match") + "ok\n"
+	if got := string(Update([]byte(file), cases)); got != want {
+		t.Errorf("want\n%s\ngot\n%s", want, got)
+	}
+
+	// The file is unchanged without new results.
+	cases, _ = Parse("file", []byte(want))
+	if got := string(Update([]byte(want), cases)); got != want {
+		t.Errorf("want\n%s\ngot\n%s", want, got)
+	}
+}
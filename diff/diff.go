@@ -0,0 +1,175 @@
+// Package diff computes the differences between two texts, in the unified
+// format of the diff command.
+package diff
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// Context is the number of unchanged lines surrounding the changes in the
+// hunks of a unified diff.
+const Context = 3
+
+// op is an operation of an edit script: an unchanged line (' '), a deleted
+// line ('-') or an inserted line ('+').
+type op struct {
+	kind byte
+	line string
+}
+
+// Unified returns the unified diff transforming the text old, named
+// oldName, into the text new, named newName. It returns nil if the texts
+// are equal.
+func Unified(oldName, newName string, old, new []byte) []byte {
+	if bytes.Equal(old, new) {
+		return nil
+	}
+	ops := edits(lines(old), lines(new))
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "--- %s\n+++ %s\n", oldName, newName)
+	oldLine, newLine := 1, 1
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			oldLine++
+			newLine++
+			i++
+			continue
+		}
+
+		// the hunk starts with the context preceding the change, and ends
+		// with the context following the last change that is separated from
+		// the previous one by at most 2*Context unchanged lines
+		start := i
+		for start > 0 && i-start < Context {
+			start--
+		}
+		last := i
+		for j := i + 1; j < len(ops) && j-last-1 <= 2*Context; j++ {
+			if ops[j].kind != ' ' {
+				last = j
+			}
+		}
+		end := last + 1 + Context
+		if end > len(ops) {
+			end = len(ops)
+		}
+
+		oldStart, newStart := oldLine-(i-start), newLine-(i-start)
+		var oldCount, newCount int
+		for _, o := range ops[start:end] {
+			if o.kind != '+' {
+				oldCount++
+			}
+			if o.kind != '-' {
+				newCount++
+			}
+		}
+		fmt.Fprintf(&buf, "@@ -%s +%s @@\n", hunkRange(oldStart, oldCount), hunkRange(newStart, newCount))
+		for _, o := range ops[start:end] {
+			buf.WriteByte(o.kind)
+			buf.WriteString(o.line)
+			if !strings.HasSuffix(o.line, "\n") {
+				buf.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		oldLine, newLine = oldStart+oldCount, newStart+newCount
+		i = end
+	}
+	return buf.Bytes()
+}
+
+// hunkRange returns the range of lines of a hunk header, starting at line
+// start and containing count lines.
+func hunkRange(start, count int) string {
+	if count == 0 {
+		// an empty range is identified by the line preceding it
+		return fmt.Sprintf("%d,0", start-1)
+	}
+	if count == 1 {
+		return fmt.Sprint(start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+// lines splits text in lines, including their terminating newline.
+func lines(text []byte) []string {
+	var ls []string
+	for len(text) > 0 {
+		i := bytes.IndexByte(text, '\n') + 1
+		if i == 0 {
+			i = len(text)
+		}
+		ls = append(ls, string(text[:i]))
+		text = text[i:]
+	}
+	return ls
+}
+
+// edits returns the shortest edit script transforming the lines a into
+// the lines b, computed with the Myers algorithm.
+func edits(a, b []string) []op {
+	n, m := len(a), len(b)
+	max := n + m
+	v := make([]int, 2*max+2)
+	// trace[d] holds the furthest reaching x of the diagonals k in [-d, d]
+	// before the step d, at index k+d
+	var trace [][]int
+	d := 0
+search:
+	for ; d <= max; d++ {
+		trace = append(trace, append([]int(nil), v[max-d:max+d+1]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || k != d && v[max+k-1] < v[max+k+1] {
+				x = v[max+k+1]
+			} else {
+				x = v[max+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[max+k] = x
+			if x >= n && y >= m {
+				break search
+			}
+		}
+	}
+
+	var ops []op
+	x, y := n, m
+	for ; d >= 0; d-- {
+		prevX, prevY := 0, 0
+		if d > 0 {
+			vd := trace[d]
+			k := x - y
+			prevK := k - 1
+			if k == -d || k != d && vd[k-1+d] < vd[k+1+d] {
+				prevK = k + 1
+			}
+			prevX = vd[prevK+d]
+			prevY = prevX - prevK
+		}
+		for x > prevX && y > prevY {
+			x--
+			y--
+			ops = append(ops, op{' ', a[x]})
+		}
+		if d > 0 {
+			if x == prevX {
+				ops = append(ops, op{'+', b[prevY]})
+			} else {
+				ops = append(ops, op{'-', a[prevX]})
+			}
+			x, y = prevX, prevY
+		}
+	}
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
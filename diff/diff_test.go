@@ -0,0 +1,31 @@
+package diff
+
+import "testing"
+
+func TestUnified(t *testing.T) {
+	cases := []struct {
+		old, new, want string
+	}{
+		{"a\nb\n", "a\nb\n", ""},
+		{"a\nb\nc\n", "a\nx\nc\n", "--- old\n+++ new\n@@ -1,3 +1,3 @@\n a\n-b\n+x\n c\n"},
+		{"", "a\n", "--- old\n+++ new\n@@ -0,0 +1 @@\n+a\n"},
+		{"a\n", "", "--- old\n+++ new\n@@ -1 +0,0 @@\n-a\n"},
+		{"a\nb", "a\nb\n", "--- old\n+++ new\n@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+b\n"},
+		{
+			"1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n",
+			"x\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\ny\n",
+			"--- old\n+++ new\n@@ -1,4 +1,4 @@\n-1\n+x\n 2\n 3\n 4\n@@ -9,4 +9,4 @@\n 9\n 10\n 11\n-12\n+y\n",
+		},
+		{
+			"1\n2\n3\n4\n5\n6\n7\n8\n",
+			"1\nx\n3\n4\n5\n6\n7\ny\n",
+			"--- old\n+++ new\n@@ -1,8 +1,8 @@\n 1\n-2\n+x\n 3\n 4\n 5\n 6\n 7\n-8\n+y\n",
+		},
+	}
+	for i, c := range cases {
+		got := string(Unified("old", "new", []byte(c.old), []byte(c.new)))
+		if got != c.want {
+			t.Errorf("%d: want\n%s\ngot\n%s", i, c.want, got)
+		}
+	}
+}
@@ -27,6 +27,41 @@ file or read from stdin. The generated parser is written to stdout
 by default.
 
 	pigeon [options] [GRAMMAR_FILE]
+	pigeon [options] GRAMMAR_FILE|DIR...
+
+With several grammar files, a directory or the -outdir flag, pigeon
+generates the parsers in batch mode: the directories are replaced by their
+.peg files, and the parser of each grammar is written next to it with the
+.go extension, e.g. parser.go for parser.peg, or in the -outdir directory.
+The grammars are generated in parallel, and the errors are reported for
+each grammar once all of them are done. The parsers written to a file
+start with a source header after the code generated comment:
+
+	//pigeon:source grammar.peg sha256:<hash> <version>
+
+It records the path of the grammar relative to the parser, the hash of the
+grammar and the version of pigeon, and it is followed by the effective
+generation options (see below). In batch mode, the grammars whose existing
+parser has the same header are skipped, so that a go:generate directive
+regenerating many grammars only generates the ones that changed. The
+staleparser package defines an analyzer reporting the parsers whose
+grammar changed since they were generated, e.g. for go vet.
+
+The generation options may also be set in the grammar, in options lines
+among the comments at the start of the grammar file:
+
+	//pigeon:options -optimize-parser -grammar-name=expr
+	//pigeon:options -alternate-entrypoints=Term,Factor
+
+The options are the flags -alternate-entrypoints, -cache, -grammar-name,
+-grammar-only, -line-directives, -nolint, -optimize-grammar,
+-optimize-parser, -optimize-ref-expr-by-index, -receiver-name,
+-run-func-prefix and -skip-rule, with the same syntax. The flags set on
+the command line win over the options of the grammar. The effective
+options that differ from the defaults are recorded in an options line in
+the header of the generated parsers, after the source line of the parsers
+written to a file, so that the parser can be generated again with the same
+configuration.
 
 The following options can be specified:
 
@@ -47,6 +82,12 @@ The following options can be specified:
 	-o=FILE : string, output file where the generated parser will be
 	written (default: stdout).
 
+	-optimize-grammar : boolean, if set, optimize the grammar before generating
+	the parser: the rules without references and the rules annotated with
+	@inline are inlined, the unused rules are removed and the literals and
+	character classes are combined. The results of the generated parser are
+	unchanged, but its error messages may differ (default: false).
+
 	-optimize-parser : boolean, if set, the options Debug, Memoize and Statistics are
 	removed	from the resulting parser. The global "state" is optimized as well by
 	either removing all related code if no state change expression is present in the
@@ -61,6 +102,53 @@ The following options can be specified:
 	code blocks. Non-initializer code blocks in the grammar end up as methods on the
 	*current type, and this option sets the name of the receiver (default: c).
 
+	-skip-rule=NAME : string, name of the rule that is applied implicitly
+	before each token of the syntactic rules (see below, section "Implicit
+	skipping") (default: none).
+
+	-line-directives : boolean, if set, add //line directives before the code
+	blocks in the generated parser, with their line in the grammar, and after
+	them, restoring the line in the generated file. Panics, stack traces,
+	coverage and compile errors of the code blocks then point to the grammar.
+	The directives are relative to the directory of the generated file, which
+	is assumed to be the directory of the grammar if -o is not set
+	(default: false).
+
+	-typecheck : boolean, if set, type-check the code blocks of the grammar
+	with the generated parser, using go/types, before writing it. If -o is set,
+	the parser is checked as this file of its package, along with the other
+	files of the package, otherwise it is checked alone. The errors in code
+	blocks are reported at their position in the grammar, e.g.
+	"grammar.peg:42:17: undefined: foo", the other ones at their position in
+	the unformatted generated code. Pigeon exits with the code 11 and the
+	parser is not written if there are errors (default: false).
+
+	-fuzz-test : boolean, if set, write a fuzz harness of the parser in the
+	_test.go file named after the output file, e.g. parser_fuzz_test.go for
+	-o parser.go, which is required. Its FuzzParse target checks, for each
+	entrypoint, that the parser does not panic, that the positions of the
+	errors are within the input and that the memoized and non-memoized parses
+	agree on the success and the value. It is seeded with the files of the
+	testdata directory, and with the Go fuzzing corpus of
+	testdata/fuzz/FuzzParse, e.g. written by the gen command. The package
+	name is the one of the init code block (default: false).
+
+	-check : boolean, if set, generate the parser in memory and compare it
+	with the existing output file, and its fuzz harness if -fuzz-test is set,
+	instead of writing them. The unified diffs of the files that are not up
+	to date are printed to stdout and pigeon exits with the code 10. The
+	version of pigeon in the source header is ignored. Requires -o, or the
+	batch mode (default: false).
+
+	-outdir=DIR : string, in batch mode, directory where the parsers are
+	written instead of next to their grammar (default: none).
+
+	-j=N : int, in batch mode, number of grammars generated in parallel
+	(default: the number of CPUs).
+
+	-force : boolean, in batch mode, generate the parsers even if their
+	source header is up to date (default: false).
+
 	-alternate-entrypoints=RULE[,RULE...] : string, comma-separated list of rule names
 	that may be used as alternate entrypoints for the parser, in addition to the
 	default entrypoint (the first rule in the grammar) (default: none).
@@ -69,6 +157,159 @@ The following options can be specified:
 	necessary if the -optimize-parser flag is set, as some rules may be optimized
 	out of the resulting parser.
 
+The lint command reports the issues of a grammar found by static checks,
+one per line with its position and the name of the check, or as a JSON
+array with the -json flag:
+
+	pigeon lint [-json] [-disable CHECK,...] [-alternate-entrypoints RULE,...]
+		[-skip-rule NAME] [GRAMMAR_FILE]
+
+It exits with the code 0 if no issue is found, 10 if any issue is found and
+3 if the grammar cannot be parsed, so it can be used as a CI step. The checks
+are:
+
+	undefined-rule        references to undefined rules
+	nullable-repetition   repetitions of expressions matching the empty input
+	duplicate-rule        rules defined more than once
+	unused-rule           rules not reachable from an entrypoint (the first
+	                      rule, the alternate entrypoints, the @export rules
+	                      and the skip rule)
+	missing-display-name  rules without a display name whose code blocks add
+	                      errors, the errors would show the rule name
+	unused-label          labels not used by a code block of their scope
+	shadowed-label        labels with the name of another label of an outer
+	                      or the same scope in the rule
+	uncaught-throw        labels thrown (%{label}) that no recovery
+	                      expression catches
+	unreachable-code      statements of code blocks following a return, a
+	                      panic or a branch statement
+	shadowed-alternative  alternatives of a choice that can never match
+
+The alternatives of a choice expression that can never match are reported
+because a previous alternative is identical, always matches, or matches
+whenever they would, e.g. "==" in "=" / "==", or Keyword in Ident / Keyword
+if the keywords are matched by Ident.
+
+The ebnf command converts a grammar to EBNF, in the notation of the W3C (as
+used in the XML specification) or of the ISO/IEC 14977 standard:
+
+	pigeon ebnf [-notation w3c|iso] [-o OUTPUT_FILE] [GRAMMAR_FILE]
+
+The actions and state code blocks are stripped, the labels are dropped and
+the ignore-case literals and character classes are expanded to both cases.
+The constructs of PEG that have no EBNF equivalent, such as the predicates
+(&, !, &&, !!, &{} and !{}), the throw and recovery expressions and the
+Unicode classes, are written as comments (or special sequences in ISO
+notation) and reported as warnings on stderr.
+
+The fmt command formats grammars in the canonical layout, like gofmt does
+for Go source:
+
+	pigeon fmt [-l] [-d] [-w] [GRAMMAR_FILE...]
+
+The rule definition operators of consecutive single-line rules are aligned,
+the alternatives of a top-level choice that does not fit on a line of 80
+characters, or that contains comments or multi-line code blocks, are written
+one per line, the string literals are double-quoted and all the rules use
+the definition operator of the first one. The code blocks and the comments
+are kept byte-for-byte. The block comments on a single line between two
+expressions stay in place, the other comments inside an expression are moved
+to the end of the line of the rule or of the alternative that contains them,
+or before it if they span several lines. Formatting a formatted
+grammar does not change it. The formatted grammars are written to stdout,
+or back to their file with -w. With -l or -d, the files whose formatting
+differs are listed or their diff is printed, and the exit code is 10 if
+there is any, so it can be used as a CI step.
+
+The gen command generates random sentences of a grammar, e.g. to seed the
+fuzzing of the generated parser with inputs that reach deep rules:
+
+	pigeon gen [-n N] [-seed N] [-depth N] [-length N] [-repeat N]
+		[-weight RULE=W,...] [-entrypoint RULE] [-skip-rule NAME]
+		[-quote] [-fuzz-dir DIR] GRAMMAR_FILE
+
+The choices pick a random alternative, weighted with -weight for the
+top-level choice of a rule, and the repetitions repeat their expression up
+to -repeat times. Once the depth budget of nested rules or the length
+budget is spent, the sentences are ended as soon as possible. The sentences
+that do not match the grammar, e.g. because of a predicate, are rejected.
+With -fuzz-dir, the sentences are written as files of the Go fuzzing corpus
+of a fuzz target with a []byte argument. The generator is available as the
+sentence package.
+
+The graph command writes the rule reference graph of a grammar, in the
+Graphviz DOT language or in JSON:
+
+	pigeon graph [-format dot|json] [-alternate-entrypoints RULE,...]
+		[-skip-rule NAME] [-o OUTPUT_FILE] [GRAMMAR_FILE]
+
+The graph marks the entrypoints, the rules that are not reachable from an
+entrypoint, the strongly connected components of mutually recursive rules
+and the left-recursive rules and references, with the leader of each
+left-recursive cycle. In DOT, the entrypoints have a double border, the
+unreachable rules are dashed and grey, the components are clusters and the
+left recursion is red, with the leaders in bold.
+
+The railroad command renders the rules of a grammar as railroad (syntax)
+diagrams, in a self-contained HTML document with an SVG diagram per rule:
+
+	pigeon railroad [-hide-code] [-title TITLE] [-rule NAME] [-o OUTPUT_FILE]
+		[GRAMMAR_FILE]
+
+The rule references link to the diagrams of the rules, and the code blocks
+are shown as boxes with the code in their tooltip, or hidden with
+-hide-code. With -rule, only the diagram of the rule NAME is written, as a
+standalone SVG document.
+
+The run command parses an input with a grammar, without generating and
+building a parser, and prints the tree of the matched rules, or their errors:
+
+	pigeon run [-entrypoint RULE] [-json] [-memoize] [-skip-rule NAME]
+		GRAMMAR_FILE [INPUT_FILE]
+
+The input is parsed exactly as the generated parser would parse it, with the
+same error messages, but the code blocks are not run: the actions return
+nothing and the predicates &{} and !{} always succeed. The interpreter is
+available as the interp package.
+
+The repl command parses the lines read from stdin with a grammar, as the
+run command does, to try out a grammar interactively:
+
+	pigeon repl [-entrypoint RULE] [-memoize] [-skip-rule NAME] GRAMMAR_FILE
+
+The lines starting with a colon are commands: ":rule NAME" switches the rule
+used to parse the next lines, ":reload" reads the grammar file again after
+it is edited, ":help" lists the commands and ":quit" exits.
+
+The test command runs the cases of corpus files against a grammar and prints
+the diff between the expected and the actual result of the failing cases:
+
+	pigeon test [-update] [-run REGEXP] [-memoize] [-skip-rule NAME] [-v]
+		GRAMMAR_FILE CORPUS...
+
+A corpus file, or each .txt file of a corpus directory, is a list of named
+cases in the format of the tree-sitter corpus files, a header, the input, a
+separator and the expected result:
+
+	==================
+	Name of the case
+	:rule NAME
+	==================
+	input
+	---
+	expected result
+
+The expected result is either "ok", for an input that must match without
+error, or the tree of the matched rules as printed by the run command, or
+"no match", followed by the errors. With -update, the actual results of the
+failing cases are written in the corpus files instead. See the corpus
+package for the details of the format.
+
+All the rule references of the grammar and the alternate entrypoints must
+be defined rules. The undefined rules are all reported at once, with the
+position of the reference and the closest rule name if it looks like a typo,
+before generating the parser (or after parsing the grammar, with -x).
+
 If the code blocks in the grammar (see below, section "Code block") are golint-
 and go vet-compliant, then the resulting generated code will also be golint-
 and go vet-compliant.
@@ -109,6 +350,52 @@ be specified after the rule identifier. E.g.:
 The rule definition operator can be any one of those:
 	=, <-, ← (U+2190), ⟵ (U+27F5)
 
+Typed rules
+
+The Go type of the value of a rule can be declared between angle brackets
+after the rule identifier, before the optional display name. E.g.:
+	Number <float64> "number" = [0-9]+ {
+		f, _ := strconv.ParseFloat(string(c.text), 64)
+		return f
+	}
+	Sum <float64> = l:Number '+' r:Number {
+		return l + r
+	}
+
+The code blocks of the actions that return the value of a typed rule (the
+action of the rule, or of the alternatives of its choice expression) return
+that type instead of an empty interface, and must return a value. The labels
+of references to typed rules have the type of the rule in all code blocks, so
+that type mistakes are reported when compiling the generated parser. If the
+value of such a label is not of the declared type at parse time, an error
+is added and the label has the zero value of the type; a nil value, e.g. of
+a rule without action, is silently converted to the zero value. A receive-only
+channel type must be enclosed in parentheses, e.g. <(<-chan int)>, because
+"<-" is a rule definition operator.
+
+Rule annotations
+
+Annotations can be written before a rule, each one starting with "@"
+followed by its name and optional string arguments between parentheses.
+E.g.:
+	@token
+	@doc("Number is an unsigned integer.")
+	Number = [0-9]+
+
+The following annotations are supported, the others are reported as warnings:
+	@inline       the rule may be inlined by the grammar optimizer even if it
+	              references other rules, as long as it is not recursive.
+	@export       the rule is never removed by the grammar optimizer.
+	@memo         the results are memoized while parsing the rule, as with
+	              the Memoize option.
+	@token        the rule, and the rules it references, never apply the
+	              rule given by -skip-rule.
+	@doc("text")  the text is written as a comment of the rule in the
+	              generated parser.
+
+Annotations starting a new line before a rule definition belong to that
+rule, they are not plucked expressions (see below) of the previous rule.
+
 Expressions
 
 A rule is defined by an expression. The following sections describe the
@@ -180,6 +467,21 @@ is used. E.g.:
 	}
 	RuleB = label:RuleA { // label is int }
 
+Pluck operator
+
+An expression of a sequence prefixed with the at sign "@" is plucked: the
+value of the sequence is the value of the plucked expression, without
+the need of an action code block. If more than one expression is plucked,
+the value is a slice of empty interfaces with the values of the plucked
+expressions, in order. The plucked expression may also be labeled, and the
+value of a plucked string capture is the captured string. E.g.:
+	Parens = "(" @Expr ")"              // value of Expr
+	Pair   = "(" @Key ":" @Value ")"     // []any{key, value}
+	Number = @n:<[0-9]+> !Letter         // the matched digits as string
+
+A sequence with plucked expressions cannot be followed by an action code
+block.
+
 And and not expressions
 
 An expression prefixed with the ampersand "&" is the "and" predicate
@@ -210,6 +512,11 @@ occurs zero or more times ("*"), zero or one time "?" or one or more times
 possible. E.g.
 	ZeroOrMoreAs = "A"*
 
+The expression repeated with "*" or "+" must not match the empty input, as
+it would then match forever: pigeon reports such repetitions, e.g. ("A"?)*,
+as grammar errors. The generated parser stops a repetition as soon as the
+expression matches without consuming input.
+
 Literal matcher
 
 A literal matcher tries to match the input against a single character or a
@@ -232,7 +539,19 @@ square bracket "]" must be escaped to be used.
 Character ranges can be specified using the "[a-z]" notation. Unicode
 classes can be specified using the "[\pL]" notation, where L is a
 single-letter Unicode class of characters, or using the "[\p{Class}]"
-notation where Class is a valid Unicode class (e.g. "Latin").
+notation where Class is a valid Unicode class (e.g. "Latin"). A script or a
+general category may also be named explicitly with "[\p{Script=Greek}]"
+(or "sc=") and "[\p{General_Category=Lu}]" (or "gc="). The "\P" escape
+matches the characters that are not in the Unicode class (e.g. "[\P{Han}]").
+
+The characters of a class can be restricted with the set operations "--"
+(subtraction) and "&&" (intersection), each followed by a nested character
+class or a Unicode class escape. The operations and their operands must come
+last in the class, after all its characters, ranges and Unicode classes, to
+which they apply: "[a-z--[aeiou]0-9]" is invalid, it is written
+"[a-z0-9--[aeiou]]". E.g.:
+	Consonant = [\p{L}--[aeiouAEIOU]]
+	GreekUpper = [\p{Greek}&&\p{Lu}]
 
 As for string literals, a lowercase "i" may follow the matcher (outside
 the ending square bracket) to indicate that the match is case-insensitive.
@@ -362,6 +681,23 @@ of pigeon and should not be used nor modified. Those keys are treated as
 internal implementation details and therefore there are no guarantees given in
 regards of API stability.
 
+Implicit skipping
+
+Grammars usually reference a whitespace rule between all the tokens of
+their rules. With the -skip-rule option, a designated rule is instead applied
+implicitly before each token of the syntactic rules, like the lexical and
+syntactic rules of Ohm. Rules whose name starts with an uppercase letter are
+syntactic, the other rules are lexical and never skip. The skip rule itself
+and the rules it references are always lexical. E.g. with -skip-rule=Spacing:
+	Assign  = name:ident "=" value:ident // spaces allowed around "="
+	ident   = [a-z]+                     // no space allowed inside
+	Spacing = [ \t\r\n]*
+
+In syntactic rules, the skip rule is applied before literals, character
+classes, the any matcher and rule references. The skipped input is not
+part of the text ("c.text" or "<...>" captures) of the expression that
+follows it. The code blocks of the skip rule are not run.
+
 Left recursion
 
 With options -support-left-recursion pigeon supports left recursion. E.g.:
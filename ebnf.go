@@ -0,0 +1,101 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/fy0/pigeon/ast"
+	"github.com/fy0/pigeon/ebnf"
+)
+
+var ebnfUsagePage = `usage: %[1]s ebnf [options] [GRAMMAR_FILE]
+
+Ebnf converts a PEG grammar to EBNF, in the notation of the W3C (as used in
+the XML specification) or of the ISO/IEC 14977 standard. The grammar is read
+from GRAMMAR_FILE, or from stdin if it is not specified.
+
+The actions and state code blocks are stripped, the labels are dropped and
+the ignore-case literals and character classes are expanded to both cases.
+The constructs that have no equivalent in the notation, such as the
+predicates (&, !, &&, !!, &{} and !{}), the throw and recovery expressions
+and the Unicode classes, are written as comments, or as special sequences in
+ISO notation, and reported as warnings on stderr.
+
+The exit code is 0 on success, even if warnings are reported, 3 if the
+grammar cannot be parsed and 1 if the arguments are invalid.
+
+The following options can be specified:
+
+	-h -help
+		display this help message.
+	-notation NOTATION
+		EBNF notation, "w3c" or "iso". Defaults to "w3c".
+	-o OUTPUT_FILE
+		write the EBNF grammar to OUTPUT_FILE. Defaults to stdout.
+`
+
+// ebnfMain implements the ebnf command.
+func ebnfMain(args []string) {
+	fs := flag.NewFlagSet(os.Args[0]+" ebnf", flag.ExitOnError)
+	var (
+		shortHelpFlag = fs.Bool("h", false, "show help page")
+		longHelpFlag  = fs.Bool("help", false, "show help page")
+		notationFlag  = fs.String("notation", "w3c", "EBNF notation, w3c or iso")
+		outputFlag    = fs.String("o", "", "output file, defaults to stdout")
+	)
+	fs.Usage = func() {
+		fmt.Printf(ebnfUsagePage, os.Args[0])
+	}
+	if err := fs.Parse(args); err != nil {
+		fmt.Fprintf(os.Stderr, "args parse error:\n%v\n", err)
+		exit(6)
+	}
+
+	if *shortHelpFlag || *longHelpFlag {
+		fs.Usage()
+		exit(0)
+	}
+	if fs.NArg() > 1 {
+		fmt.Fprintf(os.Stderr, "expected one argument, got %q\n", fs.Args())
+		fs.Usage()
+		exit(1)
+	}
+	var notation ebnf.Notation
+	switch *notationFlag {
+	case "w3c":
+		notation = ebnf.W3C
+	case "iso":
+		notation = ebnf.ISO
+	default:
+		fmt.Fprintf(os.Stderr, "unknown notation %q\n", *notationFlag)
+		fs.Usage()
+		exit(1)
+	}
+
+	nm, rc := input(fs.Arg(0))
+	g, err := ParseReader(nm, rc)
+	rc.Close()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "parse error(s):\n%v\n", err)
+		exit(3)
+	}
+
+	res, warnings := ebnf.Convert(g.(*ast.Grammar), notation)
+	for _, w := range warnings {
+		fmt.Fprintf(os.Stderr, "%s:%s\n", nm, w)
+	}
+
+	out := output(*outputFlag)
+	if _, err := out.Write(res); err != nil {
+		fmt.Fprintf(os.Stderr, "write error: %v\n", err)
+		exit(7)
+	}
+	if out == os.Stdout {
+		return
+	}
+	if err := out.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "close file error:\n%v\n", err)
+		exit(8)
+	}
+}
@@ -0,0 +1,306 @@
+// Package ebnf converts PEG grammars to the EBNF notations of the W3C (as
+// used in the XML specification) and of the ISO/IEC 14977 standard.
+//
+// The actions and state code blocks are stripped, the labels are dropped
+// and the ignore-case literals and character classes are expanded to both
+// cases. The constructs of PEG that have no equivalent in EBNF, such as the
+// predicates, are written as comments and reported as warnings.
+package ebnf
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/fy0/pigeon/ast"
+)
+
+// Notation is an EBNF notation.
+type Notation int
+
+// The supported notations.
+const (
+	W3C Notation = iota // Name ::= a b | c?
+	ISO                 // Name = a , b | [ c ] ;
+)
+
+func (n Notation) String() string {
+	switch n {
+	case W3C:
+		return "w3c"
+	case ISO:
+		return "iso"
+	}
+	return fmt.Sprintf("Notation(%d)", int(n))
+}
+
+// Width is the width of the lines of the rules above which the
+// alternatives of their top-level choice are written one per line.
+const Width = 80
+
+// Warning reports a construct of the grammar that has no equivalent in the
+// notation.
+type Warning struct {
+	Pos     ast.Pos
+	Rule    string
+	Message string
+}
+
+func (w Warning) String() string {
+	return fmt.Sprintf("%s: rule %s: %s", w.Pos, w.Rule, w.Message)
+}
+
+// Convert returns the rules of g in the EBNF notation n, and the warnings
+// for the constructs that have no equivalent in n.
+func Convert(g *ast.Grammar, n Notation) ([]byte, []Warning) {
+	c := &converter{notation: n}
+	var buf bytes.Buffer
+	for i, rule := range g.Rules {
+		if i > 0 {
+			buf.WriteString("\n")
+		}
+		c.rule = rule.Name.Val
+		if rule.DisplayName != nil {
+			name := rule.DisplayName.Val
+			if s, err := strconv.Unquote(name); err == nil {
+				name = s
+			}
+			buf.WriteString(c.comment(strconv.Quote(name)) + "\n")
+		}
+		if doc := rule.Annotation("doc"); doc != nil && len(doc.Args) > 0 {
+			buf.WriteString(c.comment(doc.Args[0]) + "\n")
+		}
+		buf.WriteString(c.ruleDef(rule) + "\n")
+	}
+	return buf.Bytes(), c.warnings
+}
+
+// Precedence levels of the EBNF expressions, from the loosest to the
+// tightest.
+const (
+	levelChoice = iota
+	levelSeq
+	levelPrimary
+)
+
+// term is the EBNF text of an expression.
+type term struct {
+	text  string
+	level int
+	// comment is set if the term is only made of comments, for the
+	// constructs without equivalent.
+	comment bool
+}
+
+type converter struct {
+	notation Notation
+	rule     string
+	warnings []Warning
+}
+
+func (c *converter) warn(expr ast.Expression, format string, args ...any) {
+	c.warnings = append(c.warnings, Warning{
+		Pos:     expr.Pos(),
+		Rule:    c.rule,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// ruleDef returns the definition of rule.
+func (c *converter) ruleDef(rule *ast.Rule) string {
+	op, end := " ::= ", ""
+	if c.notation == ISO {
+		op, end = " = ", " ;"
+	}
+	prefix := rule.Name.Val + op
+
+	choice, ok := rule.Expr.(*ast.ChoiceExpr)
+	if !ok {
+		return prefix + c.body(c.expr(rule.Expr)) + end
+	}
+	alts := make([]string, len(choice.Alternatives))
+	for i, alt := range choice.Alternatives {
+		alts[i] = c.body(c.expr(alt))
+	}
+	line := prefix + strings.Join(alts, " | ") + end
+	if utf8.RuneCountInString(line) <= Width && !strings.Contains(line, "\n") {
+		return line
+	}
+	indent := strings.Repeat(" ", utf8.RuneCountInString(prefix)-2)
+	return prefix + strings.Join(alts, "\n"+indent+"| ") + end
+}
+
+// body returns the text of t used as a rule body or an alternative, where
+// an empty expression is written as the empty string in W3C notation.
+func (c *converter) body(t term) string {
+	if t.text == "" && c.notation == W3C {
+		return `""`
+	}
+	return t.text
+}
+
+// comment returns the text of s as a comment.
+func (c *converter) comment(s string) string {
+	if c.notation == ISO {
+		return "(* " + strings.ReplaceAll(s, "*)", "* )") + " *)"
+	}
+	return "/* " + strings.ReplaceAll(s, "*/", "* /") + " */"
+}
+
+// wrap returns the text of t, enclosed in parentheses if its level is
+// looser than min.
+func (c *converter) wrap(t term, min int) string {
+	if t.level < min && !t.comment {
+		return "( " + t.text + " )"
+	}
+	return t.text
+}
+
+func (c *converter) expr(expr ast.Expression) term {
+	switch expr := expr.(type) {
+	case *ast.ChoiceExpr:
+		alts := make([]string, len(expr.Alternatives))
+		for i, alt := range expr.Alternatives {
+			alts[i] = c.body(c.expr(alt))
+		}
+		return term{text: strings.Join(alts, " | "), level: levelChoice}
+
+	case *ast.SeqExpr:
+		terms := make([]term, 0, len(expr.Exprs))
+		for _, e := range expr.Exprs {
+			terms = append(terms, c.expr(e))
+		}
+		return c.seq(terms...)
+
+	case *ast.ActionExpr:
+		return c.expr(expr.Expr)
+
+	case *ast.CodeExpr:
+		return term{level: levelPrimary}
+
+	case *ast.LabeledExpr:
+		return c.expr(expr.Expr)
+
+	case *ast.AndExpr:
+		op := "&"
+		if expr.Logical {
+			op = "&&"
+		}
+		return c.predicate(expr, op, expr.Expr)
+
+	case *ast.NotExpr:
+		op := "!"
+		if expr.Logical {
+			op = "!!"
+		}
+		return c.predicate(expr, op, expr.Expr)
+
+	case *ast.AndCodeExpr:
+		c.warn(expr, "code predicate &{...} has no EBNF equivalent, written as a comment")
+		return term{text: c.comment("&{...}"), level: levelPrimary, comment: true}
+
+	case *ast.NotCodeExpr:
+		c.warn(expr, "code predicate !{...} has no EBNF equivalent, written as a comment")
+		return term{text: c.comment("!{...}"), level: levelPrimary, comment: true}
+
+	case *ast.ThrowExpr:
+		c.warn(expr, "throw expression %%{%s} has no EBNF equivalent, written as a comment", expr.Label)
+		return term{text: c.comment("%{" + expr.Label + "}"), level: levelPrimary, comment: true}
+
+	case *ast.RecoveryExpr:
+		labels := make([]string, len(expr.Labels))
+		for i, label := range expr.Labels {
+			labels[i] = string(label)
+		}
+		c.warn(expr, "recovery expression has no EBNF equivalent, its recovery is dropped")
+		return c.seq(c.expr(expr.Expr), term{
+			text:    c.comment("//{" + strings.Join(labels, ", ") + "} recovery dropped"),
+			level:   levelPrimary,
+			comment: true,
+		})
+
+	case *ast.ZeroOrOneExpr:
+		t := c.expr(expr.Expr)
+		if c.notation == ISO {
+			return term{text: "[ " + t.text + " ]", level: levelPrimary}
+		}
+		return term{text: c.wrap(t, levelPrimary) + "?", level: levelPrimary}
+
+	case *ast.ZeroOrMoreExpr:
+		t := c.expr(expr.Expr)
+		if c.notation == ISO {
+			return term{text: "{ " + t.text + " }", level: levelPrimary}
+		}
+		return term{text: c.wrap(t, levelPrimary) + "*", level: levelPrimary}
+
+	case *ast.OneOrMoreExpr:
+		t := c.expr(expr.Expr)
+		if c.notation == ISO {
+			return c.seq(t, term{text: "{ " + t.text + " }", level: levelPrimary})
+		}
+		return term{text: c.wrap(t, levelPrimary) + "+", level: levelPrimary}
+
+	case *ast.RuleRefExpr:
+		return term{text: expr.Name.Val, level: levelPrimary}
+
+	case *ast.LitMatcher:
+		return c.literal(expr.Val, expr.IgnoreCase)
+
+	case *ast.CharClassMatcher:
+		return c.charClass(expr)
+
+	case *ast.AnyMatcher:
+		if c.notation == ISO {
+			c.warn(expr, "any character has no ISO EBNF equivalent, written as a special sequence")
+			return term{text: "? any character ?", level: levelPrimary}
+		}
+		return term{text: "[#x0-#x10FFFF]", level: levelPrimary}
+	}
+	panic(fmt.Sprintf("ebnf: unexpected expression %T", expr))
+}
+
+// predicate returns the comment of the predicate expr, with operator op and
+// operand e.
+func (c *converter) predicate(expr ast.Expression, op string, e ast.Expression) term {
+	c.warn(expr, "predicate %s has no EBNF equivalent, written as a comment", op)
+	t := c.expr(e)
+	return term{text: c.comment(op + c.wrap(t, levelPrimary)), level: levelPrimary, comment: true}
+}
+
+// seq returns the sequence of the terms, without the empty ones. The
+// comments are not separated by commas in ISO notation.
+func (c *converter) seq(terms ...term) term {
+	var buf strings.Builder
+	n, comments := 0, true
+	prevExpr := false
+	for _, t := range terms {
+		if t.text == "" {
+			continue
+		}
+		if buf.Len() > 0 {
+			if c.notation == ISO && prevExpr && !t.comment {
+				buf.WriteString(" ,")
+			}
+			buf.WriteString(" ")
+		}
+		buf.WriteString(c.wrap(t, levelSeq))
+		n++
+		if !t.comment {
+			comments = false
+			prevExpr = true
+		}
+	}
+	switch {
+	case n == 0:
+		return term{level: levelPrimary}
+	case n == 1:
+		for _, t := range terms {
+			if t.text != "" {
+				return t
+			}
+		}
+	}
+	return term{text: buf.String(), level: levelSeq, comment: comments}
+}
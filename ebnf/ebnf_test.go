@@ -0,0 +1,90 @@
+package ebnf
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/fy0/pigeon/bootstrap"
+)
+
+func TestConvert(t *testing.T) {
+	cases := []struct {
+		grammar  string
+		w3c, iso string
+		warnings []string
+	}{
+		{
+			grammar: `A "a" = b:B+ c:( 'x' / 'y' )* { return nil, nil }`,
+			w3c:     "/* \"a\" */\nA ::= B+ ( \"x\" | \"y\" )*\n",
+			iso:     "(* \"a\" *)\nA = B , { B } , { \"x\" | \"y\" } ;\n",
+		},
+		{
+			grammar: `A = "if"i ( 'a' 'b' )?`,
+			w3c:     "A ::= [iI] [fF] ( \"a\" \"b\" )?\n",
+			iso:     "A = ( \"i\" | \"I\" ) , ( \"f\" | \"F\" ) , [ \"a\" , \"b\" ] ;\n",
+		},
+		{
+			grammar: "A = \"a\\\"'\\n\" [^\\]a-c] [xy]i .",
+			w3c:     "A ::= \"a\" '\"' \"'\" #xA [^#x5Da-c] [xyXY] [#x0-#x10FFFF]\n",
+			iso:     "A = \"a\" , '\"' , \"'\" , ? U+000A ? , ? [^\\]a-c] ? , ( \"x\" | \"y\" | \"X\" | \"Y\" ) , ? any character ? ;\n",
+			warnings: []string{
+				"1:14 (13): rule A: character class [^\\]a-c] has no ISO EBNF equivalent, written as a special sequence",
+				"1:29 (28): rule A: any character has no ISO EBNF equivalent, written as a special sequence",
+			},
+		},
+		{
+			grammar: "A = !B C / &C\nB = [\\pL_]\nC = 'c'",
+			w3c:     "A ::= /* !B */ C | /* &C */\n\nB ::= [_] /* [\\pL_] */\n\nC ::= \"c\"\n",
+			iso:     "A = (* !B *) C | (* &C *) ;\n\nB = ? [\\pL_] ? ;\n\nC = \"c\" ;\n",
+			warnings: []string{
+				"1:5 (4): rule A: predicate ! has no EBNF equivalent, written as a comment",
+				"1:12 (11): rule A: predicate & has no EBNF equivalent, written as a comment",
+				"2:5 (18): rule B: character class [\\pL_] has no W3C EBNF equivalent, written as a comment",
+				"2:5 (18): rule B: character class [\\pL_] has no ISO EBNF equivalent, written as a special sequence",
+			},
+		},
+		{
+			grammar: "A = " + strings.Repeat("\"abcdefghij\" ", 4) + "/ " + strings.Repeat("\"abcdefghij\" ", 4),
+			w3c:     "A ::= " + strings.Repeat("\"abcdefghij\" ", 3) + "\"abcdefghij\"\n    | " + strings.Repeat("\"abcdefghij\" ", 3) + "\"abcdefghij\"\n",
+			iso:     "A = " + strings.Repeat("\"abcdefghij\" , ", 3) + "\"abcdefghij\"\n  | " + strings.Repeat("\"abcdefghij\" , ", 3) + "\"abcdefghij\" ;\n",
+		},
+	}
+
+	for _, tc := range cases {
+		g, err := bootstrap.NewParser().Parse("", strings.NewReader(tc.grammar))
+		if err != nil {
+			t.Fatalf("%q: %v", tc.grammar, err)
+		}
+		var warnings []string
+		for _, n := range []Notation{W3C, ISO} {
+			want := tc.w3c
+			if n == ISO {
+				want = tc.iso
+			}
+			got, ws := Convert(g, n)
+			if string(got) != want {
+				t.Errorf("%q: %s: want\n%s\ngot\n%s", tc.grammar, n, want, got)
+			}
+			for _, w := range ws {
+				warnings = append(warnings, w.String())
+			}
+		}
+		// the predicates are reported in both notations
+		warnings = dedup(warnings)
+		if strings.Join(warnings, "\n") != strings.Join(tc.warnings, "\n") {
+			t.Errorf("%q: want warnings\n%s\ngot\n%s", tc.grammar, strings.Join(tc.warnings, "\n"), strings.Join(warnings, "\n"))
+		}
+	}
+}
+
+func dedup(list []string) []string {
+	seen := make(map[string]bool)
+	var res []string
+	for _, s := range list {
+		if !seen[s] {
+			seen[s] = true
+			res = append(res, s)
+		}
+	}
+	return res
+}
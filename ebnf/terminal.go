@@ -0,0 +1,206 @@
+package ebnf
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/fy0/pigeon/ast"
+)
+
+// maxEnumerated is the maximum number of characters of a character class
+// written as a choice of strings in ISO notation.
+const maxEnumerated = 64
+
+// literal returns the term of the literal string s, expanded to both cases
+// if ignoreCase is set.
+func (c *converter) literal(s string, ignoreCase bool) term {
+	var parts []term
+	var run strings.Builder
+	flush := func() {
+		if run.Len() > 0 {
+			parts = append(parts, c.strings(run.String())...)
+			run.Reset()
+		}
+	}
+	for _, r := range s {
+		switch {
+		case ignoreCase && hasCases(r):
+			flush()
+			lower, upper := unicode.ToLower(r), unicode.ToUpper(r)
+			if c.notation == ISO {
+				parts = append(parts, term{text: fmt.Sprintf("( %s | %s )", isoString(string(lower)), isoString(string(upper))), level: levelPrimary})
+			} else {
+				parts = append(parts, term{text: "[" + classChar(lower) + classChar(upper) + "]", level: levelPrimary})
+			}
+		case !unicode.IsPrint(r):
+			flush()
+			parts = append(parts, term{text: c.char(r), level: levelPrimary})
+		default:
+			run.WriteRune(r)
+		}
+	}
+	flush()
+
+	if len(parts) == 0 {
+		if c.notation == W3C {
+			return term{text: `""`, level: levelPrimary}
+		}
+		return term{level: levelPrimary}
+	}
+	return c.seq(parts...)
+}
+
+// strings returns the terms of the printable string s. The strings that
+// contain both quote characters are split.
+func (c *converter) strings(s string) []term {
+	quote := func(s string) term {
+		if c.notation == ISO {
+			return term{text: isoString(s), level: levelPrimary}
+		}
+		if strings.Contains(s, `"`) {
+			return term{text: "'" + s + "'", level: levelPrimary}
+		}
+		return term{text: `"` + s + `"`, level: levelPrimary}
+	}
+	if !strings.Contains(s, `"`) || !strings.Contains(s, "'") {
+		return []term{quote(s)}
+	}
+	var parts []term
+	for i, seg := range strings.Split(s, `"`) {
+		if i > 0 {
+			parts = append(parts, quote(`"`))
+		}
+		if seg != "" {
+			parts = append(parts, quote(seg))
+		}
+	}
+	return parts
+}
+
+// isoString returns the ISO terminal string of s, which does not contain
+// both quote characters.
+func isoString(s string) string {
+	if strings.Contains(s, `"`) {
+		return "'" + s + "'"
+	}
+	return `"` + s + `"`
+}
+
+// char returns the term of the non-printable character r.
+func (c *converter) char(r rune) string {
+	if c.notation == ISO {
+		return fmt.Sprintf("? U+%04X ?", r)
+	}
+	return fmt.Sprintf("#x%X", r)
+}
+
+// classChar returns the text of r in a W3C character class.
+func classChar(r rune) string {
+	if strings.ContainsRune(`[]^-#\`, r) || unicode.IsSpace(r) || !unicode.IsPrint(r) {
+		return fmt.Sprintf("#x%X", r)
+	}
+	return string(r)
+}
+
+func hasCases(r rune) bool {
+	return unicode.ToLower(r) != unicode.ToUpper(r)
+}
+
+// classItems returns the characters and ranges of the class, expanded to
+// both cases if it ignores the case.
+func classItems(cc *ast.CharClassMatcher) (chars, ranges []rune) {
+	chars = append(chars, cc.Chars...)
+	ranges = append(ranges, cc.Ranges...)
+	if !cc.IgnoreCase {
+		return chars, ranges
+	}
+
+	seen := make(map[rune]bool)
+	for _, r := range chars {
+		seen[r] = true
+	}
+	for _, r := range cc.Chars {
+		for _, cr := range []rune{unicode.ToLower(r), unicode.ToUpper(r)} {
+			if !seen[cr] {
+				seen[cr] = true
+				chars = append(chars, cr)
+			}
+		}
+	}
+	for i := 0; i < len(cc.Ranges); i += 2 {
+		lo, hi := cc.Ranges[i], cc.Ranges[i+1]
+		for _, conv := range []func(rune) rune{unicode.ToLower, unicode.ToUpper} {
+			clo, chi := conv(lo), conv(hi)
+			if (clo != lo || chi != hi) && chi-clo == hi-lo {
+				ranges = append(ranges, clo, chi)
+			}
+		}
+	}
+	return chars, ranges
+}
+
+// charClass returns the term of the character class cc.
+func (c *converter) charClass(cc *ast.CharClassMatcher) term {
+	chars, ranges := classItems(cc)
+	unicodeClasses := len(cc.UnicodeClasses) > 0 || cc.HasSetOperations()
+
+	if c.notation == ISO {
+		count := len(chars)
+		for i := 0; i < len(ranges); i += 2 {
+			count += int(ranges[i+1]-ranges[i]) + 1
+		}
+		if unicodeClasses || cc.Inverted || count > maxEnumerated || count == 0 {
+			c.warn(cc, "character class %s has no ISO EBNF equivalent, written as a special sequence", cc.Val)
+			return term{text: "? " + strings.ReplaceAll(cc.Val, "?", `\x3f`) + " ?", level: levelPrimary}
+		}
+		var alts []string
+		for _, r := range chars {
+			alts = append(alts, c.isoChar(r))
+		}
+		for i := 0; i < len(ranges); i += 2 {
+			for r := ranges[i]; r <= ranges[i+1]; r++ {
+				alts = append(alts, c.isoChar(r))
+			}
+		}
+		if len(alts) == 1 {
+			return term{text: alts[0], level: levelPrimary}
+		}
+		return term{text: strings.Join(alts, " | "), level: levelChoice}
+	}
+
+	var buf strings.Builder
+	for _, r := range chars {
+		buf.WriteString(classChar(r))
+	}
+	for i := 0; i < len(ranges); i += 2 {
+		buf.WriteString(classChar(ranges[i]) + "-" + classChar(ranges[i+1]))
+	}
+	items := buf.String()
+	if !unicodeClasses {
+		if cc.Inverted {
+			items = "^" + items
+		}
+		if items == "" {
+			// the empty class never matches
+			c.warn(cc, "empty character class has no W3C EBNF equivalent, written as a comment")
+			return term{text: c.comment(cc.Val), level: levelPrimary, comment: true}
+		}
+		return term{text: "[" + items + "]", level: levelPrimary}
+	}
+
+	c.warn(cc, "character class %s has no W3C EBNF equivalent, written as a comment", cc.Val)
+	comment := term{text: c.comment(cc.Val), level: levelPrimary, comment: true}
+	if items == "" || cc.Inverted || cc.HasSetOperations() {
+		return comment
+	}
+	return c.seq(term{text: "[" + items + "]", level: levelPrimary}, comment)
+}
+
+// isoChar returns the ISO terminal of the character r.
+func (c *converter) isoChar(r rune) string {
+	if !unicode.IsPrint(r) {
+		return c.char(r)
+	}
+	return isoString(string(r))
+}
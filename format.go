@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/fy0/pigeon/ast"
+	"github.com/fy0/pigeon/diff"
+	"github.com/fy0/pigeon/format"
+)
+
+var fmtUsagePage = `usage: %[1]s fmt [options] [GRAMMAR_FILE...]
+
+Fmt formats PEG grammars in the canonical layout: the rule definition
+operators of consecutive single-line rules are aligned, the alternatives
+of the top-level choices that do not fit on a line are written one per
+line, the string literals are double-quoted and all the rules use the
+definition operator of the first one. The code blocks and the comments are
+kept as they are.
+
+By default, the formatted grammars are written to stdout. If no
+GRAMMAR_FILE is specified, the grammar is read from stdin.
+
+The exit code is 0 on success, 10 if the -l or -d flag is set and a grammar
+is not formatted, 3 if a grammar cannot be parsed, 2 if it cannot be opened
+and 1 if the arguments are invalid.
+
+The following options can be specified:
+
+	-d
+		print the diffs between the grammars and their formatting
+		instead of the formatted grammars.
+	-h -help
+		display this help message.
+	-l
+		list the files whose formatting differs instead of printing
+		the formatted grammars.
+	-w
+		write the formatted grammars back to their file instead of
+		stdout.
+`
+
+// fmtMain implements the fmt command.
+func fmtMain(args []string) {
+	fs := flag.NewFlagSet(os.Args[0]+" fmt", flag.ExitOnError)
+	var (
+		shortHelpFlag = fs.Bool("h", false, "show help page")
+		longHelpFlag  = fs.Bool("help", false, "show help page")
+		diffFlag      = fs.Bool("d", false, "print the diffs instead of the formatted grammars")
+		listFlag      = fs.Bool("l", false, "list the files whose formatting differs")
+		writeFlag     = fs.Bool("w", false, "write the formatted grammars back to their file")
+	)
+	fs.Usage = func() {
+		fmt.Printf(fmtUsagePage, os.Args[0])
+	}
+	if err := fs.Parse(args); err != nil {
+		fmt.Fprintf(os.Stderr, "args parse error:\n%v\n", err)
+		exit(6)
+	}
+
+	if *shortHelpFlag || *longHelpFlag {
+		fs.Usage()
+		exit(0)
+	}
+	if *writeFlag && fs.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "cannot use -w with stdin")
+		fs.Usage()
+		exit(1)
+	}
+
+	files := fs.Args()
+	if len(files) == 0 {
+		files = []string{""}
+	}
+	unformatted := false
+	for _, file := range files {
+		nm, rc := input(file)
+		src, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "parse error(s):\n%v\n", err)
+			exit(3)
+		}
+		g, err := Parse(nm, src)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "parse error(s):\n%v\n", err)
+			exit(3)
+		}
+		res, err := format.Source(src, g.(*ast.Grammar))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: format error: %v\n", nm, err)
+			exit(3)
+		}
+
+		changed := !bytes.Equal(src, res)
+		unformatted = unformatted || changed
+		switch {
+		case *listFlag || *diffFlag:
+			if changed && *listFlag {
+				fmt.Println(nm)
+			}
+			if changed && *diffFlag {
+				os.Stdout.Write(diff.Unified(nm+".orig", nm, src, res))
+			}
+		case *writeFlag:
+			if !changed {
+				continue
+			}
+			if err := os.WriteFile(file, res, 0644); err != nil {
+				fmt.Fprintf(os.Stderr, "write error: %v\n", err)
+				exit(7)
+			}
+		default:
+			if _, err := os.Stdout.Write(res); err != nil {
+				fmt.Fprintf(os.Stderr, "write error: %v\n", err)
+				exit(7)
+			}
+		}
+	}
+	if unformatted && (*listFlag || *diffFlag) {
+		exit(10)
+	}
+}
@@ -0,0 +1,448 @@
+// Package format implements the canonical formatting of PEG grammars,
+// used by the "pigeon fmt" command.
+package format
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/fy0/pigeon/ast"
+)
+
+// Width is the width of the lines of the rules above which their top-level
+// choice is written with one alternative per line.
+const Width = 80
+
+// indent is the indentation of the alternatives of a wrapped choice.
+const indent = "    "
+
+// Source returns the canonical formatting of the grammar src, parsed as g.
+//
+// The rules are written with their expression on a single line, unless the
+// line is too long or has comments, in which case the alternatives of the
+// top-level choice are written one per line, the rule definition operators
+// of consecutive single-line rules are aligned, the string literals are
+// double-quoted and all the rules use the definition operator of the first
+// one. The code blocks and the comments are kept as they are. The
+// single-line block comments between two subexpressions stay in place, the
+// other comments inside an expression are moved to the end of the line of
+// the rule, or of the alternative of the top-level choice that contains
+// them, or before it if they span several lines.
+func Source(src []byte, g *ast.Grammar) ([]byte, error) {
+	f := &formatter{src: string(src), g: g}
+	if err := f.scan(); err != nil {
+		return nil, err
+	}
+	f.format()
+	return []byte(f.out.String()), nil
+}
+
+// item is a unit of the formatted grammar: the initializer, a rule or a
+// line of comments.
+type item struct {
+	text string
+	// blankBefore is set if the item is preceded by a blank line.
+	blankBefore bool
+	// rule is set for the rules that can be aligned with their neighbors,
+	// with name the part preceding their definition operator and body the
+	// part following it.
+	rule       bool
+	name, body string
+}
+
+type formatter struct {
+	src   string
+	g     *ast.Grammar
+	spans []span
+	lines []int // offsets of the starts of the lines
+	op    string
+	items []item
+	out   strings.Builder
+}
+
+func (f *formatter) scan() error {
+	s := &scanner{src: f.src, codes: make(map[int]int), types: make(map[int]int)}
+	addCode := func(code *ast.CodeBlock) {
+		if code != nil {
+			s.codes[code.Pos().Off] = code.Pos().Off + len(code.Val)
+		}
+	}
+	addCode(f.g.Init)
+	for _, rule := range f.g.Rules {
+		if rule.Type != nil {
+			off := rule.Type.Pos().Off
+			if end := strings.IndexByte(f.src[off:], '>'); end >= 0 {
+				s.types[off] = off + end + 1
+			}
+		}
+		ast.Inspect(rule.Expr, func(expr ast.Expression) bool {
+			addCode(codeBlock(expr))
+			return true
+		})
+	}
+	if err := s.scan(); err != nil {
+		return err
+	}
+	f.spans = s.spans
+
+	f.lines = []int{0}
+	for i := 0; i < len(f.src); i++ {
+		if f.src[i] == '\n' {
+			f.lines = append(f.lines, i+1)
+		}
+	}
+
+	f.op = "="
+	if len(f.g.Rules) > 0 {
+		f.op = f.ruleDefOp(f.g.Rules[0])
+	}
+	return nil
+}
+
+func (f *formatter) format() {
+	prevEnd, forceBlank := 0, false
+	if init := f.g.Init; init != nil {
+		start := init.Pos().Off
+		prevEnd, _ = f.comments(0, start, false)
+		f.add(item{text: init.Val}, f.blank(prevEnd, start))
+		// the initializer is always followed by a blank line
+		prevEnd, forceBlank = start+len(init.Val), true
+	}
+
+	for i, rule := range f.g.Rules {
+		start := rule.Pos().Off
+		end := len(f.src)
+		if i+1 < len(f.g.Rules) {
+			end = f.g.Rules[i+1].Pos().Off
+		}
+		var emitted bool
+		prevEnd, emitted = f.comments(prevEnd, start, forceBlank)
+		blank := forceBlank && !emitted || f.blank(prevEnd, start)
+		prevEnd, forceBlank = f.rule(rule, start, end, blank), false
+	}
+	f.comments(prevEnd, len(f.src), forceBlank)
+
+	f.write()
+}
+
+// add adds it to the items, preceded by a blank line if blank is set and
+// it is not the first one.
+func (f *formatter) add(it item, blank bool) {
+	it.blankBefore = blank && len(f.items) > 0
+	f.items = append(f.items, it)
+}
+
+// comments adds the items of the comments in [start, end), one per line,
+// the first one preceded by a blank line if forceBlank is set. It returns
+// the end of the last comment, or start, and whether there is a comment.
+func (f *formatter) comments(start, end int, forceBlank bool) (int, bool) {
+	prev, prevLine, emitted := start, -1, false
+	for _, sp := range f.spans {
+		if !sp.comment || sp.start < start || sp.end > end {
+			continue
+		}
+		text := f.src[sp.start:sp.end]
+		if emitted && f.line(sp.start) == prevLine {
+			f.items[len(f.items)-1].text += " " + text
+		} else {
+			f.add(item{text: text}, !emitted && forceBlank || f.blank(prev, sp.start))
+		}
+		emitted = true
+		prev, prevLine = sp.end, f.line(sp.end-1)
+	}
+	return prev, emitted
+}
+
+// blank returns true if there is a blank line between the offsets start and
+// end.
+func (f *formatter) blank(start, end int) bool {
+	return strings.Count(f.src[start:end], "\n") >= 2
+}
+
+// line returns the index of the line of the offset off.
+func (f *formatter) line(off int) int {
+	return sort.Search(len(f.lines), func(i int) bool { return f.lines[i] > off }) - 1
+}
+
+// ruleDefOp returns the definition operator of rule.
+func (f *formatter) ruleDefOp(rule *ast.Rule) string {
+	off := rule.Name.Pos().Off + len(rule.Name.Val)
+	for _, sp := range f.spans {
+		if sp.start < off || sp.comment {
+			continue
+		}
+		s := f.src[sp.start:]
+		if s[0] == '<' && !strings.HasPrefix(s, "<-") || strings.IndexByte("\"'`", s[0]) >= 0 {
+			// type or display name
+			continue
+		}
+		for _, op := range []string{"=", "<-", "←", "⟵"} {
+			if strings.HasPrefix(s, op) {
+				return op
+			}
+		}
+		break
+	}
+	return "="
+}
+
+// rule adds the items of the rule in [start, end), preceded by a blank
+// line if blank is set, and returns the end of the rule, after its trailing
+// comment.
+func (f *formatter) rule(rule *ast.Rule, start, end int, blank bool) int {
+	// the tokens of the rule end before the comments and separators that
+	// follow it
+	ruleEnd := start
+	for _, sp := range f.spans {
+		if sp.start >= start && sp.end <= end && !sp.comment && f.src[sp.start:sp.end] != ";" {
+			ruleEnd = sp.end
+		}
+	}
+
+	// the single-line block comments between two subexpressions are kept
+	// in place, they are written with the expressions
+	p := &printer{src: f.src, written: make(map[int]bool)}
+	for _, sp := range f.spans {
+		if sp.comment && sp.start >= start && sp.end <= ruleEnd && inline(f.src[sp.start:sp.end]) {
+			p.comments = append(p.comments, sp)
+		}
+	}
+	choice, _ := rule.Expr.(*ast.ChoiceExpr)
+	var alts []alternative
+	var body string
+	if choice != nil {
+		alts = f.alternatives(choice, ruleEnd)
+		texts := make([]string, len(alts))
+		for i := range alts {
+			alts[i].text = p.expr(alts[i].expr, levelActionSeq)
+			texts[i] = alts[i].text
+		}
+		body = strings.Join(texts, " / ")
+	} else {
+		body = p.expr(rule.Expr, levelRecovery)
+	}
+
+	// the comments on the line of the end of the rule trail it, the other
+	// single-line ones inside the rule are moved to the end of the line of
+	// the rule, or of the alternative that contains them, and the
+	// multi-line ones before it
+	var leading, trailing []string
+	last := start
+	for _, sp := range f.spans {
+		if !sp.comment || sp.start < start || sp.end > end || p.written[sp.start] {
+			continue
+		}
+		text := f.src[sp.start:sp.end]
+		switch {
+		case sp.start > ruleEnd && f.line(sp.start) == f.line(ruleEnd):
+			trailing = append(trailing, text)
+			last = sp.end
+		case sp.start > ruleEnd:
+			// comments before the next rule
+		case alts != nil && f.addAltComment(alts, sp, text):
+		case !strings.Contains(text, "\n"):
+			trailing = append(trailing, text)
+		default:
+			leading = append(leading, text)
+		}
+	}
+	if last < ruleEnd {
+		last = ruleEnd
+	}
+
+	for i, text := range leading {
+		f.add(item{text: text}, i == 0 && blank)
+	}
+	blank = blank && len(leading) == 0
+
+	var header strings.Builder
+	for i, ann := range rule.Annotations {
+		if i > 0 {
+			header.WriteString(" ")
+		}
+		header.WriteString("@" + ann.Name.Val)
+		if len(ann.Args) > 0 {
+			args := make([]string, len(ann.Args))
+			for j, arg := range ann.Args {
+				args[j] = strconv.Quote(arg)
+			}
+			header.WriteString("(" + strings.Join(args, ", ") + ")")
+		}
+	}
+	if header.Len() > 0 {
+		header.WriteString("\n")
+	}
+
+	name := rule.Name.Val
+	if rule.Type != nil {
+		name += " <" + rule.Type.Val + ">"
+	}
+	if rule.DisplayName != nil {
+		display := rule.DisplayName.Val
+		if s, err := strconv.Unquote(display); err == nil {
+			display = strconv.Quote(s)
+		}
+		name += " " + display
+	}
+
+	comment := ""
+	if len(trailing) > 0 {
+		comment = " " + strings.Join(trailing, " ")
+	}
+	wrap := choice != nil && (strings.Contains(body, "\n") ||
+		utf8.RuneCountInString(name+" "+f.op+" "+body) > Width || hasComments(alts))
+	if wrap {
+		var buf strings.Builder
+		for i, alt := range alts {
+			if i > 0 {
+				buf.WriteString("\n")
+				for _, c := range alt.leading {
+					buf.WriteString(indent + c + "\n")
+				}
+				buf.WriteString(indent + "/ ")
+			}
+			buf.WriteString(alt.text)
+			if len(alt.trailing) > 0 && i < len(alts)-1 {
+				buf.WriteString(" " + strings.Join(alt.trailing, " "))
+			}
+		}
+		body = buf.String()
+	}
+
+	it := item{text: header.String() + name + " " + f.op + " " + body + comment}
+	if header.Len() == 0 && !strings.Contains(body, "\n") {
+		it.rule, it.name, it.body = true, name, body+comment
+	}
+	f.add(it, blank)
+	return last
+}
+
+// alternative is an alternative of a top-level choice, with its text and
+// its comments.
+type alternative struct {
+	expr              ast.Expression
+	text              string
+	start, end        int // end of the last token
+	leading, trailing []string
+}
+
+// alternatives returns the alternatives of the top-level choice, ending at
+// ruleEnd.
+func (f *formatter) alternatives(choice *ast.ChoiceExpr, ruleEnd int) []alternative {
+	alts := make([]alternative, len(choice.Alternatives))
+	for i, alt := range choice.Alternatives {
+		alts[i] = alternative{expr: alt, start: alt.Pos().Off}
+	}
+	for i := range alts {
+		if i == len(alts)-1 {
+			alts[i].end = ruleEnd
+			continue
+		}
+		// the last token before the next alternative is the separator
+		var tokens []span
+		for _, sp := range f.spans {
+			if !sp.comment && sp.start >= alts[i].start && sp.end <= alts[i+1].start {
+				tokens = append(tokens, sp)
+			}
+		}
+		alts[i].end = alts[i].start
+		if len(tokens) >= 2 {
+			alts[i].end = tokens[len(tokens)-2].end
+		}
+	}
+	return alts
+}
+
+// addAltComment adds the comment sp to the alternative that contains it,
+// and returns false if it must be added to the rule instead.
+func (f *formatter) addAltComment(alts []alternative, sp span, text string) bool {
+	for i := len(alts) - 1; i >= 0; i-- {
+		alt := &alts[i]
+		if sp.start < alt.start {
+			continue
+		}
+		switch {
+		case sp.start > alt.end && f.line(sp.start) == f.line(alt.end):
+			alt.trailing = append(alt.trailing, text)
+		case sp.start > alt.end:
+			alts[i+1].leading = append(alts[i+1].leading, text)
+		case i == len(alts)-1 && !strings.Contains(text, "\n"):
+			// the last alternative ends the line of the rule
+			return false
+		case !strings.Contains(text, "\n"):
+			alt.trailing = append(alt.trailing, text)
+		case i == 0:
+			return false
+		default:
+			alt.leading = append(alt.leading, text)
+		}
+		return true
+	}
+	return false
+}
+
+// inline returns true if the comment text can be written between two
+// expressions: it is a block comment on a single line.
+func inline(text string) bool {
+	return strings.HasPrefix(text, "/*") && !strings.Contains(text, "\n")
+}
+
+func hasComments(alts []alternative) bool {
+	for _, alt := range alts {
+		if len(alt.leading) > 0 || len(alt.trailing) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// write writes the items to the output, aligning the definition operators
+// of the consecutive single-line rules.
+func (f *formatter) write() {
+	for i := 0; i < len(f.items); {
+		// find the section of aligned rules starting at i
+		j := i + 1
+		if f.items[i].rule {
+			for j < len(f.items) && f.items[j].rule && !f.items[j].blankBefore {
+				j++
+			}
+		}
+		width := 0
+		for _, it := range f.items[i:j] {
+			if n := utf8.RuneCountInString(it.name); n > width {
+				width = n
+			}
+		}
+
+		for k := i; k < j; k++ {
+			it := f.items[k]
+			if it.blankBefore {
+				f.out.WriteString("\n")
+			}
+			if it.rule {
+				pad := strings.Repeat(" ", width-utf8.RuneCountInString(it.name))
+				f.out.WriteString(it.name + pad + " " + f.op + " " + it.body + "\n")
+			} else {
+				f.out.WriteString(it.text + "\n")
+			}
+		}
+		i = j
+	}
+}
+
+// codeBlock returns the code block of expr, if any.
+func codeBlock(expr ast.Expression) *ast.CodeBlock {
+	switch expr := expr.(type) {
+	case *ast.ActionExpr:
+		return expr.Code
+	case *ast.AndCodeExpr:
+		return expr.Code
+	case *ast.NotCodeExpr:
+		return expr.Code
+	case *ast.CodeExpr:
+		return expr.Code
+	}
+	return nil
+}
@@ -0,0 +1,221 @@
+package format
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/fy0/pigeon/ast"
+)
+
+// Precedence levels of the expressions, from the loosest to the tightest.
+// An expression is enclosed in parentheses where the grammar requires a
+// tighter one.
+const (
+	levelRecovery  = iota // e //{label} e
+	levelChoice           // e / e
+	levelActionSeq        // e { code } e { code }
+	levelAction           // e { code }
+	levelSeq              // e e
+	levelLabeled          // label:e
+	levelPrefixed         // &e !e
+	levelSuffixed         // e? e* e+
+	levelPrimary          // literals, references, ( e )
+)
+
+// printer writes the expressions of a rule. The single-line block comments
+// between two subexpressions of an expression are written back in place.
+type printer struct {
+	src      string
+	comments []span
+	written  map[int]bool // starts of the comments written
+}
+
+// between returns the comments of p in [start, end) that are not written
+// yet, each followed by a space, and marks them as written.
+func (p *printer) between(start, end int) string {
+	var buf strings.Builder
+	for _, sp := range p.comments {
+		if sp.start >= start && sp.end <= end && !p.written[sp.start] {
+			buf.WriteString(p.src[sp.start:sp.end] + " ")
+			p.written[sp.start] = true
+		}
+	}
+	return buf.String()
+}
+
+// expr returns the text of e, enclosed in parentheses if its level is
+// looser than min.
+func (p *printer) expr(e ast.Expression, min int) string {
+	var s string
+	var level int
+	if seq, ok := e.(*ast.SeqExpr); ok {
+		s, level = p.seqExpr(seq, min)
+	} else {
+		s, level = p.exprLevel(e)
+	}
+	if level < min {
+		return "( " + s + " )"
+	}
+	return s
+}
+
+// exprLevel returns the text of e and its precedence level.
+func (p *printer) exprLevel(e ast.Expression) (string, int) {
+	switch e := e.(type) {
+	case *ast.RecoveryExpr:
+		labels := make([]string, len(e.Labels))
+		for i, label := range e.Labels {
+			labels[i] = string(label)
+		}
+		return p.expr(e.Expr, levelRecovery) + " " + p.between(e.Expr.Pos().Off, e.RecoverExpr.Pos().Off) +
+			"//{" + strings.Join(labels, ", ") + "} " +
+			p.expr(e.RecoverExpr, levelChoice), levelRecovery
+
+	case *ast.ChoiceExpr:
+		var buf strings.Builder
+		for i, alt := range e.Alternatives {
+			if i > 0 {
+				buf.WriteString(" " + p.between(e.Alternatives[i-1].Pos().Off, alt.Pos().Off) + "/ ")
+			}
+			buf.WriteString(p.expr(alt, levelActionSeq))
+		}
+		return buf.String(), levelChoice
+
+	case *ast.SeqExpr:
+		return p.seqExpr(e, levelRecovery)
+
+	case *ast.ActionExpr:
+		return p.expr(e.Expr, levelSeq) + " " + p.between(e.Expr.Pos().Off, e.Code.Pos().Off) + e.Code.Val, levelAction
+
+	case *ast.CodeExpr:
+		if e.NotSkip {
+			return "*" + e.Code.Val, levelPrimary
+		}
+		return e.Code.Val, levelAction
+
+	case *ast.LabeledExpr:
+		var buf strings.Builder
+		if e.Pluck {
+			buf.WriteString("@")
+		}
+		if e.Label == nil {
+			buf.WriteString(p.expr(e.Expr, levelPrefixed))
+			return buf.String(), levelLabeled
+		}
+		buf.WriteString(e.Label.Val + ":")
+		if e.TextCapture {
+			buf.WriteString("<" + p.expr(e.Expr, levelPrefixed) + ">")
+		} else {
+			buf.WriteString(p.expr(e.Expr, levelPrefixed))
+		}
+		return buf.String(), levelLabeled
+
+	case *ast.ThrowExpr:
+		return "%{" + e.Label + "}", levelLabeled
+
+	case *ast.AndExpr:
+		op := "&"
+		if e.Logical {
+			op = "&&"
+		}
+		return p.prefixed(op, e.Expr), levelPrefixed
+
+	case *ast.NotExpr:
+		op := "!"
+		if e.Logical {
+			op = "!!"
+		}
+		return p.prefixed(op, e.Expr), levelPrefixed
+
+	case *ast.ZeroOrOneExpr:
+		return p.expr(e.Expr, levelPrimary) + "?", levelSuffixed
+	case *ast.ZeroOrMoreExpr:
+		return p.expr(e.Expr, levelPrimary) + "*", levelSuffixed
+	case *ast.OneOrMoreExpr:
+		return p.expr(e.Expr, levelPrimary) + "+", levelSuffixed
+
+	case *ast.LitMatcher:
+		s := strconv.Quote(e.Val)
+		if e.IgnoreCase {
+			s += "i"
+		}
+		return s, levelPrimary
+	case *ast.CharClassMatcher:
+		return e.Val, levelPrimary
+	case *ast.AnyMatcher:
+		return ".", levelPrimary
+	case *ast.RuleRefExpr:
+		return e.Name.Val, levelPrimary
+	case *ast.AndCodeExpr:
+		return "&" + e.Code.Val, levelPrimary
+	case *ast.NotCodeExpr:
+		return "!" + e.Code.Val, levelPrimary
+	}
+	panic(fmt.Sprintf("format: unexpected expression %T", e))
+}
+
+// prefixed returns the text of the prefixed expression with operator op
+// and operand e. The operand is separated from the operator if it starts
+// with an operator character, which would be read as part of it.
+func (p *printer) prefixed(op string, e ast.Expression) string {
+	s := p.expr(e, levelSuffixed)
+	if strings.HasPrefix(s, "&") || strings.HasPrefix(s, "!") {
+		return op + " " + s
+	}
+	return op + s
+}
+
+// seqExpr returns the text and level of the sequence e, written where an
+// expression of level min is required. A sequence of actions, e.g.
+// a { code } b { code }, is read back as one action per code block, so it
+// is only written as such if all the expressions but the last one are
+// actions and min allows it, otherwise the actions are enclosed in
+// parentheses.
+func (p *printer) seqExpr(e *ast.SeqExpr, min int) (string, int) {
+	actions := 0
+	for i, sub := range e.Exprs {
+		if isAction(sub) {
+			actions++
+		} else if i < len(e.Exprs)-1 {
+			actions = -1
+			break
+		}
+	}
+
+	exprs := make([]string, len(e.Exprs))
+	if actions <= 0 || min > levelActionSeq {
+		for i, sub := range e.Exprs {
+			exprs[i] = p.before(e, i) + p.expr(sub, levelLabeled)
+		}
+		return strings.Join(exprs, " "), levelSeq
+	}
+	for i, sub := range e.Exprs {
+		if isAction(sub) {
+			exprs[i] = p.before(e, i) + p.expr(sub, levelAction)
+		} else {
+			exprs[i] = p.before(e, i) + p.expr(sub, levelSeq)
+		}
+	}
+	return strings.Join(exprs, " "), levelActionSeq
+}
+
+// before returns the comments to write before the expression i of the
+// sequence e, after the previous one.
+func (p *printer) before(e *ast.SeqExpr, i int) string {
+	if i == 0 {
+		return ""
+	}
+	return p.between(e.Exprs[i-1].Pos().Off, e.Exprs[i].Pos().Off)
+}
+
+// isAction returns true if e is written with a trailing code block.
+func isAction(e ast.Expression) bool {
+	switch e := e.(type) {
+	case *ast.ActionExpr:
+		return true
+	case *ast.CodeExpr:
+		return !e.NotSkip
+	}
+	return false
+}
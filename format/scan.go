@@ -0,0 +1,122 @@
+package format
+
+import (
+	"fmt"
+	"strings"
+)
+
+// span is a token or a comment of the grammar source, from offset start
+// (included) to offset end (excluded).
+type span struct {
+	start, end int
+	comment    bool
+}
+
+// scanner splits the grammar source in tokens and comments. The tokens are
+// only used for their position, so the identifiers and operators are split
+// in single characters. The code blocks and the rule types, whose content
+// cannot be told apart from the grammar without parsing it, are recognized
+// by their offset.
+type scanner struct {
+	src   string
+	spans []span
+
+	// codes and types map the offsets of the code blocks and rule types
+	// to their end.
+	codes map[int]int
+	types map[int]int
+}
+
+func (s *scanner) scan() error {
+	for i := 0; i < len(s.src); {
+		c := s.src[i]
+		if end, ok := s.codes[i]; ok {
+			s.add(i, end, false)
+			i = end
+			continue
+		}
+		if end, ok := s.types[i]; ok {
+			s.add(i, end, false)
+			i = end
+			continue
+		}
+
+		var end int
+		comment := false
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+			continue
+		case strings.HasPrefix(s.src[i:], "//{"):
+			end = i + 3
+		case strings.HasPrefix(s.src[i:], "//"):
+			comment = true
+			end = strings.IndexByte(s.src[i:], '\n')
+			if end < 0 {
+				end = len(s.src)
+			} else {
+				end += i
+			}
+		case strings.HasPrefix(s.src[i:], "/*"):
+			comment = true
+			end = strings.Index(s.src[i+2:], "*/")
+			if end < 0 {
+				return fmt.Errorf("comment at offset %d not terminated", i)
+			}
+			end += i + 4
+		case c == '"' || c == '\'' || c == '`':
+			end = s.stringEnd(i)
+		case c == '[':
+			end = s.classEnd(i)
+		default:
+			end = i + 1
+		}
+		if end < 0 {
+			return fmt.Errorf("literal at offset %d not terminated", i)
+		}
+		s.add(i, end, comment)
+		i = end
+	}
+	return nil
+}
+
+func (s *scanner) add(start, end int, comment bool) {
+	s.spans = append(s.spans, span{start: start, end: end, comment: comment})
+}
+
+// stringEnd returns the end of the string literal starting at offset i,
+// or -1.
+func (s *scanner) stringEnd(i int) int {
+	quote := s.src[i]
+	for j := i + 1; j < len(s.src); j++ {
+		switch s.src[j] {
+		case '\\':
+			if quote != '`' {
+				j++
+			}
+		case quote:
+			return j + 1
+		}
+	}
+	return -1
+}
+
+// classEnd returns the end of the character class starting at offset i,
+// or -1. The nested classes of the set operations are included.
+func (s *scanner) classEnd(i int) int {
+	depth := 0
+	for j := i; j < len(s.src); j++ {
+		switch {
+		case s.src[j] == '\\':
+			j++
+		case s.src[j] == '[' && (j == i || strings.HasSuffix(s.src[:j], "--") || strings.HasSuffix(s.src[:j], "&&")):
+			depth++
+		case s.src[j] == ']':
+			depth--
+			if depth == 0 {
+				return j + 1
+			}
+		}
+	}
+	return -1
+}
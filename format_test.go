@@ -0,0 +1,138 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/fy0/pigeon/ast"
+	"github.com/fy0/pigeon/format"
+)
+
+func TestFormat(t *testing.T) {
+	cases := []struct {
+		grammar, want string
+	}{
+		{
+			grammar: "A = 'a'\nBcd = 'b' ;\n\n\nE = `e`i",
+			want:    "A   = \"a\"\nBcd = \"b\"\n\nE = \"e\"i\n",
+		},
+		{
+			grammar: "A <- B\nB = [a-z]+ / ( 'x' 'y' )? &. !B",
+			want:    "A <- B\nB <- [a-z]+ / ( \"x\" \"y\" )? &. !B\n",
+		},
+		{
+			grammar: "{\npackage p\n}\nA 'n' = a:'a' { return a } / b:'b' { return b }",
+			want:    "{\npackage p\n}\n\nA \"n\" = a:\"a\" { return a } / b:\"b\" { return b }\n",
+		},
+		{
+			grammar: "A = 'a' {\n\treturn nil\n} / 'b'",
+			want:    "A = \"a\" {\n\treturn nil\n}\n    / \"b\"\n",
+		},
+		{
+			grammar: "A = " + strings.Repeat("\"abcdefgh\" ", 6) + "/ " + strings.Repeat("\"abcdefgh\" ", 3),
+			want:    "A = " + strings.Repeat("\"abcdefgh\" ", 5) + "\"abcdefgh\"\n    / \"abcdefgh\" \"abcdefgh\" \"abcdefgh\"\n",
+		},
+		{
+			grammar: "// first\nA = 'a' // a\n  / 'b' /* b */\n  // c\n  / 'c' // end\n\n// last\n",
+			want:    "// first\nA = \"a\" // a\n    / \"b\" /* b */\n    // c\n    / \"c\" // end\n\n// last\n",
+		},
+		{
+			grammar: "A = ( 'a' // a\n 'b' ) 'c'\nB = 'b'",
+			want:    "A = ( \"a\" \"b\" ) \"c\" // a\nB = \"b\"\n",
+		},
+		{
+			grammar: "A <- b:B /* inline */ \"x\" /* action */ { return b }",
+			want:    "A <- b:B /* inline */ \"x\" /* action */ { return b }\n",
+		},
+		{
+			grammar: "A = 'a' /* x */ 'b'\n  / ( 'c' // c\n 'd' ) /* d */ 'e'\n  / 'f' /* f\n*/ 'g' // g\n",
+			want:    "A = \"a\" /* x */ \"b\"\n    / ( \"c\" \"d\" ) /* d */ \"e\" // c\n    /* f\n*/\n    / \"f\" \"g\" // g\n",
+		},
+		{
+			grammar: "A = ( 'a' { return 1 } ) 'b' { return 2 }\nB = 'b' { return 1 } 'c' { return 2 }",
+			want:    "A = ( \"a\" { return 1 } ) \"b\" { return 2 }\nB = \"b\" { return 1 } \"c\" { return 2 }\n",
+		},
+		{
+			grammar: "A = !'a' & ('b' / 'c') !( !'b' ) '[' [^\\]] @x:<'y'> %{err} //{err} 'z'",
+			want:    "A = !\"a\" &( \"b\" / \"c\" ) !( !\"b\" ) \"[\" [^\\]] @x:<\"y\"> %{err} //{err} \"z\"\n",
+		},
+		{
+			grammar: "@export @name('x')\nA = 'a'\nB = 'b'",
+			want:    "@export @name(\"x\")\nA = \"a\"\nB = \"b\"\n",
+		},
+	}
+
+	for _, tc := range cases {
+		got := formatGrammar(t, tc.grammar, tc.grammar)
+		if got != tc.want {
+			t.Errorf("%q: want\n%s\ngot\n%s", tc.grammar, tc.want, got)
+			continue
+		}
+		if again := formatGrammar(t, tc.grammar, got); again != got {
+			t.Errorf("%q: formatting is not idempotent, got\n%s", tc.grammar, again)
+		}
+	}
+}
+
+// TestFormatGrammars formats the grammars of the repository and checks
+// that the formatting is idempotent and does not change their meaning.
+func TestFormatGrammars(t *testing.T) {
+	files, err := filepath.Glob("grammar/*.peg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, pattern := range []string{"examples/*/*.peg", "test/*/*.peg"} {
+		more, err := filepath.Glob(pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, more...)
+	}
+
+	for _, file := range files {
+		src, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		exp, err := Parse(file, src)
+		if err != nil {
+			// the grammars of the tests of parse errors
+			continue
+		}
+		got := formatGrammar(t, file, string(src))
+		if again := formatGrammar(t, file, got); again != got {
+			t.Errorf("%s: formatting is not idempotent", file)
+			continue
+		}
+
+		g, err := Parse(file, []byte(got))
+		if err != nil {
+			t.Errorf("%s: parse error: %v", file, err)
+			continue
+		}
+		expg := exp.(*ast.Grammar)
+		for _, rule := range expg.Rules {
+			if rule.DisplayName != nil {
+				s, _ := strconv.Unquote(rule.DisplayName.Val)
+				rule.DisplayName.Val = strconv.Quote(s)
+			}
+		}
+		compareGrammars(t, file, expg, g.(*ast.Grammar))
+	}
+}
+
+func formatGrammar(t *testing.T, name, grammar string) string {
+	t.Helper()
+	g, err := Parse("", []byte(grammar))
+	if err != nil {
+		t.Fatalf("%s: parse error: %v", name, err)
+	}
+	res, err := format.Source([]byte(grammar), g.(*ast.Grammar))
+	if err != nil {
+		t.Fatalf("%s: format error: %v", name, err)
+	}
+	return string(res)
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/fy0/pigeon/ast"
+	"github.com/fy0/pigeon/sentence"
+)
+
+var genUsagePage = `usage: %[1]s gen [options] GRAMMAR_FILE
+
+Gen generates random sentences of the PEG grammar of GRAMMAR_FILE, e.g. to
+seed the fuzzing of the generated parser with inputs that reach deep rules
+instead of random bytes. By default, the sentences are written to stdout,
+one per line.
+
+The sentences are generated by walking the rules: the choices pick a
+weighted random alternative, the repetitions repeat their expression a
+random number of times and the literals, character classes and any
+matchers write the text they match. Once the depth budget of nested rules
+or the length budget is spent, the sentences are ended as soon as
+possible. Each sentence is then parsed with the grammar, as the run command
+does, and rejected if it does not match without error, which takes the
+predicates into account.
+
+The exit code is 0 on success, 10 if no matching sentence could be
+generated, 9 if the grammar has errors, 3 if it cannot be parsed, 2 if it
+cannot be opened, 7 if a sentence cannot be written and 1 if the arguments
+are invalid.
+
+The following options can be specified:
+
+	-depth N
+		depth budget of nested rules. Defaults to 16.
+	-entrypoint RULE
+		name of the rule of the sentences. Defaults to the first rule of
+		the grammar.
+	-fuzz-dir DIR
+		write each sentence as a file of the Go fuzzing corpus in DIR,
+		e.g. testdata/fuzz/FuzzParse, for a fuzz target with a []byte
+		argument, instead of stdout.
+	-h -help
+		display this help message.
+	-length N
+		length budget in bytes, after which the sentences are ended as
+		soon as possible. Defaults to 256.
+	-n N
+		number of sentences to generate. Defaults to 10.
+	-quote
+		write the sentences as quoted Go strings.
+	-repeat N
+		maximum number of repetitions of * and of additional
+		repetitions of +. Defaults to 3.
+	-seed N
+		seed of the random generator. Defaults to 1.
+	-skip-rule NAME
+		name of the rule applied implicitly before each token, as for
+		the generation of the parser.
+	-weight RULE=W[,W...]
+		relative weights of the alternatives of the top-level choice
+		of RULE. Can be repeated for several rules.
+`
+
+// weightsFlag is a flag setting the weights of the alternatives of rules.
+type weightsFlag map[string][]float64
+
+func (w weightsFlag) String() string {
+	return fmt.Sprint(map[string][]float64(w))
+}
+
+func (w weightsFlag) Set(value string) error {
+	name, list, ok := strings.Cut(value, "=")
+	if !ok || name == "" {
+		return fmt.Errorf("want RULE=W[,W...], got %q", value)
+	}
+	var weights []float64
+	for _, s := range strings.Split(list, ",") {
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return err
+		}
+		weights = append(weights, f)
+	}
+	w[name] = weights
+	return nil
+}
+
+// genMain implements the gen command.
+func genMain(args []string) {
+	fs := flag.NewFlagSet(os.Args[0]+" gen", flag.ExitOnError)
+	var (
+		shortHelpFlag  = fs.Bool("h", false, "show help page")
+		longHelpFlag   = fs.Bool("help", false, "show help page")
+		depthFlag      = fs.Int("depth", sentence.DefaultMaxDepth, "depth budget of nested rules")
+		entrypointFlag = fs.String("entrypoint", "", "rule of the sentences")
+		fuzzDirFlag    = fs.String("fuzz-dir", "", "write the sentences as Go fuzzing corpus files in `DIR`")
+		lengthFlag     = fs.Int("length", sentence.DefaultMaxLength, "length budget in bytes")
+		nFlag          = fs.Int("n", 10, "number of sentences")
+		quoteFlag      = fs.Bool("quote", false, "write the sentences as quoted Go strings")
+		repeatFlag     = fs.Int("repeat", sentence.DefaultMaxRepeat, "maximum number of repetitions")
+		seedFlag       = fs.Int64("seed", 1, "seed of the random generator")
+		skipRuleFlag   = fs.String("skip-rule", "", "rule applied implicitly before each token")
+
+		weights = weightsFlag{}
+	)
+	fs.Var(weights, "weight", "relative weights of the alternatives of a rule, RULE=W[,W...]")
+	fs.Usage = func() {
+		fmt.Printf(genUsagePage, os.Args[0])
+	}
+	if err := fs.Parse(args); err != nil {
+		fmt.Fprintf(os.Stderr, "args parse error:\n%v\n", err)
+		exit(6)
+	}
+
+	if *shortHelpFlag || *longHelpFlag {
+		fs.Usage()
+		exit(0)
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "expected one argument, got %q\n", fs.Args())
+		fs.Usage()
+		exit(1)
+	}
+
+	nm, rc := input(fs.Arg(0))
+	g, err := ParseReader(nm, rc)
+	rc.Close()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "parse error(s):\n%v\n", err)
+		exit(3)
+	}
+	gen, err := sentence.New(g.(*ast.Grammar), sentence.Options{
+		Entrypoint: *entrypointFlag,
+		SkipRule:   *skipRuleFlag,
+		MaxDepth:   *depthFlag,
+		MaxLength:  *lengthFlag,
+		MaxRepeat:  *repeatFlag,
+		Weights:    weights,
+		Seed:       *seedFlag,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "grammar error(s):\n%v\n", err)
+		exit(9)
+	}
+
+	if *fuzzDirFlag != "" {
+		if err := os.MkdirAll(*fuzzDirFlag, 0755); err != nil {
+			fmt.Fprintf(os.Stderr, "write error: %v\n", err)
+			exit(7)
+		}
+	}
+	for i := 0; i < *nFlag; i++ {
+		b, err := gen.Sentence()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			exit(10)
+		}
+		switch {
+		case *fuzzDirFlag != "":
+			name, content := sentence.FuzzCorpusFile(b)
+			err = os.WriteFile(filepath.Join(*fuzzDirFlag, name), content, 0644)
+		case *quoteFlag:
+			_, err = fmt.Printf("%q\n", b)
+		default:
+			_, err = fmt.Printf("%s\n", b)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "write error: %v\n", err)
+			exit(7)
+		}
+	}
+}
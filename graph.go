@@ -0,0 +1,125 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/fy0/pigeon/ast"
+	"github.com/fy0/pigeon/graph"
+)
+
+var graphUsagePage = `usage: %[1]s graph [options] [GRAMMAR_FILE]
+
+Graph writes the rule reference graph of a PEG grammar, in the Graphviz DOT
+language or in JSON. The grammar is read from GRAMMAR_FILE, or from stdin if
+it is not specified.
+
+The graph marks the entrypoints (the first rule, the alternate entrypoints,
+the skip rule and the rules annotated with @export), the rules that are not
+reachable from an entrypoint, the strongly connected components of mutually
+recursive rules and the left-recursive rules and references, with the
+leaders of the left-recursive cycles. In DOT, the entrypoints have a double
+border, the unreachable rules are dashed and grey, the components are
+clusters and the left recursion is red, with the leaders in bold.
+
+The exit code is 0 on success, 9 if the grammar references undefined rules,
+3 if it cannot be parsed and 1 if the arguments are invalid.
+
+The following options can be specified:
+
+	-alternate-entrypoints RULE[,RULE...]
+		comma-separated list of rule names that are used as alternate
+		entrypoints, as for the generation of the parser.
+	-format FORMAT
+		output format, "dot" or "json". Defaults to "dot".
+	-h -help
+		display this help message.
+	-o OUTPUT_FILE
+		write the graph to OUTPUT_FILE. Defaults to stdout.
+	-skip-rule NAME
+		name of the rule applied implicitly before each token, as for
+		the generation of the parser.
+`
+
+// graphMain implements the graph command.
+func graphMain(args []string) {
+	fs := flag.NewFlagSet(os.Args[0]+" graph", flag.ExitOnError)
+	var (
+		shortHelpFlag = fs.Bool("h", false, "show help page")
+		longHelpFlag  = fs.Bool("help", false, "show help page")
+		formatFlag    = fs.String("format", "dot", "output format, dot or json")
+		outputFlag    = fs.String("o", "", "output file, defaults to stdout")
+		skipRuleFlag  = fs.String("skip-rule", "", "rule applied implicitly before each token")
+
+		altEntrypointsFlag ruleNamesFlag
+	)
+	fs.Var(&altEntrypointsFlag, "alternate-entrypoints", "comma-separated list of rule names that may be used as entrypoints")
+	fs.Usage = func() {
+		fmt.Printf(graphUsagePage, os.Args[0])
+	}
+	if err := fs.Parse(args); err != nil {
+		fmt.Fprintf(os.Stderr, "args parse error:\n%v\n", err)
+		exit(6)
+	}
+
+	if *shortHelpFlag || *longHelpFlag {
+		fs.Usage()
+		exit(0)
+	}
+	if fs.NArg() > 1 {
+		fmt.Fprintf(os.Stderr, "expected one argument, got %q\n", fs.Args())
+		fs.Usage()
+		exit(1)
+	}
+	if *formatFlag != "dot" && *formatFlag != "json" {
+		fmt.Fprintf(os.Stderr, "unknown format %q\n", *formatFlag)
+		fs.Usage()
+		exit(1)
+	}
+
+	nm, rc := input(fs.Arg(0))
+	g, err := ParseReader(nm, rc)
+	rc.Close()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "parse error(s):\n%v\n", err)
+		exit(3)
+	}
+	grammar := g.(*ast.Grammar)
+	if err := ast.CheckRuleRefs(grammar, altEntrypointsFlag...); err != nil {
+		fmt.Fprintf(os.Stderr, "grammar error(s):\n%v\n", err)
+		exit(9)
+	}
+
+	gr, err := graph.New(grammar, graph.Options{
+		AlternateEntrypoints: altEntrypointsFlag,
+		SkipRule:             *skipRuleFlag,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "grammar error(s):\n%v\n", err)
+		exit(9)
+	}
+	var res []byte
+	if *formatFlag == "json" {
+		if res, err = gr.JSON(); err != nil {
+			fmt.Fprintf(os.Stderr, "write error: %v\n", err)
+			exit(7)
+		}
+		res = append(res, '\n')
+	} else {
+		res = gr.DOT()
+	}
+
+	out := output(*outputFlag)
+	if _, err := out.Write(res); err != nil {
+		fmt.Fprintf(os.Stderr, "write error: %v\n", err)
+		exit(7)
+	}
+	if out == os.Stdout {
+		return
+	}
+	if err := out.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "close file error:\n%v\n", err)
+		exit(8)
+	}
+}
@@ -0,0 +1,240 @@
+// Package graph computes the rule reference graph of PEG grammars, with
+// its strongly connected components and left-recursive rules, and exports
+// it as Graphviz DOT or JSON.
+package graph
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/fy0/pigeon/ast"
+	"github.com/fy0/pigeon/builder"
+)
+
+// Options configures the entrypoints of the graph.
+type Options struct {
+	// AlternateEntrypoints are the rules used as entrypoints in addition to
+	// the first rule and the rules annotated with @export.
+	AlternateEntrypoints []string
+	// SkipRule is the rule applied implicitly before each token, reachable
+	// as an entrypoint.
+	SkipRule string
+}
+
+// Graph is the rule reference graph of a grammar.
+type Graph struct {
+	Rules []*Rule `json:"rules"`
+	Edges []Edge  `json:"edges"`
+	// SCCs are the strongly connected components of the graph that
+	// contain a cycle, i.e. the groups of mutually recursive rules, with
+	// their rules in the order of the grammar.
+	SCCs [][]string `json:"sccs"`
+}
+
+// Rule is a node of the graph.
+type Rule struct {
+	Name string `json:"name"`
+	// Entrypoint is set for the first rule, the alternate entrypoints, the
+	// skip rule and the rules annotated with @export.
+	Entrypoint bool `json:"entrypoint"`
+	// Unreachable is set if the rule cannot be reached from an
+	// entrypoint.
+	Unreachable bool `json:"unreachable"`
+	// SCC is the index of the strongly connected component of the rule in
+	// the SCCs of the graph, or -1 if the rule is not recursive.
+	SCC int `json:"scc"`
+	// LeftRecursive is set if the rule is part of a left-recursive cycle,
+	// and Leader if it is the rule of the cycle through which all the
+	// left-recursive cycles go, where the left recursion is resolved.
+	LeftRecursive bool `json:"left_recursive"`
+	Leader        bool `json:"leader"`
+	Nullable      bool `json:"nullable"`
+}
+
+// Edge is a reference from the rule From to the rule To. Left is set if
+// the reference may be invoked at the initial position of From, i.e. it
+// can be part of a left recursion.
+type Edge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	Left bool   `json:"left"`
+}
+
+// New returns the rule reference graph of g. The references of g must all
+// be defined rules. The nullable and left recursion flags of the rules of
+// g are computed as for the generation of the parser.
+func New(g *ast.Grammar, opts Options) (*Graph, error) {
+	if _, err := builder.PrepareGrammar(g); err != nil {
+		return nil, err
+	}
+
+	gr := &Graph{Rules: []*Rule{}, Edges: []Edge{}, SCCs: [][]string{}}
+	rules := make(map[string]*Rule, len(g.Rules))
+	index := make(map[string]int, len(g.Rules))
+	vertices := make([]string, 0, len(g.Rules))
+	refs := make(map[string]map[string]struct{}, len(g.Rules))
+	for _, rule := range g.Rules {
+		name := rule.Name.Val
+		if _, ok := rules[name]; ok {
+			continue
+		}
+		r := &Rule{
+			Name:          name,
+			SCC:           -1,
+			LeftRecursive: rule.LeftRecursive,
+			Leader:        rule.Leader,
+			Nullable:      rule.Nullable,
+		}
+		rules[name] = r
+		index[name] = len(gr.Rules)
+		gr.Rules = append(gr.Rules, r)
+		vertices = append(vertices, name)
+
+		initial := rule.InitialNames()
+		refs[name] = make(map[string]struct{})
+		ast.Inspect(rule.Expr, func(expr ast.Expression) bool {
+			ref, ok := expr.(*ast.RuleRefExpr)
+			if !ok {
+				return true
+			}
+			if _, ok := refs[name][ref.Name.Val]; !ok {
+				refs[name][ref.Name.Val] = struct{}{}
+				_, left := initial[ref.Name.Val]
+				gr.Edges = append(gr.Edges, Edge{From: name, To: ref.Name.Val, Left: left})
+			}
+			return true
+		})
+	}
+
+	// the components with a cycle, in the order of the grammar
+	for _, scc := range builder.StronglyConnectedComponents(vertices, refs) {
+		var names []string
+		for name := range scc {
+			names = append(names, name)
+		}
+		if len(names) == 1 {
+			if _, ok := refs[names[0]][names[0]]; !ok {
+				continue
+			}
+		}
+		sort.Slice(names, func(i, j int) bool { return index[names[i]] < index[names[j]] })
+		gr.SCCs = append(gr.SCCs, names)
+	}
+	sort.Slice(gr.SCCs, func(i, j int) bool { return index[gr.SCCs[i][0]] < index[gr.SCCs[j][0]] })
+	for i, scc := range gr.SCCs {
+		for _, name := range scc {
+			rules[name].SCC = i
+		}
+	}
+
+	// the rules reachable from the entrypoints
+	reachable := make(map[string]bool, len(gr.Rules))
+	var reach func(name string)
+	reach = func(name string) {
+		if _, ok := rules[name]; !ok || reachable[name] {
+			return
+		}
+		reachable[name] = true
+		for ref := range refs[name] {
+			reach(ref)
+		}
+	}
+	entrypoint := func(name string) {
+		if r, ok := rules[name]; ok {
+			r.Entrypoint = true
+			reach(name)
+		}
+	}
+	if len(g.Rules) > 0 {
+		entrypoint(g.Rules[0].Name.Val)
+	}
+	for _, name := range opts.AlternateEntrypoints {
+		entrypoint(name)
+	}
+	entrypoint(opts.SkipRule)
+	for _, rule := range g.Rules {
+		if rule.HasAnnotation("export") {
+			entrypoint(rule.Name.Val)
+		}
+	}
+	for _, r := range gr.Rules {
+		r.Unreachable = !reachable[r.Name]
+	}
+	return gr, nil
+}
+
+// JSON returns the graph encoded in JSON.
+func (gr *Graph) JSON() ([]byte, error) {
+	return json.MarshalIndent(gr, "", "\t")
+}
+
+// DOT returns the graph in the Graphviz DOT language. The entrypoints have
+// a double border, the unreachable rules are dashed and grey, the rules of
+// a strongly connected component are grouped in a cluster and the
+// left-recursive rules and references are red, with the leaders in bold.
+func (gr *Graph) DOT() []byte {
+	var buf bytes.Buffer
+	buf.WriteString("digraph grammar {\n\tnode [shape=box];\n")
+
+	clustered := make(map[string]bool)
+	for i, scc := range gr.SCCs {
+		fmt.Fprintf(&buf, "\tsubgraph cluster_%d {\n\t\tlabel=%q;\n\t\tstyle=dashed;\n", i, fmt.Sprintf("SCC %d", i))
+		for _, name := range scc {
+			clustered[name] = true
+		}
+		for _, r := range gr.Rules {
+			if r.SCC == i {
+				buf.WriteString("\t\t" + r.dot() + "\n")
+			}
+		}
+		buf.WriteString("\t}\n")
+	}
+	for _, r := range gr.Rules {
+		if !clustered[r.Name] {
+			buf.WriteString("\t" + r.dot() + "\n")
+		}
+	}
+
+	rules := make(map[string]*Rule, len(gr.Rules))
+	for _, r := range gr.Rules {
+		rules[r.Name] = r
+	}
+	for _, e := range gr.Edges {
+		from, to := rules[e.From], rules[e.To]
+		fmt.Fprintf(&buf, "\t%q -> %q", e.From, e.To)
+		if e.Left && from != nil && to != nil && from.LeftRecursive && to.LeftRecursive && from.SCC == to.SCC {
+			buf.WriteString(" [color=red]")
+		}
+		buf.WriteString(";\n")
+	}
+	buf.WriteString("}\n")
+	return buf.Bytes()
+}
+
+// dot returns the node statement of the rule.
+func (r *Rule) dot() string {
+	var attrs, styles []string
+	if r.Entrypoint {
+		attrs = append(attrs, "peripheries=2")
+	}
+	if r.Unreachable {
+		styles = append(styles, "dashed")
+		attrs = append(attrs, "color=grey50", "fontcolor=grey50")
+	}
+	if r.LeftRecursive {
+		attrs = append(attrs, "color=red")
+	}
+	if r.Leader {
+		styles = append(styles, "bold")
+	}
+	if len(styles) > 0 {
+		attrs = append(attrs, fmt.Sprintf("style=%q", strings.Join(styles, ",")))
+	}
+	if len(attrs) == 0 {
+		return fmt.Sprintf("%q;", r.Name)
+	}
+	return fmt.Sprintf("%q [%s];", r.Name, strings.Join(attrs, ", "))
+}
@@ -0,0 +1,75 @@
+package graph
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/fy0/pigeon/bootstrap"
+)
+
+const grammar = `
+Start = Expr EOF
+Expr = Expr '+' Term / Term
+Term = '(' Expr ')' / Num
+Num = [0-9]+ Num?
+EOF = !.
+Unused = Num
+Export = 'x'
+Space = ' '*
+`
+
+func TestNew(t *testing.T) {
+	g, err := bootstrap.NewParser().Parse("", strings.NewReader(grammar))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gr, err := New(g, Options{AlternateEntrypoints: []string{"Export"}, SkipRule: "Space"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, r := range gr.Rules {
+		got = append(got, r.dot())
+	}
+	want := []string{
+		`"Start" [peripheries=2];`,
+		`"Expr" [color=red, style="bold"];`,
+		`"Term";`,
+		`"Num";`,
+		`"EOF";`,
+		`"Unused" [color=grey50, fontcolor=grey50, style="dashed"];`,
+		`"Export" [peripheries=2];`,
+		`"Space" [peripheries=2];`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("want rules\n%s\ngot\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+
+	if len(gr.SCCs) != 2 || strings.Join(gr.SCCs[0], ",") != "Expr,Term" || strings.Join(gr.SCCs[1], ",") != "Num" {
+		t.Errorf("want SCCs [[Expr Term] [Num]], got %v", gr.SCCs)
+	}
+	if gr.Rules[1].SCC != 0 || gr.Rules[3].SCC != 1 || gr.Rules[0].SCC != -1 {
+		t.Errorf("want SCC indexes 0, 1 and -1, got %d, %d and %d", gr.Rules[1].SCC, gr.Rules[3].SCC, gr.Rules[0].SCC)
+	}
+
+	dot := string(gr.DOT())
+	for _, want := range []string{
+		"\tsubgraph cluster_0 {\n\t\tlabel=\"SCC 0\";\n\t\tstyle=dashed;\n\t\t\"Expr\" [color=red, style=\"bold\"];\n\t\t\"Term\";\n\t}\n",
+		"\t\"Expr\" -> \"Expr\" [color=red];\n",
+		"\t\"Expr\" -> \"Term\";\n",
+		"\t\"Term\" -> \"Expr\";\n",
+	} {
+		if !strings.Contains(dot, want) {
+			t.Errorf("want %q in\n%s", want, dot)
+		}
+	}
+
+	js, err := gr.JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(js), `"from": "Expr",`+"\n\t\t\t"+`"to": "Expr",`+"\n\t\t\t"+`"left": true`) {
+		t.Errorf("want the left reference of Expr in\n%s", js)
+	}
+}
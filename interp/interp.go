@@ -0,0 +1,310 @@
+// Package interp runs PEG grammars directly on an input, without generating
+// and building a parser, and returns the parse tree of the matched rules.
+//
+// The input is parsed exactly as the generated parser would parse it, with
+// the same error messages, except that the code blocks are not run: the
+// actions and the code expressions return nothing, and the predicates &{}
+// and !{} always succeed.
+package interp
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/fy0/pigeon/ast"
+	"github.com/fy0/pigeon/builder"
+)
+
+// Options configures the interpretation of a grammar.
+type Options struct {
+	// AlternateEntrypoints are the rules that may be used as entrypoints
+	// in addition to the first rule. They must be defined rules.
+	AlternateEntrypoints []string
+	// SkipRule is the rule applied implicitly before each token of the
+	// syntactic rules, as with the -skip-rule flag.
+	SkipRule string
+}
+
+// Interpreter parses inputs with a grammar.
+type Interpreter struct {
+	rules     map[string]*ast.Rule
+	first     string
+	skipRule  *ast.Rule
+	syntactic map[*ast.Rule]bool
+	lits      map[*ast.LitMatcher]*litMatcher
+	classes   map[*ast.CharClassMatcher]*charClass
+}
+
+// New returns an interpreter of g. The grammar is checked as for the
+// generation of the parser: the references must be defined rules, the
+// repeated expressions must not match the empty input and the grammar must
+// not be left-recursive.
+func New(g *ast.Grammar, opts Options) (*Interpreter, error) {
+	if len(g.Rules) == 0 {
+		return nil, errNoRule
+	}
+	if err := ast.CheckRuleRefs(g, opts.AlternateEntrypoints...); err != nil {
+		return nil, err
+	}
+	if err := ast.CheckRepetitions(g); err != nil {
+		return nil, err
+	}
+	leftRecursive, err := builder.PrepareGrammar(g)
+	if err != nil {
+		return nil, err
+	}
+	if leftRecursive {
+		return nil, builder.ErrHaveLeftRecursion
+	}
+
+	in := &Interpreter{
+		rules:     make(map[string]*ast.Rule, len(g.Rules)),
+		first:     g.Rules[0].Name.Val,
+		syntactic: make(map[*ast.Rule]bool),
+		lits:      make(map[*ast.LitMatcher]*litMatcher),
+		classes:   make(map[*ast.CharClassMatcher]*charClass),
+	}
+	for _, rule := range g.Rules {
+		in.rules[rule.Name.Val] = rule
+	}
+
+	if opts.SkipRule != "" {
+		lexical, err := builder.LexicalRules(g, opts.SkipRule)
+		if err != nil {
+			return nil, err
+		}
+		b := &builder.Builder{SkipRule: opts.SkipRule, LexicalRules: lexical}
+		for _, rule := range g.Rules {
+			in.syntactic[rule] = b.IsSyntactic(rule)
+		}
+		in.skipRule = in.rules[opts.SkipRule]
+	}
+
+	var errs []error
+	ast.Inspect(g, func(expr ast.Expression) bool {
+		switch expr := expr.(type) {
+		case *ast.LitMatcher:
+			in.lits[expr] = newLitMatcher(expr)
+		case *ast.CharClassMatcher:
+			cl, err := newCharClass(expr, expr.IgnoreCase)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", expr.Pos(), err))
+			}
+			in.classes[expr] = cl
+		}
+		return true
+	})
+	if len(errs) > 0 {
+		return nil, ast.ErrorList(errs)
+	}
+	return in, nil
+}
+
+// litMatcher is a literal, ready to be matched.
+type litMatcher struct {
+	val        []rune
+	ignoreCase bool
+	want       string
+}
+
+func newLitMatcher(lit *ast.LitMatcher) *litMatcher {
+	m := &litMatcher{
+		val:        []rune(lit.Val),
+		ignoreCase: lit.IgnoreCase,
+		want:       strconv.Quote(lit.Val),
+	}
+	if lit.IgnoreCase {
+		m.val = []rune(strings.ToLower(lit.Val))
+		m.want += "i"
+	}
+	return m
+}
+
+// charClass is a character class, ready to be matched. The operands of the
+// set operations use the ignoreCase flag of the outermost class.
+type charClass struct {
+	val        string
+	chars      []rune
+	ranges     []rune
+	classes    []*unicode.RangeTable
+	notClasses []*unicode.RangeTable
+	intersect  []*charClass
+	subtract   []*charClass
+	ignoreCase bool
+	inverted   bool
+}
+
+func newCharClass(ch *ast.CharClassMatcher, ignoreCase bool) (*charClass, error) {
+	cl := &charClass{
+		val:        ch.Val,
+		ignoreCase: ignoreCase,
+		inverted:   ch.Inverted,
+	}
+	for _, rn := range ch.Chars {
+		if ignoreCase {
+			rn = unicode.ToLower(rn)
+		}
+		cl.chars = append(cl.chars, rn)
+	}
+	for _, rn := range ch.Ranges {
+		if ignoreCase {
+			rn = unicode.ToLower(rn)
+		}
+		cl.ranges = append(cl.ranges, rn)
+	}
+	for _, name := range ch.UnicodeClasses {
+		table, err := rangeTable(name)
+		if err != nil {
+			return nil, err
+		}
+		cl.classes = append(cl.classes, table)
+	}
+	for _, name := range ch.NotUnicodeClasses {
+		table, err := rangeTable(name)
+		if err != nil {
+			return nil, err
+		}
+		cl.notClasses = append(cl.notClasses, table)
+	}
+	for _, op := range ch.Intersect {
+		set, err := newCharClass(op, ignoreCase)
+		if err != nil {
+			return nil, err
+		}
+		cl.intersect = append(cl.intersect, set)
+	}
+	for _, op := range ch.Subtract {
+		set, err := newCharClass(op, ignoreCase)
+		if err != nil {
+			return nil, err
+		}
+		cl.subtract = append(cl.subtract, set)
+	}
+	return cl, nil
+}
+
+// rangeTable returns the table of the Unicode class name, which is the name
+// of the variable of the unicode package used by the generated parser.
+func rangeTable(name string) (*unicode.RangeTable, error) {
+	for _, tables := range []map[string]*unicode.RangeTable{
+		unicode.Categories, unicode.Scripts, unicode.Properties,
+	} {
+		if table, ok := tables[name]; ok {
+			return table, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown Unicode class %q", name)
+}
+
+// match returns true if rn is in the set of characters of the class.
+func (cl *charClass) match(rn rune) bool {
+	if cl.ignoreCase {
+		rn = unicode.ToLower(rn)
+	}
+	in := cl.contains(rn)
+	if in {
+		for _, set := range cl.intersect {
+			if !set.match(rn) {
+				in = false
+				break
+			}
+		}
+	}
+	if in {
+		for _, set := range cl.subtract {
+			if set.match(rn) {
+				in = false
+				break
+			}
+		}
+	}
+	return in != cl.inverted
+}
+
+// contains returns true if rn is in the chars, ranges or Unicode classes of
+// the class, before the set operations are applied.
+func (cl *charClass) contains(rn rune) bool {
+	for _, c := range cl.chars {
+		if c == rn {
+			return true
+		}
+	}
+	for i := 0; i < len(cl.ranges); i += 2 {
+		if rn >= cl.ranges[i] && rn <= cl.ranges[i+1] {
+			return true
+		}
+	}
+	for _, table := range cl.classes {
+		if unicode.Is(table, rn) {
+			return true
+		}
+	}
+	for _, table := range cl.notClasses {
+		if !unicode.Is(table, rn) {
+			return true
+		}
+	}
+	return false
+}
+
+// Position is a position in the input. Line is 1-based, Offset is the
+// 0-based byte offset. Col is the 1-based column in runes, except for the
+// newline characters that are at the column 0 of the next line, as in the
+// generated parser.
+type Position struct {
+	Line   int `json:"line"`
+	Col    int `json:"col"`
+	Offset int `json:"offset"`
+}
+
+// String returns the position as "line:col (offset)", as in the errors.
+func (p Position) String() string {
+	return fmt.Sprintf("%d:%d (%d)", p.Line, p.Col, p.Offset)
+}
+
+// Node is a rule matched in the input. The rules matched in predicates and
+// by the skip rule are not part of the tree. For the syntactic rules, the
+// input skipped before the first token is not part of the node.
+type Node struct {
+	Rule     string   `json:"rule"`
+	Start    Position `json:"start"`
+	End      Position `json:"end"`
+	Text     string   `json:"text"`
+	Children []*Node  `json:"children,omitempty"`
+}
+
+// maxText is the maximum length of the text of a node in String.
+const maxText = 40
+
+// String returns the tree rooted at n, one node per line indented by its
+// depth, with its rule, its span and its quoted text, shortened if needed.
+func (n *Node) String() string {
+	var buf strings.Builder
+	n.write(&buf, 0)
+	return buf.String()
+}
+
+func (n *Node) write(buf *strings.Builder, depth int) {
+	text, more := n.Text, ""
+	if len(text) > maxText {
+		cut := maxText
+		for cut > 0 && !utf8.RuneStart(text[cut]) {
+			cut--
+		}
+		text, more = text[:cut], "..."
+	}
+	fmt.Fprintf(buf, "%s%s %d:%d-%d:%d %s%s\n", strings.Repeat("  ", depth),
+		n.Rule, n.Start.Line, n.Start.Col, n.End.Line, n.End.Col, strconv.Quote(text), more)
+	for _, child := range n.Children {
+		child.write(buf, depth+1)
+	}
+}
+
+// JSON returns the tree rooted at n as indented JSON.
+func (n *Node) JSON() ([]byte, error) {
+	return json.MarshalIndent(n, "", "  ")
+}
@@ -0,0 +1,177 @@
+package interp
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/fy0/pigeon/bootstrap"
+)
+
+func newInterpreter(t *testing.T, grammar string, opts Options) *Interpreter {
+	t.Helper()
+	g, err := bootstrap.NewParser().Parse("", strings.NewReader(grammar))
+	if err != nil {
+		t.Fatal(err)
+	}
+	in, err := New(g, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return in
+}
+
+func TestParse(t *testing.T) {
+	in := newInterpreter(t, `
+Top = List EOF
+List = '[' Items? ']'
+Items = Item ( ',' Item )*
+Item = Number / List / Word
+Number "number" = [0-9]+ !Word
+Word = [a-z]i+ { return string(c.text) }
+EOF = !.
+`, Options{})
+
+	cases := []struct {
+		in, want, err string
+	}{
+		{in: "[]", want: "Top 1:1-1:3 \"[]\"\n  List 1:1-1:3 \"[]\"\n  EOF 1:3-1:3 \"\"\n"},
+		{in: "[1,ab,[]]", want: `Top 1:1-1:10 "[1,ab,[]]"
+  List 1:1-1:10 "[1,ab,[]]"
+    Items 1:2-1:9 "1,ab,[]"
+      Item 1:2-1:3 "1"
+        Number 1:2-1:3 "1"
+      Item 1:4-1:6 "ab"
+        Word 1:4-1:6 "ab"
+      Item 1:7-1:9 "[]"
+        List 1:7-1:9 "[]"
+  EOF 1:10-1:10 ""
+`},
+		{in: "[1,]", err: `1:4 (3): no match found, expected: "[", [0-9] or [a-z]i`},
+		{in: "[1x]", err: `1:3 (2): no match found, expected: ![a-z]i or [0-9]`},
+		// No match error is added if the input has errors.
+		{in: "[\xff]", err: "1:2 (1): rule List: invalid encoding"},
+	}
+	for _, tc := range cases {
+		for _, memoize := range []bool{false, true} {
+			node, err := in.Parse("", []byte(tc.in), Memoize(memoize))
+			var got string
+			if node != nil {
+				got = node.String()
+			}
+			if got != tc.want {
+				t.Errorf("%q: want tree\n%s\ngot\n%s", tc.in, tc.want, got)
+			}
+			var gotErr string
+			if err != nil {
+				gotErr = err.Error()
+			}
+			if gotErr != tc.err {
+				t.Errorf("%q: want error\n%s\ngot\n%s", tc.in, tc.err, gotErr)
+			}
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	in := newInterpreter(t, `
+A "a list" = 'a'+ B?
+B = 'b'
+`, Options{AlternateEntrypoints: []string{"B"}})
+
+	_, err := in.Parse("file", []byte("c"))
+	el, ok := err.(ErrorList)
+	if !ok || len(el) != 1 {
+		t.Fatalf("want an ErrorList of 1 error, got %#v", err)
+	}
+	pe := el[0].(*ParseError)
+	if pe.Error() != `file:1:1 (0): no match found, expected: "a"` || pe.Rule != "" || len(pe.Expected) != 1 {
+		t.Errorf("want no match error without rule, got %q %q %q", pe, pe.Rule, pe.Expected)
+	}
+
+	node, err := in.Parse("file", []byte("b"), Entrypoint("B"))
+	if err != nil || node.Rule != "B" {
+		t.Errorf("want B to match with the B entrypoint, got %v %v", node, err)
+	}
+	if _, err := in.Parse("", []byte("b"), Entrypoint("C")); err == nil || err.Error() != "1:0 (0): invalid entrypoint" {
+		t.Errorf("want invalid entrypoint error, got %v", err)
+	}
+
+	// The invalid rune is not matched, but read after the a.
+	node, err = in.Parse("", []byte("a\xffb"))
+	if err == nil || err.Error() != "1:2 (1): rule a list: invalid encoding" || node.Text != "a" {
+		t.Errorf("want a match of a with invalid encoding error, got %v %v", node, err)
+	}
+	node, err = in.Parse("", []byte("a\xffb"), AllowInvalidUTF8(true))
+	if err != nil || node.Text != "a" {
+		t.Errorf("want a match of a, got %v %v", node, err)
+	}
+	_, err = in.Parse("", []byte("aaaab"), MaxExpressions(5))
+	if err == nil || err.Error() != "1:4 (3): rule a list: max number of expressions parsed" {
+		t.Errorf("want max expressions error, got %v", err)
+	}
+}
+
+func TestParseSkipRule(t *testing.T) {
+	in := newInterpreter(t, `
+File = Call !.
+Call = name:ident '(' Args? ')'
+Args = Arg ( ',' Arg )*
+Arg = Call / ident
+ident = [a-z]+
+_ = ( ' ' / comment )*
+comment = '#' [^\n]* '\n'
+`, Options{SkipRule: "_"})
+
+	node, err := in.Parse("", []byte("f ( a, #x\n g() )"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `File 1:1-2:7 "f ( a, #x\n g() )"
+  Call 1:1-2:7 "f ( a, #x\n g() )"
+    ident 1:1-1:2 "f"
+    Args 1:5-2:5 "a, #x\n g()"
+      Arg 1:5-1:6 "a"
+        ident 1:5-1:6 "a"
+      Arg 2:2-2:5 "g()"
+        Call 2:2-2:5 "g()"
+          ident 2:2-2:3 "g"
+`
+	if got := node.String(); got != want {
+		t.Errorf("want tree\n%s\ngot\n%s", want, got)
+	}
+
+	if _, err := in.Parse("", []byte("f(a b)")); err == nil || err.Error() != `1:5 (4): no match found, expected: " ", "#", "(", ")" or ","` {
+		t.Errorf("want no match error, got %v", err)
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	cases := []struct {
+		grammar string
+		opts    Options
+		err     string
+	}{
+		{grammar: "A = B", err: "1:5 (4): rule A: undefined rule B"},
+		{grammar: "A = 'a'*", opts: Options{SkipRule: "B"}, err: `skip rule "B" is not defined`},
+		{grammar: "A = A 'a' / 'a'", err: "grammar contains left recursion"},
+		{grammar: "A = ( 'a'? )*", err: "1:7 (6): rule A: repeated expression matches the empty input"},
+	}
+	for _, tc := range cases {
+		g, err := bootstrap.NewParser().Parse("", strings.NewReader(tc.grammar))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = New(g, tc.opts)
+		if err == nil || err.Error() != tc.err {
+			t.Errorf("%q: want error %q, got %v", tc.grammar, tc.err, err)
+		}
+	}
+}
+
+func TestNodeString(t *testing.T) {
+	n := &Node{Rule: "A", Start: Position{1, 1, 0}, End: Position{1, 46, 45}, Text: strings.Repeat("é", 25)}
+	want := "A 1:1-1:46 \"" + strings.Repeat("é", 20) + "\"...\n"
+	if got := n.String(); got != want {
+		t.Errorf("want %q, got %q", want, got)
+	}
+}
@@ -0,0 +1,625 @@
+package interp
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/fy0/pigeon/ast"
+	"github.com/fy0/pigeon/builder"
+)
+
+var (
+	// errNoRule is returned when the grammar to parse has no rule.
+	errNoRule = errors.New("grammar has no rule")
+
+	// errInvalidEntrypoint is returned when the specified entrypoint rule
+	// does not exit.
+	errInvalidEntrypoint = errors.New("invalid entrypoint")
+
+	// errInvalidEncoding is returned when the source is not properly
+	// utf8-encoded.
+	errInvalidEncoding = errors.New("invalid encoding")
+
+	// errMaxExprCnt is used to signal that the maximum number of
+	// expressions have been parsed.
+	errMaxExprCnt = errors.New("max number of expressions parsed")
+)
+
+// A ParseOption configures a call to Parse.
+type ParseOption func(*parser)
+
+// Entrypoint sets the rule used to parse the input. It defaults to the
+// first rule of the grammar.
+func Entrypoint(ruleName string) ParseOption {
+	return func(p *parser) {
+		p.entrypoint = ruleName
+	}
+}
+
+// Memoize enables the memoization of the results of the expressions, as the
+// Memoize option of the generated parser. The rules annotated with @memo are
+// memoized in any case.
+func Memoize(b bool) ParseOption {
+	return func(p *parser) {
+		p.memoized = b
+	}
+}
+
+// MaxExpressions sets the maximum number of expressions parsed, after which
+// the parsing fails. 0 means no limit.
+func MaxExpressions(n uint64) ParseOption {
+	return func(p *parser) {
+		p.maxExprCnt = n
+	}
+}
+
+// AllowInvalidUTF8 accepts the input that is not valid UTF-8, as the
+// AllowInvalidUTF8 option of the generated parser.
+func AllowInvalidUTF8(b bool) ParseOption {
+	return func(p *parser) {
+		p.allowInvalidUTF8 = b
+	}
+}
+
+// ErrorList is the list of errors returned by Parse.
+type ErrorList []error
+
+// Error returns the error messages, one per line.
+func (e ErrorList) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// ParseError is an error found in the input. Expected is set if the input
+// does not match, with the expected tokens at the farthest position reached.
+type ParseError struct {
+	Inner    error
+	Pos      Position
+	Rule     string
+	Expected []string
+	prefix   string
+}
+
+// Error returns the error message, prefixed with its position and rule as
+// in the generated parser.
+func (e *ParseError) Error() string {
+	return e.prefix + ": " + e.Inner.Error()
+}
+
+// Parse parses b with the grammar and returns the tree of the matched rules,
+// or the errors found in the input as an ErrorList of *ParseError. The tree
+// is returned along with the errors if the input matches but is not valid
+// UTF-8. filename is used in the errors.
+func (in *Interpreter) Parse(filename string, b []byte, opts ...ParseOption) (*Node, error) {
+	p := &parser{
+		in:         in,
+		filename:   filename,
+		data:       b,
+		pt:         savepoint{Position: Position{Line: 1}},
+		maxFailPos: Position{Line: 1, Col: 1},
+		entrypoint: in.first,
+		memo:       [2]map[int]map[memoKey]*result{{}, {}},
+		nodes:      []*Node{{}},
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	if p.maxExprCnt == 0 {
+		p.maxExprCnt = math.MaxUint64
+	}
+	return p.parse()
+}
+
+type savepoint struct {
+	Position
+	rn rune
+	w  int
+}
+
+// memoKey identifies an expression of the grammar, with or without the skip
+// rule applied before it.
+type memoKey struct {
+	expr ast.Expression
+	skip bool
+}
+
+type result struct {
+	ok    bool
+	end   savepoint
+	nodes []*Node
+}
+
+type recovery struct {
+	labels    []ast.FailureLabel
+	expr      ast.Expression
+	syntactic bool
+}
+
+// parser mirrors the parser of the generated code. The values of the
+// expressions are not computed, as the code blocks are not run.
+type parser struct {
+	in       *Interpreter
+	filename string
+	data     []byte
+	pt       savepoint
+	errs     ErrorList
+
+	// rule stack, allows identification of the current rule in errors
+	rstack []*ast.Rule
+	// set if the current rule applies the skip rule before its tokens
+	syntactic bool
+	// depth of the predicates and skip rules, where the code and the
+	// nodes are skipped
+	skipCode int
+	// nodes of the rules being parsed, the first one holds the result
+	nodes []*Node
+
+	maxFailPos            Position
+	maxFailExpected       []string
+	maxFailInvertExpected bool
+
+	recoveryStack []recovery
+
+	memoized bool
+	memo     [2]map[int]map[memoKey]*result
+
+	exprCnt    uint64
+	maxExprCnt uint64
+	entrypoint string
+
+	allowInvalidUTF8 bool
+}
+
+func (p *parser) parse() (node *Node, err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			if e != errMaxExprCnt {
+				panic(e)
+			}
+			node = nil
+			p.addErr(errMaxExprCnt)
+			err = p.err()
+		}
+	}()
+
+	rule, ok := p.in.rules[p.entrypoint]
+	if !ok {
+		p.addErr(errInvalidEntrypoint)
+		return nil, p.err()
+	}
+
+	p.read() // advance to first rune
+	if !p.parseRule(rule) {
+		if len(p.errs) == 0 {
+			// If parsing fails, but no errors have been recorded, the expected values
+			// for the farthest parser position are returned as error.
+			set := make(map[string]struct{}, len(p.maxFailExpected))
+			for _, v := range p.maxFailExpected {
+				set[v] = struct{}{}
+			}
+			expected := make([]string, 0, len(set))
+			_, eof := set["!."]
+			delete(set, "!.")
+			for k := range set {
+				expected = append(expected, k)
+			}
+			sort.Strings(expected)
+			if eof {
+				expected = append(expected, "EOF")
+			}
+			inner := errors.New("no match found, expected: " + listJoin(expected, ", ", "or"))
+			p.addErrAt(inner, p.maxFailPos, expected)
+		}
+		return nil, p.err()
+	}
+	return p.nodes[0].Children[0], p.err()
+}
+
+func listJoin(list []string, sep string, lastSep string) string {
+	switch len(list) {
+	case 0:
+		return ""
+	case 1:
+		return list[0]
+	default:
+		return strings.Join(list[:len(list)-1], sep) + " " + lastSep + " " + list[len(list)-1]
+	}
+}
+
+// err returns the errors without duplicate messages, or nil.
+func (p *parser) err() error {
+	if len(p.errs) == 0 {
+		return nil
+	}
+	var errs ErrorList
+	set := make(map[string]bool)
+	for _, err := range p.errs {
+		if msg := err.Error(); !set[msg] {
+			set[msg] = true
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+func (p *parser) addErr(err error) {
+	p.addErrAt(err, p.pt.Position, []string{})
+}
+
+func (p *parser) addErrAt(err error, pos Position, expected []string) {
+	var buf strings.Builder
+	if p.filename != "" {
+		buf.WriteString(p.filename + ":")
+	}
+	buf.WriteString(pos.String())
+	pe := &ParseError{Inner: err, Pos: pos, Expected: expected}
+	if len(p.rstack) > 0 {
+		rule := p.rstack[len(p.rstack)-1]
+		pe.Rule = rule.Name.Val
+		if rule.DisplayName != nil && rule.DisplayName.Val != "" {
+			buf.WriteString(": rule " + rule.DisplayName.Val)
+		} else {
+			buf.WriteString(": rule " + rule.Name.Val)
+		}
+	}
+	pe.prefix = buf.String()
+	p.errs = append(p.errs, pe)
+}
+
+func (p *parser) failAt(fail bool, pos Position, want string) {
+	// process fail if parsing fails and not inverted or parsing succeeds and invert is set
+	if fail == p.maxFailInvertExpected {
+		if pos.Offset < p.maxFailPos.Offset {
+			return
+		}
+
+		if pos.Offset > p.maxFailPos.Offset {
+			p.maxFailPos = pos
+			p.maxFailExpected = p.maxFailExpected[:0]
+		}
+
+		if p.maxFailInvertExpected {
+			want = "!" + want
+		}
+		p.maxFailExpected = append(p.maxFailExpected, want)
+	}
+}
+
+// read advances the parser to the next rune.
+func (p *parser) read() {
+	p.pt.Offset += p.pt.w
+	rn, n := utf8.DecodeRune(p.data[p.pt.Offset:])
+	p.pt.rn = rn
+	p.pt.w = n
+	p.pt.Col++
+	if rn == '\n' {
+		p.pt.Line++
+		p.pt.Col = 0
+	}
+
+	if rn == utf8.RuneError && n == 1 { // see utf8.DecodeRune
+		if !p.allowInvalidUTF8 {
+			p.addErr(errInvalidEncoding)
+		}
+	}
+}
+
+// restore parser position to the savepoint pt.
+func (p *parser) restore(pt savepoint) {
+	if pt.Offset == p.pt.Offset {
+		return
+	}
+	p.pt = pt
+}
+
+func (p *parser) eof() bool {
+	return p.pt.rn == utf8.RuneError && p.pt.w == 0
+}
+
+// node returns the node of the current rule.
+func (p *parser) node() *Node {
+	return p.nodes[len(p.nodes)-1]
+}
+
+func (p *parser) parseRule(rule *ast.Rule) bool {
+	if rule.HasAnnotation("memo") && !p.memoized {
+		p.memoized = true
+		defer func() { p.memoized = false }()
+	}
+
+	p.rstack = append(p.rstack, rule)
+	syntactic := p.syntactic
+	p.syntactic = p.in.syntactic[rule]
+	if p.skipCode > 0 {
+		ok := p.parseExpr(rule.Expr)
+		p.syntactic = syntactic
+		p.rstack = p.rstack[:len(p.rstack)-1]
+		return ok
+	}
+
+	node := &Node{Rule: rule.Name.Val, Start: p.pt.Position}
+	p.nodes = append(p.nodes, node)
+	ok := p.parseExpr(rule.Expr)
+	p.nodes = p.nodes[:len(p.nodes)-1]
+	p.syntactic = syntactic
+	p.rstack = p.rstack[:len(p.rstack)-1]
+
+	if ok {
+		if node.Start.Offset > p.pt.Offset {
+			// The skipped input was given back.
+			node.Start = p.pt.Position
+		}
+		node.End = p.pt.Position
+		node.Text = string(p.data[node.Start.Offset:node.End.Offset])
+		parent := p.node()
+		parent.Children = append(parent.Children, node)
+	}
+	return ok
+}
+
+// parseExpr parses expr, applying the skip rule before it in the syntactic
+// rules if it is a token.
+func (p *parser) parseExpr(expr ast.Expression) bool {
+	return p.parseExprSkip(expr, p.syntactic && builder.NeedSkip(expr))
+}
+
+func (p *parser) parseExprSkip(expr ast.Expression, skip bool) bool {
+	p.exprCnt++
+	if p.exprCnt > p.maxExprCnt {
+		panic(errMaxExprCnt)
+	}
+
+	memo := p.memo[0]
+	if p.skipCode > 0 {
+		memo = p.memo[1]
+	}
+	key := memoKey{expr, skip}
+	pos := p.pt.Offset
+	node := p.node()
+	children := len(node.Children)
+
+	if p.memoized {
+		if res := memo[pos][key]; res != nil {
+			p.restore(res.end)
+			node.Children = append(node.Children, res.nodes...)
+			return res.ok
+		}
+	}
+
+	var ok bool
+	if skip {
+		ok = p.parseSkipExpr(expr)
+	} else {
+		ok = p.parseExprNoSkip(expr)
+	}
+	if !ok {
+		node.Children = node.Children[:children]
+	}
+
+	if p.memoized {
+		res := &result{ok: ok, end: p.pt}
+		if ok && len(node.Children) > children {
+			res.nodes = append([]*Node(nil), node.Children[children:]...)
+		}
+		if memo[pos] == nil {
+			memo[pos] = make(map[memoKey]*result)
+		}
+		memo[pos][key] = res
+	}
+	return ok
+}
+
+func (p *parser) parseExprNoSkip(expr ast.Expression) bool {
+	switch expr := expr.(type) {
+	case *ast.ActionExpr:
+		return p.parseExpr(expr.Expr)
+	case *ast.AndCodeExpr:
+		// The code is not run, the predicate succeeds.
+		return true
+	case *ast.AndExpr:
+		return p.parseAndExpr(expr)
+	case *ast.AnyMatcher:
+		return p.parseAnyMatcher()
+	case *ast.CharClassMatcher:
+		return p.parseCharClassMatcher(p.in.classes[expr])
+	case *ast.ChoiceExpr:
+		for _, alt := range expr.Alternatives {
+			if p.parseExpr(alt) {
+				return true
+			}
+		}
+		return false
+	case *ast.CodeExpr:
+		return true
+	case *ast.LabeledExpr:
+		return p.parseExpr(expr.Expr)
+	case *ast.LitMatcher:
+		return p.parseLitMatcher(p.in.lits[expr])
+	case *ast.NotCodeExpr:
+		// The code is not run, the predicate succeeds.
+		return true
+	case *ast.NotExpr:
+		return p.parseNotExpr(expr)
+	case *ast.OneOrMoreExpr:
+		return p.parseRepetition(expr.Expr, 1)
+	case *ast.RecoveryExpr:
+		p.recoveryStack = append(p.recoveryStack, recovery{
+			labels: expr.Labels, expr: expr.RecoverExpr, syntactic: p.syntactic,
+		})
+		ok := p.parseExpr(expr.Expr)
+		p.recoveryStack = p.recoveryStack[:len(p.recoveryStack)-1]
+		return ok
+	case *ast.RuleRefExpr:
+		return p.parseRule(p.in.rules[expr.Name.Val])
+	case *ast.SeqExpr:
+		pt := p.pt
+		for _, expr := range expr.Exprs {
+			if !p.parseExpr(expr) {
+				p.restore(pt)
+				return false
+			}
+		}
+		return true
+	case *ast.ThrowExpr:
+		return p.parseThrowExpr(expr)
+	case *ast.ZeroOrMoreExpr:
+		return p.parseRepetition(expr.Expr, 0)
+	case *ast.ZeroOrOneExpr:
+		p.parseExpr(expr.Expr)
+		// whether it matched or not, consider it a match
+		return true
+	default:
+		panic(fmt.Sprintf("unknown expression type %T", expr))
+	}
+}
+
+func (p *parser) parseAndExpr(and *ast.AndExpr) bool {
+	pt := p.pt
+
+	p.skipCode++
+	ok := p.parseExpr(and.Expr)
+	p.skipCode--
+
+	matchedOffset := p.pt.Offset
+	p.restore(pt)
+
+	if and.Logical {
+		return ok && p.pt.Offset != matchedOffset
+	}
+	return ok
+}
+
+func (p *parser) parseNotExpr(not *ast.NotExpr) bool {
+	pt := p.pt
+	p.maxFailInvertExpected = !p.maxFailInvertExpected
+
+	p.skipCode++
+	ok := p.parseExpr(not.Expr)
+	p.skipCode--
+
+	p.maxFailInvertExpected = !p.maxFailInvertExpected
+	matchedOffset := p.pt.Offset
+	p.restore(pt)
+
+	if not.Logical {
+		return !ok && p.pt.Offset != matchedOffset
+	}
+	return !ok
+}
+
+func (p *parser) parseAnyMatcher() bool {
+	if p.eof() {
+		p.failAt(false, p.pt.Position, ".")
+		return false
+	}
+	p.failAt(true, p.pt.Position, ".")
+	p.read()
+	return true
+}
+
+func (p *parser) parseCharClassMatcher(cl *charClass) bool {
+	// can't match EOF
+	if p.eof() {
+		p.failAt(false, p.pt.Position, cl.val)
+		return false
+	}
+	if cl.match(p.pt.rn) {
+		p.failAt(true, p.pt.Position, cl.val)
+		p.read()
+		return true
+	}
+	p.failAt(false, p.pt.Position, cl.val)
+	return false
+}
+
+func (p *parser) parseLitMatcher(lit *litMatcher) bool {
+	start := p.pt
+	for _, want := range lit.val {
+		cur := p.pt.rn
+		if lit.ignoreCase {
+			cur = unicode.ToLower(cur)
+		}
+		if cur != want {
+			p.failAt(false, start.Position, lit.want)
+			p.restore(start)
+			return false
+		}
+		p.read()
+	}
+	p.failAt(true, start.Position, lit.want)
+	return true
+}
+
+// parseRepetition parses expr repeatedly, and succeeds if it matches at
+// least min times.
+func (p *parser) parseRepetition(expr ast.Expression, min int) bool {
+	n := 0
+	for {
+		pos := p.pt.Offset
+		if !p.parseExpr(expr) {
+			break
+		}
+		n++
+		if p.pt.Offset == pos {
+			// the expression matched without consuming input, it would
+			// match forever
+			break
+		}
+	}
+	return n >= min
+}
+
+// parseSkipExpr applies the skip rule before parsing expr.
+func (p *parser) parseSkipExpr(expr ast.Expression) bool {
+	pt := p.pt
+	p.parseSkipRule()
+	if node := p.node(); p.skipCode == 0 && len(p.nodes) > 1 &&
+		node.Start.Offset == pt.Offset && len(node.Children) == 0 {
+		// Nothing but skipped input has been matched by the rule.
+		node.Start = p.pt.Position
+	}
+	ok := p.parseExprSkip(expr, false)
+	if !ok {
+		p.restore(pt)
+	}
+	return ok
+}
+
+// parseSkipRule consumes the input matched by the skip rule.
+func (p *parser) parseSkipRule() {
+	pt := p.pt
+	p.skipCode++
+	ok := p.parseRule(p.in.skipRule)
+	p.skipCode--
+	if !ok {
+		p.restore(pt)
+	}
+}
+
+func (p *parser) parseThrowExpr(expr *ast.ThrowExpr) bool {
+	for i := len(p.recoveryStack) - 1; i >= 0; i-- {
+		rec := p.recoveryStack[i]
+		for _, label := range rec.labels {
+			if string(label) != expr.Label {
+				continue
+			}
+			syntactic := p.syntactic
+			p.syntactic = rec.syntactic
+			ok := p.parseExpr(rec.expr)
+			p.syntactic = syntactic
+			if ok {
+				return true
+			}
+			break
+		}
+	}
+	return false
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/fy0/pigeon/ast"
+	"github.com/fy0/pigeon/lint"
+)
+
+// commands maps the names of the sub-commands to their implementation,
+// called with the command-line arguments following the name.
+var commands = map[string]func(args []string){
+	"ebnf":     ebnfMain,
+	"fmt":      fmtMain,
+	"gen":      genMain,
+	"graph":    graphMain,
+	"lint":     lintMain,
+	"railroad": railroadMain,
+	"repl":     replMain,
+	"run":      runMain,
+	"test":     testMain,
+}
+
+var lintUsagePage = `usage: %[1]s lint [options] [GRAMMAR_FILE]
+
+Lint reports the issues of a PEG grammar found by static checks. The
+grammar is read from GRAMMAR_FILE, or from stdin if it is not specified.
+
+The checks are:
+
+	undefined-rule        references to undefined rules
+	nullable-repetition   repetitions of expressions matching the empty input
+	duplicate-rule        rules defined more than once
+	unused-rule           rules not reachable from an entrypoint
+	missing-display-name  rules adding errors without a display name
+	unused-label          labels not used by a code block of their scope
+	shadowed-label        labels shadowing another label of the rule
+	uncaught-throw        thrown labels that no recovery expression catches
+	unreachable-code      statements of code blocks that never run
+	shadowed-alternative  alternatives of a choice that can never match
+
+Each issue is reported on a line of stdout, with its position and the name
+of the check, or as a JSON array of objects with the -json flag. The exit
+code is 0 if no issue is found, 10 if issues are found, 3 if the grammar
+cannot be parsed and 1 if the arguments are invalid.
+
+The following options can be specified:
+
+	-alternate-entrypoints RULE[,RULE...]
+		comma-separated list of rule names that are used as alternate
+		entrypoints, as for the generation of the parser.
+	-disable CHECK[,CHECK...]
+		comma-separated list of checks that are not run.
+	-h -help
+		display this help message.
+	-json
+		report the issues in JSON.
+	-skip-rule NAME
+		name of the rule applied implicitly before each token, as for
+		the generation of the parser.
+`
+
+// lintDiagnostic is the JSON representation of a lint.Diagnostic.
+type lintDiagnostic struct {
+	File    string `json:"file"`
+	Line    int    `json:"line"`
+	Col     int    `json:"col"`
+	Offset  int    `json:"offset"`
+	Rule    string `json:"rule,omitempty"`
+	Check   string `json:"check"`
+	Message string `json:"message"`
+}
+
+// lintMain implements the lint command.
+func lintMain(args []string) {
+	fs := flag.NewFlagSet(os.Args[0]+" lint", flag.ExitOnError)
+	var (
+		shortHelpFlag = fs.Bool("h", false, "show help page")
+		longHelpFlag  = fs.Bool("help", false, "show help page")
+		jsonFlag      = fs.Bool("json", false, "report the issues in JSON")
+		skipRuleFlag  = fs.String("skip-rule", "", "rule applied implicitly before each token")
+
+		altEntrypointsFlag ruleNamesFlag
+		disableFlag        ruleNamesFlag
+	)
+	fs.Var(&altEntrypointsFlag, "alternate-entrypoints", "comma-separated list of rule names that may be used as entrypoints")
+	fs.Var(&disableFlag, "disable", "comma-separated list of checks that are not run")
+	fs.Usage = func() {
+		fmt.Printf(lintUsagePage, os.Args[0])
+	}
+	if err := fs.Parse(args); err != nil {
+		fmt.Fprintf(os.Stderr, "args parse error:\n%v\n", err)
+		exit(6)
+	}
+
+	if *shortHelpFlag || *longHelpFlag {
+		fs.Usage()
+		exit(0)
+	}
+	if fs.NArg() > 1 {
+		fmt.Fprintf(os.Stderr, "expected one argument, got %q\n", fs.Args())
+		fs.Usage()
+		exit(1)
+	}
+	for _, name := range disableFlag {
+		if !isLintCheck(name) {
+			fmt.Fprintf(os.Stderr, "unknown check %q\n", name)
+			fs.Usage()
+			exit(1)
+		}
+	}
+
+	nm, rc := input(fs.Arg(0))
+	g, err := ParseReader(nm, rc)
+	rc.Close()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "parse error(s):\n%v\n", err)
+		exit(3)
+	}
+
+	diags := lint.Check(g.(*ast.Grammar), lint.Options{
+		AlternateEntrypoints: altEntrypointsFlag,
+		SkipRule:             *skipRuleFlag,
+		Disabled:             disableFlag,
+	})
+	if *jsonFlag {
+		list := make([]lintDiagnostic, len(diags))
+		for i, d := range diags {
+			list[i] = lintDiagnostic{
+				File:    nm,
+				Line:    d.Pos.Line,
+				Col:     d.Pos.Col,
+				Offset:  d.Pos.Off,
+				Rule:    d.Rule,
+				Check:   d.Check,
+				Message: d.Message,
+			}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "\t")
+		if err := enc.Encode(list); err != nil {
+			fmt.Fprintf(os.Stderr, "write error: %v\n", err)
+			exit(7)
+		}
+	} else {
+		for _, d := range diags {
+			if d.Pos.Line == 0 {
+				fmt.Printf("%s: %s\n", nm, d)
+			} else {
+				fmt.Printf("%s:%s\n", nm, d)
+			}
+		}
+	}
+	if len(diags) > 0 {
+		exit(10)
+	}
+}
+
+// isLintCheck returns true if name is the name of a check of the lint
+// package.
+func isLintCheck(name string) bool {
+	for _, check := range lint.Checks {
+		if name == check {
+			return true
+		}
+	}
+	return false
+}
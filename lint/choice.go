@@ -0,0 +1,405 @@
+package lint
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/fy0/pigeon/ast"
+)
+
+// ShadowedAlternatives reports the alternatives of the choice expressions
+// of g that can never match, because a previous alternative of the same
+// choice is identical, always matches, or matches whenever they would, e.g.
+// "==" in "=" / "==", or Keyword in Ident / Keyword when the keywords are
+// identifiers.
+func ShadowedAlternatives(g *ast.Grammar) []Diagnostic {
+	a := &choiceAnalyzer{rules: ruleMap(g)}
+
+	var diags []Diagnostic
+	for _, rule := range g.Rules {
+		ast.Inspect(rule.Expr, func(expr ast.Expression) bool {
+			choice, ok := expr.(*ast.ChoiceExpr)
+			if !ok {
+				return true
+			}
+			for j := 1; j < len(choice.Alternatives); j++ {
+				alt := choice.Alternatives[j]
+				for i := 0; i < j; i++ {
+					if msg := a.shadows(choice.Alternatives[i], alt); msg != "" {
+						diags = append(diags, Diagnostic{
+							Pos:     alt.Pos(),
+							Rule:    rule.Name.Val,
+							Check:   CheckShadowedAlternative,
+							Message: msg,
+						})
+						break
+					}
+				}
+			}
+			return true
+		})
+	}
+	return diags
+}
+
+type choiceAnalyzer struct {
+	rules map[string]*ast.Rule
+}
+
+// literal is a string matched by an expression, case-insensitively if fold
+// is set.
+type literal struct {
+	s    string
+	fold bool
+}
+
+// shadows returns the reason why the alternative next can never match when
+// it follows the alternative prev, or an empty string.
+func (a *choiceAnalyzer) shadows(prev, next ast.Expression) string {
+	if k := key(prev); k != "" && k == key(next) {
+		return fmt.Sprintf("%s is identical to the alternative at %s", describe(next), prev.Pos())
+	}
+	if a.alwaysMatches(prev, 0) {
+		return fmt.Sprintf("%s is unreachable, %s at %s always matches", describe(next), describe(prev), prev.Pos())
+	}
+	lits, ok := a.literals(next, 0)
+	if !ok {
+		return ""
+	}
+	for _, lit := range lits {
+		if !a.matchesPrefix(prev, lit, 0) {
+			return ""
+		}
+	}
+	return fmt.Sprintf("%s is shadowed by %s at %s", describe(next), describe(prev), prev.Pos())
+}
+
+// alwaysMatches returns true if expr matches any input.
+func (a *choiceAnalyzer) alwaysMatches(expr ast.Expression, depth int) bool {
+	switch expr := expr.(type) {
+	case *ast.ZeroOrOneExpr, *ast.ZeroOrMoreExpr, *ast.CodeExpr:
+		return true
+	case *ast.LitMatcher:
+		return expr.Val == ""
+	case *ast.ActionExpr:
+		return a.alwaysMatches(expr.Expr, depth)
+	case *ast.LabeledExpr:
+		return a.alwaysMatches(expr.Expr, depth)
+	case *ast.AndExpr:
+		return a.alwaysMatches(expr.Expr, depth)
+	case *ast.SeqExpr:
+		for _, e := range expr.Exprs {
+			if !a.alwaysMatches(e, depth) {
+				return false
+			}
+		}
+		return true
+	case *ast.ChoiceExpr:
+		for _, e := range expr.Alternatives {
+			if a.alwaysMatches(e, depth) {
+				return true
+			}
+		}
+	case *ast.RuleRefExpr:
+		if rule, ok := a.rules[expr.Name.Val]; ok && depth < maxDepth {
+			return a.alwaysMatches(rule.Expr, depth+1)
+		}
+	}
+	return false
+}
+
+// literals returns the non-empty strings matched by expr, if expr only
+// matches a finite set of literal strings.
+func (a *choiceAnalyzer) literals(expr ast.Expression, depth int) ([]literal, bool) {
+	switch expr := expr.(type) {
+	case *ast.LitMatcher:
+		if expr.Val == "" {
+			return nil, false
+		}
+		return []literal{{s: expr.Val, fold: expr.IgnoreCase}}, true
+	case *ast.ActionExpr:
+		return a.literals(expr.Expr, depth)
+	case *ast.LabeledExpr:
+		return a.literals(expr.Expr, depth)
+	case *ast.SeqExpr:
+		var lit literal
+		for i, e := range expr.Exprs {
+			l, ok := e.(*ast.LitMatcher)
+			if !ok || (i > 0 && l.IgnoreCase != lit.fold) {
+				return nil, false
+			}
+			lit.s += l.Val
+			lit.fold = l.IgnoreCase
+		}
+		if lit.s == "" {
+			return nil, false
+		}
+		return []literal{lit}, true
+	case *ast.ChoiceExpr:
+		var lits []literal
+		for _, e := range expr.Alternatives {
+			l, ok := a.literals(e, depth)
+			if !ok {
+				return nil, false
+			}
+			lits = append(lits, l...)
+		}
+		return lits, true
+	case *ast.RuleRefExpr:
+		if rule, ok := a.rules[expr.Name.Val]; ok && depth < maxDepth {
+			return a.literals(rule.Expr, depth+1)
+		}
+	}
+	return nil, false
+}
+
+// matchesPrefix returns true if expr matches any input starting with lit.
+func (a *choiceAnalyzer) matchesPrefix(expr ast.Expression, lit literal, depth int) bool {
+	switch expr := expr.(type) {
+	case *ast.LitMatcher, *ast.CharClassMatcher, *ast.AnyMatcher:
+		_, ok := consume(expr, lit)
+		return ok
+	case *ast.ZeroOrOneExpr, *ast.ZeroOrMoreExpr, *ast.CodeExpr:
+		return true
+	case *ast.OneOrMoreExpr:
+		return a.matchesPrefix(expr.Expr, lit, depth)
+	case *ast.ActionExpr:
+		return a.matchesPrefix(expr.Expr, lit, depth)
+	case *ast.LabeledExpr:
+		return a.matchesPrefix(expr.Expr, lit, depth)
+	case *ast.AndExpr:
+		return a.matchesPrefix(expr.Expr, lit, depth)
+	case *ast.SeqExpr:
+		for i, e := range expr.Exprs {
+			if rest, ok := consume(e, lit); ok {
+				lit.s = rest
+				continue
+			}
+			// the expressions after one that consumes an unknown part of
+			// the input must match anything.
+			if !a.matchesPrefix(e, lit, depth) {
+				return false
+			}
+			for _, e := range expr.Exprs[i+1:] {
+				if !a.alwaysMatches(e, depth) {
+					return false
+				}
+			}
+			return true
+		}
+		return true
+	case *ast.ChoiceExpr:
+		for _, e := range expr.Alternatives {
+			if a.matchesPrefix(e, lit, depth) {
+				return true
+			}
+		}
+	case *ast.RuleRefExpr:
+		if rule, ok := a.rules[expr.Name.Val]; ok && depth < maxDepth {
+			return a.matchesPrefix(rule.Expr, lit, depth+1)
+		}
+	}
+	return false
+}
+
+// consume returns the rest of lit after the input matched by the literal,
+// character class or any matcher expr, if expr matches any input starting
+// with lit.
+func consume(expr ast.Expression, lit literal) (string, bool) {
+	switch expr := expr.(type) {
+	case *ast.LitMatcher:
+		n := utf8.RuneCountInString(expr.Val)
+		if utf8.RuneCountInString(lit.s) < n {
+			return "", false
+		}
+		prefix := lit.s
+		for i := range lit.s {
+			if n == 0 {
+				prefix = lit.s[:i]
+				break
+			}
+			n--
+		}
+		switch {
+		case expr.IgnoreCase:
+			return lit.s[len(prefix):], strings.EqualFold(prefix, expr.Val)
+		case lit.fold && !caseless(prefix):
+			return "", false
+		}
+		return lit.s[len(prefix):], prefix == expr.Val
+	case *ast.CharClassMatcher:
+		rn, w := utf8.DecodeRuneInString(lit.s)
+		if w == 0 {
+			return "", false
+		}
+		runes := []rune{rn}
+		if lit.fold {
+			for f := unicode.SimpleFold(rn); f != rn; f = unicode.SimpleFold(f) {
+				runes = append(runes, f)
+			}
+		}
+		for _, rn := range runes {
+			if in, known := classMatches(expr, rn); !in || !known {
+				return "", false
+			}
+		}
+		return lit.s[w:], true
+	case *ast.AnyMatcher:
+		_, w := utf8.DecodeRuneInString(lit.s)
+		return lit.s[w:], w > 0
+	}
+	return "", false
+}
+
+// caseless returns true if s has no letters with case variants.
+func caseless(s string) bool {
+	for _, rn := range s {
+		if unicode.SimpleFold(rn) != rn {
+			return false
+		}
+	}
+	return true
+}
+
+// classMatches returns true if the character class c matches rn, as the
+// generated parser does. known is false if c uses a Unicode class unknown
+// to the unicode package, in which case the result is meaningless.
+func classMatches(c *ast.CharClassMatcher, rn rune) (in, known bool) {
+	if c.IgnoreCase {
+		rn = unicode.ToLower(rn)
+	}
+	lower := func(r rune) rune {
+		if c.IgnoreCase {
+			return unicode.ToLower(r)
+		}
+		return r
+	}
+
+	for _, r := range c.Chars {
+		if lower(r) == rn {
+			in = true
+		}
+	}
+	for i := 0; i+1 < len(c.Ranges); i += 2 {
+		if rn >= lower(c.Ranges[i]) && rn <= lower(c.Ranges[i+1]) {
+			in = true
+		}
+	}
+	for _, cl := range c.UnicodeClasses {
+		t := rangeTable(cl)
+		if t == nil {
+			return false, false
+		}
+		in = in || unicode.Is(t, rn)
+	}
+	for _, cl := range c.NotUnicodeClasses {
+		t := rangeTable(cl)
+		if t == nil {
+			return false, false
+		}
+		in = in || !unicode.Is(t, rn)
+	}
+	for _, set := range c.Intersect {
+		m, ok := classMatches(set, rn)
+		if !ok {
+			return false, false
+		}
+		in = in && m
+	}
+	for _, set := range c.Subtract {
+		m, ok := classMatches(set, rn)
+		if !ok {
+			return false, false
+		}
+		in = in && !m
+	}
+	return in != c.Inverted, true
+}
+
+func rangeTable(class string) *unicode.RangeTable {
+	if t, ok := unicode.Categories[class]; ok {
+		return t
+	}
+	return unicode.Scripts[class]
+}
+
+// key returns a textual representation of expr independent of the
+// positions, so that identical expressions have the same key. It returns
+// an empty string if expr cannot be compared.
+func key(expr ast.Expression) string {
+	keys := func(prefix string, exprs []ast.Expression) string {
+		ks := make([]string, len(exprs))
+		for i, e := range exprs {
+			if ks[i] = key(e); ks[i] == "" {
+				return ""
+			}
+		}
+		return prefix + "(" + strings.Join(ks, " ") + ")"
+	}
+	wrap := func(prefix string, e ast.Expression) string {
+		if k := key(e); k != "" {
+			return prefix + "(" + k + ")"
+		}
+		return ""
+	}
+
+	switch expr := expr.(type) {
+	case *ast.LitMatcher, *ast.CharClassMatcher, *ast.AnyMatcher, *ast.RuleRefExpr:
+		return describe(expr)
+	case *ast.SeqExpr:
+		return keys("seq", expr.Exprs)
+	case *ast.ChoiceExpr:
+		return keys("choice", expr.Alternatives)
+	case *ast.ZeroOrOneExpr:
+		return wrap("?", expr.Expr)
+	case *ast.ZeroOrMoreExpr:
+		return wrap("*", expr.Expr)
+	case *ast.OneOrMoreExpr:
+		return wrap("+", expr.Expr)
+	case *ast.AndExpr:
+		return wrap(fmt.Sprintf("&%t", expr.Logical), expr.Expr)
+	case *ast.NotExpr:
+		return wrap(fmt.Sprintf("!%t", expr.Logical), expr.Expr)
+	case *ast.LabeledExpr:
+		label := ""
+		if expr.Label != nil {
+			label = expr.Label.Val
+		}
+		return wrap(fmt.Sprintf("%s:%t:%t", label, expr.TextCapture, expr.Pluck), expr.Expr)
+	case *ast.ActionExpr:
+		return wrap("action"+expr.Code.Val, expr.Expr)
+	case *ast.AndCodeExpr:
+		return "&" + expr.Code.Val
+	case *ast.NotCodeExpr:
+		return "!" + expr.Code.Val
+	case *ast.CodeExpr:
+		return expr.Code.Val
+	}
+	return ""
+}
+
+// describe returns a short description of expr for the diagnostics.
+func describe(expr ast.Expression) string {
+	switch expr := expr.(type) {
+	case *ast.LitMatcher:
+		s := strconv.Quote(expr.Val)
+		if expr.IgnoreCase {
+			s += "i"
+		}
+		return s
+	case *ast.CharClassMatcher:
+		return expr.Val
+	case *ast.AnyMatcher:
+		return "."
+	case *ast.RuleRefExpr:
+		return expr.Name.Val
+	case *ast.ActionExpr:
+		return describe(expr.Expr)
+	case *ast.LabeledExpr:
+		return describe(expr.Expr)
+	}
+	return "alternative"
+}
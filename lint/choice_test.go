@@ -0,0 +1,73 @@
+package lint
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/fy0/pigeon/ast"
+	"github.com/fy0/pigeon/bootstrap"
+)
+
+func TestShadowedAlternatives(t *testing.T) {
+	cases := []struct {
+		grammar string
+		want    []string
+	}{
+		{grammar: `A = "=" / "=="`, want: []string{
+			`1:11 (10): rule A: "==" is shadowed by "=" at 1:5 (4) (shadowed-alternative)`,
+		}},
+		{grammar: `A = "==" / "="`},
+		{grammar: `A = "a"i / "A" / "b" / "B"i`, want: []string{
+			`1:12 (11): rule A: "A" is shadowed by "a"i at 1:5 (4) (shadowed-alternative)`,
+		}},
+		{grammar: `A = [a-z] / "x" / [^0-9] / "X" / "1"`, want: []string{
+			`1:13 (12): rule A: "x" is shadowed by [a-z] at 1:5 (4) (shadowed-alternative)`,
+			`1:28 (27): rule A: "X" is shadowed by [^0-9] at 1:19 (18) (shadowed-alternative)`,
+		}},
+		{grammar: `A = B / "b" / B`, want: []string{
+			`1:15 (14): rule A: B is identical to the alternative at 1:5 (4) (shadowed-alternative)`,
+		}},
+		{grammar: "A = Ident / Keyword\nIdent = [a-z]+\nKeyword = \"if\" / \"else\"", want: []string{
+			`1:13 (12): rule A: Keyword is shadowed by Ident at 1:5 (4) (shadowed-alternative)`,
+		}},
+		{grammar: "A = Ident / Keyword\nIdent = !Keyword [a-z]+\nKeyword = \"if\" / \"else\""},
+		{grammar: `A = "a" "b"* / "ab" / "a"? / "c"`, want: []string{
+			`1:16 (15): rule A: "ab" is shadowed by alternative at 1:5 (4) (shadowed-alternative)`,
+			`1:30 (29): rule A: "c" is unreachable, alternative at 1:23 (22) always matches (shadowed-alternative)`,
+		}},
+		{grammar: `A = . / "a" / &"b" / "b" / !"c" / "c"`, want: []string{
+			`1:9 (8): rule A: "a" is shadowed by . at 1:5 (4) (shadowed-alternative)`,
+			`1:22 (21): rule A: "b" is shadowed by . at 1:5 (4) (shadowed-alternative)`,
+			`1:35 (34): rule A: "c" is shadowed by . at 1:5 (4) (shadowed-alternative)`,
+		}},
+	}
+
+	for _, tc := range cases {
+		g, err := bootstrap.NewParser().Parse("", strings.NewReader(tc.grammar))
+		if err != nil {
+			t.Fatalf("%q: %v", tc.grammar, err)
+		}
+		var got []string
+		for _, d := range ShadowedAlternatives(g) {
+			got = append(got, d.String())
+		}
+		if strings.Join(got, "\n") != strings.Join(tc.want, "\n") {
+			t.Errorf("%q:\nwant:\n%s\ngot:\n%s", tc.grammar, strings.Join(tc.want, "\n"), strings.Join(got, "\n"))
+		}
+	}
+}
+
+func TestClassMatches(t *testing.T) {
+	c := ast.NewCharClassMatcher(ast.Pos{}, `[\p{Greek}--[α]&&\p{Ll}]`)
+	for rn, want := range map[rune]bool{'β': true, 'α': false, 'Β': false, 'b': false} {
+		in, known := classMatches(c, rn)
+		if in != want || !known {
+			t.Errorf("%q: want %t, got %t (known: %t)", rn, want, in, known)
+		}
+	}
+
+	c = ast.NewCharClassMatcher(ast.Pos{}, `[\p{Unknown}]`)
+	if _, known := classMatches(c, 'a'); known {
+		t.Error("want unknown class")
+	}
+}
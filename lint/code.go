@@ -0,0 +1,109 @@
+package lint
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+
+	pegast "github.com/fy0/pigeon/ast"
+)
+
+// codePrefix turns a code block into a Go source file that can be parsed.
+const codePrefix = "package p\nfunc _() "
+
+// UnreachableCode reports the statements of the code blocks of g that
+// follow a return, a panic or a goto, break or continue statement in the
+// same block, and can never run. The code blocks that are not valid Go
+// are ignored, the Go compiler reports them.
+func UnreachableCode(g *pegast.Grammar) []Diagnostic {
+	var diags []Diagnostic
+	for _, rule := range g.Rules {
+		pegast.Inspect(rule.Expr, func(expr pegast.Expression) bool {
+			if code := codeBlock(expr); code != nil {
+				for _, pos := range unreachableStmts(code) {
+					diags = append(diags, Diagnostic{
+						Pos:     pos,
+						Rule:    rule.Name.Val,
+						Check:   CheckUnreachableCode,
+						Message: "unreachable code",
+					})
+				}
+			}
+			return true
+		})
+	}
+	return diags
+}
+
+// unreachableStmts returns the positions in the grammar of the first
+// unreachable statement of each statement list of code.
+func unreachableStmts(code *pegast.CodeBlock) []pegast.Pos {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", codePrefix+code.Val, 0)
+	if err != nil {
+		return nil
+	}
+
+	var list []pegast.Pos
+	check := func(stmts []ast.Stmt) {
+		for i := 0; i+1 < len(stmts); i++ {
+			if !terminates(stmts[i]) {
+				continue
+			}
+			next := stmts[i+1]
+			if _, ok := next.(*ast.LabeledStmt); ok {
+				// may be the target of a goto
+				continue
+			}
+			list = append(list, codePos(code, fset.Position(next.Pos())))
+			break
+		}
+	}
+	ast.Inspect(f, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.BlockStmt:
+			check(n.List)
+		case *ast.CaseClause:
+			check(n.Body)
+		case *ast.CommClause:
+			check(n.Body)
+		}
+		return true
+	})
+	return list
+}
+
+// terminates returns true if the statements following stmt in the same
+// list never run.
+func terminates(stmt ast.Stmt) bool {
+	switch stmt := stmt.(type) {
+	case *ast.ReturnStmt:
+		return true
+	case *ast.BranchStmt:
+		return stmt.Tok != token.FALLTHROUGH
+	case *ast.ExprStmt:
+		call, ok := stmt.X.(*ast.CallExpr)
+		if !ok {
+			return false
+		}
+		id, ok := call.Fun.(*ast.Ident)
+		return ok && id.Name == "panic"
+	}
+	return false
+}
+
+// codePos converts the position pos in the parsed source of code to its
+// position in the grammar.
+func codePos(code *pegast.CodeBlock, pos token.Position) pegast.Pos {
+	start := code.Pos()
+	p := pegast.Pos{
+		Filename: start.Filename,
+		Line:     start.Line + pos.Line - 2,
+		Col:      pos.Column,
+		Off:      start.Off + pos.Offset - len(codePrefix),
+	}
+	if pos.Line == 2 {
+		p.Col = start.Col + pos.Column - 1 - (len(codePrefix) - len("package p\n"))
+	}
+	return p
+}
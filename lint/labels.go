@@ -0,0 +1,204 @@
+package lint
+
+import (
+	"fmt"
+	"go/scanner"
+	"go/token"
+
+	"github.com/fy0/pigeon/ast"
+)
+
+// Labels reports the unused labels, which are not referenced by a code
+// block of their scope, and the labels that shadow the label of an outer
+// scope, or of their own scope.
+//
+// The scopes are those of the generated code: the labeled expressions, the
+// alternatives of a choice, the predicates, the repetitions and the recovery
+// expressions start a new scope, and a code block only sees the labels of
+// its own scope.
+func Labels(g *ast.Grammar) []Diagnostic {
+	var diags []Diagnostic
+	for _, rule := range g.Rules {
+		l := &labelChecker{rule: rule.Name.Val}
+		sc := &labelScope{}
+		l.visit(rule.Expr, sc)
+		l.close(sc)
+		diags = append(diags, l.diags...)
+	}
+	return diags
+}
+
+type labelScope struct {
+	outer  *labelScope
+	labels []*ast.LabeledExpr
+	idents map[string]bool
+}
+
+type labelChecker struct {
+	rule  string
+	diags []Diagnostic
+}
+
+func (l *labelChecker) visit(expr ast.Expression, sc *labelScope) {
+	switch expr := expr.(type) {
+	case *ast.ActionExpr:
+		l.visit(expr.Expr, sc)
+		sc.use(expr.Code)
+	case *ast.AndCodeExpr:
+		sc.use(expr.Code)
+	case *ast.NotCodeExpr:
+		sc.use(expr.Code)
+	case *ast.CodeExpr:
+		sc.use(expr.Code)
+	case *ast.LabeledExpr:
+		l.declare(expr, sc)
+		l.visitScope(sc, expr.Expr)
+	case *ast.AndExpr:
+		l.visitScope(sc, expr.Expr)
+	case *ast.NotExpr:
+		l.visitScope(sc, expr.Expr)
+	case *ast.OneOrMoreExpr:
+		l.visitScope(sc, expr.Expr)
+	case *ast.ZeroOrMoreExpr:
+		l.visitScope(sc, expr.Expr)
+	case *ast.ZeroOrOneExpr:
+		l.visitScope(sc, expr.Expr)
+	case *ast.RecoveryExpr:
+		l.visitScope(sc, expr.Expr, expr.RecoverExpr)
+	case *ast.ChoiceExpr:
+		for _, alt := range expr.Alternatives {
+			l.visitScope(sc, alt)
+		}
+	case *ast.SeqExpr:
+		for _, e := range expr.Exprs {
+			l.visit(e, sc)
+		}
+	}
+}
+
+// visitScope visits exprs in a new scope nested in outer.
+func (l *labelChecker) visitScope(outer *labelScope, exprs ...ast.Expression) {
+	sc := &labelScope{outer: outer}
+	for _, expr := range exprs {
+		l.visit(expr, sc)
+	}
+	l.close(sc)
+}
+
+func (l *labelChecker) declare(lab *ast.LabeledExpr, sc *labelScope) {
+	if lab.Label == nil {
+		return
+	}
+	name := lab.Label.Val
+	for s := sc; s != nil; s = s.outer {
+		for _, prev := range s.labels {
+			if prev.Label.Val == name {
+				l.diags = append(l.diags, Diagnostic{
+					Pos:     lab.Pos(),
+					Rule:    l.rule,
+					Check:   CheckShadowedLabel,
+					Message: fmt.Sprintf("label %s shadows the label at %s", name, prev.Pos()),
+				})
+				sc.labels = append(sc.labels, lab)
+				return
+			}
+		}
+	}
+	sc.labels = append(sc.labels, lab)
+}
+
+// close reports the unused labels of sc.
+func (l *labelChecker) close(sc *labelScope) {
+	for _, lab := range sc.labels {
+		if lab.Pluck || sc.idents[lab.Label.Val] {
+			continue
+		}
+		l.diags = append(l.diags, Diagnostic{
+			Pos:     lab.Pos(),
+			Rule:    l.rule,
+			Check:   CheckUnusedLabel,
+			Message: fmt.Sprintf("label %s is not used by a code block", lab.Label.Val),
+		})
+	}
+}
+
+func (sc *labelScope) use(code *ast.CodeBlock) {
+	if code == nil {
+		return
+	}
+	if sc.idents == nil {
+		sc.idents = make(map[string]bool)
+	}
+	for id := range codeIdents(code) {
+		sc.idents[id] = true
+	}
+}
+
+// UncaughtThrows reports the throw expressions whose label is not recovered
+// by any recovery expression of g, they always fail the parsing.
+func UncaughtThrows(g *ast.Grammar) []Diagnostic {
+	recovered := make(map[string]bool)
+	for _, rule := range g.Rules {
+		ast.Inspect(rule.Expr, func(expr ast.Expression) bool {
+			if rec, ok := expr.(*ast.RecoveryExpr); ok {
+				for _, label := range rec.Labels {
+					recovered[string(label)] = true
+				}
+			}
+			return true
+		})
+	}
+
+	var diags []Diagnostic
+	for _, rule := range g.Rules {
+		ast.Inspect(rule.Expr, func(expr ast.Expression) bool {
+			if throw, ok := expr.(*ast.ThrowExpr); ok && !recovered[throw.Label] {
+				diags = append(diags, Diagnostic{
+					Pos:     throw.Pos(),
+					Rule:    rule.Name.Val,
+					Check:   CheckUncaughtThrow,
+					Message: fmt.Sprintf("label %s is thrown but no recovery expression catches it", throw.Label),
+				})
+			}
+			return true
+		})
+	}
+	return diags
+}
+
+// codeBlock returns the code block of expr, if any.
+func codeBlock(expr ast.Expression) *ast.CodeBlock {
+	switch expr := expr.(type) {
+	case *ast.ActionExpr:
+		return expr.Code
+	case *ast.AndCodeExpr:
+		return expr.Code
+	case *ast.NotCodeExpr:
+		return expr.Code
+	case *ast.CodeExpr:
+		return expr.Code
+	}
+	return nil
+}
+
+// codeIdents returns the identifiers used in code.
+func codeIdents(code *ast.CodeBlock) map[string]bool {
+	idents := make(map[string]bool)
+	if code == nil {
+		return idents
+	}
+	var s scanner.Scanner
+	fset := token.NewFileSet()
+	src := []byte(code.Val)
+	s.Init(fset.AddFile("", -1, len(src)), src, nil, 0)
+	for {
+		_, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		if tok == token.IDENT {
+			idents[lit] = true
+		}
+	}
+	return idents
+}
@@ -0,0 +1,162 @@
+// Package lint implements static checks of PEG grammars, reported by the
+// "pigeon lint" command.
+package lint
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/fy0/pigeon/ast"
+)
+
+// Names of the checks, as reported in the diagnostics.
+const (
+	CheckUndefinedRule       = "undefined-rule"
+	CheckNullableRepetition  = "nullable-repetition"
+	CheckDuplicateRule       = "duplicate-rule"
+	CheckUnusedRule          = "unused-rule"
+	CheckMissingDisplayName  = "missing-display-name"
+	CheckUnusedLabel         = "unused-label"
+	CheckShadowedLabel       = "shadowed-label"
+	CheckUncaughtThrow       = "uncaught-throw"
+	CheckUnreachableCode     = "unreachable-code"
+	CheckShadowedAlternative = "shadowed-alternative"
+)
+
+// Checks lists the names of all the checks, in the order they are run.
+var Checks = []string{
+	CheckUndefinedRule,
+	CheckNullableRepetition,
+	CheckDuplicateRule,
+	CheckUnusedRule,
+	CheckMissingDisplayName,
+	CheckUnusedLabel,
+	CheckShadowedLabel,
+	CheckUncaughtThrow,
+	CheckUnreachableCode,
+	CheckShadowedAlternative,
+}
+
+// Diagnostic is an issue found in a grammar by a check.
+type Diagnostic struct {
+	// Pos is the position of the issue, it is the zero value for the
+	// issues of the command-line options, e.g. an undefined entrypoint.
+	Pos ast.Pos
+	// Rule is the name of the rule containing the issue, if any.
+	Rule    string
+	Check   string
+	Message string
+}
+
+// String returns the textual representation of the diagnostic.
+func (d Diagnostic) String() string {
+	if d.Rule == "" {
+		if d.Pos.Line == 0 {
+			return fmt.Sprintf("%s (%s)", d.Message, d.Check)
+		}
+		return fmt.Sprintf("%s: %s (%s)", d.Pos, d.Message, d.Check)
+	}
+	return fmt.Sprintf("%s: rule %s: %s (%s)", d.Pos, d.Rule, d.Message, d.Check)
+}
+
+// Options configures the checks.
+type Options struct {
+	// AlternateEntrypoints are the rules that can be used as entrypoints
+	// in addition to the first rule of the grammar.
+	AlternateEntrypoints []string
+	// SkipRule is the rule inserted implicitly between the expressions of
+	// the grammar, as with the -skip-rule option of pigeon, if any.
+	SkipRule string
+	// Disabled are the names of the checks that are not run.
+	Disabled []string
+}
+
+// Check runs the checks enabled by opts on g and returns the diagnostics,
+// sorted by position.
+func Check(g *ast.Grammar, opts Options) []Diagnostic {
+	disabled := make(map[string]bool, len(opts.Disabled))
+	for _, name := range opts.Disabled {
+		disabled[name] = true
+	}
+
+	var diags []Diagnostic
+	run := func(check string, fn func() []Diagnostic) {
+		if !disabled[check] {
+			diags = append(diags, fn()...)
+		}
+	}
+	run(CheckUndefinedRule, func() []Diagnostic { return UndefinedRules(g, opts.AlternateEntrypoints) })
+	run(CheckNullableRepetition, func() []Diagnostic { return NullableRepetitions(g) })
+	run(CheckDuplicateRule, func() []Diagnostic { return DuplicateRules(g) })
+	run(CheckUnusedRule, func() []Diagnostic { return UnusedRules(g, opts) })
+	run(CheckMissingDisplayName, func() []Diagnostic { return MissingDisplayNames(g) })
+	if !disabled[CheckUnusedLabel] || !disabled[CheckShadowedLabel] {
+		for _, d := range Labels(g) {
+			if !disabled[d.Check] {
+				diags = append(diags, d)
+			}
+		}
+	}
+	run(CheckUncaughtThrow, func() []Diagnostic { return UncaughtThrows(g) })
+	run(CheckUnreachableCode, func() []Diagnostic { return UnreachableCode(g) })
+	run(CheckShadowedAlternative, func() []Diagnostic { return ShadowedAlternatives(g) })
+
+	sort.SliceStable(diags, func(i, j int) bool {
+		return diags[i].Pos.Off < diags[j].Pos.Off
+	})
+	return diags
+}
+
+// UndefinedRules reports the references to undefined rules and the
+// undefined alternate entrypoints, as ast.CheckRuleRefs.
+func UndefinedRules(g *ast.Grammar, alternateEntrypoints []string) []Diagnostic {
+	var diags []Diagnostic
+	var errs ast.ErrorList
+	errors.As(ast.CheckRuleRefs(g, alternateEntrypoints...), &errs)
+	for _, err := range errs {
+		e := err.(*ast.UndefinedRuleError)
+		msg := "undefined rule " + e.Name
+		if e.Rule == "" {
+			msg += " used as alternate entrypoint"
+		}
+		if e.Suggestion != "" {
+			msg += ", did you mean " + e.Suggestion + "?"
+		}
+		diags = append(diags, Diagnostic{Pos: e.Pos, Rule: e.Rule, Check: CheckUndefinedRule, Message: msg})
+	}
+	return diags
+}
+
+// NullableRepetitions reports the repetitions that match the empty input,
+// as ast.CheckRepetitions.
+func NullableRepetitions(g *ast.Grammar) []Diagnostic {
+	var diags []Diagnostic
+	var errs ast.ErrorList
+	errors.As(ast.CheckRepetitions(g), &errs)
+	for _, err := range errs {
+		e := err.(*ast.RepetitionError)
+		diags = append(diags, Diagnostic{
+			Pos:     e.Pos,
+			Rule:    e.Rule,
+			Check:   CheckNullableRepetition,
+			Message: "repeated expression matches the empty input",
+		})
+	}
+	return diags
+}
+
+// maxDepth limits the number of rule references followed by the analysis
+// of an expression.
+const maxDepth = 16
+
+func ruleMap(g *ast.Grammar) map[string]*ast.Rule {
+	rules := make(map[string]*ast.Rule, len(g.Rules))
+	for _, rule := range g.Rules {
+		// the duplicate definitions are reported separately
+		if _, ok := rules[rule.Name.Val]; !ok {
+			rules[rule.Name.Val] = rule
+		}
+	}
+	return rules
+}
@@ -0,0 +1,95 @@
+package lint
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/fy0/pigeon/ast"
+	"github.com/fy0/pigeon/bootstrap"
+)
+
+func TestCheck(t *testing.T) {
+	cases := []struct {
+		grammar string
+		opts    Options
+		want    []string
+	}{
+		{grammar: "A = B\nB = 'b'"},
+		{grammar: "A = B\nB = 'b'\nA = 'a'", want: []string{
+			`3:1 (14): rule A: rule already defined at 1:1 (0) (duplicate-rule)`,
+		}},
+		{grammar: "A = C*\nB = 'b'", want: []string{
+			`1:5 (4): rule A: undefined rule C (undefined-rule)`,
+			`2:1 (7): rule B: rule is not reachable from an entrypoint (unused-rule)`,
+		}},
+		{grammar: "A = 'a'\nB = 'b'\nC = 'c'\n_ = ' '", opts: Options{AlternateEntrypoints: []string{"C", "D"}, SkipRule: "_"}, want: []string{
+			`undefined rule D used as alternate entrypoint (undefined-rule)`,
+			`2:1 (8): rule B: rule is not reachable from an entrypoint (unused-rule)`,
+		}},
+		{grammar: "A = 'a'\nB = 'b'", opts: Options{Disabled: []string{CheckUnusedRule}}},
+		{grammar: "A = ( 'a'? )*", want: []string{
+			`1:7 (6): rule A: repeated expression matches the empty input (nullable-repetition)`,
+		}},
+		{grammar: "A = 'a' { p.addErr(nil); return nil }\nB \"b\" = 'b' { c.addErr(nil); return nil }", opts: Options{AlternateEntrypoints: []string{"B"}}, want: []string{
+			`1:1 (0): rule A: rule has no display name, and the code block at 1:9 (8) adds errors (missing-display-name)`,
+		}},
+		{grammar: "A = a:'a' b:'b' c:'c' { return []any{a, b} }", want: []string{
+			`1:17 (16): rule A: label c is not used by a code block (unused-label)`,
+		}},
+		{grammar: "A = a:'a' ( a:'b' { return a } )* a:'c' { return a }", want: []string{
+			`1:13 (12): rule A: label a shadows the label at 1:5 (4) (shadowed-label)`,
+			`1:35 (34): rule A: label a shadows the label at 1:5 (4) (shadowed-label)`,
+		}},
+		{grammar: "A = ( a:'a' )* { return a }", want: []string{
+			`1:7 (6): rule A: label a is not used by a code block (unused-label)`,
+		}},
+		{grammar: "A = 'a' {\n\tif c.text == nil {\n\t\treturn nil\n\t\tpanic(1)\n\t}\n\treturn 1\n\treturn 2\n}", want: []string{
+			`4:3 (45): rule A: unreachable code (unreachable-code)`,
+			`7:2 (68): rule A: unreachable code (unreachable-code)`,
+		}},
+		{grammar: "A = 'a' { switch { case true: break; default: goto x; x: } return nil }"},
+		{grammar: "A = 'a' { return nil +; x }"},
+	}
+
+	for _, tc := range cases {
+		g, err := bootstrap.NewParser().Parse("", strings.NewReader(tc.grammar))
+		if err != nil {
+			t.Fatalf("%q: %v", tc.grammar, err)
+		}
+		var got []string
+		for _, d := range Check(g, tc.opts) {
+			got = append(got, d.String())
+		}
+		if strings.Join(got, "\n") != strings.Join(tc.want, "\n") {
+			t.Errorf("%q:\nwant:\n%s\ngot:\n%s", tc.grammar, strings.Join(tc.want, "\n"), strings.Join(got, "\n"))
+		}
+	}
+}
+
+func TestUncaughtThrows(t *testing.T) {
+	pos := ast.Pos{Line: 1, Col: 5, Off: 4}
+	throw := func(label string) *ast.ThrowExpr {
+		expr := ast.NewThrowExpr(pos)
+		expr.Label = label
+		return expr
+	}
+	rec := ast.NewRecoveryExpr(pos)
+	rec.Expr = throw("a")
+	rec.RecoverExpr = ast.NewAnyMatcher(pos, ".")
+	rec.Labels = []ast.FailureLabel{"a"}
+
+	g := ast.NewGrammar(pos)
+	for i, expr := range []ast.Expression{rec, throw("a"), throw("b")} {
+		rule := ast.NewRule(pos, ast.NewIdentifier(pos, string(rune('A'+i))))
+		rule.Expr = expr
+		g.Rules = append(g.Rules, rule)
+	}
+
+	got := UncaughtThrows(g)
+	if len(got) != 1 {
+		t.Fatalf("want 1 diagnostic, got %v", got)
+	}
+	if want := "1:5 (4): rule C: label b is thrown but no recovery expression catches it (uncaught-throw)"; got[0].String() != want {
+		t.Errorf("want %q, got %q", want, got[0])
+	}
+}
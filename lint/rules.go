@@ -0,0 +1,116 @@
+package lint
+
+import (
+	"fmt"
+
+	"github.com/fy0/pigeon/ast"
+)
+
+// DuplicateRules reports the rules defined more than once, at each
+// definition following the first one.
+func DuplicateRules(g *ast.Grammar) []Diagnostic {
+	var diags []Diagnostic
+	first := make(map[string]*ast.Rule, len(g.Rules))
+	for _, rule := range g.Rules {
+		prev, ok := first[rule.Name.Val]
+		if !ok {
+			first[rule.Name.Val] = rule
+			continue
+		}
+		diags = append(diags, Diagnostic{
+			Pos:     rule.Pos(),
+			Rule:    rule.Name.Val,
+			Check:   CheckDuplicateRule,
+			Message: fmt.Sprintf("rule already defined at %s", prev.Pos()),
+		})
+	}
+	return diags
+}
+
+// UnusedRules reports the rules that cannot be reached from an entrypoint:
+// the first rule, the alternate entrypoints, the rules annotated with
+// @export and the skip rule.
+func UnusedRules(g *ast.Grammar, opts Options) []Diagnostic {
+	if len(g.Rules) == 0 {
+		return nil
+	}
+	rules := ruleMap(g)
+
+	used := make(map[string]bool, len(g.Rules))
+	var use func(name string)
+	use = func(name string) {
+		rule, ok := rules[name]
+		if !ok || used[name] {
+			return
+		}
+		used[name] = true
+		ast.Inspect(rule.Expr, func(expr ast.Expression) bool {
+			if ref, ok := expr.(*ast.RuleRefExpr); ok {
+				use(ref.Name.Val)
+			}
+			return true
+		})
+	}
+
+	use(g.Rules[0].Name.Val)
+	for _, name := range opts.AlternateEntrypoints {
+		use(name)
+	}
+	use(opts.SkipRule)
+	for _, rule := range g.Rules {
+		if rule.HasAnnotation("export") {
+			use(rule.Name.Val)
+		}
+	}
+
+	var diags []Diagnostic
+	reported := make(map[string]bool)
+	for _, rule := range g.Rules {
+		if used[rule.Name.Val] || reported[rule.Name.Val] {
+			continue
+		}
+		reported[rule.Name.Val] = true
+		diags = append(diags, Diagnostic{
+			Pos:     rule.Pos(),
+			Rule:    rule.Name.Val,
+			Check:   CheckUnusedRule,
+			Message: "rule is not reachable from an entrypoint",
+		})
+	}
+	return diags
+}
+
+// MissingDisplayNames reports the rules without a display name whose code
+// blocks add errors: the errors are prefixed by the name of the rule, which
+// is meant for the grammar, not for its users.
+func MissingDisplayNames(g *ast.Grammar) []Diagnostic {
+	var diags []Diagnostic
+	for _, rule := range g.Rules {
+		if rule.DisplayName != nil {
+			continue
+		}
+		var code *ast.CodeBlock
+		ast.Inspect(rule.Expr, func(expr ast.Expression) bool {
+			if code != nil {
+				return false
+			}
+			if c := codeBlock(expr); c != nil {
+				idents := codeIdents(c)
+				if idents["addErr"] || idents["addErrAt"] {
+					code = c
+				}
+			}
+			return true
+		})
+		if code == nil {
+			continue
+		}
+		diags = append(diags, Diagnostic{
+			Pos:     rule.Pos(),
+			Rule:    rule.Name.Val,
+			Check:   CheckMissingDisplayName,
+			Message: fmt.Sprintf("rule has no display name, and the code block at %s adds errors", code.Pos()),
+		})
+	}
+	return diags
+}
@@ -8,6 +8,8 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"runtime"
 	"strconv"
 	"strings"
 
@@ -26,7 +28,7 @@ var exit = os.Exit
 type ruleNamesFlag []string
 
 func (r *ruleNamesFlag) String() string {
-	return fmt.Sprint(*r)
+	return strings.Join(*r, ",")
 }
 
 func (r *ruleNamesFlag) Set(value string) error {
@@ -51,6 +53,13 @@ func Parse(filename string, b []byte, opts ...option) (any, error) {
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		if cmd, ok := commands[os.Args[1]]; ok {
+			cmd(os.Args[2:])
+			return
+		}
+	}
+
 	fs := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
 
 	// define command-line flags
@@ -62,18 +71,25 @@ func main() {
 		nolint             = fs.Bool("nolint", false, "add '// nolint: ...' comments to suppress warnings by gometalinter or golangci-lint")
 		outputFlag         = fs.String("o", "", "output file, defaults to stdout")
 		optimizeParserFlag = fs.Bool("optimize-parser", false, "generate optimized parser without Debug options")
-		recvrNmFlag        = fs.String("receiver-name", "c", "receiver name for the generated methods")
+		recvrNmFlag        = fs.String("receiver-name", defaultGenConfig.receiverName, "receiver name for the generated methods")
 		noBuildFlag        = fs.Bool("x", false, "do not build, only parse")
 
 		cacheFlag = fs.Bool("cache", false, "cache parsing results")
 
-		grammarNameFlag        = fs.String("grammar-name", "g", "default is g, `var g = &grammar{ ... }")
+		grammarNameFlag        = fs.String("grammar-name", defaultGenConfig.grammarName, "default is g, `var g = &grammar{ ... }")
 		runFuncPrefixFlag      = fs.String("run-func-prefix", "", "set prefix for generated function name: `(*parser).call_onXXX`. For multiple peg files")
 		grammarOnlyFlag        = fs.Bool("grammar-only", false, "use it when you have multiple peg files")
 		optimizeRefExprByIndex = fs.Bool("optimize-ref-expr-by-index", false, "generate optimized parser grammar find RefExpr by index (~10% increased)")
-		targetFlag             = fs.String("t", "go", "build target, default go")
-
-		// optimizeGrammar        = fs.Bool("optimize-grammar", false, "optimize the given grammar (EXPERIMENTAL FEATURE)")
+		targetFlag             = fs.String("t", defaultGenConfig.target, "build target, default go")
+		skipRuleFlag           = fs.String("skip-rule", "", "rule applied implicitly before each token of syntactic rules")
+		typeCheckFlag          = fs.Bool("typecheck", false, "type-check the code blocks of the grammar")
+		lineDirectivesFlag     = fs.Bool("line-directives", false, "add //line directives pointing to the grammar before the code blocks")
+		optimizeGrammarFlag    = fs.Bool("optimize-grammar", false, "optimize the grammar before generating the parser")
+		fuzzTestFlag           = fs.Bool("fuzz-test", false, "write a fuzz harness of the parser next to the output file")
+		outdirFlag             = fs.String("outdir", "", "output directory of the parsers of several grammars")
+		jobsFlag               = fs.Int("j", runtime.GOMAXPROCS(0), "number of grammars generated in parallel")
+		forceFlag              = fs.Bool("force", false, "regenerate the parsers of several grammars even if up to date")
+		checkFlag              = fs.Bool("check", false, "compare the generated parser with the output file instead of writing it")
 
 		altEntrypointsFlag ruleNamesFlag
 	)
@@ -91,8 +107,48 @@ func main() {
 		exit(0)
 	}
 
-	if fs.NArg() > 1 {
-		argError(1, "expected one argument, got %q", strings.Join(fs.Args(), " "))
+	cfg := &genConfig{
+		debug:                  *dbgFlag,
+		cache:                  *cacheFlag,
+		noBuild:                *noBuildFlag,
+		nolint:                 *nolint,
+		optimizeParser:         *optimizeParserFlag,
+		optimizeRefExprByIndex: *optimizeRefExprByIndex,
+		optimizeGrammar:        *optimizeGrammarFlag,
+		grammarOnly:            *grammarOnlyFlag,
+		receiverName:           *recvrNmFlag,
+		grammarName:            *grammarNameFlag,
+		runFuncPrefix:          *runFuncPrefixFlag,
+		skipRule:               *skipRuleFlag,
+		target:                 *targetFlag,
+		typeCheck:              *typeCheckFlag,
+		lineDirectives:         *lineDirectivesFlag,
+		fuzzTest:               *fuzzTestFlag,
+		altEntrypoints:         altEntrypointsFlag,
+		flags:                  make(map[string]bool),
+	}
+	fs.Visit(func(f *flag.Flag) {
+		cfg.flags[f.Name] = true
+	})
+
+	if isBatch(fs.Args(), *outdirFlag) {
+		if *outputFlag != "" {
+			argError(1, "-o cannot be used with several grammars or a directory, got %q", strings.Join(fs.Args(), " "))
+		}
+		if *jobsFlag < 1 {
+			argError(1, "-j must be at least 1, got %d", *jobsFlag)
+		}
+		bc := batchConfig{outdir: *outdirFlag, jobs: *jobsFlag, force: *forceFlag, check: *checkFlag}
+		if code := batch(fs.Args(), bc, cfg); code != 0 {
+			exit(code)
+		}
+		return
+	}
+	if *fuzzTestFlag && *outputFlag == "" {
+		argError(1, "-fuzz-test requires -o")
+	}
+	if *checkFlag && *outputFlag == "" {
+		argError(1, "-check requires -o")
 	}
 
 	// get input source
@@ -114,109 +170,230 @@ func main() {
 		}
 	}()
 
-	// parse input
-	// , Recover(!*noRecoverFlag)
-	g, err := ParseReader(nm, rc, debug(*dbgFlag), memoized(*cacheFlag))
+	src, err := io.ReadAll(rc)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "parse error(s):\n", err)
 		exit(3)
 	}
+	parser, fuzz, err := generate(nm, src, *outputFlag, cfg)
+	var gerr *genError
+	if errors.As(err, &gerr) && parser == nil {
+		fmt.Fprintf(os.Stderr, "%s%v\n", gerr.msg, gerr.err)
+		exit(gerr.code)
+	}
+	if parser == nil {
+		return
+	}
+	if *checkFlag {
+		// the check never writes, not even the unformatted parser
+		if gerr != nil {
+			fmt.Fprintf(os.Stderr, "%s%v\n", gerr.msg, gerr.err)
+			exit(gerr.code)
+		}
+		d, err := checkOutput(*outputFlag, parser, fuzz)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			exit(2)
+		}
+		if d != nil {
+			os.Stdout.Write(d)
+			fmt.Fprintf(os.Stderr, "%s is not up to date with %s\n", *outputFlag, nm)
+			exit(10)
+		}
+		return
+	}
 
-	// validate alternate entrypoints
-	grammar := g.(*ast.Grammar)
-	rules := make(map[string]struct{}, len(grammar.Rules))
-	for _, rule := range grammar.Rules {
-		rules[rule.Name.Val] = struct{}{}
+	out := output(*outputFlag)
+	defer func() {
+		err := out.Close()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "close file error:\n", err)
+			exit(8)
+		}
+	}()
+	if _, err := out.Write(parser); err != nil {
+		fmt.Fprintln(os.Stderr, "write error: ", err)
+		exit(7)
 	}
-	for _, entrypoint := range altEntrypointsFlag {
-		if entrypoint == "" {
-			continue
+	if gerr != nil {
+		// the unformatted parser is written to help find the error
+		fmt.Fprintf(os.Stderr, "%s%v\n", gerr.msg, gerr.err)
+		exit(gerr.code)
+	}
+	if fuzz != nil {
+		if err := os.WriteFile(fuzzTestName(*outputFlag), fuzz, 0644); err != nil {
+			fmt.Fprintln(os.Stderr, "write error: ", err)
+			exit(7)
 		}
+	}
+}
 
-		if _, ok := rules[entrypoint]; !ok {
-			fmt.Fprintf(os.Stderr, "argument error:\nunknown rule name %s used as alternate entrypoint\n", entrypoint)
-			exit(9)
+// genConfig is the configuration of the generation of a parser, set by the
+// command-line flags.
+type genConfig struct {
+	debug, cache, noBuild  bool
+	nolint, optimizeParser bool
+	optimizeRefExprByIndex bool
+	optimizeGrammar        bool
+	grammarOnly            bool
+	receiverName           string
+	grammarName            string
+	runFuncPrefix          string
+	skipRule               string
+	target                 string
+	typeCheck              bool
+	lineDirectives         bool
+	fuzzTest               bool
+	altEntrypoints         []string
+	// flags are the names of the flags set on the command line, which
+	// win over the options of the grammar.
+	flags map[string]bool
+}
+
+// genError is an error of the generation of a parser, with the exit code
+// and the message printed before it.
+type genError struct {
+	code int
+	msg  string
+	err  error
+}
+
+func (e *genError) Error() string {
+	return strings.TrimSpace(e.msg) + " " + e.err.Error()
+}
+
+func (e *genError) Unwrap() error {
+	return e.err
+}
+
+// generate generates the parser of the grammar src read from nm, to be
+// written to outfile, or to stdout if it is empty, and its fuzz harness
+// if cfg.fuzzTest is set. The options of the grammar are merged with cfg.
+// It returns a nil parser if cfg.noBuild is set. The parser written to a
+// file starts with the source header, see sourceHeader, the one written to
+// stdout with the options line only. On a format error, it returns the
+// unformatted parser with the error.
+func generate(nm string, src []byte, outfile string, cfg *genConfig) (parser, fuzz []byte, err error) {
+	cfg, err = cfg.withGrammarOptions(src)
+	if err != nil {
+		return nil, nil, &genError{6, "options parse error:\n", fmt.Errorf("%s: %w", nm, err)}
+	}
+
+	// , Recover(!*noRecoverFlag)
+	g, err := Parse(nm, src, debug(cfg.debug), memoized(cfg.cache))
+	if err != nil {
+		return nil, nil, &genError{3, "parse error(s):\n", err}
+	}
+
+	grammar := g.(*ast.Grammar)
+	for _, w := range ast.AnnotationWarnings(grammar) {
+		fmt.Fprintln(os.Stderr, "warning:", w)
+	}
+
+	// validate rule references, alternate entrypoints and repetitions
+	if err := ast.CheckRuleRefs(grammar, cfg.altEntrypoints...); err != nil {
+		return nil, nil, &genError{9, "grammar error(s):\n", err}
+	}
+	if err := ast.CheckRepetitions(grammar); err != nil {
+		return nil, nil, &genError{9, "grammar error(s):\n", err}
+	}
+	if cfg.noBuild {
+		return nil, nil, nil
+	}
+
+	if cfg.optimizeGrammar {
+		if err := optimizeGrammar(grammar, cfg.skipRule, cfg.altEntrypoints); err != nil {
+			return nil, nil, &genError{9, "grammar error(s):\n", err}
 		}
 	}
 
-	if !*noBuildFlag {
-		// if *optimizeGrammar {
-		// ast.Optimize(grammar, altEntrypointsFlag...)
-		// }
-
-		// generate parser
-		out := output(*outputFlag)
-		defer func() {
-			err := out.Close()
-			if err != nil {
-				fmt.Fprintln(os.Stderr, "close file error:\n", err)
-				exit(8)
-			}
-		}()
-
-		outBuf := bytes.NewBuffer([]byte{})
-
-		curNmOpt := builderGo.ReceiverName(*recvrNmFlag)
-		optimizeParser := builderGo.Optimize(*optimizeParserFlag)
-		nolintOpt := builderGo.Nolint(*nolint)
-		refExprByIndex := builderGo.OptimizeRefExprByIndex(*optimizeRefExprByIndex)
-		runFuncPrefix := builderGo.RunFuncPrefix(*runFuncPrefixFlag)
-		grammarOnly := builderGo.GrammarOnly(*grammarOnlyFlag)
-		grammarName := builderGo.GrammarName(*grammarNameFlag)
-
-		if *targetFlag == "go" {
-			if err := builderGo.BuildParser(
-				outBuf, grammar, curNmOpt, optimizeParser,
-				runFuncPrefix, grammarOnly, grammarName,
-				nolintOpt, refExprByIndex); err != nil {
-				fmt.Fprintln(os.Stderr, "build error: ", err)
-				exit(5)
-			}
+	opts := []builderGo.Option{
+		builderGo.ReceiverName(cfg.receiverName),
+		builderGo.Optimize(cfg.optimizeParser),
+		builderGo.RunFuncPrefix(cfg.runFuncPrefix),
+		builderGo.GrammarOnly(cfg.grammarOnly),
+		builderGo.GrammarName(cfg.grammarName),
+		builderGo.Nolint(cfg.nolint),
+		builderGo.OptimizeRefExprByIndex(cfg.optimizeRefExprByIndex),
+		builderGo.SkipRule(cfg.skipRule),
+		builderGo.AlternateEntrypoints(cfg.altEntrypoints...),
+	}
+	if cfg.lineDirectives {
+		opts = append(opts, builderGo.LineDirectives(grammarPath(outfile, nm)))
+	}
+
+	// type-check the code blocks before writing the parser
+	if cfg.typeCheck && cfg.target == "go" {
+		if err := typeCheck(nm, src, outfile, opts...); err != nil {
+			return nil, nil, &genError{11, "type error(s):\n", err}
 		}
+	}
 
-		// if *targetFlag == "hx" {
-		// 	if err := builderHx.BuildParser(
-		// 		outBuf, grammar, curNmOpt, optimizeParser,
-		// 		runFuncPrefix, grammarOnly, grammarName,
-		// 		nolintOpt, refExprByIndex); err != nil {
-		// 		fmt.Fprintln(os.Stderr, "build error: ", err)
-		// 		exit(5)
-		// 	}
-		// }
-
-		// Defaults from golang.org/x/tools/cmd/goimports
-		options := &imports.Options{
-			TabWidth:  8,
-			TabIndent: true,
-			Comments:  true,
-			Fragment:  true,
+	var fuzzBuf bytes.Buffer
+	if cfg.fuzzTest {
+		opts = append(opts, builderGo.FuzzHarness(&fuzzBuf))
+	}
+
+	// generate parser
+	outBuf := bytes.NewBuffer([]byte{})
+
+	if cfg.target == "go" {
+		if err := builderGo.BuildParser(outBuf, grammar, opts...); err != nil {
+			return nil, nil, &genError{5, "build error: ", err}
 		}
+	}
+
+	// if cfg.target == "hx" {
+	// 	if err := builderHx.BuildParser(outBuf, grammar, opts...); err != nil {
+	// 		return nil, nil, &genError{5, "build error: ", err}
+	// 	}
+	// }
 
-		if *targetFlag == "go" {
-			formattedBuf, err := imports.Process("filename", outBuf.Bytes(), options)
-			if err != nil {
-				if _, err := out.Write(outBuf.Bytes()); err != nil {
-					fmt.Fprintln(os.Stderr, "write error: ", err)
-					exit(7)
-				}
-				fmt.Fprintln(os.Stderr, "format error: ", err)
-				exit(6)
-			}
-
-			if _, err := out.Write(formattedBuf); err != nil {
-				fmt.Fprintln(os.Stderr, "write error: ", err)
-				exit(7)
-			}
-		} else {
-			if _, err := out.Write(outBuf.Bytes()); err != nil {
-				fmt.Fprintln(os.Stderr, "write error: ", err)
-				exit(7)
-			}
+	if cfg.target != "go" {
+		return outBuf.Bytes(), nil, nil
+	}
+
+	// Defaults from golang.org/x/tools/cmd/goimports
+	options := &imports.Options{
+		TabWidth:  8,
+		TabIndent: true,
+		Comments:  true,
+		Fragment:  true,
+	}
+
+	parser, err = imports.Process("filename", outBuf.Bytes(), options)
+	if err != nil {
+		return outBuf.Bytes(), nil, &genError{6, "format error: ", err}
+	}
+	if outfile != "" {
+		parser = addSourceHeader(parser, sourceHeader(nm, src, outfile, cfg))
+	} else if line := optionsLine(cfg); line != "" {
+		// only the source line depends on the path of the parser
+		parser = addSourceHeader(parser, line)
+	}
+	if cfg.lineDirectives {
+		parser = restorePositions(parser, outputName(outfile, nm))
+	}
+	if cfg.fuzzTest {
+		fuzz, err = imports.Process(fuzzTestName(outfile), fuzzBuf.Bytes(), options)
+		if err != nil {
+			return nil, nil, &genError{6, "format error: ", err}
 		}
 	}
+	return parser, fuzz, nil
 }
 
-var usagePage = `usage: %s [options] [GRAMMAR_FILE]
+var usagePage = `usage: %[1]s [options] [GRAMMAR_FILE]
+       %[1]s [options] GRAMMAR_FILE|DIR...
+       %[1]s lint [options] [GRAMMAR_FILE]
+       %[1]s ebnf [options] [GRAMMAR_FILE]
+       %[1]s fmt [options] [GRAMMAR_FILE...]
+       %[1]s gen [options] GRAMMAR_FILE
+       %[1]s graph [options] [GRAMMAR_FILE]
+       %[1]s railroad [options] [GRAMMAR_FILE]
+       %[1]s repl [options] GRAMMAR_FILE
+       %[1]s run [options] GRAMMAR_FILE [INPUT_FILE]
+       %[1]s test [options] GRAMMAR_FILE CORPUS...
 
 Pigeon generates a parser based on a PEG grammar.
 
@@ -225,14 +402,46 @@ generated parser to stdout. If GRAMMAR_FILE is specified, the
 grammar is read from this file instead. If the -o flag is set,
 the generated code is written to this file instead.
 
+With several grammar files, a directory or -outdir, the parser of each
+grammar (the .peg files of the directories) is written next to it with
+the .go extension, or in the -outdir directory, in parallel. The parsers
+start with a //pigeon:source header recording the path and the hash of
+the grammar, and the version of pigeon. The grammars whose existing
+parser has the same header and options are skipped.
+
+The options -alternate-entrypoints, -cache, -grammar-name, -grammar-only,
+-line-directives, -nolint, -optimize-grammar, -optimize-parser,
+-optimize-ref-expr-by-index, -receiver-name, -run-func-prefix and
+-skip-rule may also be set in the grammar, in lines starting with
+"//pigeon:options" among its leading comments. The flags win over the
+options of the grammar. The effective options are recorded after the
+source header.
+
 	-cache
 		cache parser results to avoid exponential parsing time in
 		pathological cases. Can make the parsing slower for typical
 		cases and uses more memory.
+	-check
+		generate the parser in memory and compare it with the output
+		file instead of writing it. The diffs of the files that are not
+		up to date are printed and the exit code is 10. Requires -o or
+		the batch mode.
 	-debug
 		output debugging information while parsing the grammar.
+	-force
+		in batch mode, generate the parsers even if they are up to date.
+	-fuzz-test
+		write a fuzz harness of the parser next to the output file, in
+		OUTPUT_FILE without .go followed by _fuzz_test.go. Its FuzzParse
+		target checks that the parser does not panic, that the errors
+		are positioned within the input and that the memoized and
+		non-memoized parses agree, for each entrypoint. It is seeded
+		with the files of the testdata directory. Requires -o.
 	-h -help
 		display this help message.
+	-j N
+		in batch mode, generate N grammars in parallel. Defaults to the
+		number of CPUs.
 	-nolint
 		add '// nolint: ...' comments for generated parser to suppress
 		warnings by gometalinter (https://github.com/alecthomas/gometalinter) or
@@ -242,14 +451,37 @@ the generated code is written to this file instead.
 		when debugging, otherwise the panic is converted to an error.
 	-o OUTPUT_FILE
 		write the generated parser to OUTPUT_FILE. Defaults to stdout.
+	-outdir DIR
+		in batch mode, write the parsers to DIR instead of next to their
+		grammar.
 	-optimize-ref-expr-by-index
 		generate optimized parser grammar find RefExpr by index (~10%% performance increased, cause more git line diff)
+	-optimize-grammar
+		optimize the grammar before generating the parser: inline the
+		rules without references and the rules annotated with @inline,
+		remove the unused rules and combine the literals and character
+		classes. The results of the parser are unchanged, but its error
+		messages may differ.
 	-optimize-parser
 		generate optimized parser without Debug and Memoize options and
 		with some other optimizations applied.
 	-receiver-name NAME
 		use NAME as for the receiver name of the generated methods
 		for the grammar's code blocks. Defaults to "c".
+	-skip-rule NAME
+		apply the rule NAME implicitly before each token of the syntactic
+		rules (rules whose name starts with an uppercase letter). The
+		skipped input is not part of the text captured by the tokens.
+	-line-directives
+		add //line directives before the code blocks, so that panics,
+		stack traces and compile errors in code blocks point to the
+		grammar. The parser is assumed to be written in the directory
+		of the grammar if -o is not set.
+	-typecheck
+		type-check the code blocks of the grammar with the generated
+		parser before writing it, with the other files of its package if
+		-o is set. The errors in code blocks are reported at their
+		position in the grammar, and the parser is not written.
 	-x
 		do not generate the parser, only parse the grammar.
  	-alternate-entrypoints RULE[,RULE...]
@@ -265,6 +497,36 @@ the generated code is written to this file instead.
 	-target
 		build target, default go
 
+Commands:
+
+	ebnf
+		convert the grammar to W3C or ISO EBNF,
+		see "%[1]s ebnf -h".
+	fmt
+		format the grammars in the canonical layout,
+		see "%[1]s fmt -h".
+	gen
+		generate random sentences of the grammar,
+		see "%[1]s gen -h".
+	graph
+		write the rule reference graph of the grammar in DOT or JSON,
+		see "%[1]s graph -h".
+	lint
+		report the issues of the grammar found by static checks,
+		see "%[1]s lint -h".
+	railroad
+		render the rules of the grammar as railroad diagrams,
+		see "%[1]s railroad -h".
+	repl
+		parse the input lines interactively with the grammar,
+		see "%[1]s repl -h".
+	run
+		parse an input with the grammar and print the tree of the
+		matched rules, see "%[1]s run -h".
+	test
+		run the cases of corpus files against the grammar,
+		see "%[1]s test -h".
+
 See https://godoc.org/github.com/mna/pigeon for more information.
 This version is a fork: https://github.com/fy0/pigeon
 `
@@ -314,6 +576,76 @@ func output(filename string) io.WriteCloser {
 	return out
 }
 
+// optimizeGrammar optimizes the grammar, keeping the alternate entrypoints
+// and the skip rule. The syntactic rules are left as is where the
+// optimizations would change how the skip rule is applied.
+func optimizeGrammar(grammar *ast.Grammar, skipRule string, altEntrypoints []string) error {
+	if skipRule == "" {
+		ast.Optimize(grammar, altEntrypoints...)
+		return nil
+	}
+	lexical, err := builderGo.LexicalRules(grammar, skipRule)
+	if err != nil {
+		return err
+	}
+	b := &builderGo.Builder{SkipRule: skipRule, LexicalRules: lexical}
+	entrypoints := append([]string{skipRule}, altEntrypoints...)
+	ast.OptimizeSkip(grammar, b.IsSyntactic, entrypoints...)
+	return nil
+}
+
+// fuzzTestName returns the name of the fuzz harness of the parser written
+// to filename.
+func fuzzTestName(filename string) string {
+	return strings.TrimSuffix(filename, ".go") + "_fuzz_test.go"
+}
+
+// outputName returns the name of the generated file used in the //line
+// directives: the base name of the output file, or of the grammar file nm
+// with the .go extension if the parser is written to stdout.
+func outputName(filename, nm string) string {
+	if filename != "" {
+		return filepath.Base(filename)
+	}
+	nm = filepath.Base(nm)
+	return strings.TrimSuffix(nm, filepath.Ext(nm)) + ".go"
+}
+
+// grammarPath returns the path of the grammar file nm used in the //line
+// directives, relative to the directory of the output file, which is
+// assumed to be the directory of the grammar if the parser is written to
+// stdout.
+func grammarPath(filename, nm string) string {
+	if filename == "" {
+		return filepath.Base(nm)
+	}
+	dir, err := filepath.Abs(filepath.Dir(filename))
+	if err != nil {
+		return nm
+	}
+	path, err := filepath.Abs(nm)
+	if err != nil {
+		return nm
+	}
+	if rel, err := filepath.Rel(dir, path); err == nil {
+		return rel
+	}
+	return path
+}
+
+// restorePositions replaces the markers that follow the code blocks in the
+// generated code src by //line directives restoring the position in the
+// generated file name.
+func restorePositions(src []byte, name string) []byte {
+	lines := bytes.Split(src, []byte("\n"))
+	for i, line := range lines {
+		if string(bytes.TrimSpace(line)) == builderGo.CodeEndMarker {
+			lines[i] = []byte("//line " + name + ":" + strconv.Itoa(i+2) + ":1")
+		}
+	}
+	return bytes.Join(lines, []byte("\n"))
+}
+
 // create a ReadCloser that reads from r and closes c.
 func makeReadCloser(r io.Reader, c io.Closer) io.ReadCloser {
 	rc := struct {
@@ -2,14 +2,15 @@ package main
 
 import (
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 )
 
 func TestMain(t *testing.T) {
 	stdout, stderr := os.Stdout, os.Stderr
-	os.Stdout, _ = os.Open(os.DevNull)
-	os.Stderr, _ = os.Open(os.DevNull)
+	os.Stdout, _ = os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	os.Stderr, _ = os.OpenFile(os.DevNull, os.O_WRONLY, 0)
 	defer func() {
 		exit = os.Exit
 		os.Stdout = stdout
@@ -25,8 +26,48 @@ func TestMain(t *testing.T) {
 	}{
 		{args: "", code: 3},            // stdin: no match found
 		{args: "-h", code: 0},          // help
-		{args: "FILE1 FILE2", code: 1}, // want only 1 non-flag arg
+		{args: "FILE1 FILE2", code: 2}, // several grammars: FILE1 not found
 		{args: "-x", code: 3},          // stdin: no match found
+		{args: "-fuzz-test", code: 1},  // -fuzz-test requires -o
+		{args: "-check", code: 1},      // -check requires -o
+		{args: "-check -o test/pluck/pluck.go test/pluck/pluck.peg", code: 10}, // no source header
+		{args: "-o out.go test/pluck/pluck.peg test/pluck/pluck.peg", code: 1}, // -o with several grammars
+		{args: "ebnf -h", code: 0},
+		{args: "ebnf -notation iso test/pluck/pluck.peg", code: 0},
+		{args: "ebnf -notation bnf test/pluck/pluck.peg", code: 1},
+		{args: "fmt -h", code: 0},
+		{args: "fmt -l test/issue_115/issue_115.peg", code: 0},
+		{args: "fmt -d test/pluck/pluck.peg", code: 10},
+		{args: "fmt -w", code: 1}, // -w requires files
+		{args: "fmt test/pluck/pluck.peg", code: 0},
+		{args: "gen -h", code: 0},
+		{args: "gen", code: 1}, // the grammar is required
+		{args: "gen -n 3 -weight Factor=1,3 examples/calculator/calculator.peg", code: 0},
+		{args: "gen -weight Value=1,1 examples/json/json.peg", code: 9},
+		{args: "graph -h", code: 0},
+		{args: "graph -format json test/left_recursion/left_recursion.peg", code: 0},
+		{args: "graph -format png test/left_recursion/left_recursion.peg", code: 1},
+		{args: "lint -h", code: 0},
+		{args: "railroad -h", code: 0},
+		{args: "railroad -hide-code test/pluck/pluck.peg", code: 0},
+		{args: "railroad -rule nope test/pluck/pluck.peg", code: 1},
+		{args: "lint test/pluck/pluck.peg", code: 0},
+		{args: "repl -h", code: 0},
+		{args: "repl", code: 1},                                       // the grammar is required
+		{args: "repl -entrypoint nope test/pluck/pluck.peg", code: 9}, // undefined rule
+		{args: "run -h", code: 0},
+		{args: "run", code: 1}, // the grammar is required
+		{args: "run -json examples/json/json.peg examples/json/testdata/github-octocat-status1.json", code: 0},
+		{args: "run -entrypoint nope examples/json/json.peg main.go", code: 9},
+		{args: "run test/errorpos/errorpos.peg main.go", code: 10},
+		{args: "test -h", code: 0},
+		{args: "test examples/calculator/calculator.peg", code: 1}, // the corpus is required
+		{args: "test examples/calculator/calculator.peg examples/calculator/corpus", code: 0},
+		{args: "test -run Missing examples/json/json.peg examples/calculator/corpus", code: 10},
+		{args: "test examples/calculator/calculator.peg nope.txt", code: 2},
+		{args: "lint test/issue_70b/issue_70b.peg", code: 10}, // shadowed alternative
+		{args: "lint -json -disable unused-rule,shadowed-alternative test/issue_70b/issue_70b.peg", code: 0},
+		{args: "lint -disable nope test/pluck/pluck.peg", code: 1},
 	}
 
 	for _, tc := range cases {
@@ -52,3 +93,39 @@ func runMainRecover() (code int) {
 	main()
 	return 0
 }
+
+func TestCheckFormatError(t *testing.T) {
+	stdout, stderr := os.Stdout, os.Stderr
+	os.Stdout, _ = os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	os.Stderr, _ = os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	defer func() {
+		exit = os.Exit
+		os.Stdout = stdout
+		os.Stderr = stderr
+	}()
+	exit = func(code int) {
+		panic(code)
+	}
+
+	dir := t.TempDir()
+	grammar, outfile := filepath.Join(dir, "bad.peg"), filepath.Join(dir, "bad.go")
+	if err := os.WriteFile(grammar, []byte("{\npackage bad\n}\nA = 'a' { return ) }\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(outfile, []byte("package bad\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// the unformatted parser is not written by the check
+	os.Args = []string{"pigeon", "-check", "-o", outfile, grammar}
+	if got := runMainRecover(); got != 6 {
+		t.Errorf("want code 6, got %d", got)
+	}
+	b, err := os.ReadFile(outfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "package bad\n" {
+		t.Errorf("want %s not written, got\n%s", outfile, b)
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// optionsPragma starts the lines of the grammar options, among the comments
+// at the start of the grammar, e.g.:
+//
+//	//pigeon:options -optimize-parser -grammar-name=expr
+//
+// It also starts the line recording the effective options in the header of
+// the generated parsers.
+const optionsPragma = "//pigeon:options"
+
+// defaultGenConfig is the configuration of the generation without flags.
+var defaultGenConfig = genConfig{
+	receiverName: "c",
+	grammarName:  "g",
+	target:       "go",
+}
+
+// grammarFlags defines the flags of the options that can be set in the
+// grammar, bound to the fields of cfg. Their default values are the values
+// of the fields, so that defining them leaves cfg unchanged.
+func grammarFlags(fs *flag.FlagSet, cfg *genConfig) {
+	fs.BoolVar(&cfg.cache, "cache", cfg.cache, "cache parsing results")
+	fs.BoolVar(&cfg.nolint, "nolint", cfg.nolint, "add '// nolint: ...' comments")
+	fs.BoolVar(&cfg.optimizeParser, "optimize-parser", cfg.optimizeParser, "generate optimized parser")
+	fs.BoolVar(&cfg.optimizeGrammar, "optimize-grammar", cfg.optimizeGrammar, "optimize the grammar")
+	fs.BoolVar(&cfg.optimizeRefExprByIndex, "optimize-ref-expr-by-index", cfg.optimizeRefExprByIndex, "find RefExpr by index")
+	fs.BoolVar(&cfg.grammarOnly, "grammar-only", cfg.grammarOnly, "generate grammar part only")
+	fs.BoolVar(&cfg.lineDirectives, "line-directives", cfg.lineDirectives, "add //line directives")
+	fs.StringVar(&cfg.receiverName, "receiver-name", cfg.receiverName, "receiver name for the generated methods")
+	fs.StringVar(&cfg.grammarName, "grammar-name", cfg.grammarName, "variable name of the grammar")
+	fs.StringVar(&cfg.runFuncPrefix, "run-func-prefix", cfg.runFuncPrefix, "prefix of the generated function names")
+	fs.StringVar(&cfg.skipRule, "skip-rule", cfg.skipRule, "rule applied implicitly before each token")
+	fs.Var((*ruleNamesFlag)(&cfg.altEntrypoints), "alternate-entrypoints", "alternate entrypoints")
+}
+
+// grammarOptions returns the arguments of the options lines among the
+// comments at the start of the grammar src.
+func grammarOptions(src []byte) []string {
+	var args []string
+	for _, line := range bytes.Split(src, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		if !bytes.HasPrefix(line, []byte("//")) {
+			break
+		}
+		if rest, ok := bytes.CutPrefix(line, []byte(optionsPragma)); ok && (len(rest) == 0 || rest[0] == ' ' || rest[0] == '\t') {
+			args = append(args, strings.Fields(string(rest))...)
+		}
+	}
+	return args
+}
+
+// withGrammarOptions returns the configuration cfg merged with the options
+// of the grammar src. The flags set on the command line, in cfg.flags, win
+// over the options of the grammar.
+func (cfg *genConfig) withGrammarOptions(src []byte) (*genConfig, error) {
+	args := grammarOptions(src)
+	if len(args) == 0 {
+		return cfg, nil
+	}
+
+	var opts genConfig
+	ofs := flag.NewFlagSet(optionsPragma, flag.ContinueOnError)
+	ofs.SetOutput(io.Discard)
+	grammarFlags(ofs, &opts)
+	if err := ofs.Parse(args); err != nil {
+		return nil, err
+	}
+	if ofs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected argument %q", ofs.Arg(0))
+	}
+
+	eff := *cfg
+	eff.altEntrypoints = append([]string(nil), cfg.altEntrypoints...)
+	efs := flag.NewFlagSet(optionsPragma, flag.ContinueOnError)
+	grammarFlags(efs, &eff)
+	ofs.Visit(func(f *flag.Flag) {
+		if cfg.flags[f.Name] {
+			return
+		}
+		if f.Name == "alternate-entrypoints" {
+			eff.altEntrypoints = nil
+		}
+		// the values are valid, they are set from the same kind of flag
+		_ = efs.Set(f.Name, f.Value.String())
+	})
+	return &eff, nil
+}
+
+// grammarArgs returns the arguments of the options of the grammar that
+// differ from their default value in cfg, as written in an options line.
+func (cfg *genConfig) grammarArgs() []string {
+	def := defaultGenConfig
+	dfs := flag.NewFlagSet("", flag.ContinueOnError)
+	grammarFlags(dfs, &def)
+	cur := *cfg
+	cfs := flag.NewFlagSet("", flag.ContinueOnError)
+	grammarFlags(cfs, &cur)
+
+	var args []string
+	cfs.VisitAll(func(f *flag.Flag) {
+		val := f.Value.String()
+		if val == dfs.Lookup(f.Name).Value.String() {
+			return
+		}
+		if bf, ok := f.Value.(interface{ IsBoolFlag() bool }); ok && bf.IsBoolFlag() {
+			args = append(args, "-"+f.Name)
+			return
+		}
+		args = append(args, "-"+f.Name+"="+val)
+	})
+	return args
+}
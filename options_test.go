@@ -0,0 +1,77 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGrammarOptions(t *testing.T) {
+	const grammar = `// Expression grammar.
+//pigeon:options -nolint -grammar-name=expr
+//pigeon:options -alternate-entrypoints Term,Factor
+//pigeon:optionsfoo -cache
+
+{
+package expr
+}
+//pigeon:options -optimize-parser
+Expr = "x"
+`
+	want := []string{"-nolint", "-grammar-name=expr", "-alternate-entrypoints", "Term,Factor"}
+	if got := grammarOptions([]byte(grammar)); !reflect.DeepEqual(got, want) {
+		t.Fatalf("want options %q, got %q", want, got)
+	}
+
+	cases := []struct {
+		flags map[string]bool
+		cfg   genConfig
+		want  string
+	}{
+		{
+			cfg:  defaultGenConfig,
+			want: "-alternate-entrypoints=Term,Factor -grammar-name=expr -nolint",
+		},
+		{
+			// the flags win over the options of the grammar
+			flags: map[string]bool{"grammar-name": true, "alternate-entrypoints": true},
+			cfg:   genConfig{receiverName: "c", grammarName: "g", altEntrypoints: []string{"Expr"}},
+			want:  "-alternate-entrypoints=Expr -nolint",
+		},
+		{
+			flags: map[string]bool{"optimize-parser": true},
+			cfg:   genConfig{receiverName: "r", grammarName: "g", optimizeParser: true},
+			want:  "-alternate-entrypoints=Term,Factor -grammar-name=expr -nolint -optimize-parser -receiver-name=r",
+		},
+	}
+	for i, tc := range cases {
+		cfg := tc.cfg
+		cfg.flags = tc.flags
+		eff, err := cfg.withGrammarOptions([]byte(grammar))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Join(eff.grammarArgs(), " "); got != tc.want {
+			t.Errorf("%d: want effective options %q, got %q", i, tc.want, got)
+		}
+	}
+
+	// the parser written to stdout has the options line, but no source
+	// line
+	parser, _, err := generate("expr.peg", []byte(grammar+"Term = \"t\"\nFactor = \"f\"\n"), "", &defaultGenConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := readSourceHeader(parser), optionsPragma+" "+cases[0].want; got != want {
+		t.Errorf("stdout: want header %q, got %q", want, got)
+	}
+
+	for _, grammar := range []string{
+		"//pigeon:options -nope\nA = 'a'\n",
+		"//pigeon:options -nolint Expr\nA = 'a'\n",
+	} {
+		if _, err := defaultGenConfig.withGrammarOptions([]byte(grammar)); err == nil {
+			t.Errorf("%q: want error", grammar)
+		}
+	}
+}
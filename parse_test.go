@@ -7,18 +7,21 @@ import (
 )
 
 var invalidParseCases = map[string]string{
-	"":           `file:1:1 (0): no match found, expected: "/*", "//", "\n", "{", [ \t\r] or [\pL_]`,
-	"a":          `file:1:2 (1): no match found, expected: "'", "/*", "//", "<-", "=", "\"", "\n", "` + "`" + `", "←", "⟵", [ \t\r], [\pL_] or [\p{Nd}]`,
-	"abc":        `file:1:4 (3): no match found, expected: "'", "/*", "//", "<-", "=", "\"", "\n", "` + "`" + `", "←", "⟵", [ \t\r], [\pL_] or [\p{Nd}]`,
-	" ":          `file:1:2 (1): no match found, expected: "/*", "//", "\n", "{", [ \t\r] or [\pL_]`,
-	`a = +`:      `file:1:5 (4): no match found, expected: "!", "#", "%", "&", "'", "(", ".", "/*", "//", "[", "\"", "\n", "` + "`" + `", [ \t\r] or [\pL_]`,
-	`a = *`:      `file:1:5 (4): no match found, expected: "!", "#", "%", "&", "'", "(", ".", "/*", "//", "[", "\"", "\n", "` + "`" + `", [ \t\r] or [\pL_]`,
-	`a = ?`:      `file:1:5 (4): no match found, expected: "!", "#", "%", "&", "'", "(", ".", "/*", "//", "[", "\"", "\n", "` + "`" + `", [ \t\r] or [\pL_]`,
-	"a ←":        `file:1:4 (5): no match found, expected: "!", "#", "%", "&", "'", "(", ".", "/*", "//", "[", "\"", "\n", "` + "`" + `", [ \t\r] or [\pL_]`,
-	"a ← b\nb ←": `file:2:4 (13): no match found, expected: "!", "#", "%", "&", "'", "(", ".", "/*", "//", "[", "\"", "\n", "` + "`" + `", [ \t\r] or [\pL_]`,
-	"a ← nil:b":  "file:1:5 (6): rule Identifier: identifier is a reserved word",
-	"\xfe":       "file:1:1 (0): invalid encoding",
-	"{}{}":       `file:1:3 (2): no match found, expected: "/*", "//", ";", "\n", [ \t\r] or EOF`,
+	"":                      `file:1:1 (0): no match found, expected: "/*", "//", "@", "\n", "{", [ \t\r] or [\pL_]`,
+	"a":                     `file:1:2 (1): no match found, expected: "'", "/*", "//", "<", "<-", "=", "\"", "\n", "` + "`" + `", "←", "⟵", [ \t\r], [\pL_] or [\p{Nd}]`,
+	"abc":                   `file:1:4 (3): no match found, expected: "'", "/*", "//", "<", "<-", "=", "\"", "\n", "` + "`" + `", "←", "⟵", [ \t\r], [\pL_] or [\p{Nd}]`,
+	" ":                     `file:1:2 (1): no match found, expected: "/*", "//", "@", "\n", "{", [ \t\r] or [\pL_]`,
+	`a = +`:                 `file:1:5 (4): no match found, expected: "!", "#", "%", "&", "'", "(", ".", "/*", "//", "[", "\"", "\n", "` + "`" + `", [ \t\r] or [\pL_]`,
+	`a = *`:                 `file:1:5 (4): no match found, expected: "!", "#", "%", "&", "'", "(", ".", "/*", "//", "[", "\"", "\n", "` + "`" + `", [ \t\r] or [\pL_]`,
+	`a = ?`:                 `file:1:5 (4): no match found, expected: "!", "#", "%", "&", "'", "(", ".", "/*", "//", "[", "\"", "\n", "` + "`" + `", [ \t\r] or [\pL_]`,
+	"a ←":                   `file:1:4 (5): no match found, expected: "!", "#", "%", "&", "'", "(", ".", "/*", "//", "[", "\"", "\n", "` + "`" + `", [ \t\r] or [\pL_]`,
+	"a ← b\nb ←":            `file:2:4 (13): no match found, expected: "!", "#", "%", "&", "'", "(", ".", "/*", "//", "[", "\"", "\n", "` + "`" + `", [ \t\r] or [\pL_]`,
+	"a ← nil:b":             "file:1:5 (6): rule Identifier: identifier is a reserved word",
+	"\xfe":                  "file:1:1 (0): invalid encoding",
+	"a < > = b":             "file:1:3 (2): rule RuleType: empty rule type",
+	"a = @b c { return c }": `file:1:5 (4): rule ActionExpr: "@" cannot be used with an action block`,
+	"@doc(x) a = b":         `file:1:6 (5): no match found, expected: "'", ")", "/*", "//", "\"", "\n", "` + "`" + `" or [ \t\r]`,
+	"{}{}":                  `file:1:3 (2): no match found, expected: "/*", "//", ";", "\n", [ \t\r] or EOF`,
 
 	// non-terminated, empty, EOF "quoted" tokens
 	"{":         "file:1:1 (0): rule CodeBlock: code block not terminated",
@@ -54,15 +57,18 @@ var invalidParseCases = map[string]string{
 file:1:5 (4): rule CharClassMatcher: character class not terminated`,
 
 	// invalid escapes
-	`a ← [\pA]`:    "file:1:8 (9): rule UnicodeClassEscape: invalid Unicode class escape",
-	`a ← [\p{WW}]`: "file:1:8 (9): rule UnicodeClassEscape: invalid Unicode class escape",
-	`a = '\"'`:     "file:1:7 (6): rule SingleStringEscape: invalid escape character",
-	`a = "\'"`:     "file:1:7 (6): rule DoubleStringEscape: invalid escape character",
-	`a = [\']`:     "file:1:7 (6): rule CharClassEscape: invalid escape character",
-	`a = '\xz'`:    "file:1:7 (6): rule HexEscape: invalid hexadecimal escape",
-	`a = '\0z'`:    "file:1:7 (6): rule OctalEscape: invalid octal escape",
-	`a = '\uz'`:    "file:1:7 (6): rule ShortUnicodeEscape: invalid Unicode escape",
-	`a = '\Uz'`:    "file:1:7 (6): rule LongUnicodeEscape: invalid Unicode escape",
+	`a ← [\pA]`:            "file:1:8 (9): rule UnicodeClassEscape: invalid Unicode class escape",
+	`a ← [\p{WW}]`:         "file:1:8 (9): rule UnicodeClassEscape: invalid Unicode class escape",
+	`a = '\"'`:             "file:1:7 (6): rule SingleStringEscape: invalid escape character",
+	`a = "\'"`:             "file:1:7 (6): rule DoubleStringEscape: invalid escape character",
+	`a ← [\P{WW}]`:         "file:1:8 (9): rule UnicodeClassEscape: invalid Unicode class escape",
+	`a = [\p{Script=Foo}]`: `file:1:8 (7): rule UnicodeClassEscape: unknown Unicode Script value "Foo"`,
+	`a = [\p{Foo=Greek}]`:  `file:1:8 (7): rule UnicodeClassEscape: unknown Unicode property "Foo"`,
+	`a = [\']`:             "file:1:7 (6): rule CharClassEscape: invalid escape character",
+	`a = '\xz'`:            "file:1:7 (6): rule HexEscape: invalid hexadecimal escape",
+	`a = '\0z'`:            "file:1:7 (6): rule OctalEscape: invalid octal escape",
+	`a = '\uz'`:            "file:1:7 (6): rule ShortUnicodeEscape: invalid Unicode escape",
+	`a = '\Uz'`:            "file:1:7 (6): rule LongUnicodeEscape: invalid Unicode escape",
 
 	// escapes followed by newline
 	"a = '\\\n": `file:2:0 (6): rule SingleStringEscape: invalid escape character
@@ -412,6 +418,18 @@ var validParseCases = map[string]*ast.Grammar{
 			},
 		},
 	},
+	`a = "b"i`: {
+		Rules: []*ast.Rule{
+			{
+				Name: ast.NewIdentifier(ast.Pos{}, "a"),
+				Expr: func() *ast.LitMatcher {
+					m := ast.NewLitMatcher(ast.Pos{}, "b")
+					m.IgnoreCase = true
+					return m
+				}(),
+			},
+		},
+	},
 	"a = ``": {
 		Rules: []*ast.Rule{
 			{
@@ -420,6 +438,87 @@ var validParseCases = map[string]*ast.Grammar{
 			},
 		},
 	},
+	`a = [\p{Script=Greek}--[α]&&\P{Lu}]`: {
+		Rules: []*ast.Rule{
+			{
+				Name: ast.NewIdentifier(ast.Pos{}, "a"),
+				Expr: &ast.CharClassMatcher{
+					UnicodeClasses: []string{"Greek"},
+					Subtract: []*ast.CharClassMatcher{
+						{Chars: []rune{'α'}},
+					},
+					Intersect: []*ast.CharClassMatcher{
+						{NotUnicodeClasses: []string{"Lu"}},
+					},
+				},
+			},
+		},
+	},
+	"a <int> = b\nc < map[string][]*T > \"C\" = d": {
+		Rules: []*ast.Rule{
+			{
+				Name: ast.NewIdentifier(ast.Pos{}, "a"),
+				Type: ast.NewGoType(ast.Pos{}, "int"),
+				Expr: &ast.RuleRefExpr{Name: ast.NewIdentifier(ast.Pos{}, "b")},
+			},
+			{
+				Name:        ast.NewIdentifier(ast.Pos{}, "c"),
+				Type:        ast.NewGoType(ast.Pos{}, "map[string][]*T"),
+				DisplayName: ast.NewStringLit(ast.Pos{}, `"C"`),
+				Expr:        &ast.RuleRefExpr{Name: ast.NewIdentifier(ast.Pos{}, "d")},
+			},
+		},
+	},
+	"a = '(' @b @c:<d> ')'": {
+		Rules: []*ast.Rule{
+			{
+				Name: ast.NewIdentifier(ast.Pos{}, "a"),
+				Expr: &ast.SeqExpr{
+					Exprs: []ast.Expression{
+						ast.NewLitMatcher(ast.Pos{}, "("),
+						&ast.LabeledExpr{
+							Expr:  &ast.RuleRefExpr{Name: ast.NewIdentifier(ast.Pos{}, "b")},
+							Pluck: true,
+						},
+						&ast.LabeledExpr{
+							Label:       ast.NewIdentifier(ast.Pos{}, "c"),
+							Expr:        &ast.RuleRefExpr{Name: ast.NewIdentifier(ast.Pos{}, "d")},
+							TextCapture: true,
+							Pluck:       true,
+						},
+						ast.NewLitMatcher(ast.Pos{}, ")"),
+					},
+				},
+			},
+		},
+	},
+	"@inline @doc(\"A\\n\", `b`)\na = b @c\n  @token\nb = c": {
+		Rules: []*ast.Rule{
+			{
+				Name: ast.NewIdentifier(ast.Pos{}, "a"),
+				Annotations: []*ast.Annotation{
+					{Name: ast.NewIdentifier(ast.Pos{}, "inline")},
+					{Name: ast.NewIdentifier(ast.Pos{}, "doc"), Args: []string{"A\n", "b"}},
+				},
+				Expr: &ast.SeqExpr{
+					Exprs: []ast.Expression{
+						&ast.RuleRefExpr{Name: ast.NewIdentifier(ast.Pos{}, "b")},
+						&ast.LabeledExpr{
+							Expr:  &ast.RuleRefExpr{Name: ast.NewIdentifier(ast.Pos{}, "c")},
+							Pluck: true,
+						},
+					},
+				},
+			},
+			{
+				Name: ast.NewIdentifier(ast.Pos{}, "b"),
+				Annotations: []*ast.Annotation{
+					{Name: ast.NewIdentifier(ast.Pos{}, "token")},
+				},
+				Expr: &ast.RuleRefExpr{Name: ast.NewIdentifier(ast.Pos{}, "c")},
+			},
+		},
+	},
 }
 
 func TestValidParseCases(t *testing.T) {
@@ -443,3 +542,25 @@ again:
 		goto again
 	}
 }
+
+func TestParseIgnoreCase(t *testing.T) {
+	cases := map[string]bool{
+		`a = "a"i`: true,
+		`a = "a"`:  false,
+	}
+	for tc, want := range cases {
+		g, err := Parse("", []byte(tc))
+		if err != nil {
+			t.Errorf("%q: got error %v", tc, err)
+			continue
+		}
+		lit, ok := g.(*ast.Grammar).Rules[0].Expr.(*ast.LitMatcher)
+		if !ok {
+			t.Errorf("%q: want a literal matcher, got %T", tc, g.(*ast.Grammar).Rules[0].Expr)
+			continue
+		}
+		if lit.Val != "a" || lit.IgnoreCase != want {
+			t.Errorf("%q: want %q with IgnoreCase %t, got %q with IgnoreCase %t", tc, "a", want, lit.Val, lit.IgnoreCase)
+		}
+	}
+}
@@ -90,16 +90,50 @@ var g = &grammar{
 				run: (*parser).call_onRule_1,
 				expr: &seqExpr{
 					exprs: []any{
+						&labeledExpr{
+							label: "annotations",
+							expr: &zeroOrMoreExpr{
+								expr: &actionExpr{
+									run: (*parser).call_onRule_5,
+									expr: &seqExpr{
+										exprs: []any{
+											&labeledExpr{
+												label: "a",
+												expr:  &ruleRefExpr{name: "Annotation"},
+											},
+											&ruleRefExpr{name: "__"},
+										},
+									},
+								},
+							},
+						},
 						&labeledExpr{
 							label: "name",
 							expr:  &ruleRefExpr{name: "IdentifierName"},
 						},
 						&ruleRefExpr{name: "__"},
+						&labeledExpr{
+							label: "typ",
+							expr: &zeroOrOneExpr{
+								expr: &actionExpr{
+									run: (*parser).call_onRule_15,
+									expr: &seqExpr{
+										exprs: []any{
+											&labeledExpr{
+												label: "t",
+												expr:  &ruleRefExpr{name: "RuleType"},
+											},
+											&ruleRefExpr{name: "__"},
+										},
+									},
+								},
+							},
+						},
 						&labeledExpr{
 							label: "display",
 							expr: &zeroOrOneExpr{
 								expr: &actionExpr{
-									run: (*parser).call_onRule_8,
+									run: (*parser).call_onRule_22,
 									expr: &seqExpr{
 										exprs: []any{
 											&labeledExpr{
@@ -123,6 +157,118 @@ var g = &grammar{
 				},
 			},
 		},
+		{
+			name:      "Annotation",
+			varExists: true,
+			expr: &actionExpr{
+				run: (*parser).call_onAnnotation_1,
+				expr: &seqExpr{
+					exprs: []any{
+						&litMatcher{val: "@", want: "\"@\""},
+						&labeledExpr{
+							label: "name",
+							expr:  &ruleRefExpr{name: "IdentifierName"},
+						},
+						&labeledExpr{
+							label: "args",
+							expr: &zeroOrOneExpr{
+								expr: &actionExpr{
+									run: (*parser).call_onAnnotation_8,
+									expr: &seqExpr{
+										exprs: []any{
+											&litMatcher{val: "(", want: "\"(\""},
+											&ruleRefExpr{name: "__"},
+											&labeledExpr{
+												label: "a",
+												expr: &zeroOrOneExpr{
+													expr: &ruleRefExpr{name: "AnnotationArgs"},
+												},
+											},
+											&ruleRefExpr{name: "__"},
+											&litMatcher{val: ")", want: "\")\""},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name:      "AnnotationArgs",
+			varExists: true,
+			expr: &actionExpr{
+				run: (*parser).call_onAnnotationArgs_1,
+				expr: &seqExpr{
+					exprs: []any{
+						&labeledExpr{
+							label: "first",
+							expr:  &ruleRefExpr{name: "StringLiteral"},
+						},
+						&labeledExpr{
+							label: "rest",
+							expr: &zeroOrMoreExpr{
+								expr: &actionExpr{
+									run: (*parser).call_onAnnotationArgs_7,
+									expr: &seqExpr{
+										exprs: []any{
+											&ruleRefExpr{name: "__"},
+											&litMatcher{val: ",", want: "\",\""},
+											&ruleRefExpr{name: "__"},
+											&labeledExpr{
+												label: "s",
+												expr:  &ruleRefExpr{name: "StringLiteral"},
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "NextAnnotatedRule",
+			expr: &seqExpr{
+				exprs: []any{
+					&ruleRefExpr{name: "_"},
+					&zeroOrOneExpr{
+						expr: &ruleRefExpr{name: "SingleLineComment"},
+					},
+					&ruleRefExpr{name: "EOL"},
+					&ruleRefExpr{name: "__"},
+					&oneOrMoreExpr{
+						expr: &seqExpr{
+							exprs: []any{
+								&ruleRefExpr{name: "Annotation"},
+								&ruleRefExpr{name: "__"},
+							},
+						},
+					},
+					&ruleRefExpr{name: "IdentifierName"},
+					&ruleRefExpr{name: "__"},
+					&zeroOrOneExpr{
+						expr: &seqExpr{
+							exprs: []any{
+								&ruleRefExpr{name: "RuleType"},
+								&ruleRefExpr{name: "__"},
+							},
+						},
+					},
+					&zeroOrOneExpr{
+						expr: &seqExpr{
+							exprs: []any{
+								&ruleRefExpr{name: "StringLiteral"},
+								&ruleRefExpr{name: "__"},
+							},
+						},
+					},
+					&ruleRefExpr{name: "RuleDefOp"},
+				},
+			},
+		},
 		{
 			name: "Expression",
 			expr: &ruleRefExpr{name: "RecoveryExpr"},
@@ -254,6 +400,9 @@ var g = &grammar{
 									run: (*parser).call_onActionSeqExpr_7,
 									expr: &seqExpr{
 										exprs: []any{
+											&notExpr{
+												expr: &ruleRefExpr{name: "NextAnnotatedRule"},
+											},
 											&ruleRefExpr{name: "__"},
 											&labeledExpr{
 												label: "ae",
@@ -334,6 +483,9 @@ var g = &grammar{
 									run: (*parser).call_onSeqExpr_7,
 									expr: &seqExpr{
 										exprs: []any{
+											&notExpr{
+												expr: &ruleRefExpr{name: "NextAnnotatedRule"},
+											},
 											&ruleRefExpr{name: "__"},
 											&labeledExpr{
 												label: "le",
@@ -357,6 +509,12 @@ var g = &grammar{
 						run: (*parser).call_onLabeledExpr_2,
 						expr: &seqExpr{
 							exprs: []any{
+								&labeledExpr{
+									label: "pluck",
+									expr: &zeroOrOneExpr{
+										expr: &ruleRefExpr{name: "PluckOp"},
+									},
+								},
 								&labeledExpr{
 									label: "label",
 									expr:  &ruleRefExpr{name: "Identifier"},
@@ -376,9 +534,15 @@ var g = &grammar{
 						},
 					},
 					&actionExpr{
-						run: (*parser).call_onLabeledExpr_15,
+						run: (*parser).call_onLabeledExpr_18,
 						expr: &seqExpr{
 							exprs: []any{
+								&labeledExpr{
+									label: "pluck",
+									expr: &zeroOrOneExpr{
+										expr: &ruleRefExpr{name: "PluckOp"},
+									},
+								},
 								&labeledExpr{
 									label: "label",
 									expr:  &ruleRefExpr{name: "Identifier"},
@@ -393,11 +557,30 @@ var g = &grammar{
 							},
 						},
 					},
+					&actionExpr{
+						run: (*parser).call_onLabeledExpr_30,
+						expr: &seqExpr{
+							exprs: []any{
+								&ruleRefExpr{name: "PluckOp"},
+								&labeledExpr{
+									label: "expr",
+									expr:  &ruleRefExpr{name: "PrefixedExpr"},
+								},
+							},
+						},
+					},
 					&ruleRefExpr{name: "PrefixedExpr"},
 					&ruleRefExpr{name: "ThrowExpr"},
 				},
 			},
 		},
+		{
+			name: "PluckOp",
+			expr: &actionExpr{
+				run:  (*parser).call_onPluckOp_1,
+				expr: &litMatcher{val: "@", want: "\"@\""},
+			},
+		},
 		{
 			name:      "PrefixedExpr",
 			varExists: true,
@@ -517,6 +700,14 @@ var g = &grammar{
 							expr: &seqExpr{
 								exprs: []any{
 									&ruleRefExpr{name: "__"},
+									&zeroOrOneExpr{
+										expr: &seqExpr{
+											exprs: []any{
+												&ruleRefExpr{name: "RuleType"},
+												&ruleRefExpr{name: "__"},
+											},
+										},
+									},
 									&zeroOrOneExpr{
 										expr: &seqExpr{
 											exprs: []any{
@@ -533,6 +724,72 @@ var g = &grammar{
 				},
 			},
 		},
+		{
+			name: "RuleType",
+			expr: &choiceExpr{
+				alternatives: []any{
+					&actionExpr{
+						run: (*parser).call_onRuleType_2,
+						expr: &seqExpr{
+							exprs: []any{
+								&litMatcher{val: "<", want: "\"<\""},
+								&notExpr{
+									expr: &litMatcher{val: "-", want: "\"-\""},
+								},
+								&oneOrMoreExpr{
+									expr: &seqExpr{
+										exprs: []any{
+											&notExpr{
+												expr: &choiceExpr{
+													alternatives: []any{
+														&litMatcher{val: ">", want: "\">\""},
+														&ruleRefExpr{name: "EOL"},
+													},
+												},
+											},
+											&ruleRefExpr{name: "SourceChar"},
+										},
+									},
+								},
+								&litMatcher{val: ">", want: "\">\""},
+							},
+						},
+					},
+					&actionExpr{
+						run: (*parser).call_onRuleType_15,
+						expr: &seqExpr{
+							exprs: []any{
+								&litMatcher{val: "<", want: "\"<\""},
+								&notExpr{
+									expr: &litMatcher{val: "-", want: "\"-\""},
+								},
+								&zeroOrMoreExpr{
+									expr: &seqExpr{
+										exprs: []any{
+											&notExpr{
+												expr: &choiceExpr{
+													alternatives: []any{
+														&litMatcher{val: ">", want: "\">\""},
+														&ruleRefExpr{name: "EOL"},
+													},
+												},
+											},
+											&ruleRefExpr{name: "SourceChar"},
+										},
+									},
+								},
+								&choiceExpr{
+									alternatives: []any{
+										&ruleRefExpr{name: "EOL"},
+										&ruleRefExpr{name: "EOF"},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
 		{
 			name:      "SemanticPredExpr",
 			varExists: true,
@@ -713,7 +970,10 @@ var g = &grammar{
 						&labeledExpr{
 							label: "ignore",
 							expr: &zeroOrOneExpr{
-								expr: &litMatcher{val: "i", want: "\"i\""},
+								expr: &actionExpr{
+									run:  (*parser).call_onLitMatcher_7,
+									expr: &litMatcher{val: "i", want: "\"i\""},
+								},
 							},
 						},
 					},
@@ -1102,17 +1362,12 @@ var g = &grammar{
 						expr: &seqExpr{
 							exprs: []any{
 								&litMatcher{val: "[", want: "\"[\""},
+								&ruleRefExpr{name: "ClassItems"},
 								&zeroOrMoreExpr{
-									expr: &choiceExpr{
-										alternatives: []any{
-											&ruleRefExpr{name: "ClassCharRange"},
-											&ruleRefExpr{name: "ClassChar"},
-											&seqExpr{
-												exprs: []any{
-													&litMatcher{val: "\\", want: "\"\\\\\""},
-													&ruleRefExpr{name: "UnicodeClassEscape"},
-												},
-											},
+									expr: &seqExpr{
+										exprs: []any{
+											&ruleRefExpr{name: "CharClassSetOp"},
+											&ruleRefExpr{name: "ClassOperand"},
 										},
 									},
 								},
@@ -1124,7 +1379,7 @@ var g = &grammar{
 						},
 					},
 					&actionExpr{
-						run: (*parser).call_onCharClassMatcher_15,
+						run: (*parser).call_onCharClassMatcher_13,
 						expr: &seqExpr{
 							exprs: []any{
 								&litMatcher{val: "[", want: "\"[\""},
@@ -1150,11 +1405,95 @@ var g = &grammar{
 				},
 			},
 		},
+		{
+			name: "ClassItems",
+			expr: &zeroOrMoreExpr{
+				expr: &seqExpr{
+					exprs: []any{
+						&notExpr{
+							expr: &ruleRefExpr{name: "CharClassSetOp"},
+						},
+						&choiceExpr{
+							alternatives: []any{
+								&ruleRefExpr{name: "ClassCharRange"},
+								&ruleRefExpr{name: "ClassChar"},
+								&seqExpr{
+									exprs: []any{
+										&litMatcher{val: "\\", want: "\"\\\\\""},
+										&ruleRefExpr{name: "UnicodeClassEscape"},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "ClassOperand",
+			expr: &choiceExpr{
+				alternatives: []any{
+					&seqExpr{
+						exprs: []any{
+							&litMatcher{val: "[", want: "\"[\""},
+							&ruleRefExpr{name: "ClassItems"},
+							&zeroOrMoreExpr{
+								expr: &seqExpr{
+									exprs: []any{
+										&ruleRefExpr{name: "CharClassSetOp"},
+										&ruleRefExpr{name: "ClassOperand"},
+									},
+								},
+							},
+							&litMatcher{val: "]", want: "\"]\""},
+						},
+					},
+					&seqExpr{
+						exprs: []any{
+							&litMatcher{val: "\\", want: "\"\\\\\""},
+							&ruleRefExpr{name: "UnicodeClassEscape"},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "CharClassSetOp",
+			expr: &seqExpr{
+				exprs: []any{
+					&choiceExpr{
+						alternatives: []any{
+							&litMatcher{val: "--", want: "\"--\""},
+							&litMatcher{val: "&&", want: "\"&&\""},
+						},
+					},
+					&andExpr{
+						expr: &choiceExpr{
+							alternatives: []any{
+								&litMatcher{val: "[", want: "\"[\""},
+								&seqExpr{
+									exprs: []any{
+										&litMatcher{val: "\\", want: "\"\\\\\""},
+										&charClassMatcher{
+											val:   "[pP]",
+											chars: []rune{'p', 'P'},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
 		{
 			name: "ClassCharRange",
 			expr: &seqExpr{
 				exprs: []any{
 					&ruleRefExpr{name: "ClassChar"},
+					&notExpr{
+						expr: &ruleRefExpr{name: "CharClassSetOp"},
+					},
 					&litMatcher{val: "-", want: "\"-\""},
 					&ruleRefExpr{name: "ClassChar"},
 				},
@@ -1202,7 +1541,10 @@ var g = &grammar{
 						expr: &seqExpr{
 							exprs: []any{
 								&notExpr{
-									expr: &litMatcher{val: "p", want: "\"p\""},
+									expr: &charClassMatcher{
+										val:   "[pP]",
+										chars: []rune{'p', 'P'},
+									},
 								},
 								&choiceExpr{
 									alternatives: []any{
@@ -1222,7 +1564,10 @@ var g = &grammar{
 			varExists: true,
 			expr: &seqExpr{
 				exprs: []any{
-					&litMatcher{val: "p", want: "\"p\""},
+					&charClassMatcher{
+						val:   "[pP]",
+						chars: []rune{'p', 'P'},
+					},
 					&choiceExpr{
 						alternatives: []any{
 							&ruleRefExpr{name: "SingleCharUnicodeClass"},
@@ -1245,6 +1590,24 @@ var g = &grammar{
 							},
 							&actionExpr{
 								run: (*parser).call_onUnicodeClassEscape_13,
+								expr: &seqExpr{
+									exprs: []any{
+										&litMatcher{val: "{", want: "\"{\""},
+										&labeledExpr{
+											label: "prop",
+											expr:  &ruleRefExpr{name: "IdentifierName"},
+										},
+										&litMatcher{val: "=", want: "\"=\""},
+										&labeledExpr{
+											label: "value",
+											expr:  &ruleRefExpr{name: "IdentifierName"},
+										},
+										&litMatcher{val: "}", want: "\"}\""},
+									},
+								},
+							},
+							&actionExpr{
+								run: (*parser).call_onUnicodeClassEscape_22,
 								expr: &seqExpr{
 									exprs: []any{
 										&litMatcher{val: "{", want: "\"{\""},
@@ -1257,11 +1620,19 @@ var g = &grammar{
 								},
 							},
 							&actionExpr{
-								run: (*parser).call_onUnicodeClassEscape_19,
+								run: (*parser).call_onUnicodeClassEscape_28,
 								expr: &seqExpr{
 									exprs: []any{
 										&litMatcher{val: "{", want: "\"{\""},
 										&ruleRefExpr{name: "IdentifierName"},
+										&zeroOrOneExpr{
+											expr: &seqExpr{
+												exprs: []any{
+													&litMatcher{val: "=", want: "\"=\""},
+													&ruleRefExpr{name: "IdentifierName"},
+												},
+											},
+										},
 										&choiceExpr{
 											alternatives: []any{
 												&litMatcher{val: "]", want: "\"]\""},
@@ -1561,7 +1932,23 @@ func (p *parser) call_onInitializer_1() any {
 	})(&p.cur, stack["code"])
 }
 
-func (p *parser) call_onRule_8() any {
+func (p *parser) call_onRule_5() any {
+	stack := p.vstack[len(p.vstack)-1]
+	return (func(c *current, a any) any {
+		return a
+		return nil
+	})(&p.cur, stack["a"])
+}
+
+func (p *parser) call_onRule_15() any {
+	stack := p.vstack[len(p.vstack)-1]
+	return (func(c *current, t any) any {
+		return t
+		return nil
+	})(&p.cur, stack["t"])
+}
+
+func (p *parser) call_onRule_22() any {
 	stack := p.vstack[len(p.vstack)-1]
 	return (func(c *current, sl any) any {
 		return sl
@@ -1571,18 +1958,65 @@ func (p *parser) call_onRule_8() any {
 
 func (p *parser) call_onRule_1() any {
 	stack := p.vstack[len(p.vstack)-1]
-	return (func(c *current, name, display, expr any) any {
+	return (func(c *current, annotations, name, typ, display, expr any) any {
 		pos := c.astPos()
 
 		rule := ast.NewRule(pos, name.(*ast.Identifier))
+		if typ != nil {
+			rule.Type = typ.(*ast.GoType)
+		}
 		if display != nil {
 			rule.DisplayName = display.(*ast.StringLit)
 		}
 		rule.Expr = expr.(ast.Expression)
+		for _, a := range toAnySlice(annotations) {
+			rule.Annotations = append(rule.Annotations, a.(*ast.Annotation))
+		}
 
 		return rule
 		return nil
-	})(&p.cur, stack["name"], stack["display"], stack["expr"])
+	})(&p.cur, stack["annotations"], stack["name"], stack["typ"], stack["display"], stack["expr"])
+}
+
+func (p *parser) call_onAnnotation_8() any {
+	stack := p.vstack[len(p.vstack)-1]
+	return (func(c *current, a any) any {
+		return a
+		return nil
+	})(&p.cur, stack["a"])
+}
+
+func (p *parser) call_onAnnotation_1() any {
+	stack := p.vstack[len(p.vstack)-1]
+	return (func(c *current, name, args any) any {
+		ann := ast.NewAnnotation(c.astPos(), name.(*ast.Identifier))
+		for _, arg := range toAnySlice(args) {
+			s, err := strconv.Unquote(arg.(*ast.StringLit).Val)
+			if err != nil {
+				// an invalid string literal raises an error in the escape rules.
+				s = ""
+			}
+			ann.Args = append(ann.Args, s)
+		}
+		return ann
+		return nil
+	})(&p.cur, stack["name"], stack["args"])
+}
+
+func (p *parser) call_onAnnotationArgs_7() any {
+	stack := p.vstack[len(p.vstack)-1]
+	return (func(c *current, s any) any {
+		return s
+		return nil
+	})(&p.cur, stack["s"])
+}
+
+func (p *parser) call_onAnnotationArgs_1() any {
+	stack := p.vstack[len(p.vstack)-1]
+	return (func(c *current, first, rest any) any {
+		return append([]any{first}, toAnySlice(rest)...)
+		return nil
+	})(&p.cur, stack["first"], stack["rest"])
 }
 
 func (p *parser) call_onRecoveryExpr_7() any {
@@ -1699,6 +2133,9 @@ func (p *parser) call_onActionExpr_2() any {
 		if code == nil {
 			return expr
 		}
+		if ast.IsPlucked(expr.(ast.Expression)) {
+			p.addErr(errors.New("\"@\" cannot be used with an action block"))
+		}
 
 		pos := c.astPos()
 		act := ast.NewActionExpr(pos)
@@ -1747,27 +2184,48 @@ func (p *parser) call_onSeqExpr_1() any {
 
 func (p *parser) call_onLabeledExpr_2() any {
 	stack := p.vstack[len(p.vstack)-1]
-	return (func(c *current, label, expr any) any {
+	return (func(c *current, pluck, label, expr any) any {
 		pos := c.astPos()
 		lab := ast.NewLabeledExpr(pos)
 		lab.Label = label.(*ast.Identifier)
 		lab.Expr = expr.(ast.Expression)
 		lab.TextCapture = true
+		lab.Pluck = pluck != nil
 		return lab
 		return nil
-	})(&p.cur, stack["label"], stack["expr"])
+	})(&p.cur, stack["pluck"], stack["label"], stack["expr"])
 }
 
-func (p *parser) call_onLabeledExpr_15() any {
+func (p *parser) call_onLabeledExpr_18() any {
 	stack := p.vstack[len(p.vstack)-1]
-	return (func(c *current, label, expr any) any {
+	return (func(c *current, pluck, label, expr any) any {
 		pos := c.astPos()
 		lab := ast.NewLabeledExpr(pos)
 		lab.Label = label.(*ast.Identifier)
 		lab.Expr = expr.(ast.Expression)
+		lab.Pluck = pluck != nil
 		return lab
 		return nil
-	})(&p.cur, stack["label"], stack["expr"])
+	})(&p.cur, stack["pluck"], stack["label"], stack["expr"])
+}
+
+func (p *parser) call_onLabeledExpr_30() any {
+	stack := p.vstack[len(p.vstack)-1]
+	return (func(c *current, expr any) any {
+		pos := c.astPos()
+		lab := ast.NewLabeledExpr(pos)
+		lab.Expr = expr.(ast.Expression)
+		lab.Pluck = true
+		return lab
+		return nil
+	})(&p.cur, stack["expr"])
+}
+
+func (p *parser) call_onPluckOp_1() any {
+	return (func(c *current) any {
+		return true
+		return nil
+	})(&p.cur)
 }
 
 func (p *parser) call_onPrefixedExpr_2() any {
@@ -1854,6 +2312,25 @@ func (p *parser) call_onRuleRefExpr_1() any {
 	})(&p.cur, stack["name"])
 }
 
+func (p *parser) call_onRuleType_2() any {
+	return (func(c *current) any {
+		t := strings.TrimSpace(string(c.text[1 : len(c.text)-1]))
+		if t == "" {
+			p.addErr(errors.New("empty rule type"))
+		}
+		return ast.NewGoType(c.astPos(), t)
+		return nil
+	})(&p.cur)
+}
+
+func (p *parser) call_onRuleType_15() any {
+	return (func(c *current) any {
+		p.addErr(errors.New("rule type not terminated"))
+		return ast.NewGoType(c.astPos(), "")
+		return nil
+	})(&p.cur)
+}
+
 func (p *parser) call_onSemanticPredExpr_1() any {
 	stack := p.vstack[len(p.vstack)-1]
 	return (func(c *current, op, code any) any {
@@ -1907,6 +2384,13 @@ func (p *parser) call_onIdentifierName_1() any {
 	})(&p.cur)
 }
 
+func (p *parser) call_onLitMatcher_7() any {
+	return (func(c *current) any {
+		return true
+		return nil
+	})(&p.cur)
+}
+
 func (p *parser) call_onLitMatcher_1() any {
 	stack := p.vstack[len(p.vstack)-1]
 	return (func(c *current, lit, ignore any) any {
@@ -2013,7 +2497,7 @@ func (p *parser) call_onCharClassMatcher_2() any {
 	})(&p.cur)
 }
 
-func (p *parser) call_onCharClassMatcher_15() any {
+func (p *parser) call_onCharClassMatcher_13() any {
 	return (func(c *current) any {
 		p.addErr(errors.New("character class not terminated"))
 		return ast.NewCharClassMatcher(c.astPos(), "[]")
@@ -2036,6 +2520,16 @@ func (p *parser) call_onUnicodeClassEscape_5() any {
 }
 
 func (p *parser) call_onUnicodeClassEscape_13() any {
+	stack := p.vstack[len(p.vstack)-1]
+	return (func(c *current, prop, value any) any {
+		if _, err := ast.UnicodePropertyValue(prop.(*ast.Identifier).Val, value.(*ast.Identifier).Val); err != nil {
+			p.addErr(err)
+		}
+		return nil
+	})(&p.cur, stack["prop"], stack["value"])
+}
+
+func (p *parser) call_onUnicodeClassEscape_22() any {
 	stack := p.vstack[len(p.vstack)-1]
 	return (func(c *current, ident any) any {
 		if !unicodeClasses[ident.(*ast.Identifier).Val] {
@@ -2045,7 +2539,7 @@ func (p *parser) call_onUnicodeClassEscape_13() any {
 	})(&p.cur, stack["ident"])
 }
 
-func (p *parser) call_onUnicodeClassEscape_19() any {
+func (p *parser) call_onUnicodeClassEscape_28() any {
 	return (func(c *current) any {
 		p.addErr(errors.New("Unicode class not terminated"))
 		return nil
@@ -3206,18 +3700,25 @@ func (p *parser) parseOneOrMoreExpr(expr *oneOrMoreExpr) (any, bool) {
 	var vals []any
 	var matched bool
 	for {
+		pos := p.pt.offset
 		val, ok := p.parseExprWrap(expr.expr)
 		if !ok {
-			if len(vals) > 0 {
-				return vals, matched
-			}
-			return nil, matched
+			break
 		}
 		matched = true
 		if val != nil {
 			vals = append(vals, val)
 		}
+		if p.pt.offset == pos {
+			// the expression matched without consuming input, it would
+			// match forever
+			break
+		}
+	}
+	if len(vals) > 0 {
+		return vals, matched
 	}
+	return nil, matched
 }
 
 func (p *parser) parseRecoveryExpr(recover *recoveryExpr) (any, bool) {
@@ -3292,17 +3793,24 @@ func (p *parser) parseZeroOrMoreExpr(expr *zeroOrMoreExpr) (any, bool) {
 
 	var vals []any
 	for {
+		pos := p.pt.offset
 		val, ok := p.parseExprWrap(expr.expr)
 		if !ok {
-			if len(vals) > 0 {
-				return vals, true
-			}
-			return nil, true
+			break
 		}
 		if val != nil {
 			vals = append(vals, val)
 		}
+		if p.pt.offset == pos {
+			// the expression matched without consuming input, it would
+			// match forever
+			break
+		}
 	}
+	if len(vals) > 0 {
+		return vals, true
+	}
+	return nil, true
 }
 
 func (p *parser) parseZeroOrOneExpr(expr *zeroOrOneExpr) (any, bool) {
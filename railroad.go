@@ -0,0 +1,116 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fy0/pigeon/ast"
+	"github.com/fy0/pigeon/railroad"
+)
+
+var railroadUsagePage = `usage: %[1]s railroad [options] [GRAMMAR_FILE]
+
+Railroad renders the rules of a PEG grammar as railroad diagrams, written
+as a self-contained HTML document with a section and an SVG diagram per
+rule, where the rule references link to the sections of the rules. The
+grammar is read from GRAMMAR_FILE, or from stdin if it is not specified.
+
+The diagrams show the choices, sequences, repetitions, predicates, literals,
+character classes, rule references, code blocks and throw and recovery
+expressions of the rules. The labels are not shown, and the code of the code
+blocks is in the tooltip of their box.
+
+The following options can be specified:
+
+	-h -help
+		display this help message.
+	-hide-code
+		hide the code blocks: the actions, the state code blocks and
+		the semantic predicates.
+	-o OUTPUT_FILE
+		write the diagrams to OUTPUT_FILE. Defaults to stdout.
+	-rule NAME
+		write the diagram of the rule NAME only, as a standalone SVG
+		document.
+	-title TITLE
+		title of the HTML document. Defaults to the name of the grammar
+		file.
+`
+
+// railroadMain implements the railroad command.
+func railroadMain(args []string) {
+	fs := flag.NewFlagSet(os.Args[0]+" railroad", flag.ExitOnError)
+	var (
+		shortHelpFlag = fs.Bool("h", false, "show help page")
+		longHelpFlag  = fs.Bool("help", false, "show help page")
+		hideCodeFlag  = fs.Bool("hide-code", false, "hide the code blocks")
+		outputFlag    = fs.String("o", "", "output file, defaults to stdout")
+		ruleFlag      = fs.String("rule", "", "write the SVG diagram of this rule only")
+		titleFlag     = fs.String("title", "", "title of the HTML document")
+	)
+	fs.Usage = func() {
+		fmt.Printf(railroadUsagePage, os.Args[0])
+	}
+	if err := fs.Parse(args); err != nil {
+		fmt.Fprintf(os.Stderr, "args parse error:\n%v\n", err)
+		exit(6)
+	}
+
+	if *shortHelpFlag || *longHelpFlag {
+		fs.Usage()
+		exit(0)
+	}
+	if fs.NArg() > 1 {
+		fmt.Fprintf(os.Stderr, "expected one argument, got %q\n", fs.Args())
+		fs.Usage()
+		exit(1)
+	}
+
+	nm, rc := input(fs.Arg(0))
+	g, err := ParseReader(nm, rc)
+	rc.Close()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "parse error(s):\n%v\n", err)
+		exit(3)
+	}
+	grammar := g.(*ast.Grammar)
+
+	opts := railroad.Options{HideCode: *hideCodeFlag}
+	var res []byte
+	if *ruleFlag != "" {
+		var rule *ast.Rule
+		for _, r := range grammar.Rules {
+			if r.Name.Val == *ruleFlag {
+				rule = r
+				break
+			}
+		}
+		if rule == nil {
+			fmt.Fprintf(os.Stderr, "undefined rule %q\n", *ruleFlag)
+			exit(1)
+		}
+		res = railroad.SVG(grammar, rule, opts)
+	} else {
+		title := *titleFlag
+		if title == "" {
+			title = strings.TrimSuffix(filepath.Base(nm), filepath.Ext(nm))
+		}
+		res = railroad.HTML(grammar, title, opts)
+	}
+
+	out := output(*outputFlag)
+	if _, err := out.Write(res); err != nil {
+		fmt.Fprintf(os.Stderr, "write error: %v\n", err)
+		exit(7)
+	}
+	if out == os.Stdout {
+		return
+	}
+	if err := out.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "close file error:\n%v\n", err)
+		exit(8)
+	}
+}
@@ -0,0 +1,241 @@
+package railroad
+
+import (
+	"fmt"
+	"html"
+	"strings"
+	"unicode/utf8"
+)
+
+// Dimensions of the diagrams, in pixels.
+const (
+	arcRadius  = 10  // radius of the arcs connecting the branches
+	vertSep    = 8   // vertical separation between branches
+	horizSep   = 10  // horizontal separation between the items of a sequence
+	boxHeight  = 22  // height of the boxes of terminals and non-terminals
+	boxPadding = 10  // horizontal padding of the text in the boxes
+	charWidth  = 7.5 // width of a character of the monospace font
+	groupPad   = 10  // padding of the content of a group
+	labelLine  = 14  // height of the label line of a group
+)
+
+// node is an element of a railroad diagram. It is laid out around its
+// baseline, the horizontal line entering it on the left and leaving it on
+// the right.
+type node interface {
+	// size returns the width of the node and its height above and below
+	// the baseline.
+	size() (width, up, down float64)
+	// draw writes the SVG elements of the node, with its baseline
+	// starting at (x, y).
+	draw(w *writer, x, y float64)
+}
+
+// writer accumulates the SVG elements of a diagram.
+type writer struct {
+	strings.Builder
+}
+
+func (w *writer) line(x1, y1, x2, y2 float64) {
+	if x1 != x2 || y1 != y2 {
+		fmt.Fprintf(w, `<path d="M%g %gL%g %g"/>`+"\n", x1, y1, x2, y2)
+	}
+}
+
+func (w *writer) path(x, y float64, d string, args ...any) {
+	fmt.Fprintf(w, `<path d="M%g %g`+d+`"/>`+"\n", append([]any{x, y}, args...)...)
+}
+
+func textWidth(s string) float64 {
+	return float64(utf8.RuneCountInString(s)) * charWidth
+}
+
+// box is a terminal or a non-terminal: a box containing text, with an
+// optional link and tooltip.
+type box struct {
+	class string
+	text  string
+	href  string
+	title string
+}
+
+func (b *box) size() (float64, float64, float64) {
+	return textWidth(b.text) + 2*boxPadding, boxHeight / 2, boxHeight / 2
+}
+
+func (b *box) draw(w *writer, x, y float64) {
+	width, _, _ := b.size()
+	fmt.Fprintf(w, `<g class="%s">`, b.class)
+	if b.title != "" {
+		fmt.Fprintf(w, "<title>%s</title>", html.EscapeString(b.title))
+	}
+	if b.href != "" {
+		fmt.Fprintf(w, `<a href="%s">`, html.EscapeString(b.href))
+	}
+	rx := 0
+	if b.class == "terminal" {
+		rx = boxHeight / 2
+	}
+	fmt.Fprintf(w, `<rect x="%g" y="%g" width="%g" height="%d" rx="%d"/>`, x, y-boxHeight/2, width, boxHeight, rx)
+	fmt.Fprintf(w, `<text x="%g" y="%g">%s</text>`, x+width/2, y+4, html.EscapeString(b.text))
+	if b.href != "" {
+		w.WriteString("</a>")
+	}
+	w.WriteString("</g>\n")
+}
+
+// sequence is a sequence of nodes, connected on their baseline.
+type sequence []node
+
+func (s sequence) size() (width, up, down float64) {
+	for i, n := range s {
+		w, u, d := n.size()
+		if i > 0 {
+			width += horizSep
+		}
+		width += w
+		if u > up {
+			up = u
+		}
+		if d > down {
+			down = d
+		}
+	}
+	return width, up, down
+}
+
+func (s sequence) draw(w *writer, x, y float64) {
+	for i, n := range s {
+		if i > 0 {
+			w.line(x, y, x+horizSep, y)
+			x += horizSep
+		}
+		n.draw(w, x, y)
+		width, _, _ := n.size()
+		x += width
+	}
+}
+
+// choice is a choice between nodes, the first one on the baseline and the
+// other ones below it.
+type choice []node
+
+// offsets returns the offsets of the baselines of the branches relative to
+// the baseline of the choice.
+func (c choice) offsets() []float64 {
+	offs := make([]float64, len(c))
+	for i := 1; i < len(c); i++ {
+		_, _, prevDown := c[i-1].size()
+		_, up, _ := c[i].size()
+		offs[i] = offs[i-1] + prevDown + vertSep + up
+		if offs[i] < offs[i-1]+2*arcRadius {
+			offs[i] = offs[i-1] + 2*arcRadius
+		}
+	}
+	return offs
+}
+
+func (c choice) size() (width, up, down float64) {
+	for _, n := range c {
+		if w, _, _ := n.size(); w > width {
+			width = w
+		}
+	}
+	_, up, down = c[0].size()
+	if len(c) > 1 {
+		offs := c.offsets()
+		_, _, d := c[len(c)-1].size()
+		down = offs[len(offs)-1] + d
+	}
+	return width + 4*arcRadius, up, down
+}
+
+func (c choice) draw(w *writer, x, y float64) {
+	width, _, _ := c.size()
+	for i, off := range c.offsets() {
+		nw, _, _ := c[i].size()
+		start, end := x+2*arcRadius, x+width-2*arcRadius
+		if i == 0 {
+			w.line(x, y, start, y)
+		} else {
+			w.path(x, y, "a%d %d 0 0 1 %d %dv%ga%d %d 0 0 0 %d %d",
+				arcRadius, arcRadius, arcRadius, arcRadius, off-2*arcRadius,
+				arcRadius, arcRadius, arcRadius, arcRadius)
+		}
+		c[i].draw(w, start, y+off)
+		w.line(start+nw, y+off, end, y+off)
+		if i == 0 {
+			w.line(end, y, x+width, y)
+		} else {
+			w.path(end, y+off, "a%d %d 0 0 0 %d %dv%ga%d %d 0 0 1 %d %d",
+				arcRadius, arcRadius, arcRadius, -arcRadius, -(off - 2*arcRadius),
+				arcRadius, arcRadius, arcRadius, -arcRadius)
+		}
+	}
+}
+
+// loop is the repetition of a node, with a path looping back below it.
+type loop struct {
+	n node
+}
+
+func (l loop) offset() float64 {
+	_, _, down := l.n.size()
+	if down+vertSep < 2*arcRadius {
+		return 2 * arcRadius
+	}
+	return down + vertSep
+}
+
+func (l loop) size() (float64, float64, float64) {
+	width, up, _ := l.n.size()
+	return width + 2*arcRadius, up, l.offset()
+}
+
+func (l loop) draw(w *writer, x, y float64) {
+	width, _, _ := l.n.size()
+	off := l.offset()
+	w.line(x, y, x+arcRadius, y)
+	l.n.draw(w, x+arcRadius, y)
+	w.line(x+arcRadius+width, y, x+2*arcRadius+width, y)
+	w.path(x+arcRadius+width, y, "a%d %d 0 0 1 %d %dv%ga%d %d 0 0 1 %d %dh%ga%d %d 0 0 1 %d %dv%ga%d %d 0 0 1 %d %d",
+		arcRadius, arcRadius, arcRadius, arcRadius, off-2*arcRadius,
+		arcRadius, arcRadius, -arcRadius, arcRadius, -width,
+		arcRadius, arcRadius, -arcRadius, -arcRadius, -(off - 2*arcRadius),
+		arcRadius, arcRadius, arcRadius, -arcRadius)
+}
+
+// group surrounds a node with a dashed box and a label, for the predicates
+// and the recovery expressions.
+type group struct {
+	class string
+	label string
+	n     node
+}
+
+func (g group) size() (float64, float64, float64) {
+	width, up, down := g.n.size()
+	width += 2 * groupPad
+	if lw := textWidth(g.label) + groupPad; lw > width {
+		width = lw
+	}
+	return width, up + groupPad + labelLine, down + groupPad
+}
+
+func (g group) draw(w *writer, x, y float64) {
+	width, up, down := g.size()
+	nw, _, _ := g.n.size()
+	start := x + (width-nw)/2
+	fmt.Fprintf(w, `<g class="%s"><rect x="%g" y="%g" width="%g" height="%g" rx="%d"/>`,
+		g.class, x, y-up+labelLine, width, up+down-labelLine, arcRadius)
+	fmt.Fprintf(w, `<text x="%g" y="%g">%s</text></g>`+"\n", x+2, y-up+labelLine-4, html.EscapeString(g.label))
+	w.line(x, y, start, y)
+	g.n.draw(w, start, y)
+	w.line(start+nw, y, x+width, y)
+}
+
+// skip is the empty path of an optional node.
+type skip struct{}
+
+func (skip) size() (float64, float64, float64) { return 0, 0, 0 }
+func (skip) draw(*writer, float64, float64)    {}
@@ -0,0 +1,250 @@
+// Package railroad renders the rules of PEG grammars as railroad diagrams,
+// in SVG, and the grammars as HTML documents embedding these diagrams.
+package railroad
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+
+	"github.com/fy0/pigeon/ast"
+)
+
+// Options configures the rendering of the diagrams.
+type Options struct {
+	// HideCode hides the code blocks: the actions, the state code blocks
+	// and the semantic predicates.
+	HideCode bool
+}
+
+// margin is the margin around a diagram, and endSize the size of the
+// markers of its start and end.
+const (
+	margin  = 10
+	endSize = 10
+)
+
+// Style is the CSS style of the diagrams, embedded in the standalone SVG
+// diagrams and the HTML documents.
+const Style = `svg.railroad { background-color: #fafaf5; }
+svg.railroad path { stroke-width: 2; stroke: #333; fill: none; }
+svg.railroad text { font: 12px monospace; text-anchor: middle; white-space: pre; }
+svg.railroad rect { stroke-width: 2; stroke: #333; fill: #dfd; }
+svg.railroad .nonterminal rect { fill: #ddf; }
+svg.railroad .code rect, svg.railroad .throw rect { fill: #eee; stroke-dasharray: 4 2; }
+svg.railroad .predicate rect, svg.railroad .recovery rect { fill: none; stroke: #999; stroke-dasharray: 4 2; }
+svg.railroad .predicate text, svg.railroad .recovery text { text-anchor: start; fill: #666; }
+svg.railroad a text { fill: #00c; }
+`
+
+// SVG returns the railroad diagram of the rule of g, as a standalone SVG
+// document. The references to the rules of g link to the #rule-NAME
+// anchors.
+func SVG(g *ast.Grammar, rule *ast.Rule, opts Options) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	writeSVG(&buf, g, rule, opts, true)
+	return buf.Bytes()
+}
+
+// HTML returns an HTML document with the railroad diagram of each rule of
+// g, preceded by a heading with its name, its display name and its
+// documentation.
+func HTML(g *ast.Grammar, title string, opts Options) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>%s</title>\n<style>\n%s</style>\n</head>\n<body>\n",
+		html.EscapeString(title), Style)
+	fmt.Fprintf(&buf, "<h1>%s</h1>\n", html.EscapeString(title))
+	for _, rule := range g.Rules {
+		fmt.Fprintf(&buf, "<h2 id=\"rule-%s\">%s", rule.Name.Val, html.EscapeString(rule.Name.Val))
+		if rule.DisplayName != nil {
+			name := rule.DisplayName.Val
+			if s, err := strconv.Unquote(name); err == nil {
+				name = s
+			}
+			fmt.Fprintf(&buf, " <small>%s</small>", html.EscapeString(name))
+		}
+		buf.WriteString("</h2>\n")
+		if doc := rule.Annotation("doc"); doc != nil && len(doc.Args) > 0 {
+			fmt.Fprintf(&buf, "<p>%s</p>\n", html.EscapeString(doc.Args[0]))
+		}
+		writeSVG(&buf, g, rule, opts, false)
+	}
+	buf.WriteString("</body>\n</html>\n")
+	return buf.Bytes()
+}
+
+// writeSVG writes the svg element of the diagram of rule, with its style
+// if standalone is set.
+func writeSVG(buf *bytes.Buffer, g *ast.Grammar, rule *ast.Rule, opts Options, standalone bool) {
+	c := &converter{opts: opts, rules: make(map[string]bool, len(g.Rules))}
+	for _, r := range g.Rules {
+		c.rules[r.Name.Val] = true
+	}
+	n := c.node(rule.Expr)
+
+	width, up, down := n.size()
+	width += 2*margin + 2*endSize
+	height := up + down + 2*margin
+	fmt.Fprintf(buf, `<svg class="railroad" xmlns="http://www.w3.org/2000/svg" width="%g" height="%g" viewBox="0 0 %g %g">`+"\n",
+		width, height, width, height)
+	if standalone {
+		fmt.Fprintf(buf, "<style>\n%s</style>\n", Style)
+	}
+	fmt.Fprintf(buf, "<title>%s</title>\n", html.EscapeString(rule.Name.Val))
+
+	var w writer
+	x, y := float64(margin), margin+up
+	// the start and end markers are double vertical bars
+	w.path(x, y-endSize/2, "v%dm%d %dv%d", endSize, endSize/2, -endSize, endSize)
+	w.line(x, y, x+endSize, y)
+	n.draw(&w, x+endSize, y)
+	x = width - margin - endSize
+	w.line(x, y, x+endSize, y)
+	w.path(x+endSize/2, y-endSize/2, "v%dm%d %dv%d", endSize, endSize/2, -endSize, endSize)
+	buf.WriteString(w.String())
+	buf.WriteString("</svg>\n")
+}
+
+// converter converts the expressions of a rule to the nodes of its
+// diagram.
+type converter struct {
+	opts  Options
+	rules map[string]bool
+}
+
+func (c *converter) node(expr ast.Expression) node {
+	switch expr := expr.(type) {
+	case *ast.ChoiceExpr:
+		ch := make(choice, len(expr.Alternatives))
+		for i, alt := range expr.Alternatives {
+			ch[i] = c.node(alt)
+		}
+		return ch
+
+	case *ast.SeqExpr:
+		var seq sequence
+		for _, e := range expr.Exprs {
+			seq = c.appendNode(seq, c.node(e))
+		}
+		return c.compact(seq)
+
+	case *ast.ActionExpr:
+		n := c.node(expr.Expr)
+		if c.opts.HideCode {
+			return n
+		}
+		return c.compact(c.appendNode(sequence{n}, c.code("{…}", expr.Code)))
+
+	case *ast.CodeExpr:
+		if c.opts.HideCode {
+			return skip{}
+		}
+		if expr.NotSkip {
+			return c.code("*{…}", expr.Code)
+		}
+		return c.code("{…}", expr.Code)
+
+	case *ast.AndCodeExpr:
+		if c.opts.HideCode {
+			return skip{}
+		}
+		return c.code("&{…}", expr.Code)
+
+	case *ast.NotCodeExpr:
+		if c.opts.HideCode {
+			return skip{}
+		}
+		return c.code("!{…}", expr.Code)
+
+	case *ast.LabeledExpr:
+		return c.node(expr.Expr)
+
+	case *ast.AndExpr:
+		label := "followed by"
+		if expr.Logical {
+			label = "followed by (logical)"
+		}
+		return group{class: "predicate", label: label, n: c.node(expr.Expr)}
+
+	case *ast.NotExpr:
+		label := "not followed by"
+		if expr.Logical {
+			label = "not followed by (logical)"
+		}
+		return group{class: "predicate", label: label, n: c.node(expr.Expr)}
+
+	case *ast.ZeroOrOneExpr:
+		return choice{skip{}, c.node(expr.Expr)}
+
+	case *ast.ZeroOrMoreExpr:
+		return choice{skip{}, loop{c.node(expr.Expr)}}
+
+	case *ast.OneOrMoreExpr:
+		return loop{c.node(expr.Expr)}
+
+	case *ast.RecoveryExpr:
+		labels := make([]string, len(expr.Labels))
+		for i, label := range expr.Labels {
+			labels[i] = string(label)
+		}
+		return sequence{
+			c.node(expr.Expr),
+			group{class: "recovery", label: "recover " + strings.Join(labels, ", "), n: c.node(expr.RecoverExpr)},
+		}
+
+	case *ast.ThrowExpr:
+		return &box{class: "throw", text: "%{" + expr.Label + "}"}
+
+	case *ast.LitMatcher:
+		text := strconv.Quote(expr.Val)
+		if expr.IgnoreCase {
+			text += "i"
+		}
+		return &box{class: "terminal", text: text}
+
+	case *ast.CharClassMatcher:
+		return &box{class: "terminal", text: expr.Val}
+
+	case *ast.AnyMatcher:
+		return &box{class: "terminal", text: "any character"}
+
+	case *ast.RuleRefExpr:
+		b := &box{class: "nonterminal", text: expr.Name.Val}
+		if c.rules[expr.Name.Val] {
+			b.href = "#rule-" + expr.Name.Val
+		}
+		return b
+	}
+	panic(fmt.Sprintf("railroad: unexpected expression %T", expr))
+}
+
+// code returns the node of a code block, with the code as its tooltip.
+func (c *converter) code(text string, code *ast.CodeBlock) node {
+	return &box{class: "code", text: text, title: code.Val}
+}
+
+// appendNode appends n to seq, flattening the nested sequences and
+// dropping the hidden code blocks.
+func (c *converter) appendNode(seq sequence, n node) sequence {
+	switch n := n.(type) {
+	case sequence:
+		return append(seq, n...)
+	case skip:
+		return seq
+	}
+	return append(seq, n)
+}
+
+// compact returns the single node of seq, or seq.
+func (c *converter) compact(seq sequence) node {
+	switch len(seq) {
+	case 0:
+		return skip{}
+	case 1:
+		return seq[0]
+	}
+	return seq
+}
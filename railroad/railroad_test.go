@@ -0,0 +1,75 @@
+package railroad
+
+import (
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/fy0/pigeon/ast"
+	"github.com/fy0/pigeon/bootstrap"
+)
+
+const grammar = `
+Start "start" = a:Item+ ( ',' Item )* !. { return a, nil }
+Item = [a-z]i / 'x' { return nil, nil } / Undefined? / &'y' .
+`
+
+func parse(t *testing.T) *ast.Grammar {
+	t.Helper()
+	g, err := bootstrap.NewParser().Parse("", strings.NewReader(grammar))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g
+}
+
+func TestSVG(t *testing.T) {
+	g := parse(t)
+	for _, hide := range []bool{false, true} {
+		for _, rule := range g.Rules {
+			svg := SVG(g, rule, Options{HideCode: hide})
+
+			// the diagrams must be well-formed
+			dec := xml.NewDecoder(strings.NewReader(string(svg)))
+			for {
+				_, err := dec.Token()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("%s: %v\n%s", rule.Name.Val, err, svg)
+				}
+			}
+
+			if got := strings.Contains(string(svg), `class="code"`); got == hide {
+				t.Errorf("%s: want code blocks %t, got %t", rule.Name.Val, !hide, got)
+			}
+		}
+	}
+}
+
+func TestHTML(t *testing.T) {
+	got := string(HTML(parse(t), "Test <grammar>", Options{}))
+	for _, want := range []string{
+		`<title>Test &lt;grammar&gt;</title>`,
+		`<h2 id="rule-Start">Start <small>start</small></h2>`,
+		`<h2 id="rule-Item">Item</h2>`,
+		`<a href="#rule-Item">`,
+		`<text x="`,
+		`>[a-z]i</text>`,
+		`>&#34;,&#34;</text>`,
+		`>any character</text>`,
+		`>followed by</text>`,
+		`>not followed by</text>`,
+		`<title>{ return a, nil }</title>`,
+		`>{…}</text>`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("want %q in the document", want)
+		}
+	}
+	if strings.Contains(got, `href="#rule-Undefined"`) {
+		t.Errorf("want no link to an undefined rule")
+	}
+}
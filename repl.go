@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/fy0/pigeon/ast"
+	"github.com/fy0/pigeon/interp"
+)
+
+var replUsagePage = `usage: %[1]s repl [options] GRAMMAR_FILE
+
+Repl reads input lines from stdin and parses each of them with the PEG
+grammar of GRAMMAR_FILE, as the run command does, printing the tree of the
+matched rules or the errors, with the farthest failure and its expected
+tokens when the line does not match.
+
+The lines starting with a colon are commands:
+
+	:rule [NAME]
+		use the rule NAME to parse the next lines, or list the rules.
+	:reload
+		read GRAMMAR_FILE again, e.g. after editing it. The current
+		grammar is kept if the new one has errors.
+	:help
+		display the commands.
+	:quit
+		exit, as end of input does.
+
+A line starting with "::" is parsed without its first colon.
+
+The exit code is 0 at the end of the input, 9 if the grammar has errors,
+3 if it cannot be parsed, 2 if it cannot be opened and 1 if the arguments
+are invalid.
+
+The following options can be specified:
+
+	-entrypoint RULE
+		name of the rule used to parse the input at start. Defaults to
+		the first rule of the grammar.
+	-h -help
+		display this help message.
+	-memoize
+		memoize the results of the expressions, as the Memoize option of
+		the generated parser.
+	-skip-rule NAME
+		name of the rule applied implicitly before each token, as for
+		the generation of the parser.
+`
+
+var replHelp = `:rule [NAME]  use the rule NAME to parse the next lines, or list the rules
+:reload       read the grammar file again
+:help         display this help
+:quit         exit
+`
+
+// replMain implements the repl command.
+func replMain(args []string) {
+	fs := flag.NewFlagSet(os.Args[0]+" repl", flag.ExitOnError)
+	var (
+		shortHelpFlag  = fs.Bool("h", false, "show help page")
+		longHelpFlag   = fs.Bool("help", false, "show help page")
+		entrypointFlag = fs.String("entrypoint", "", "rule used to parse the input at start")
+		memoizeFlag    = fs.Bool("memoize", false, "memoize the results of the expressions")
+		skipRuleFlag   = fs.String("skip-rule", "", "rule applied implicitly before each token")
+	)
+	fs.Usage = func() {
+		fmt.Printf(replUsagePage, os.Args[0])
+	}
+	if err := fs.Parse(args); err != nil {
+		fmt.Fprintf(os.Stderr, "args parse error:\n%v\n", err)
+		exit(6)
+	}
+
+	if *shortHelpFlag || *longHelpFlag {
+		fs.Usage()
+		exit(0)
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "expected one argument, got %q\n", fs.Args())
+		fs.Usage()
+		exit(1)
+	}
+
+	r := &repl{
+		file:     fs.Arg(0),
+		rule:     *entrypointFlag,
+		skipRule: *skipRuleFlag,
+		memoize:  *memoizeFlag,
+	}
+	if code, err := r.load(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		exit(code)
+	}
+	r.loop(os.Stdin, os.Stdout)
+}
+
+// repl is an interactive session parsing input lines with a grammar.
+type repl struct {
+	file     string
+	rule     string
+	skipRule string
+	memoize  bool
+
+	rules []string
+	in    *interp.Interpreter
+}
+
+// load reads and checks the grammar file. On error, it returns the exit
+// code of the error and the session keeps its current grammar.
+func (r *repl) load() (int, error) {
+	f, err := os.Open(r.file)
+	if err != nil {
+		return 2, err
+	}
+	defer f.Close()
+	g, err := ParseReader(r.file, bufio.NewReader(f))
+	if err != nil {
+		return 3, fmt.Errorf("parse error(s):\n %w", err)
+	}
+	grammar := g.(*ast.Grammar)
+
+	// All the rules can be used as entrypoints.
+	rules := make([]string, 0, len(grammar.Rules))
+	for _, rule := range grammar.Rules {
+		rules = append(rules, rule.Name.Val)
+	}
+	in, err := interp.New(grammar, interp.Options{
+		AlternateEntrypoints: rules,
+		SkipRule:             r.skipRule,
+	})
+	if err != nil {
+		return 9, fmt.Errorf("grammar error(s):\n %w", err)
+	}
+
+	if r.rule != "" && !hasRule(rules, r.rule) {
+		if r.in == nil {
+			return 9, fmt.Errorf("grammar error(s):\n rule %s is not defined", r.rule)
+		}
+		r.rule = ""
+	}
+	if r.rule == "" {
+		r.rule = rules[0]
+	}
+	r.rules, r.in = rules, in
+	return 0, nil
+}
+
+// hasRule returns true if name is in rules.
+func hasRule(rules []string, name string) bool {
+	for _, rule := range rules {
+		if rule == name {
+			return true
+		}
+	}
+	return false
+}
+
+// loop reads the lines of rd until the end of input or :quit, and writes
+// their results to w.
+func (r *repl) loop(rd io.Reader, w io.Writer) {
+	fmt.Fprintf(w, "%s: %d rules, parsing with rule %s, :help for the commands.\n",
+		r.file, len(r.rules), r.rule)
+
+	sc := bufio.NewScanner(rd)
+	for {
+		fmt.Fprint(w, "> ")
+		if !sc.Scan() {
+			fmt.Fprintln(w)
+			return
+		}
+		line := sc.Text()
+		if !strings.HasPrefix(line, ":") || strings.HasPrefix(line, "::") {
+			r.parse(strings.TrimPrefix(line, ":"), w)
+			continue
+		}
+
+		cmd, arg, _ := strings.Cut(strings.TrimSpace(line[1:]), " ")
+		arg = strings.TrimSpace(arg)
+		switch cmd {
+		case "rule":
+			if arg == "" {
+				fmt.Fprintf(w, "rule %s, rules: %s\n", r.rule, strings.Join(r.rules, " "))
+				break
+			}
+			if !hasRule(r.rules, arg) {
+				fmt.Fprintf(w, "rule %s is not defined\n", arg)
+				break
+			}
+			r.rule = arg
+		case "reload":
+			rule := r.rule
+			if _, err := r.load(); err != nil {
+				fmt.Fprintf(w, "%v\nkeeping the current grammar\n", err)
+				break
+			}
+			if r.rule != rule {
+				fmt.Fprintf(w, "rule %s is not defined anymore, ", rule)
+			}
+			fmt.Fprintf(w, "%d rules, parsing with rule %s\n", len(r.rules), r.rule)
+		case "help":
+			fmt.Fprint(w, replHelp)
+		case "quit", "q":
+			return
+		default:
+			fmt.Fprintf(w, "unknown command :%s, :help for the commands\n", cmd)
+		}
+	}
+}
+
+// parse parses line and writes the tree of the matched rules and the
+// errors to w.
+func (r *repl) parse(line string, w io.Writer) {
+	node, err := r.in.Parse("", []byte(line), interp.Entrypoint(r.rule), interp.Memoize(r.memoize))
+	if node != nil {
+		fmt.Fprint(w, node)
+	} else {
+		fmt.Fprintln(w, "no match")
+	}
+	if err != nil {
+		fmt.Fprintln(w, err)
+	}
+}
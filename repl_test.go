@@ -0,0 +1,92 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// replStep is a line of a repl session, with the grammar written to the
+// grammar file before the line is read.
+type replStep struct {
+	line, grammar string
+}
+
+// replReader returns the lines of the steps one per read.
+type replReader struct {
+	t     *testing.T
+	file  string
+	steps []replStep
+}
+
+func (r *replReader) Read(b []byte) (int, error) {
+	if len(r.steps) == 0 {
+		return 0, io.EOF
+	}
+	step := r.steps[0]
+	r.steps = r.steps[1:]
+	if step.grammar != "" {
+		if err := os.WriteFile(r.file, []byte(step.grammar), 0o644); err != nil {
+			r.t.Fatal(err)
+		}
+	}
+	return copy(b, step.line+"\n"), nil
+}
+
+func TestRepl(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "list.peg")
+	if err := os.WriteFile(file, []byte("List = Item ( ',' Item )* !.\nItem = [a-z]+\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	r := &repl{file: file}
+	if _, err := r.load(); err != nil {
+		t.Fatal(err)
+	}
+
+	rd := &replReader{t: t, file: file, steps: []replStep{
+		{line: "a,b"},
+		{line: "a,"},
+		{line: ":rule Item"},
+		{line: "ab"},
+		{line: ":rule Nope"},
+		{line: ":rule"},
+		{line: ":reload", grammar: "List = Item ( ';' Item )* !.\nItem = [a-z]+\n"},
+		{line: ":rule List"},
+		{line: "a;b"},
+		{line: ":reload", grammar: "List = Item+\nItem = 'a' / Nope\n"},
+		{line: ":reload", grammar: "Letters = [a-z]+\n"},
+		{line: "::"},
+		{line: ":nope"},
+		{line: ":quit"},
+		{line: "not parsed"},
+	}}
+	var out strings.Builder
+	r.loop(rd, &out)
+
+	want := file + `: 2 rules, parsing with rule List, :help for the commands.
+> List 1:1-1:4 "a,b"
+  Item 1:1-1:2 "a"
+  Item 1:3-1:4 "b"
+> no match
+1:3 (2): no match found, expected: [a-z]
+> > Item 1:1-1:3 "ab"
+> rule Nope is not defined
+> rule Item, rules: List Item
+> 2 rules, parsing with rule Item
+> > List 1:1-1:4 "a;b"
+  Item 1:1-1:2 "a"
+  Item 1:3-1:4 "b"
+> grammar error(s):
+ 2:14 (26): rule Item: undefined rule Nope
+keeping the current grammar
+> rule List is not defined anymore, 1 rules, parsing with rule Letters
+> no match
+1:1 (0): no match found, expected: [a-z]
+> unknown command :nope, :help for the commands
+> `
+	if got := out.String(); got != want {
+		t.Errorf("want output\n%s\ngot\n%s", want, got)
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/fy0/pigeon/ast"
+	"github.com/fy0/pigeon/interp"
+)
+
+var runUsagePage = `usage: %[1]s run [options] GRAMMAR_FILE [INPUT_FILE]
+
+Run parses INPUT_FILE, or stdin if it is not specified, with the PEG grammar
+of GRAMMAR_FILE, without generating a parser, and prints the tree of the
+matched rules: one rule per line, indented by its depth, with its span as
+line:col-line:col and its text. The rules matched in predicates and by the
+skip rule are not part of the tree.
+
+The input is parsed exactly as the generated parser would parse it, with
+the same error messages, but the code blocks of the grammar are not run:
+the actions return nothing and the predicates &{} and !{} always succeed.
+
+The exit code is 0 if the input matches, 10 if it does not match or has
+errors, 9 if the grammar has errors, 3 if it cannot be parsed, 2 if a file
+cannot be opened and 1 if the arguments are invalid.
+
+The following options can be specified:
+
+	-entrypoint RULE
+		name of the rule used to parse the input. Defaults to the first
+		rule of the grammar.
+	-h -help
+		display this help message.
+	-json
+		print the tree in JSON.
+	-memoize
+		memoize the results of the expressions, as the Memoize option of
+		the generated parser.
+	-skip-rule NAME
+		name of the rule applied implicitly before each token, as for
+		the generation of the parser.
+`
+
+// runMain implements the run command.
+func runMain(args []string) {
+	fs := flag.NewFlagSet(os.Args[0]+" run", flag.ExitOnError)
+	var (
+		shortHelpFlag  = fs.Bool("h", false, "show help page")
+		longHelpFlag   = fs.Bool("help", false, "show help page")
+		entrypointFlag = fs.String("entrypoint", "", "rule used to parse the input")
+		jsonFlag       = fs.Bool("json", false, "print the tree in JSON")
+		memoizeFlag    = fs.Bool("memoize", false, "memoize the results of the expressions")
+		skipRuleFlag   = fs.String("skip-rule", "", "rule applied implicitly before each token")
+	)
+	fs.Usage = func() {
+		fmt.Printf(runUsagePage, os.Args[0])
+	}
+	if err := fs.Parse(args); err != nil {
+		fmt.Fprintf(os.Stderr, "args parse error:\n%v\n", err)
+		exit(6)
+	}
+
+	if *shortHelpFlag || *longHelpFlag {
+		fs.Usage()
+		exit(0)
+	}
+	if fs.NArg() < 1 || fs.NArg() > 2 {
+		fmt.Fprintf(os.Stderr, "expected one or two arguments, got %q\n", fs.Args())
+		fs.Usage()
+		exit(1)
+	}
+
+	nm, rc := input(fs.Arg(0))
+	g, err := ParseReader(nm, rc)
+	rc.Close()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "parse error(s):\n%v\n", err)
+		exit(3)
+	}
+	var altEntrypoints []string
+	if *entrypointFlag != "" {
+		altEntrypoints = append(altEntrypoints, *entrypointFlag)
+	}
+	in, err := interp.New(g.(*ast.Grammar), interp.Options{
+		AlternateEntrypoints: altEntrypoints,
+		SkipRule:             *skipRuleFlag,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "grammar error(s):\n%v\n", err)
+		exit(9)
+	}
+
+	nm, rc = input(fs.Arg(1))
+	b, err := io.ReadAll(rc)
+	rc.Close()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "read error:\n%v\n", err)
+		exit(3)
+	}
+	opts := []interp.ParseOption{interp.Memoize(*memoizeFlag)}
+	if *entrypointFlag != "" {
+		opts = append(opts, interp.Entrypoint(*entrypointFlag))
+	}
+	node, err := in.Parse(nm, b, opts...)
+	if node != nil {
+		if *jsonFlag {
+			res, err := node.JSON()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "write error: %v\n", err)
+				exit(7)
+			}
+			fmt.Println(string(res))
+		} else {
+			fmt.Print(node)
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		exit(10)
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fy0/pigeon/ast"
+	"github.com/fy0/pigeon/interp"
+	optimizegrammar "github.com/fy0/pigeon/test/optimize_grammar"
+)
+
+func TestRunInterp(t *testing.T) {
+	const grammar = "test/optimize_grammar/optimize_grammar.peg"
+	f, err := os.Open(grammar)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	g, err := ParseReader(grammar, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	in, err := interp.New(g.(*ast.Grammar), interp.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files, _ := filepath.Glob("test/optimize_grammar/testdata/*.txt")
+	json, _ := filepath.Glob("examples/json/testdata/*.json")
+	for _, file := range append(files, json...) {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		val, want := optimizegrammar.Parse(file, b)
+		node, got := in.Parse(file, b)
+		if (val != nil) != (node != nil) {
+			t.Errorf("%s: want match %t, got %v", file, val != nil, node)
+		}
+		if want != nil && strings.Contains(want.Error(), "invalid note") {
+			// The error is added by the code of the recovery, which is not
+			// run by the interpreter, and replaces the no match error.
+			continue
+		}
+		if (want == nil) != (got == nil) || want != nil && want.Error() != got.Error() {
+			t.Errorf("%s: want error %v, got %v", file, want, got)
+		}
+	}
+}
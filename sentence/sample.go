@@ -0,0 +1,150 @@
+package sentence
+
+import (
+	"math/rand"
+	"unicode"
+
+	"github.com/fy0/pigeon/ast"
+)
+
+// maxSamples is the number of random characters tried to find one in an
+// inverted character class or a class with set operations.
+const maxSamples = 1000
+
+// randRune returns a random character, mostly printable ASCII.
+func randRune(rnd *rand.Rand) rune {
+	switch n := rnd.Intn(20); {
+	case n < 16:
+		return rune(' ' + rnd.Intn('~'-' '+1))
+	case n == 16:
+		return []rune{'\t', '\n', '\r'}[rnd.Intn(3)]
+	case n == 17:
+		return rune(0xa0 + rnd.Intn(0x250-0xa0))
+	case n == 18:
+		return rune(0x370 + rnd.Intn(0x400-0x370))
+	default:
+		return rune(0x4e00 + rnd.Intn(0x100))
+	}
+}
+
+// sampleClass returns a random character matched by the class, or a random
+// character if none is found.
+func sampleClass(rnd *rand.Rand, cl *ast.CharClassMatcher) rune {
+	rn := randRune(rnd)
+	for i := 0; i < maxSamples; i++ {
+		if !cl.Inverted && len(cl.NotUnicodeClasses) == 0 {
+			rn = sampleSet(rnd, cl)
+		}
+		if matchClass(cl, rn, cl.IgnoreCase) {
+			break
+		}
+		rn = randRune(rnd)
+	}
+	if cl.IgnoreCase && rnd.Intn(2) == 0 {
+		rn = unicode.ToUpper(rn)
+	}
+	return rn
+}
+
+// sampleSet returns a random character of the chars, ranges and Unicode
+// classes of cl, before the set operations are applied.
+func sampleSet(rnd *rand.Rand, cl *ast.CharClassMatcher) rune {
+	n := len(cl.Chars) + len(cl.Ranges)/2 + len(cl.UnicodeClasses)
+	if n == 0 {
+		return randRune(rnd)
+	}
+	i := rnd.Intn(n)
+	if i < len(cl.Chars) {
+		return cl.Chars[i]
+	}
+	i -= len(cl.Chars)
+	if i < len(cl.Ranges)/2 {
+		lo, hi := cl.Ranges[2*i], cl.Ranges[2*i+1]
+		return lo + rune(rnd.Intn(int(hi-lo)+1))
+	}
+	i -= len(cl.Ranges) / 2
+	table := rangeTable(cl.UnicodeClasses[i])
+	if table == nil {
+		return randRune(rnd)
+	}
+	return sampleTable(rnd, table)
+}
+
+// sampleTable returns a random character of table.
+func sampleTable(rnd *rand.Rand, table *unicode.RangeTable) rune {
+	n := len(table.R16) + len(table.R32)
+	if n == 0 {
+		return randRune(rnd)
+	}
+	var lo, hi, stride rune
+	if i := rnd.Intn(n); i < len(table.R16) {
+		r := table.R16[i]
+		lo, hi, stride = rune(r.Lo), rune(r.Hi), rune(r.Stride)
+	} else {
+		r := table.R32[i-len(table.R16)]
+		lo, hi, stride = rune(r.Lo), rune(r.Hi), rune(r.Stride)
+	}
+	return lo + stride*rune(rnd.Intn(int((hi-lo)/stride)+1))
+}
+
+// matchClass returns true if rn is matched by cl. The operands of the set
+// operations use the ignoreCase flag of the outermost class, as in the
+// generated parser.
+func matchClass(cl *ast.CharClassMatcher, rn rune, ignoreCase bool) bool {
+	if ignoreCase {
+		rn = unicode.ToLower(rn)
+	}
+	in := containsRune(cl, rn, ignoreCase)
+	for _, set := range cl.Intersect {
+		in = in && matchClass(set, rn, ignoreCase)
+	}
+	for _, set := range cl.Subtract {
+		in = in && !matchClass(set, rn, ignoreCase)
+	}
+	return in != cl.Inverted
+}
+
+// containsRune returns true if rn is in the chars, ranges or Unicode classes
+// of cl.
+func containsRune(cl *ast.CharClassMatcher, rn rune, ignoreCase bool) bool {
+	lower := func(rn rune) rune {
+		if ignoreCase {
+			return unicode.ToLower(rn)
+		}
+		return rn
+	}
+	for _, c := range cl.Chars {
+		if lower(c) == rn {
+			return true
+		}
+	}
+	for i := 0; i+1 < len(cl.Ranges); i += 2 {
+		if rn >= lower(cl.Ranges[i]) && rn <= lower(cl.Ranges[i+1]) {
+			return true
+		}
+	}
+	for _, name := range cl.UnicodeClasses {
+		if table := rangeTable(name); table != nil && unicode.Is(table, rn) {
+			return true
+		}
+	}
+	for _, name := range cl.NotUnicodeClasses {
+		if table := rangeTable(name); table != nil && !unicode.Is(table, rn) {
+			return true
+		}
+	}
+	return false
+}
+
+// rangeTable returns the table of the Unicode class name, or nil if it is
+// unknown.
+func rangeTable(name string) *unicode.RangeTable {
+	for _, tables := range []map[string]*unicode.RangeTable{
+		unicode.Categories, unicode.Scripts, unicode.Properties,
+	} {
+		if table, ok := tables[name]; ok {
+			return table
+		}
+	}
+	return nil
+}
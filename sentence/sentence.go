@@ -0,0 +1,368 @@
+// Package sentence generates random sentences of PEG grammars, e.g. to seed
+// the fuzzing of the generated parsers with inputs that reach deep rules.
+//
+// The sentences are generated by walking the expressions of the grammar:
+// the choices pick a weighted random alternative, the repetitions repeat
+// their expression a random number of times, the literals are written as
+// they are, with a random case if they ignore the case, and the character
+// classes and the any matcher write a random character they match. Once
+// the depth budget of nested rules or the length budget is spent, the
+// choices pick the alternatives that end the sentence the soonest, and the
+// optional expressions are left out.
+//
+// The predicates and the ordered choices are not taken into account by the
+// walk, so each sentence is then parsed with the grammar, using the interp
+// package, and rejected if it does not match without error.
+package sentence
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"unicode"
+
+	"github.com/fy0/pigeon/ast"
+	"github.com/fy0/pigeon/builder"
+	"github.com/fy0/pigeon/interp"
+)
+
+// ErrNoSentence is returned when no sentence matching the grammar has been
+// generated in the maximum number of attempts.
+var ErrNoSentence = errors.New("no matching sentence generated")
+
+// Default values of the options.
+const (
+	DefaultMaxDepth    = 16
+	DefaultMaxLength   = 256
+	DefaultMaxRepeat   = 3
+	DefaultMaxAttempts = 100
+)
+
+// Options configures the generation of the sentences.
+type Options struct {
+	// Entrypoint is the rule of the sentences, the first rule of the
+	// grammar if it is empty.
+	Entrypoint string
+	// SkipRule is the rule applied implicitly before each token of the
+	// syntactic rules, as with the -skip-rule flag. It is randomly
+	// generated before the tokens.
+	SkipRule string
+	// MaxDepth is the depth budget, the number of nested rules after which
+	// the sentence is ended as soon as possible.
+	MaxDepth int
+	// MaxLength is the length budget in bytes, after which the sentence is
+	// ended as soon as possible. The sentences may be longer.
+	MaxLength int
+	// MaxRepeat is the maximum number of repetitions of the expressions of
+	// *, and of the additional repetitions of +.
+	MaxRepeat int
+	// MaxAttempts is the maximum number of sentences generated by Sentence
+	// before it returns ErrNoSentence.
+	MaxAttempts int
+	// Weights are the relative weights of the alternatives of the top-level
+	// choice of the rules, by rule name. The alternatives of the other
+	// choices have the same weight.
+	Weights map[string][]float64
+	// Seed initializes the random source.
+	Seed int64
+}
+
+// Generator generates sentences of a grammar.
+type Generator struct {
+	opts      Options
+	rnd       *rand.Rand
+	in        *interp.Interpreter
+	rules     map[string]*ast.Rule
+	skipRule  *ast.Rule
+	syntactic map[*ast.Rule]bool
+	heights   map[string]int
+	weights   map[*ast.ChoiceExpr][]float64
+}
+
+// New returns a generator of the sentences of g. The grammar is checked as
+// by interp.New.
+func New(g *ast.Grammar, opts Options) (*Generator, error) {
+	var alt []string
+	if opts.Entrypoint != "" {
+		alt = append(alt, opts.Entrypoint)
+	}
+	in, err := interp.New(g, interp.Options{AlternateEntrypoints: alt, SkipRule: opts.SkipRule})
+	if err != nil {
+		return nil, err
+	}
+	if opts.Entrypoint == "" {
+		opts.Entrypoint = g.Rules[0].Name.Val
+	}
+	if opts.MaxDepth <= 0 {
+		opts.MaxDepth = DefaultMaxDepth
+	}
+	if opts.MaxLength <= 0 {
+		opts.MaxLength = DefaultMaxLength
+	}
+	if opts.MaxRepeat <= 0 {
+		opts.MaxRepeat = DefaultMaxRepeat
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = DefaultMaxAttempts
+	}
+
+	gen := &Generator{
+		opts:      opts,
+		rnd:       rand.New(rand.NewSource(opts.Seed)),
+		in:        in,
+		rules:     make(map[string]*ast.Rule, len(g.Rules)),
+		syntactic: make(map[*ast.Rule]bool),
+		weights:   make(map[*ast.ChoiceExpr][]float64),
+	}
+	for _, rule := range g.Rules {
+		gen.rules[rule.Name.Val] = rule
+	}
+	if opts.SkipRule != "" {
+		lexical, err := builder.LexicalRules(g, opts.SkipRule)
+		if err != nil {
+			return nil, err
+		}
+		b := &builder.Builder{SkipRule: opts.SkipRule, LexicalRules: lexical}
+		for _, rule := range g.Rules {
+			gen.syntactic[rule] = b.IsSyntactic(rule)
+		}
+		gen.skipRule = gen.rules[opts.SkipRule]
+	}
+
+	for name, weights := range opts.Weights {
+		rule, ok := gen.rules[name]
+		if !ok {
+			return nil, fmt.Errorf("weights of undefined rule %s", name)
+		}
+		ch, ok := rule.Expr.(*ast.ChoiceExpr)
+		if !ok || len(ch.Alternatives) != len(weights) {
+			return nil, fmt.Errorf("rule %s: want a weight per alternative of its choice", name)
+		}
+		var total float64
+		for _, w := range weights {
+			if w < 0 {
+				return nil, fmt.Errorf("rule %s: negative weight %v", name, w)
+			}
+			total += w
+		}
+		if total == 0 {
+			return nil, fmt.Errorf("rule %s: want a positive weight", name)
+		}
+		gen.weights[ch] = weights
+	}
+	gen.heights = heights(g)
+	return gen, nil
+}
+
+// Sentence returns a random sentence of the grammar. It returns
+// ErrNoSentence if none of the generated sentences matches the grammar.
+func (gen *Generator) Sentence() ([]byte, error) {
+	rule := gen.rules[gen.opts.Entrypoint]
+	for i := 0; i < gen.opts.MaxAttempts; i++ {
+		w := &walk{gen: gen}
+		if !w.rule(rule, 0) {
+			continue
+		}
+		b := []byte(w.buf.String())
+		node, err := gen.in.Parse("", b, interp.Entrypoint(gen.opts.Entrypoint))
+		if node != nil && err == nil {
+			return b, nil
+		}
+	}
+	return nil, ErrNoSentence
+}
+
+// FuzzCorpusFile returns the content of the file of the Go fuzzing corpus
+// for a fuzz target with a []byte argument, e.g. FuzzParse(f, b []byte),
+// seeded with b, and its name in the testdata/fuzz/FuzzParse directory.
+func FuzzCorpusFile(b []byte) (name string, content []byte) {
+	content = []byte(fmt.Sprintf("go test fuzz v1\n[]byte(%q)\n", b))
+	return fmt.Sprintf("%x", sha256.Sum256(content))[:16], content
+}
+
+// infinite is the height of the expressions that cannot end.
+const infinite = 1 << 30
+
+// heights returns the height of the rules of g: the minimum number of
+// nested rules needed to generate a sentence of the rule.
+func heights(g *ast.Grammar) map[string]int {
+	hs := make(map[string]int, len(g.Rules))
+	for _, rule := range g.Rules {
+		hs[rule.Name.Val] = infinite
+	}
+	for changed := true; changed; {
+		changed = false
+		for _, rule := range g.Rules {
+			if h := height(rule.Expr, hs); h+1 < hs[rule.Name.Val] {
+				hs[rule.Name.Val] = h + 1
+				changed = true
+			}
+		}
+	}
+	return hs
+}
+
+// height returns the height of expr, given the heights of the rules.
+func height(expr ast.Expression, hs map[string]int) int {
+	switch expr := expr.(type) {
+	case *ast.ActionExpr:
+		return height(expr.Expr, hs)
+	case *ast.ChoiceExpr:
+		h := infinite
+		for _, alt := range expr.Alternatives {
+			if ah := height(alt, hs); ah < h {
+				h = ah
+			}
+		}
+		return h
+	case *ast.LabeledExpr:
+		return height(expr.Expr, hs)
+	case *ast.OneOrMoreExpr:
+		return height(expr.Expr, hs)
+	case *ast.RecoveryExpr:
+		return height(expr.Expr, hs)
+	case *ast.RuleRefExpr:
+		if h, ok := hs[expr.Name.Val]; ok {
+			return h
+		}
+		return infinite
+	case *ast.SeqExpr:
+		h := 0
+		for _, expr := range expr.Exprs {
+			if eh := height(expr, hs); eh > h {
+				h = eh
+			}
+		}
+		return h
+	default:
+		// The matchers, the predicates and the code expressions, and the
+		// optional expressions that can be left out.
+		return 0
+	}
+}
+
+// walk generates a sentence.
+type walk struct {
+	gen *Generator
+	buf strings.Builder
+}
+
+// rule generates a sentence of rule at depth. It returns false if the
+// sentence cannot end.
+func (w *walk) rule(rule *ast.Rule, depth int) bool {
+	if depth > 4*w.gen.opts.MaxDepth {
+		// Only rules that cannot end recurse this deep.
+		return false
+	}
+	return w.expr(rule.Expr, depth+1, w.gen.syntactic[rule])
+}
+
+func (w *walk) expr(expr ast.Expression, depth int, syntactic bool) bool {
+	if syntactic && w.gen.skipRule != nil && builder.NeedSkip(expr) && w.gen.rnd.Intn(2) == 0 {
+		if !w.rule(w.gen.skipRule, depth) {
+			return false
+		}
+	}
+
+	rnd := w.gen.rnd
+	spent := depth > w.gen.opts.MaxDepth || w.buf.Len() > w.gen.opts.MaxLength
+	switch expr := expr.(type) {
+	case *ast.ActionExpr:
+		return w.expr(expr.Expr, depth, syntactic)
+	case *ast.AnyMatcher:
+		w.buf.WriteRune(randRune(rnd))
+	case *ast.CharClassMatcher:
+		w.buf.WriteRune(sampleClass(rnd, expr))
+	case *ast.ChoiceExpr:
+		return w.expr(w.choose(expr, spent), depth, syntactic)
+	case *ast.LabeledExpr:
+		return w.expr(expr.Expr, depth, syntactic)
+	case *ast.LitMatcher:
+		if !expr.IgnoreCase {
+			w.buf.WriteString(expr.Val)
+			break
+		}
+		for _, rn := range expr.Val {
+			if rnd.Intn(2) == 0 {
+				rn = unicode.ToUpper(rn)
+			} else {
+				rn = unicode.ToLower(rn)
+			}
+			w.buf.WriteRune(rn)
+		}
+	case *ast.OneOrMoreExpr:
+		return w.repeat(expr.Expr, depth, syntactic, 1, spent)
+	case *ast.RecoveryExpr:
+		return w.expr(expr.Expr, depth, syntactic)
+	case *ast.RuleRefExpr:
+		return w.rule(w.gen.rules[expr.Name.Val], depth)
+	case *ast.SeqExpr:
+		for _, expr := range expr.Exprs {
+			if !w.expr(expr, depth, syntactic) {
+				return false
+			}
+		}
+	case *ast.ZeroOrMoreExpr:
+		return w.repeat(expr.Expr, depth, syntactic, 0, spent)
+	case *ast.ZeroOrOneExpr:
+		if !spent && rnd.Intn(2) == 0 {
+			return w.expr(expr.Expr, depth, syntactic)
+		}
+	default:
+		// The predicates are left to the rejection of the sentences, the
+		// code is not run and the throws have no sentence without error.
+	}
+	return true
+}
+
+// repeat generates min or more repetitions of expr, only min if the depth
+// budget is spent.
+func (w *walk) repeat(expr ast.Expression, depth int, syntactic bool, min int, spent bool) bool {
+	n := min
+	if !spent {
+		n += w.gen.rnd.Intn(w.gen.opts.MaxRepeat + 1)
+	}
+	for i := 0; i < n; i++ {
+		if !w.expr(expr, depth, syntactic) {
+			return false
+		}
+	}
+	return true
+}
+
+// choose returns a random alternative of ch, one of the lowest ones if the
+// depth budget is spent.
+func (w *walk) choose(ch *ast.ChoiceExpr, spent bool) ast.Expression {
+	if spent {
+		var lowest []ast.Expression
+		min := infinite + 1
+		for _, alt := range ch.Alternatives {
+			switch h := height(alt, w.gen.heights); {
+			case h < min:
+				lowest, min = []ast.Expression{alt}, h
+			case h == min:
+				lowest = append(lowest, alt)
+			}
+		}
+		return lowest[w.gen.rnd.Intn(len(lowest))]
+	}
+
+	weights, ok := w.gen.weights[ch]
+	if !ok {
+		return ch.Alternatives[w.gen.rnd.Intn(len(ch.Alternatives))]
+	}
+	var total float64
+	for _, wt := range weights {
+		total += wt
+	}
+	r := w.gen.rnd.Float64() * total
+	for i, wt := range weights {
+		if r < wt {
+			return ch.Alternatives[i]
+		}
+		r -= wt
+	}
+	return ch.Alternatives[len(ch.Alternatives)-1]
+}
@@ -0,0 +1,201 @@
+package sentence
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/fy0/pigeon/ast"
+	"github.com/fy0/pigeon/bootstrap"
+	"github.com/fy0/pigeon/interp"
+)
+
+func parseGrammar(t *testing.T, grammar string) *ast.Grammar {
+	t.Helper()
+	g, err := bootstrap.NewParser().Parse("", strings.NewReader(grammar))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g
+}
+
+const listGrammar = `
+Top = List !.
+List = '[' _ ( Item ( ',' _ Item )* )? ']' _
+Item = !Keyword [a-z]+ _ / Number _ / List / Keyword _
+Keyword = ( "nil"i / "true" ) ![a-z]
+Number = [0-9]+ ( '.' [0-9]+ )?
+_ = [ \t\n]*
+`
+
+func TestSentence(t *testing.T) {
+	g := parseGrammar(t, listGrammar)
+	gen, err := New(g, Options{MaxDepth: 6})
+	if err != nil {
+		t.Fatal(err)
+	}
+	in, err := interp.New(parseGrammar(t, listGrammar), interp.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var sentences [][]byte
+	seen := map[string]bool{}
+	for i := 0; i < 100; i++ {
+		b, err := gen.Sentence()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := in.Parse("", b); err != nil {
+			t.Errorf("%q: %v", b, err)
+		}
+		sentences = append(sentences, b)
+		for _, s := range []string{"nil", "true"} {
+			if bytes.Contains(bytes.ToLower(b), []byte(s)) {
+				seen[s] = true
+			}
+		}
+		if bytes.Count(b, []byte("[")) > 1 {
+			seen["nested"] = true
+		}
+	}
+	if len(seen) != 3 {
+		t.Errorf("want keywords and nested lists, got %v", seen)
+	}
+
+	// The sentences only depend on the seed.
+	gen, _ = New(g, Options{MaxDepth: 6})
+	for i, want := range sentences {
+		if b, _ := gen.Sentence(); !bytes.Equal(b, want) {
+			t.Fatalf("%d: want %q with the same seed, got %q", i, want, b)
+		}
+	}
+}
+
+func TestSentenceBudget(t *testing.T) {
+	g := parseGrammar(t, `
+A = '(' A ( ',' A )* ')' / 'x'
+`)
+	gen, err := New(g, Options{MaxDepth: 3, MaxLength: 10, MaxRepeat: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		b, err := gen.Sentence()
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Depth 3 allows 2 nested parentheses, of at most 3 elements.
+		if len(b) > 2+3*(2+3*2) {
+			t.Errorf("want a sentence within the depth budget, got %q", b)
+		}
+	}
+}
+
+func TestSentenceWeights(t *testing.T) {
+	g := parseGrammar(t, `
+A = 'a' / 'b' / 'c'
+`)
+	gen, err := New(g, Options{Weights: map[string][]float64{"A": {0, 1, 3}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts := map[string]int{}
+	for i := 0; i < 400; i++ {
+		b, err := gen.Sentence()
+		if err != nil {
+			t.Fatal(err)
+		}
+		counts[string(b)]++
+	}
+	if counts["a"] != 0 || counts["b"] < 50 || counts["c"] < 2*counts["b"] {
+		t.Errorf("want no a and 3 times more c than b, got %v", counts)
+	}
+}
+
+func TestSentenceSkipRule(t *testing.T) {
+	g := parseGrammar(t, `
+Call = ident '(' ( ident ( ',' ident )* )? ')' !.
+ident = [a-z] [a-z0-9]*
+_ = ' '*
+`)
+	gen, err := New(g, Options{SkipRule: "_"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	spaces := false
+	for i := 0; i < 50; i++ {
+		b, err := gen.Sentence()
+		if err != nil {
+			t.Fatal(err)
+		}
+		spaces = spaces || bytes.Contains(b, []byte(" "))
+	}
+	if !spaces {
+		t.Error("want the skip rule to be generated")
+	}
+}
+
+func TestSentenceErrors(t *testing.T) {
+	// The greedy repetition never leaves an a to match.
+	gen, err := New(parseGrammar(t, "A = [a-z]* 'a'"), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := gen.Sentence(); !errors.Is(err, ErrNoSentence) {
+		t.Errorf("want ErrNoSentence, got %v", err)
+	}
+
+	cases := []struct {
+		grammar string
+		opts    Options
+		err     string
+	}{
+		{grammar: "A = B", err: "1:5 (4): rule A: undefined rule B"},
+		{grammar: "A = 'a'", opts: Options{Entrypoint: "B"}, err: "undefined rule B used as alternate entrypoint"},
+		{grammar: "A = 'a'", opts: Options{Weights: map[string][]float64{"B": {1}}}, err: "weights of undefined rule B"},
+		{grammar: "A = 'a' / 'b'", opts: Options{Weights: map[string][]float64{"A": {1}}}, err: "rule A: want a weight per alternative of its choice"},
+		{grammar: "A = 'a' / 'b'", opts: Options{Weights: map[string][]float64{"A": {1, -1}}}, err: "rule A: negative weight -1"},
+		{grammar: "A = 'a' / 'b'", opts: Options{Weights: map[string][]float64{"A": {0, 0}}}, err: "rule A: want a positive weight"},
+	}
+	for _, tc := range cases {
+		_, err := New(parseGrammar(t, tc.grammar), tc.opts)
+		if err == nil || err.Error() != tc.err {
+			t.Errorf("%q: want error %q, got %v", tc.grammar, tc.err, err)
+		}
+	}
+}
+
+func TestSampleClass(t *testing.T) {
+	pos := ast.Pos{}
+	letters := ast.NewCharClassMatcher(pos, `[\pL]`)
+	letters.Subtract = []*ast.CharClassMatcher{ast.NewCharClassMatcher(pos, "[a-z]")}
+	classes := []*ast.CharClassMatcher{
+		ast.NewCharClassMatcher(pos, "[a-c]"),
+		ast.NewCharClassMatcher(pos, "[xyz]i"),
+		ast.NewCharClassMatcher(pos, `[^"\\]`),
+		ast.NewCharClassMatcher(pos, `[\p{Greek}]`),
+		ast.NewCharClassMatcher(pos, `[\PL]`),
+		letters,
+	}
+	rnd := rand.New(rand.NewSource(1))
+	for _, cl := range classes {
+		for i := 0; i < 100; i++ {
+			if rn := sampleClass(rnd, cl); !matchClass(cl, rn, cl.IgnoreCase) {
+				t.Errorf("%s: want a matching character, got %q", cl.Val, rn)
+			}
+		}
+	}
+}
+
+func TestFuzzCorpusFile(t *testing.T) {
+	name, content := FuzzCorpusFile([]byte("a\n\"b\""))
+	if want := "go test fuzz v1\n[]byte(\"a\\n\\\"b\\\"\")\n"; string(content) != want {
+		t.Errorf("want %q, got %q", want, content)
+	}
+	if len(name) != 16 {
+		t.Errorf("want a name of 16 hex digits, got %q", name)
+	}
+}
@@ -0,0 +1,112 @@
+// Package staleparser defines an analyzer that reports the stale parsers
+// generated by pigeon: the parsers whose grammar changed since they were
+// generated.
+//
+// The parsers written to a file by pigeon start with a source header,
+// after the code generated comment:
+//
+//	//pigeon:source grammar.peg sha256:<hash> <version>
+//
+// It records the path of the grammar, relative to the directory of the
+// parser, the SHA-256 hash of the grammar and the version of pigeon. The
+// analyzer reports the files of a package whose header does not match the
+// grammar. It can be run by go vet from a vet tool built with the
+// unitchecker package:
+//
+//	func main() { unitchecker.Main(staleparser.Analyzer) }
+//
+//	go vet -vettool=$(which vettool) ./...
+//
+// It does not generate the parsers, so the changes of the generation
+// options or of the version of pigeon are not reported, see the -check
+// flag of pigeon for that.
+package staleparser
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+// HeaderPrefix starts the source header of the generated parsers.
+const HeaderPrefix = "//pigeon:source "
+
+// Analyzer reports the stale parsers generated by pigeon.
+var Analyzer = &analysis.Analyzer{
+	Name: "staleparser",
+	Doc:  "report the parsers generated by pigeon whose grammar changed since they were generated",
+	Run:  run,
+}
+
+// Header returns the source header of a parser generated by pigeon version
+// from the grammar src, at the path grammar relative to the directory of
+// the parser.
+func Header(grammar string, src []byte, version string) string {
+	return HeaderPrefix + filepath.ToSlash(grammar) + " " + Hash(src) + " " + version
+}
+
+// ParseHeader returns the path of the grammar, the hash of the grammar and
+// the version of pigeon of the source header line. It returns false if the
+// line is not a source header.
+func ParseHeader(line string) (grammar, hash, version string, ok bool) {
+	rest, ok := strings.CutPrefix(strings.TrimSpace(line), HeaderPrefix)
+	if !ok {
+		return "", "", "", false
+	}
+	fields := strings.Fields(rest)
+	if len(fields) != 3 {
+		return "", "", "", false
+	}
+	return fields[0], fields[1], fields[2], true
+}
+
+// Hash returns the hash of the grammar src recorded in the source header.
+func Hash(src []byte) string {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(src))
+}
+
+func run(pass *analysis.Pass) (any, error) {
+	for _, f := range pass.Files {
+		line, pos := header(f)
+		if line == "" {
+			continue
+		}
+		grammar, hash, _, ok := ParseHeader(line)
+		if !ok {
+			pass.Reportf(pos, "invalid pigeon source header %q", line)
+			continue
+		}
+		dir := filepath.Dir(pass.Fset.File(f.Pos()).Name())
+		src, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(grammar)))
+		if err != nil {
+			pass.Reportf(pos, "grammar of the generated parser: %v", err)
+			continue
+		}
+		if Hash(src) != hash {
+			pass.Reportf(pos, "stale parser: %s changed since the parser was generated, run pigeon again", grammar)
+		}
+	}
+	return nil, nil
+}
+
+// header returns the source header of f and its position, or "" if there
+// is none before the package clause.
+func header(f *ast.File) (string, token.Pos) {
+	for _, cg := range f.Comments {
+		if cg.Pos() > f.Package {
+			break
+		}
+		for _, c := range cg.List {
+			if strings.HasPrefix(c.Text, HeaderPrefix) {
+				return c.Text, c.Pos()
+			}
+		}
+	}
+	return "", token.NoPos
+}
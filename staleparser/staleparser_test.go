@@ -0,0 +1,79 @@
+package staleparser
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+func TestAnalyzer(t *testing.T) {
+	dir := t.TempDir()
+	grammar := []byte("A = 'a'\n")
+	if err := os.WriteFile(filepath.Join(dir, "a.peg"), grammar, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	const generated = "// Code generated by pigeon; DO NOT EDIT.\n"
+	cases := []struct {
+		src  string
+		want string
+	}{
+		{src: generated + Header("a.peg", grammar, "v1.0.0") + "\n\npackage a\n"},
+		{src: "package a\n\n" + Header("a.peg", []byte("A = 'b'\n"), "v1.0.0") + "\n"},
+		{src: "package a\n"},
+		{
+			src:  generated + Header("a.peg", []byte("A = 'b'\n"), "v1.0.0") + "\n\npackage a\n",
+			want: "stale parser: a.peg changed since the parser was generated",
+		},
+		{
+			src:  generated + Header("b.peg", grammar, "v1.0.0") + "\n\npackage a\n",
+			want: "grammar of the generated parser:",
+		},
+		{
+			src:  generated + HeaderPrefix + "a.peg\n\npackage a\n",
+			want: "invalid pigeon source header",
+		},
+	}
+	for _, tc := range cases {
+		fset := token.NewFileSet()
+		f, err := parser.ParseFile(fset, filepath.Join(dir, "a.go"), tc.src, parser.ParseComments)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		pass := &analysis.Pass{
+			Analyzer: Analyzer,
+			Fset:     fset,
+			Files:    []*ast.File{f},
+			Report: func(d analysis.Diagnostic) {
+				got = append(got, d.Message)
+			},
+		}
+		if _, err := Analyzer.Run(pass); err != nil {
+			t.Fatal(err)
+		}
+		switch {
+		case tc.want == "" && len(got) > 0:
+			t.Errorf("%q: want no diagnostic, got %q", tc.src, got)
+		case tc.want != "" && (len(got) != 1 || !strings.HasPrefix(got[0], tc.want)):
+			t.Errorf("%q: want diagnostic %q, got %q", tc.src, tc.want, got)
+		}
+	}
+}
+
+func TestParseHeader(t *testing.T) {
+	line := Header(filepath.Join("grammar", "a.peg"), []byte("A = 'a'\n"), "v1.2.3")
+	grammar, hash, version, ok := ParseHeader(line)
+	if !ok || grammar != "grammar/a.peg" || hash != Hash([]byte("A = 'a'\n")) || version != "v1.2.3" {
+		t.Errorf("%q: got %q, %q, %q, %t", line, grammar, hash, version, ok)
+	}
+	if _, _, _, ok := ParseHeader("//pigeon:options -nolint"); ok {
+		t.Error("want no source header")
+	}
+}
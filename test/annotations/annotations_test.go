@@ -0,0 +1,41 @@
+package annotations
+
+import (
+	"fmt"
+	"testing"
+)
+
+// the values of the sums, or the error. Number is annotated with @token,
+// so the skip rule is not applied between its digits.
+var cases = map[string]string{
+	"1":              "1",
+	" 12 + ( 3+4 ) ": "19",
+	"((1)) + 2":      "3",
+	"1 2":            `1:3 (2): no match found, expected: "+", [ \t] or EOF`,
+}
+
+func TestAnnotations(t *testing.T) {
+	for tc, exp := range cases {
+		v, err := parse("", []byte(tc))
+		got := fmt.Sprint(v)
+		if err != nil {
+			got = err.Error()
+		}
+		if got != exp {
+			t.Errorf("%q: want %v, got %v", tc, exp, got)
+		}
+	}
+}
+
+func TestMemoRule(t *testing.T) {
+	p := newParser("", []byte("(1) + 2"))
+	if _, err := p.parse(g); err != nil {
+		t.Fatal(err)
+	}
+	if p.memoized {
+		t.Error("want memoization disabled after parsing the @memo rule")
+	}
+	if len(p.memo1) == 0 {
+		t.Error("want memoized results for the @memo rule")
+	}
+}
@@ -0,0 +1,34 @@
+package charclass_set
+
+import "testing"
+
+// the name of the matched alternative, or the error
+var cases = map[string]string{
+	"αβγ":   "greek",
+	"xyzÇ!": "consonants",
+	"DÉZ?":  "upper",
+	"αж_#":  "not latin",
+	"漢字":    "han",
+	// vowels are subtracted from the letters
+	"xaz!": `1:2 (1): no match found, expected: "!" or [\p{L}--[aeiou]]`,
+	// A to C are subtracted from the uppercase letters
+	"DAZ?": `1:4 (3): no match found, expected: "!" or [\p{L}--[aeiou]]`,
+	// lowercase letters are not in the intersection
+	"Dz?": `1:3 (2): no match found, expected: "!" or [\p{L}--[aeiou]]`,
+	// latin letters and digits are not in the negated class
+	"αa#": `1:2 (2): no match found, expected: "!", "#", [\P{sc=Latin}--[\p{Nd}#]], [\p{L}--[aeiou]], [\p{Script=Greek}] or EOF`,
+	"α٣#": `1:2 (2): no match found, expected: "!", "#", [\P{sc=Latin}--[\p{Nd}#]], [\p{L}--[aeiou]], [\p{Script=Greek}] or EOF`,
+}
+
+func TestCharClassSet(t *testing.T) {
+	for tc, exp := range cases {
+		v, err := parse("", []byte(tc))
+		var got any = v
+		if err != nil {
+			got = err.Error()
+		}
+		if got != exp {
+			t.Errorf("%q: want %v, got %v", tc, exp, got)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package errorpos
+
+import (
+	"os"
+	"testing"
+
+	"github.com/fy0/pigeon/bootstrap"
+	"github.com/fy0/pigeon/interp"
+)
+
+func TestErrorPosInterp(t *testing.T) {
+	f, err := os.Open("errorpos.peg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	g, err := bootstrap.NewParser().Parse("errorpos.peg", f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	in, err := interp.New(g, interp.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for tc, exp := range cases {
+		_, err := in.Parse("", []byte(tc))
+		var got string
+		if err != nil {
+			got = err.Error()
+		}
+		if got != exp {
+			t.Errorf("%q: want '%v', got '%v'", tc, exp, got)
+		}
+	}
+}
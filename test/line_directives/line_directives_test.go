@@ -0,0 +1,34 @@
+package line_directives
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestLineDirectives(t *testing.T) {
+	got, err := parse("", []byte("ab"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := got.([]any)
+
+	// the code block of A is at line 30 of the grammar
+	if want := (callerPos{file: "line_directives.peg", line: 30}); res[0] != want {
+		t.Errorf("want %v, got %v", want, res[0])
+	}
+
+	// the code following the code block of B is at its actual line
+	caller := res[1].(callerPos)
+	if caller.file != "line_directives.go" {
+		t.Fatalf("want caller in line_directives.go, got %v", caller)
+	}
+	src, err := os.ReadFile("line_directives.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(string(src), "\n")
+	if line := lines[caller.line-1]; !strings.Contains(line, "(&p.cur)") {
+		t.Errorf("want the call of the code block at line %d, got %q", caller.line, line)
+	}
+}
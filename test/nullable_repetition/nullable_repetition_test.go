@@ -0,0 +1,56 @@
+package nullable_repetition
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestItems(t *testing.T) {
+	got, err := parse("", []byte("a,bc,"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []any{"a", "bc"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("want %#v, got %#v", want, got)
+	}
+}
+
+func TestNullableRepetitionGuard(t *testing.T) {
+	// pigeon rejects repetitions of expressions matching the empty input,
+	// so the grammar is written by hand, as a parser generated by an older
+	// version would contain it:
+	//   Loop ← ( "a"? )* ( "b"* )+ !.
+	loop := &grammar{
+		rules: []*rule{
+			{
+				name: "Loop",
+				expr: &seqExpr{
+					exprs: []any{
+						&zeroOrMoreExpr{expr: &zeroOrOneExpr{expr: &litMatcher{val: "a", want: `"a"`}}},
+						&oneOrMoreExpr{expr: &zeroOrMoreExpr{expr: &litMatcher{val: "b", want: `"b"`}}},
+						&notExpr{expr: &anyMatcher{}},
+					},
+				},
+			},
+		},
+	}
+
+	for _, in := range []string{"", "aab", "bb"} {
+		done := make(chan error, 1)
+		go func() {
+			p := newParser("", []byte(in))
+			p.entrypoint = "Loop"
+			_, err := p.parse(loop)
+			done <- err
+		}()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("%q: want no error, got %v", in, err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%q: the repetition loops forever", in)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package optimizegrammar
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	optimized "github.com/fy0/pigeon/test/optimize_grammar/optimized"
+)
+
+// TestOptimizeGrammar checks that the parser generated with the
+// -optimize-grammar flag gives the same results as the standard parser, on
+// the documents of testdata and the JSON corpus of the examples.
+func TestOptimizeGrammar(t *testing.T) {
+	var files []string
+	for _, pattern := range []string{"testdata/*.txt", "../../examples/json/testdata/*.json"} {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, matches...)
+	}
+	if len(files) == 0 {
+		t.Fatal("no input files")
+	}
+
+	for _, file := range files {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, wantErr := Parse(file, b)
+		got, gotErr := optimized.Parse(file, b)
+		if (wantErr == nil) != (gotErr == nil) {
+			t.Errorf("%s: want error %v, got %v", file, wantErr, gotErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: want %#v, got %#v", file, want, got)
+		}
+	}
+}
+
+func TestOptimizeGrammarResults(t *testing.T) {
+	cases := []struct {
+		in   string
+		want any
+		err  bool
+	}{
+		{in: `[1, "a", []]`, want: []any{
+			[]any{1.0, "a"},
+			nil,
+		}},
+		{in: `{"a": {"b": true}}`, want: []any{
+			map[string]any{"a": map[string]any{"b": true}},
+			nil,
+		}},
+		{in: `"a" @todo "b"`, want: []any{
+			"a",
+			[]any{[]any{"todo", "b"}},
+		}},
+		{in: `null @todo 1`, err: true},
+		{in: `[1,]`, err: true},
+	}
+
+	for _, tc := range cases {
+		for name, parse := range map[string]func(string, []byte) (any, error){
+			"standard":  Parse,
+			"optimized": optimized.Parse,
+		} {
+			got, err := parse("", []byte(tc.in))
+			if (err != nil) != tc.err {
+				t.Errorf("%s: %q: want error %t, got %v", name, tc.in, tc.err, err)
+				continue
+			}
+			if tc.want != nil && !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("%s: %q: want %#v, got %#v", name, tc.in, tc.want, got)
+			}
+		}
+	}
+}
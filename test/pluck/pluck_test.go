@@ -0,0 +1,28 @@
+package pluck
+
+import (
+	"fmt"
+	"testing"
+)
+
+// the plucked items of the lists, or the error
+var cases = map[string]string{
+	"[1]":             "[1]",
+	"[ 1, 23 ,4 ]":    "[1 23 4]",
+	"[(1:2), 3]":      "[[1 2] 3]",
+	"[ ( 10 : 20 ) ]": "[[10 20]]",
+	"[1a]":            `1:3 (2): no match found, expected: ![a-z] or [0-9]`,
+}
+
+func TestPluck(t *testing.T) {
+	for tc, exp := range cases {
+		v, err := parse("", []byte(tc))
+		got := fmt.Sprint(v)
+		if err != nil {
+			got = err.Error()
+		}
+		if got != exp {
+			t.Errorf("%q: want %v, got %v", tc, exp, got)
+		}
+	}
+}
@@ -1,4 +1,5 @@
 // Code generated by pigeon; DO NOT EDIT.
+//pigeon:options -nolint
 
 package predicates
 
@@ -6,168 +7,107 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
-	"io"
 	"math"
-	"os"
 	"sort"
 	"strconv"
 	"strings"
-	"sync"
 	"unicode"
 	"unicode/utf8"
 )
 
+type ParserCustomData struct {
+}
+
 var g = &grammar{
 	rules: []*rule{
 		{
-			name: "A",
-			pos:  position{line: 5, col: 1, offset: 24},
+			name:      "A",
+			varExists: true,
 			expr: &choiceExpr{
-				pos: position{line: 5, col: 5, offset: 30},
 				alternatives: []any{
 					&seqExpr{
-						pos: position{line: 5, col: 5, offset: 30},
 						exprs: []any{
 							&labeledExpr{
-								pos:   position{line: 5, col: 5, offset: 30},
 								label: "a",
-								expr: &litMatcher{
-									pos:        position{line: 5, col: 7, offset: 32},
-									val:        "a",
-									ignoreCase: false,
-									want:       "\"a\"",
-								},
-							},
-							&notCodeExpr{
-								pos: position{line: 5, col: 11, offset: 36},
-								run: (*parser).callonA5,
+								expr:  &litMatcher{val: "a", want: "\"a\""},
 							},
+							&notCodeExpr{run: (*parser).call_onA_5},
 						},
 					},
 					&seqExpr{
-						pos: position{line: 10, col: 3, offset: 98},
 						exprs: []any{
 							&labeledExpr{
-								pos:   position{line: 10, col: 3, offset: 98},
 								label: "b",
-								expr: &litMatcher{
-									pos:        position{line: 10, col: 5, offset: 100},
-									val:        "b",
-									ignoreCase: false,
-									want:       "\"b\"",
-								},
-							},
-							&notCodeExpr{
-								pos: position{line: 10, col: 9, offset: 104},
-								run: (*parser).callonA9,
+								expr:  &litMatcher{val: "b", want: "\"b\""},
 							},
+							&notCodeExpr{run: (*parser).call_onA_9},
 						},
 					},
 					&seqExpr{
-						pos: position{line: 15, col: 3, offset: 165},
 						exprs: []any{
 							&labeledExpr{
-								pos:   position{line: 15, col: 3, offset: 165},
 								label: "d",
-								expr: &litMatcher{
-									pos:        position{line: 15, col: 5, offset: 167},
-									val:        "d",
-									ignoreCase: false,
-									want:       "\"d\"",
-								},
-							},
-							&andCodeExpr{
-								pos: position{line: 15, col: 9, offset: 171},
-								run: (*parser).callonA13,
+								expr:  &litMatcher{val: "d", want: "\"d\""},
 							},
+							&andCodeExpr{run: (*parser).call_onA_13},
 						},
 					},
 				},
 			},
 		},
 		{
-			name: "B",
-			pos:  position{line: 20, col: 1, offset: 230},
+			name:      "B",
+			varExists: true,
 			expr: &seqExpr{
-				pos: position{line: 20, col: 5, offset: 236},
 				exprs: []any{
 					&labeledExpr{
-						pos:   position{line: 20, col: 5, offset: 236},
 						label: "out",
 						expr: &seqExpr{
-							pos: position{line: 20, col: 11, offset: 242},
 							exprs: []any{
 								&labeledExpr{
-									pos:   position{line: 20, col: 11, offset: 242},
 									label: "inner",
 									expr: &seqExpr{
-										pos: position{line: 20, col: 19, offset: 250},
 										exprs: []any{
 											&charClassMatcher{
-												pos:        position{line: 20, col: 19, offset: 250},
-												val:        "[^abd]",
-												chars:      []rune{'a', 'b', 'd'},
-												ignoreCase: false,
-												inverted:   true,
+												val:      "[^abd]",
+												chars:    []rune{'a', 'b', 'd'},
+												inverted: true,
 											},
 											&labeledExpr{
-												pos:   position{line: 20, col: 26, offset: 257},
 												label: "innermost",
-												expr: &anyMatcher{
-													line: 20, col: 36, offset: 267,
-												},
-											},
-											&andCodeExpr{
-												pos: position{line: 20, col: 38, offset: 269},
-												run: (*parser).callonB9,
+												expr:  &anyMatcher{},
 											},
+											&andCodeExpr{run: (*parser).call_onB_9},
 										},
 									},
 								},
-								&andCodeExpr{
-									pos: position{line: 20, col: 60, offset: 291},
-									run: (*parser).callonB10,
-								},
+								&andCodeExpr{run: (*parser).call_onB_10},
 							},
 						},
 					},
-					&andCodeExpr{
-						pos: position{line: 20, col: 82, offset: 313},
-						run: (*parser).callonB11,
-					},
+					&andCodeExpr{run: (*parser).call_onB_11},
 				},
 			},
 		},
 		{
-			name: "C",
-			pos:  position{line: 22, col: 1, offset: 334},
+			name:      "C",
+			varExists: true,
 			expr: &actionExpr{
-				pos: position{line: 22, col: 5, offset: 340},
-				run: (*parser).callonC1,
+				run: (*parser).call_onC_1,
 				expr: &seqExpr{
-					pos: position{line: 22, col: 5, offset: 340},
 					exprs: []any{
 						&andExpr{
-							pos: position{line: 22, col: 5, offset: 340},
 							expr: &labeledExpr{
-								pos:   position{line: 22, col: 7, offset: 342},
 								label: "inand",
 								expr: &charClassMatcher{
-									pos:        position{line: 22, col: 13, offset: 348},
-									val:        "[efg]",
-									chars:      []rune{'e', 'f', 'g'},
-									ignoreCase: false,
-									inverted:   false,
+									val:   "[efg]",
+									chars: []rune{'e', 'f', 'g'},
 								},
 							},
 						},
 						&labeledExpr{
-							pos:   position{line: 22, col: 20, offset: 355},
 							label: "rest",
-							expr: &ruleRefExpr{
-								pos:  position{line: 22, col: 25, offset: 360},
-								name: "hij",
-							},
+							expr:  &litMatcher{val: "hij", want: "\"hij\""},
 						},
 					},
 				},
@@ -176,77 +116,57 @@ var g = &grammar{
 	},
 }
 
-func (c *current) onA5(a any) (bool, error) {
-	fmt.Println(string(c.text))
-	return true, nil
-}
-
-func (p *parser) callonA5() (bool, error) {
+func (p *parser) call_onA_5() bool {
 	stack := p.vstack[len(p.vstack)-1]
-	_ = stack
-	return p.cur.onA5(stack["a"])
+	return (func(c *current, a any) bool {
+		fmt.Println(string(c.text))
+		return true
+	})(&p.cur, stack["a"])
 }
 
-func (c *current) onA9(b any) (bool, error) {
-	fmt.Println(string(c.text))
-	return true, nil
-}
-
-func (p *parser) callonA9() (bool, error) {
+func (p *parser) call_onA_9() bool {
 	stack := p.vstack[len(p.vstack)-1]
-	_ = stack
-	return p.cur.onA9(stack["b"])
-}
-
-func (c *current) onA13(d any) (bool, error) {
-	fmt.Println(string(c.text))
-	return true, nil
+	return (func(c *current, b any) bool {
+		fmt.Println(string(c.text))
+		return true
+	})(&p.cur, stack["b"])
 }
 
-func (p *parser) callonA13() (bool, error) {
+func (p *parser) call_onA_13() bool {
 	stack := p.vstack[len(p.vstack)-1]
-	_ = stack
-	return p.cur.onA13(stack["d"])
+	return (func(c *current, d any) bool {
+		fmt.Println(string(c.text))
+		return true
+	})(&p.cur, stack["d"])
 }
 
-func (c *current) onB9(innermost any) (bool, error) {
-	return true, nil
-}
-
-func (p *parser) callonB9() (bool, error) {
+func (p *parser) call_onB_9() bool {
 	stack := p.vstack[len(p.vstack)-1]
-	_ = stack
-	return p.cur.onB9(stack["innermost"])
-}
-
-func (c *current) onB10(inner any) (bool, error) {
-	return true, nil
+	return (func(c *current, innermost any) bool {
+		return true
+	})(&p.cur, stack["innermost"])
 }
 
-func (p *parser) callonB10() (bool, error) {
+func (p *parser) call_onB_10() bool {
 	stack := p.vstack[len(p.vstack)-1]
-	_ = stack
-	return p.cur.onB10(stack["inner"])
-}
-
-func (c *current) onB11(out any) (bool, error) {
-	return true, nil
+	return (func(c *current, inner any) bool {
+		return true
+	})(&p.cur, stack["inner"])
 }
 
-func (p *parser) callonB11() (bool, error) {
+func (p *parser) call_onB_11() bool {
 	stack := p.vstack[len(p.vstack)-1]
-	_ = stack
-	return p.cur.onB11(stack["out"])
+	return (func(c *current, out any) bool {
+		return true
+	})(&p.cur, stack["out"])
 }
 
-func (c *current) onC1(rest any) (any, error) {
-	return nil, nil
-}
-
-func (p *parser) callonC1() (any, error) {
+func (p *parser) call_onC_1() any {
 	stack := p.vstack[len(p.vstack)-1]
-	_ = stack
-	return p.cur.onC1(stack["rest"])
+	return (func(c *current, rest any) any {
+		return nil
+		return nil
+	})(&p.cur, stack["rest"])
 }
 
 var (
@@ -266,42 +186,52 @@ var (
 	errMaxExprCnt = errors.New("max number of expressions parsed")
 )
 
-// Option is a function that can set an option on the parser. It returns
-// the previous setting as an Option.
-type Option func(*parser) Option
+// remove generic because it can't be compiled by gopherjs
+type parserStack struct {
+	data  []savepoint
+	index int
+	size  int
+}
 
-// MaxExpressions creates an Option to stop parsing after the provided
-// number of expressions have been parsed, if the value is 0 then the parser will
-// parse for as many steps as needed (possibly an infinite number).
-//
-// The default for maxExprCnt is 0.
-func MaxExpressions(maxExprCnt uint64) Option {
-	return func(p *parser) Option {
-		oldMaxExprCnt := p.maxExprCnt
-		p.maxExprCnt = maxExprCnt
-		return MaxExpressions(oldMaxExprCnt)
+func (ss *parserStack) init(size int) {
+	ss.index = -1
+	ss.data = make([]savepoint, size)
+	ss.size = size
+}
+
+func (ss *parserStack) push(v *savepoint) {
+	ss.index += 1
+	if ss.index == ss.size {
+		ss.data = append(ss.data, *v)
+		ss.size = len(ss.data)
+	} else {
+		ss.data[ss.index] = *v
 	}
 }
 
-// Entrypoint creates an Option to set the rule name to use as entrypoint.
-// The rule name must have been specified in the -alternate-entrypoints
-// if generating the parser with the -optimize-grammar flag, otherwise
-// it may have been optimized out. Passing an empty string sets the
-// entrypoint to the first rule in the grammar.
-//
-// The default is to start parsing at the first rule in the grammar.
-func Entrypoint(ruleName string) Option {
-	return func(p *parser) Option {
-		oldEntrypoint := p.entrypoint
-		p.entrypoint = ruleName
-		if ruleName == "" {
-			p.entrypoint = g.rules[0].name
-		}
-		return Entrypoint(oldEntrypoint)
+func (ss *parserStack) pop() *savepoint {
+	ref := &ss.data[ss.index]
+	ss.index--
+	return ref
+}
+
+func (ss *parserStack) top() *savepoint {
+	return &ss.data[ss.index]
+}
+
+// option is a function that can set an option on the parser. It returns
+// the previous setting as an option.
+type option func(*parser) option
+
+func noMatchErrorFormatter(fn func(position, []byte, []string) error) option {
+	return func(p *parser) option {
+		old := p.noMatchErrorFormatter
+		p.noMatchErrorFormatter = fn
+		return noMatchErrorFormatter(old)
 	}
 }
 
-// Statistics adds a user provided Stats struct to the parser to allow
+// statistics adds a user provided Stats struct to the parser to allow
 // the user to process the results after the parsing has finished.
 // Also the key for the "no match" counter is set.
 //
@@ -318,8 +248,8 @@ func Entrypoint(ruleName string) Option {
 //	    log.Panicln(err)
 //	}
 //	fmt.Println(string(b))
-func Statistics(stats *Stats, choiceNoMatch string) Option {
-	return func(p *parser) Option {
+func statistics(stats *Stats, choiceNoMatch string) option {
+	return func(p *parser) option {
 		oldStats := p.Stats
 		p.Stats = stats
 		oldChoiceNoMatch := p.choiceNoMatch
@@ -327,112 +257,33 @@ func Statistics(stats *Stats, choiceNoMatch string) Option {
 		if p.Stats.ChoiceAltCnt == nil {
 			p.Stats.ChoiceAltCnt = make(map[string]map[string]int)
 		}
-		return Statistics(oldStats, oldChoiceNoMatch)
+		return statistics(oldStats, oldChoiceNoMatch)
 	}
 }
 
-// Debug creates an Option to set the debug flag to b. When set to true,
+// debug creates an option to set the debug flag to b. When set to true,
 // debugging information is printed to stdout while parsing.
 //
 // The default is false.
-func Debug(b bool) Option {
-	return func(p *parser) Option {
+func debug(b bool) option {
+	return func(p *parser) option {
 		old := p.debug
 		p.debug = b
-		return Debug(old)
-	}
-}
-
-// Memoize creates an Option to set the memoize flag to b. When set to true,
-// the parser will cache all results so each expression is evaluated only
-// once. This guarantees linear parsing time even for pathological cases,
-// at the expense of more memory and slower times for typical cases.
-//
-// The default is false.
-func Memoize(b bool) Option {
-	return func(p *parser) Option {
-		old := p.memoize
-		p.memoize = b
-		return Memoize(old)
-	}
-}
-
-// AllowInvalidUTF8 creates an Option to allow invalid UTF-8 bytes.
-// Every invalid UTF-8 byte is treated as a utf8.RuneError (U+FFFD)
-// by character class matchers and is matched by the any matcher.
-// The returned matched value, c.text and c.offset are NOT affected.
-//
-// The default is false.
-func AllowInvalidUTF8(b bool) Option {
-	return func(p *parser) Option {
-		old := p.allowInvalidUTF8
-		p.allowInvalidUTF8 = b
-		return AllowInvalidUTF8(old)
-	}
-}
-
-// Recover creates an Option to set the recover flag to b. When set to
-// true, this causes the parser to recover from panics and convert it
-// to an error. Setting it to false can be useful while debugging to
-// access the full stack trace.
-//
-// The default is true.
-func Recover(b bool) Option {
-	return func(p *parser) Option {
-		old := p.recover
-		p.recover = b
-		return Recover(old)
-	}
-}
-
-// GlobalStore creates an Option to set a key to a certain value in
-// the globalStore.
-func GlobalStore(key string, value any) Option {
-	return func(p *parser) Option {
-		old := p.cur.globalStore[key]
-		p.cur.globalStore[key] = value
-		return GlobalStore(key, old)
-	}
-}
-
-// InitState creates an Option to set a key to a certain value in
-// the global "state" store.
-func InitState(key string, value any) Option {
-	return func(p *parser) Option {
-		old := p.cur.state[key]
-		p.cur.state[key] = value
-		return InitState(key, old)
+		return debug(old)
 	}
 }
 
-// ParseFile parses the file identified by filename.
-func ParseFile(filename string, opts ...Option) (i any, err error) { // nolint: deadcode
-	f, err := os.Open(filename)
-	if err != nil {
-		return nil, err
-	}
-	defer func() {
-		if closeErr := f.Close(); closeErr != nil {
-			err = closeErr
-		}
-	}()
-	return ParseReader(filename, f, opts...)
-}
-
-// ParseReader parses the data from r using filename as information in the
-// error messages.
-func ParseReader(filename string, r io.Reader, opts ...Option) (any, error) { // nolint: deadcode
-	b, err := io.ReadAll(r)
-	if err != nil {
-		return nil, err
+func memoized(b bool) option {
+	return func(p *parser) option {
+		old := p.memoized
+		p.memoized = b
+		return memoized(old)
 	}
-
-	return Parse(filename, b, opts...)
 }
 
 // Parse parses the data from b using filename as information in the
 // error messages.
-func Parse(filename string, b []byte, opts ...Option) (any, error) {
+func parse(filename string, b []byte, opts ...option) (any, error) {
 	return newParser(filename, b, opts...).parse(g)
 }
 
@@ -456,54 +307,37 @@ type savepoint struct {
 type current struct {
 	pos  position // start position of the match
 	text []byte   // raw text of the match
-
-	// state is a store for arbitrary key,value pairs that the user wants to be
-	// tied to the backtracking of the parser.
-	// This is always rolled back if a parsing rule fails.
-	state storeDict
-
-	// globalStore is a general store for the user to store arbitrary key-value
-	// pairs that they need to manage and that they do not want tied to the
-	// backtracking of the parser. This is only modified by the user and never
-	// rolled back by the parser. It is always up to the user to keep this in a
-	// consistent state.
-	globalStore storeDict
+	data *ParserCustomData
 }
 
-type storeDict map[string]any
-
 // the AST types...
 
 // nolint: structcheck
 type grammar struct {
-	pos   position
 	rules []*rule
 }
 
 // nolint: structcheck
 type rule struct {
-	pos         position
 	name        string
 	displayName string
 	expr        any
+	varExists   bool
 }
 
 // nolint: structcheck
 type choiceExpr struct {
-	pos          position
 	alternatives []any
 }
 
 // nolint: structcheck
 type actionExpr struct {
-	pos  position
 	expr any
-	run  func(*parser) (any, error)
+	run  func(*parser) any
 }
 
 // nolint: structcheck
 type recoveryExpr struct {
-	pos          position
 	expr         any
 	recoverExpr  any
 	failureLabel []string
@@ -511,32 +345,31 @@ type recoveryExpr struct {
 
 // nolint: structcheck
 type seqExpr struct {
-	pos   position
 	exprs []any
 }
 
 // nolint: structcheck
 type throwExpr struct {
-	pos   position
 	label string
 }
 
 // nolint: structcheck
 type labeledExpr struct {
-	pos   position
-	label string
-	expr  any
+	label       string
+	expr        any
+	textCapture bool
 }
 
 // nolint: structcheck
 type expr struct {
-	pos  position
 	expr any
 }
 
 type (
 	andExpr        expr // nolint: structcheck
 	notExpr        expr // nolint: structcheck
+	andLogicalExpr expr // nolint: structcheck
+	notLogicalExpr expr // nolint: structcheck
 	zeroOrOneExpr  expr // nolint: structcheck
 	zeroOrMoreExpr expr // nolint: structcheck
 	oneOrMoreExpr  expr // nolint: structcheck
@@ -544,49 +377,43 @@ type (
 
 // nolint: structcheck
 type ruleRefExpr struct {
-	pos  position
 	name string
 }
 
-// nolint: structcheck
-type stateCodeExpr struct {
-	pos position
-	run func(*parser) error
-}
-
 // nolint: structcheck
 type andCodeExpr struct {
-	pos position
-	run func(*parser) (bool, error)
+	run func(*parser) bool
 }
 
 // nolint: structcheck
 type notCodeExpr struct {
-	pos position
-	run func(*parser) (bool, error)
+	run func(*parser) bool
 }
 
 // nolint: structcheck
 type litMatcher struct {
-	pos        position
 	val        string
 	ignoreCase bool
 	want       string
 }
 
+// nolint: structcheck
+type codeExpr struct {
+	run     func(*parser) any
+	notSkip bool
+}
+
 // nolint: structcheck
 type charClassMatcher struct {
-	pos             position
-	val             string
-	basicLatinChars [128]bool
-	chars           []rune
-	ranges          []rune
-	classes         []*unicode.RangeTable
-	ignoreCase      bool
-	inverted        bool
+	val        string
+	chars      []rune
+	ranges     []rune
+	classes    []*unicode.RangeTable
+	ignoreCase bool
+	inverted   bool
 }
 
-type anyMatcher position // nolint: structcheck
+type anyMatcher struct{} // nolint: structcheck
 
 // errList cumulates the errors found by the parser.
 type errList []error
@@ -648,44 +475,6 @@ func (p *parserError) Error() string {
 	return p.prefix + ": " + p.Inner.Error()
 }
 
-// newParser creates a parser with the specified input source and options.
-func newParser(filename string, b []byte, opts ...Option) *parser {
-	stats := Stats{
-		ChoiceAltCnt: make(map[string]map[string]int),
-	}
-
-	p := &parser{
-		filename: filename,
-		errs:     new(errList),
-		data:     b,
-		pt:       savepoint{position: position{line: 1}},
-		recover:  true,
-		cur: current{
-			state:       make(storeDict),
-			globalStore: make(storeDict),
-		},
-		maxFailPos:      position{col: 1, line: 1},
-		maxFailExpected: make([]string, 0, 20),
-		Stats:           &stats,
-		// start rule is rule [0] unless an alternate entrypoint is specified
-		entrypoint: g.rules[0].name,
-	}
-	p.setOptions(opts)
-
-	if p.maxExprCnt == 0 {
-		p.maxExprCnt = math.MaxUint64
-	}
-
-	return p
-}
-
-// setOptions applies the options to the parser.
-func (p *parser) setOptions(opts []Option) {
-	for _, opt := range opts {
-		opt(p)
-	}
-}
-
 // nolint: structcheck,deadcode
 type resultTuple struct {
 	v   any
@@ -708,11 +497,11 @@ type Stats struct {
 	// These numbers allow to optimize the order of the ordered choice expression
 	// to increase the performance of the parser
 	//
-	// The outer key of ChoiceAltCnt is composed of the name of the rule as well
+	// The outer key of ChoiceAltCnt is composed of the exprType of the rule as well
 	// as the line and the column of the ordered choice.
 	// The inner key of ChoiceAltCnt is the number (one-based) of the matching alternative.
 	// For each alternative the number of matches are counted. If an ordered choice does not
-	// match, a special counter is incremented. The name of this counter is set with
+	// match, a special counter is incremented. The exprType of this counter is set with
 	// the parser option Statistics.
 	// For an alternative to be included in ChoiceAltCnt, it has to match at least once.
 	ChoiceAltCnt map[string]map[string]int
@@ -727,17 +516,19 @@ type parser struct {
 	data []byte
 	errs *errList
 
-	depth   int
-	recover bool
-	debug   bool
+	depth    int
+	recover  bool
+	memoized bool
+	debug    bool
 
-	memoize bool
 	// memoization table for the packrat algorithm:
 	// map[offset in source] map[expression or rule] {value, match}
-	memo map[int]map[any]resultTuple
+	memo1 map[int]map[any]*resultTuple
+	memo2 map[int]map[any]*resultTuple
 
 	// rules table, maps the rule identifier to the rule node
-	rules map[string]*rule
+	rules      map[string]*rule
+	rulesArray []*rule
 	// variables stack, map of label to value
 	vstack []map[string]any
 	// rule stack, allows identification of the current rule in errors
@@ -747,6 +538,7 @@ type parser struct {
 	maxFailPos            position
 	maxFailExpected       []string
 	maxFailInvertExpected bool
+	noMatchErrorFormatter func(position, []byte, []string) error
 
 	// max number of expressions to be parsed
 	maxExprCnt uint64
@@ -760,6 +552,63 @@ type parser struct {
 	choiceNoMatch string
 	// recovery expression stack, keeps track of the currently available recovery expression, these are traversed in reverse
 	recoveryStack []map[string]any
+
+	_errPos *position
+	// skip code stack
+	scStack []bool
+	// save point stack
+	spStack parserStack
+}
+
+// newParser creates a parser with the specified input source and options.
+func newParser(filename string, b []byte, opts ...option) *parser {
+	stats := Stats{
+		ChoiceAltCnt: make(map[string]map[string]int),
+	}
+
+	p := &parser{
+		filename: filename,
+		errs:     new(errList),
+		data:     b,
+		pt:       savepoint{position: position{line: 1}},
+		recover:  false,
+		cur: current{
+			data: &ParserCustomData{},
+		},
+		maxFailPos:      position{col: 1, line: 1},
+		maxFailExpected: make([]string, 0, 20),
+		Stats:           &stats,
+		memo1:           map[int]map[any]*resultTuple{},
+		memo2:           map[int]map[any]*resultTuple{},
+		// start rule is rule [0] unless an alternate entrypoint is specified
+		entrypoint: "A",
+		scStack:    []bool{false},
+	}
+
+	p.spStack.init(5)
+	p.setOptions(opts)
+
+	if p.maxExprCnt == 0 {
+		p.maxExprCnt = math.MaxUint64
+	}
+
+	return p
+}
+
+// setOptions applies the options to the parser.
+func (p *parser) setOptions(opts []option) {
+	for _, opt := range opts {
+		opt(p)
+	}
+}
+
+// setCustomData to the parser.
+func (p *parser) setCustomData(data *ParserCustomData) {
+	p.cur.data = data
+}
+
+func (p *parser) checkSkipCode() bool {
+	return p.scStack[len(p.scStack)-1]
 }
 
 // push a variable set on the vstack.
@@ -845,7 +694,11 @@ func (p *parser) out(s string) string {
 }
 
 func (p *parser) addErr(err error) {
-	p.addErrAt(err, p.pt.position, []string{})
+	if p._errPos != nil {
+		p.addErrAt(err, *p._errPos, []string{})
+	} else {
+		p.addErrAt(err, p.pt.position, []string{})
+	}
 }
 
 func (p *parser) addErrAt(err error, pos position, expected []string) {
@@ -872,7 +725,17 @@ func (p *parser) addErrAt(err error, pos position, expected []string) {
 	p.errs.add(pe)
 }
 
-func (p *parser) failAt(fail bool, pos position, want string) {
+func (p *parser) buildNoMatchError(pos position, expected []string) error {
+	if p.noMatchErrorFormatter != nil {
+		if err := p.noMatchErrorFormatter(pos, p.data, expected); err != nil {
+			return err
+		}
+	}
+
+	return errors.New("no match found, expected: " + listJoin(expected, ", ", "or"))
+}
+
+func (p *parser) failAt(fail bool, pos *position, want string) {
 	// process fail if parsing fails and not inverted or parsing succeeds and invert is set
 	if fail == p.maxFailInvertExpected {
 		if pos.offset < p.maxFailPos.offset {
@@ -880,7 +743,7 @@ func (p *parser) failAt(fail bool, pos position, want string) {
 		}
 
 		if pos.offset > p.maxFailPos.offset {
-			p.maxFailPos = pos
+			p.maxFailPos = *pos
 			p.maxFailExpected = p.maxFailExpected[:0]
 		}
 
@@ -911,92 +774,24 @@ func (p *parser) read() {
 }
 
 // restore parser position to the savepoint pt.
-func (p *parser) restore(pt savepoint) {
+func (p *parser) restore(pt *savepoint) {
 	if p.debug {
 		defer p.out(p.in("restore"))
 	}
 	if pt.offset == p.pt.offset {
 		return
 	}
-	p.pt = pt
-}
-
-// Cloner is implemented by any value that has a Clone method, which returns a
-// copy of the value. This is mainly used for types which are not passed by
-// value (e.g map, slice, chan) or structs that contain such types.
-//
-// This is used in conjunction with the global state feature to create proper
-// copies of the state to allow the parser to properly restore the state in
-// the case of backtracking.
-type Cloner interface {
-	Clone() any
-}
-
-var statePool = &sync.Pool{
-	New: func() any { return make(storeDict) },
-}
-
-func (sd storeDict) Discard() {
-	for k := range sd {
-		delete(sd, k)
-	}
-	statePool.Put(sd)
-}
-
-// clone and return parser current state.
-func (p *parser) cloneState() storeDict {
-	if p.debug {
-		defer p.out(p.in("cloneState"))
-	}
-
-	state := statePool.Get().(storeDict)
-	for k, v := range p.cur.state {
-		if c, ok := v.(Cloner); ok {
-			state[k] = c.Clone()
-		} else {
-			state[k] = v
-		}
-	}
-	return state
-}
-
-// restore parser current state to the state storeDict.
-// every restoreState should applied only one time for every cloned state
-func (p *parser) restoreState(state storeDict) {
-	if p.debug {
-		defer p.out(p.in("restoreState"))
-	}
-	p.cur.state.Discard()
-	p.cur.state = state
+	p.pt = *pt
 }
 
 // get the slice of bytes from the savepoint start to the current position.
-func (p *parser) sliceFrom(start savepoint) []byte {
+func (p *parser) sliceFrom(start *savepoint) []byte {
 	return p.data[start.position.offset:p.pt.position.offset]
 }
 
-func (p *parser) getMemoized(node any) (resultTuple, bool) {
-	if len(p.memo) == 0 {
-		return resultTuple{}, false
-	}
-	m := p.memo[p.pt.offset]
-	if len(m) == 0 {
-		return resultTuple{}, false
-	}
-	res, ok := m[node]
-	return res, ok
-}
-
-func (p *parser) setMemoized(pt savepoint, node any, tuple resultTuple) {
-	if p.memo == nil {
-		p.memo = make(map[int]map[any]resultTuple)
-	}
-	m := p.memo[pt.offset]
-	if m == nil {
-		m = make(map[any]resultTuple)
-		p.memo[pt.offset] = m
-	}
-	m[node] = tuple
+// get the slice of bytes from the savepoint start to the current position.
+func (p *parser) sliceFromOffset(offset int) []byte {
+	return p.data[offset:p.pt.position.offset]
 }
 
 func (p *parser) buildRulesTable(g *grammar) {
@@ -1007,14 +802,17 @@ func (p *parser) buildRulesTable(g *grammar) {
 }
 
 // nolint: gocyclo
-func (p *parser) parse(g *grammar) (val any, err error) {
-	if len(g.rules) == 0 {
+func (p *parser) parse(grammar *grammar) (val any, err error) {
+	if grammar == nil {
+		grammar = g
+	}
+	if len(grammar.rules) == 0 {
 		p.addErr(errNoRule)
 		return nil, p.errs.err()
 	}
 
-	// TODO : not super critical but this could be generated
-	p.buildRulesTable(g)
+	p.rulesArray = grammar.rules
+	p.buildRulesTable(grammar)
 
 	if p.recover {
 		// panic can be used in action code to stop parsing immediately
@@ -1065,7 +863,7 @@ func (p *parser) parse(g *grammar) (val any, err error) {
 			if eof {
 				expected = append(expected, "EOF")
 			}
-			p.addErrAt(errors.New("no match found, expected: "+listJoin(expected, ", ", "or")), p.maxFailPos, expected)
+			p.addErrAt(p.buildNoMatchError(p.maxFailPos, expected), p.maxFailPos, expected)
 		}
 
 		return nil, p.errs.err()
@@ -1084,20 +882,6 @@ func listJoin(list []string, sep string, lastSep string) string {
 	}
 }
 
-func (p *parser) parseRuleMemoize(rule *rule) (any, bool) {
-	res, ok := p.getMemoized(rule)
-	if ok {
-		p.restore(res.end)
-		return res.v, res.b
-	}
-
-	startMark := p.pt
-	val, ok := p.parseRule(rule)
-	p.setMemoized(startMark, rule, resultTuple{val, ok, p.pt})
-
-	return val, ok
-}
-
 func (p *parser) parseRuleWrap(rule *rule) (any, bool) {
 	if p.debug {
 		defer p.out(p.in("parseRule " + rule.name))
@@ -1105,14 +889,10 @@ func (p *parser) parseRuleWrap(rule *rule) (any, bool) {
 	var (
 		val       any
 		ok        bool
-		startMark = p.pt
+		startMark = &p.pt
 	)
 
-	if p.memoize {
-		val, ok = p.parseRuleMemoize(rule)
-	} else {
-		val, ok = p.parseRule(rule)
-	}
+	val, ok = p.parseRule(rule)
 
 	if ok && p.debug {
 		p.printIndent("MATCH", string(p.sliceFrom(startMark)))
@@ -1130,22 +910,7 @@ func (p *parser) parseRule(rule *rule) (any, bool) {
 }
 
 func (p *parser) parseExprWrap(expr any) (any, bool) {
-	var pt savepoint
-
-	if p.memoize {
-		res, ok := p.getMemoized(expr)
-		if ok {
-			p.restore(res.end)
-			return res.v, res.b
-		}
-		pt = p.pt
-	}
-
 	val, ok := p.parseExpr(expr)
-
-	if p.memoize {
-		p.setMemoized(pt, expr, resultTuple{val, ok, p.pt})
-	}
 	return val, ok
 }
 
@@ -1156,6 +921,39 @@ func (p *parser) parseExpr(expr any) (any, bool) {
 		panic(errMaxExprCnt)
 	}
 
+	skipCode := p.checkSkipCode()
+	memo := p.memo1
+	if skipCode {
+		memo = p.memo2
+	}
+
+	setMemoized := func(pos int, expr any, val resultTuple) {
+		if !p.memoized {
+			return
+		}
+		if memo[pos] == nil {
+			memo[pos] = map[any]*resultTuple{}
+		}
+		memo[pos][expr] = &val
+	}
+
+	if p.memoized {
+		getMemoized := func(expr any) *resultTuple {
+			pos := p.pt.offset
+			if memo[pos] == nil {
+				return nil
+			}
+			return memo[pos][expr]
+		}
+
+		if m := getMemoized(expr); m != nil {
+			p.restore(&m.end)
+			return m.v, m.b
+		}
+	}
+
+	pos := p.pt.offset
+
 	var val any
 	var ok bool
 	switch expr := expr.(type) {
@@ -1165,12 +963,16 @@ func (p *parser) parseExpr(expr any) (any, bool) {
 		val, ok = p.parseAndCodeExpr(expr)
 	case *andExpr:
 		val, ok = p.parseAndExpr(expr)
+	case *andLogicalExpr:
+		val, ok = p.parseAndLogicalExpr(expr)
 	case *anyMatcher:
 		val, ok = p.parseAnyMatcher(expr)
 	case *charClassMatcher:
 		val, ok = p.parseCharClassMatcher(expr)
 	case *choiceExpr:
 		val, ok = p.parseChoiceExpr(expr)
+	case *codeExpr:
+		val, ok = p.parseCodeExpr(expr)
 	case *labeledExpr:
 		val, ok = p.parseLabeledExpr(expr)
 	case *litMatcher:
@@ -1179,6 +981,8 @@ func (p *parser) parseExpr(expr any) (any, bool) {
 		val, ok = p.parseNotCodeExpr(expr)
 	case *notExpr:
 		val, ok = p.parseNotExpr(expr)
+	case *notLogicalExpr:
+		val, ok = p.parseNotLogicalExpr(expr)
 	case *oneOrMoreExpr:
 		val, ok = p.parseOneOrMoreExpr(expr)
 	case *recoveryExpr:
@@ -1187,8 +991,6 @@ func (p *parser) parseExpr(expr any) (any, bool) {
 		val, ok = p.parseRuleRefExpr(expr)
 	case *seqExpr:
 		val, ok = p.parseSeqExpr(expr)
-	case *stateCodeExpr:
-		val, ok = p.parseStateCodeExpr(expr)
 	case *throwExpr:
 		val, ok = p.parseThrowExpr(expr)
 	case *zeroOrMoreExpr:
@@ -1198,6 +1000,8 @@ func (p *parser) parseExpr(expr any) (any, bool) {
 	default:
 		panic(fmt.Sprintf("unknown expression type %T", expr))
 	}
+
+	setMemoized(pos, expr, resultTuple{val, ok, p.pt})
 	return val, ok
 }
 
@@ -1206,22 +1010,25 @@ func (p *parser) parseActionExpr(act *actionExpr) (any, bool) {
 		defer p.out(p.in("parseActionExpr"))
 	}
 
-	start := p.pt
+	if p.checkSkipCode() {
+		_, ok := p.parseExprWrap(act.expr)
+		return nil, ok
+	}
+
+	p.spStack.push(&p.pt)
 	val, ok := p.parseExprWrap(act.expr)
+	start := p.spStack.pop()
+
 	if ok {
 		p.cur.pos = start.position
 		p.cur.text = p.sliceFrom(start)
-		state := p.cloneState()
-		actVal, err := act.run(p)
-		if err != nil {
-			p.addErrAt(err, start.position, []string{})
-		}
-		p.restoreState(state)
-
+		p._errPos = &start.position
+		actVal := act.run(p)
+		p._errPos = nil
 		val = actVal
 	}
 	if ok && p.debug {
-		p.printIndent("MATCH", string(p.sliceFrom(start)))
+		p.printIndent("MATCH", string(p.sliceFrom(&p.spStack.data[p.spStack.index+1])))
 	}
 	return val, ok
 }
@@ -1231,30 +1038,35 @@ func (p *parser) parseAndCodeExpr(and *andCodeExpr) (any, bool) {
 		defer p.out(p.in("parseAndCodeExpr"))
 	}
 
-	state := p.cloneState()
-
-	ok, err := and.run(p)
-	if err != nil {
-		p.addErr(err)
-	}
-	p.restoreState(state)
-
+	ok := and.run(p)
 	return nil, ok
 }
 
 func (p *parser) parseAndExpr(and *andExpr) (any, bool) {
+	return p.parseAndExprBase(and, false)
+}
+
+func (p *parser) parseAndLogicalExpr(and *andLogicalExpr) (any, bool) {
+	return p.parseAndExprBase((*andExpr)(and), true)
+}
+
+func (p *parser) parseAndExprBase(and *andExpr, logical bool) (any, bool) {
 	if p.debug {
 		defer p.out(p.in("parseAndExpr"))
 	}
 
 	pt := p.pt
-	state := p.cloneState()
-	p.pushV()
+
+	p.scStack = append(p.scStack, true)
 	_, ok := p.parseExprWrap(and.expr)
-	p.popV()
-	p.restoreState(state)
-	p.restore(pt)
+	p.scStack = p.scStack[:len(p.scStack)-1]
+
+	matchedOffset := p.pt.offset
+	p.restore(&pt)
 
+	if logical {
+		return nil, ok && p.pt.offset != matchedOffset
+	}
 	return nil, ok
 }
 
@@ -1265,13 +1077,12 @@ func (p *parser) parseAnyMatcher(any *anyMatcher) (any, bool) {
 
 	if p.pt.rn == utf8.RuneError && p.pt.w == 0 {
 		// EOF - see utf8.DecodeRune
-		p.failAt(false, p.pt.position, ".")
+		p.failAt(false, &p.pt.position, ".")
 		return nil, false
 	}
-	start := p.pt
+	p.failAt(true, &p.pt.position, ".")
 	p.read()
-	p.failAt(true, start.position, ".")
-	return p.sliceFrom(start), true
+	return nil, true
 }
 
 // nolint: gocyclo
@@ -1281,11 +1092,10 @@ func (p *parser) parseCharClassMatcher(chr *charClassMatcher) (any, bool) {
 	}
 
 	cur := p.pt.rn
-	start := p.pt
 
 	// can't match EOF
 	if cur == utf8.RuneError && p.pt.w == 0 { // see utf8.DecodeRune
-		p.failAt(false, start.position, chr.val)
+		p.failAt(false, &p.pt.position, chr.val)
 		return nil, false
 	}
 
@@ -1297,12 +1107,12 @@ func (p *parser) parseCharClassMatcher(chr *charClassMatcher) (any, bool) {
 	for _, rn := range chr.chars {
 		if rn == cur {
 			if chr.inverted {
-				p.failAt(false, start.position, chr.val)
+				p.failAt(false, &p.pt.position, chr.val)
 				return nil, false
 			}
+			p.failAt(true, &p.pt.position, chr.val)
 			p.read()
-			p.failAt(true, start.position, chr.val)
-			return p.sliceFrom(start), true
+			return nil, true
 		}
 	}
 
@@ -1310,12 +1120,12 @@ func (p *parser) parseCharClassMatcher(chr *charClassMatcher) (any, bool) {
 	for i := 0; i < len(chr.ranges); i += 2 {
 		if cur >= chr.ranges[i] && cur <= chr.ranges[i+1] {
 			if chr.inverted {
-				p.failAt(false, start.position, chr.val)
+				p.failAt(false, &p.pt.position, chr.val)
 				return nil, false
 			}
+			p.failAt(true, &p.pt.position, chr.val)
 			p.read()
-			p.failAt(true, start.position, chr.val)
-			return p.sliceFrom(start), true
+			return nil, true
 		}
 	}
 
@@ -1323,26 +1133,27 @@ func (p *parser) parseCharClassMatcher(chr *charClassMatcher) (any, bool) {
 	for _, cl := range chr.classes {
 		if unicode.Is(cl, cur) {
 			if chr.inverted {
-				p.failAt(false, start.position, chr.val)
+				p.failAt(false, &p.pt.position, chr.val)
 				return nil, false
 			}
+			p.failAt(true, &p.pt.position, chr.val)
 			p.read()
-			p.failAt(true, start.position, chr.val)
-			return p.sliceFrom(start), true
+			return nil, true
 		}
 	}
 
 	if chr.inverted {
+		p.failAt(true, &p.pt.position, chr.val)
 		p.read()
-		p.failAt(true, start.position, chr.val)
-		return p.sliceFrom(start), true
+		return nil, true
 	}
-	p.failAt(false, start.position, chr.val)
+	p.failAt(false, &p.pt.position, chr.val)
 	return nil, false
 }
 
 func (p *parser) incChoiceAltCnt(ch *choiceExpr, altI int) {
-	choiceIdent := fmt.Sprintf("%s %d:%d", p.rstack[len(p.rstack)-1].name, ch.pos.line, ch.pos.col)
+	// choiceIdent := fmt.Sprintf("%s %d:%d", p.rstack[len(p.rstack)-1].name, ch.pos.line, ch.pos.col)
+	choiceIdent := fmt.Sprintf("%s", p.rstack[len(p.rstack)-1].name)
 	m := p.ChoiceAltCnt[choiceIdent]
 	if m == nil {
 		m = make(map[string]int)
@@ -1357,24 +1168,15 @@ func (p *parser) incChoiceAltCnt(ch *choiceExpr, altI int) {
 }
 
 func (p *parser) parseChoiceExpr(ch *choiceExpr) (any, bool) {
-	if p.debug {
-		defer p.out(p.in("parseChoiceExpr"))
-	}
-
 	for altI, alt := range ch.alternatives {
 		// dummy assignment to prevent compile error if optimized
 		_ = altI
 
-		state := p.cloneState()
-
-		p.pushV()
 		val, ok := p.parseExprWrap(alt)
-		p.popV()
 		if ok {
 			p.incChoiceAltCnt(ch, altI)
 			return val, ok
 		}
-		p.restoreState(state)
 	}
 	p.incChoiceAltCnt(ch, choiceNoMatch)
 	return nil, false
@@ -1385,16 +1187,32 @@ func (p *parser) parseLabeledExpr(lab *labeledExpr) (any, bool) {
 		defer p.out(p.in("parseLabeledExpr"))
 	}
 
-	p.pushV()
-	val, ok := p.parseExprWrap(lab.expr)
-	p.popV()
-	if ok && lab.label != "" {
+	startOffset := p.pt.position.offset
+	var val any
+	var ok bool
+	val, ok = p.parseExprWrap(lab.expr)
+	if ok && lab.label != "" && !p.checkSkipCode() {
 		m := p.vstack[len(p.vstack)-1]
-		m[lab.label] = val
+		if lab.textCapture {
+			m[lab.label] = string(p.sliceFromOffset(startOffset))
+		} else {
+			m[lab.label] = val
+		}
 	}
 	return val, ok
 }
 
+func (p *parser) parseCodeExpr(code *codeExpr) (any, bool) {
+	if p.debug {
+		defer p.out(p.in("parseCodeExpr"))
+	}
+
+	if !code.notSkip && p.checkSkipCode() {
+		return nil, true
+	}
+	return code.run(p), true
+}
+
 func (p *parser) parseLitMatcher(lit *litMatcher) (any, bool) {
 	if p.debug {
 		defer p.out(p.in("parseLitMatcher"))
@@ -1407,14 +1225,14 @@ func (p *parser) parseLitMatcher(lit *litMatcher) (any, bool) {
 			cur = unicode.ToLower(cur)
 		}
 		if cur != want {
-			p.failAt(false, start.position, lit.want)
-			p.restore(start)
+			p.failAt(false, &start.position, lit.want)
+			p.restore(&start)
 			return nil, false
 		}
 		p.read()
 	}
-	p.failAt(true, start.position, lit.want)
-	return p.sliceFrom(start), true
+	p.failAt(true, &start.position, lit.want)
+	return nil, true
 }
 
 func (p *parser) parseNotCodeExpr(not *notCodeExpr) (any, bool) {
@@ -1422,32 +1240,37 @@ func (p *parser) parseNotCodeExpr(not *notCodeExpr) (any, bool) {
 		defer p.out(p.in("parseNotCodeExpr"))
 	}
 
-	state := p.cloneState()
-
-	ok, err := not.run(p)
-	if err != nil {
-		p.addErr(err)
-	}
-	p.restoreState(state)
-
+	ok := not.run(p)
 	return nil, !ok
 }
 
 func (p *parser) parseNotExpr(not *notExpr) (any, bool) {
+	return p.parseNotExprBase(not, false)
+}
+
+func (p *parser) parseNotLogicalExpr(not *notLogicalExpr) (any, bool) {
+	return p.parseNotExprBase((*notExpr)(not), true)
+}
+
+func (p *parser) parseNotExprBase(not *notExpr, logical bool) (any, bool) {
 	if p.debug {
 		defer p.out(p.in("parseNotExpr"))
 	}
 
 	pt := p.pt
-	state := p.cloneState()
-	p.pushV()
 	p.maxFailInvertExpected = !p.maxFailInvertExpected
+
+	p.scStack = append(p.scStack, true)
 	_, ok := p.parseExprWrap(not.expr)
+	p.scStack = p.scStack[:len(p.scStack)-1]
+
 	p.maxFailInvertExpected = !p.maxFailInvertExpected
-	p.popV()
-	p.restoreState(state)
-	p.restore(pt)
+	matchedOffset := p.pt.offset
+	p.restore(&pt)
 
+	if logical {
+		return nil, !ok && p.pt.offset != matchedOffset
+	}
 	return nil, !ok
 }
 
@@ -1457,20 +1280,27 @@ func (p *parser) parseOneOrMoreExpr(expr *oneOrMoreExpr) (any, bool) {
 	}
 
 	var vals []any
-
+	var matched bool
 	for {
-		p.pushV()
+		pos := p.pt.offset
 		val, ok := p.parseExprWrap(expr.expr)
-		p.popV()
 		if !ok {
-			if len(vals) == 0 {
-				// did not match once, no match
-				return nil, false
-			}
-			return vals, true
+			break
+		}
+		matched = true
+		if val != nil {
+			vals = append(vals, val)
+		}
+		if p.pt.offset == pos {
+			// the expression matched without consuming input, it would
+			// match forever
+			break
 		}
-		vals = append(vals, val)
 	}
+	if len(vals) > 0 {
+		return vals, matched
+	}
+	return nil, matched
 }
 
 func (p *parser) parseRecoveryExpr(recover *recoveryExpr) (any, bool) {
@@ -1490,10 +1320,6 @@ func (p *parser) parseRuleRefExpr(ref *ruleRefExpr) (any, bool) {
 		defer p.out(p.in("parseRuleRefExpr " + ref.name))
 	}
 
-	if ref.name == "" {
-		panic(fmt.Sprintf("%s: invalid rule: missing name", ref.pos))
-	}
-
 	rule := p.rules[ref.name]
 	if rule == nil {
 		p.addErr(fmt.Errorf("undefined rule: %s", ref.name))
@@ -1507,30 +1333,22 @@ func (p *parser) parseSeqExpr(seq *seqExpr) (any, bool) {
 		defer p.out(p.in("parseSeqExpr"))
 	}
 
-	vals := make([]any, 0, len(seq.exprs))
+	var vals []any
+	notSkipCode := p.checkSkipCode()
 
 	pt := p.pt
-	state := p.cloneState()
 	for _, expr := range seq.exprs {
 		val, ok := p.parseExprWrap(expr)
 		if !ok {
-			p.restoreState(state)
-			p.restore(pt)
+			p.restore(&pt)
 			return nil, false
 		}
-		vals = append(vals, val)
-	}
-	return vals, true
-}
-
-func (p *parser) parseStateCodeExpr(state *stateCodeExpr) (any, bool) {
-	if p.debug {
-		defer p.out(p.in("parseStateCodeExpr"))
+		if notSkipCode && val != nil {
+			vals = append(vals, val)
+		}
 	}
-
-	err := state.run(p)
-	if err != nil {
-		p.addErr(err)
+	if len(vals) > 0 {
+		return vals, true
 	}
 	return nil, true
 }
@@ -1547,7 +1365,6 @@ func (p *parser) parseThrowExpr(expr *throwExpr) (any, bool) {
 			}
 		}
 	}
-
 	return nil, false
 }
 
@@ -1557,16 +1374,25 @@ func (p *parser) parseZeroOrMoreExpr(expr *zeroOrMoreExpr) (any, bool) {
 	}
 
 	var vals []any
-
 	for {
-		p.pushV()
+		pos := p.pt.offset
 		val, ok := p.parseExprWrap(expr.expr)
-		p.popV()
 		if !ok {
-			return vals, true
+			break
+		}
+		if val != nil {
+			vals = append(vals, val)
+		}
+		if p.pt.offset == pos {
+			// the expression matched without consuming input, it would
+			// match forever
+			break
 		}
-		vals = append(vals, val)
 	}
+	if len(vals) > 0 {
+		return vals, true
+	}
+	return nil, true
 }
 
 func (p *parser) parseZeroOrOneExpr(expr *zeroOrOneExpr) (any, bool) {
@@ -1574,9 +1400,7 @@ func (p *parser) parseZeroOrOneExpr(expr *zeroOrOneExpr) (any, bool) {
 		defer p.out(p.in("parseZeroOrOneExpr"))
 	}
 
-	p.pushV()
 	val, _ := p.parseExprWrap(expr.expr)
-	p.popV()
 	// whether it matched or not, consider it a match
 	return val, true
 }
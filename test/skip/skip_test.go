@@ -0,0 +1,32 @@
+package skip
+
+import (
+	"fmt"
+	"testing"
+)
+
+// the name, the value and the text of the statements, or the error. The
+// text captured by the operator and the statement excludes the skipped
+// input.
+var cases = map[string]string{
+	"":                            "<nil>",
+	" \n# comment\n":              "<nil>",
+	"a=1;":                        "[[a 1 a=1;]]",
+	"  abc = 1 + (2 - 3) ;  ":     "[[abc 0 abc = 1 + (2 - 3) ;]]",
+	"a = 1; # comment\nb=\t4-1 ;": "[[a 1 a = 1;] [b 3 b=\t4-1 ;]]",
+	"a b = 1;":                    `1:3 (2): no match found, expected: "#", "=" or [ \t\r\n]`,
+	"a = 1 2;":                    `1:7 (6): no match found, expected: "#", ";", [ \t\r\n] or [+-]`,
+}
+
+func TestSkip(t *testing.T) {
+	for tc, exp := range cases {
+		v, err := parse("", []byte(tc))
+		got := fmt.Sprint(v)
+		if err != nil {
+			got = err.Error()
+		}
+		if got != exp {
+			t.Errorf("%q: want %q, got %q", tc, exp, got)
+		}
+	}
+}
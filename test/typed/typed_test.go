@@ -0,0 +1,39 @@
+package typed
+
+import (
+	"fmt"
+	"testing"
+)
+
+// the type and the value of the pairs, or the error
+var cases = map[string]string{
+	"a=1":            "[]typed.Pair [{a 1}]",
+	"a = -1.5, bc=2": "[]typed.Pair [{a -1.5} {bc 2}]",
+	"a=_":            "[]typed.Pair [{a 0}]",
+	"a=":             `1:3 (2): no match found, expected: "-", "_", [ \t] or [0-9]`,
+}
+
+func TestTyped(t *testing.T) {
+	for tc, exp := range cases {
+		v, err := parse("", []byte(tc))
+		got := fmt.Sprintf("%T %v", v, v)
+		if err != nil {
+			got = err.Error()
+		}
+		if got != exp {
+			t.Errorf("%q: want %v, got %v", tc, exp, got)
+		}
+	}
+}
+
+func TestTypedLabelMismatch(t *testing.T) {
+	p := newParser("", []byte("a=1"))
+	p.rstack = append(p.rstack, &rule{name: "Pair"})
+	if got := typedLabel[float64](p, "value", "1"); got != 0 {
+		t.Errorf("want zero value, got %v", got)
+	}
+	want := `1:0 (0): rule Pair: label value: want type float64, got string`
+	if err := p.errs.err(); err == nil || err.Error() != want {
+		t.Errorf("want error %q, got %v", want, err)
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	goast "go/ast"
+	"go/build"
+	"go/importer"
+	goparser "go/parser"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"strings"
+
+	"github.com/fy0/pigeon/ast"
+	builderGo "github.com/fy0/pigeon/builder"
+	"golang.org/x/tools/imports"
+)
+
+// typeCheck type-checks the parser generated from the grammar src with the
+// builder options opts, and returns the type errors as an ErrorList. The
+// errors in code blocks are reported at their position in the grammar file
+// nm. If outfile is not empty, the parser is checked as this file of its
+// package, along with the other files of the package, otherwise it is
+// checked alone.
+func typeCheck(nm string, src []byte, outfile string, opts ...builderGo.Option) error {
+	// the builder may modify the grammar, use a fresh one
+	g, err := Parse(nm, src)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	opts = append(opts, builderGo.CodePositions(nm))
+	if err := builderGo.BuildParser(&buf, g.(*ast.Grammar), opts...); err != nil {
+		return err
+	}
+	code, err := addImports(buf.Bytes())
+	if err != nil {
+		return err
+	}
+
+	name := "parser.go"
+	if outfile != "" {
+		name = filepath.Base(outfile)
+	}
+	code = restorePositions(code, name)
+
+	// the file is named without its directory, for the relative grammar
+	// file name of the position directives to be kept as is
+	fset := token.NewFileSet()
+	f, err := goparser.ParseFile(fset, name, code, goparser.ParseComments)
+	if err != nil {
+		return err
+	}
+	files := []*goast.File{f}
+	if outfile != "" {
+		pkgFiles, err := packageFiles(fset, outfile, f.Name.Name)
+		if err != nil {
+			return err
+		}
+		files = append(files, pkgFiles...)
+	}
+
+	var errs ast.ErrorList
+	conf := types.Config{
+		Importer: importer.ForCompiler(fset, "source", nil),
+		Error: func(err error) {
+			errs = append(errs, err)
+		},
+	}
+	conf.Check(f.Name.Name, fset, files, nil)
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// addImports adds the imports of the generated code src, which are added
+// by goimports, on the line of its package clause: the lines of src must
+// not change for the position directives to be valid.
+func addImports(src []byte) ([]byte, error) {
+	formatted, err := imports.Process("filename", src, &imports.Options{Comments: true, Fragment: true})
+	if err != nil {
+		return nil, err
+	}
+	fset := token.NewFileSet()
+	want, err := goparser.ParseFile(fset, "", formatted, goparser.ImportsOnly)
+	if err != nil {
+		return nil, err
+	}
+	have, err := goparser.ParseFile(fset, "", src, goparser.ImportsOnly)
+	if err != nil {
+		return nil, err
+	}
+
+	imported := make(map[string]bool)
+	for _, spec := range have.Imports {
+		imported[spec.Path.Value] = true
+	}
+	var decl strings.Builder
+	for _, spec := range want.Imports {
+		if imported[spec.Path.Value] {
+			continue
+		}
+		decl.WriteString("; import ")
+		if spec.Name != nil {
+			decl.WriteString(spec.Name.Name + " ")
+		}
+		decl.WriteString(spec.Path.Value)
+	}
+
+	off := fset.Position(have.Name.End()).Offset
+	out := make([]byte, 0, len(src)+decl.Len())
+	out = append(out, src[:off]...)
+	out = append(out, decl.String()...)
+	return append(out, src[off:]...), nil
+}
+
+// packageFiles parses the files of the package of outfile, except outfile
+// itself, if they belong to the package pkg.
+func packageFiles(fset *token.FileSet, outfile, pkg string) ([]*goast.File, error) {
+	bpkg, err := build.ImportDir(filepath.Dir(outfile), 0)
+	if err != nil {
+		if _, ok := err.(*build.NoGoError); ok {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if bpkg.Name != pkg {
+		return nil, nil
+	}
+
+	var files []*goast.File
+	for _, name := range bpkg.GoFiles {
+		if name == filepath.Base(outfile) {
+			continue
+		}
+		f, err := goparser.ParseFile(fset, filepath.Join(bpkg.Dir, name), nil, 0)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	return files, nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTypeCheck(t *testing.T) {
+	grammar := `{
+package tc
+}
+
+A = a:'a' b:B {
+    return foo(a) + string(b.([]byte))
+}
+
+B = 'b' {
+	x := 1
+	return helper()
+}
+`
+	dir := t.TempDir()
+	helper := "package tc\n\ntype ParserCustomData struct{}\n\nfunc helper() any { return nil }\n"
+	if err := os.WriteFile(filepath.Join(dir, "helper.go"), []byte(helper), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		outfile string
+		want    []string
+	}{
+		{outfile: filepath.Join(dir, "parser.go"), want: []string{
+			"grammar.peg:6:12: undefined: foo",
+			"grammar.peg:10:2: declared and not used: x",
+		}},
+		// without the package, helper is undefined
+		{want: []string{
+			"grammar.peg:6:12: undefined: foo",
+			"grammar.peg:11:9: undefined: helper",
+			"grammar.peg:10:2: declared and not used: x",
+		}},
+	}
+	for _, tc := range cases {
+		err := typeCheck("grammar.peg", []byte(grammar), tc.outfile)
+		if err == nil {
+			t.Errorf("%q: want errors, got none", tc.outfile)
+			continue
+		}
+		var got []string
+		for _, msg := range strings.Split(err.Error(), "\n") {
+			if strings.HasPrefix(msg, "grammar.peg:") {
+				got = append(got, msg)
+			}
+		}
+		if strings.Join(got, "\n") != strings.Join(tc.want, "\n") {
+			t.Errorf("%q: want\n%s\ngot\n%s", tc.outfile, strings.Join(tc.want, "\n"), err)
+		}
+	}
+
+	valid := strings.NewReplacer("foo(a)", "string(a.([]byte))", "x := 1\n", "").Replace(grammar)
+	if err := typeCheck("grammar.peg", []byte(valid), filepath.Join(dir, "parser.go")); err != nil {
+		t.Errorf("want no error, got %v", err)
+	}
+}